@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/gofrs/uuid"
+	"github.com/spf13/cobra"
+	"log"
+	"os"
+	"simpleServer/internal/config"
+	"simpleServer/internal/database"
+	"simpleServer/internal/drivetest"
+	measurementDB "simpleServer/internal/measurement/database"
+	"simpleServer/internal/measurement/model"
+	"time"
+)
+
+var importOptions struct {
+	postId   string
+	format   string
+	timezone string
+	maxGap   time.Duration
+}
+
+var importDriveTestCmd = &cobra.Command{
+	Use:   "import-drivetest [files...]",
+	Short: "Import G-NetTrack exports or NMEA/AT modem logs of a post",
+	Args:  cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := runImportDriveTest(args); err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+func init() {
+	importDriveTestCmd.Flags().StringVar(&importOptions.postId, "post", "", "id of the post the logs were recorded by")
+	importDriveTestCmd.Flags().StringVar(&importOptions.format, "format", drivetest.FormatGNetTrack, "log format: gnettrack or nmea")
+	importDriveTestCmd.Flags().StringVar(&importOptions.timezone, "tz", "Local", "time zone of timestamps written without one")
+	importDriveTestCmd.Flags().DurationVar(&importOptions.maxGap, "max-gap", 5*time.Second, "largest time distance between a scan and its GPS fix")
+	_ = importDriveTestCmd.MarkFlagRequired("post")
+}
+
+func runImportDriveTest(files []string) error {
+	postId, err := uuid.FromString(importOptions.postId)
+	if err != nil {
+		return fmt.Errorf("invalid post id: %w", err)
+	}
+	location, err := time.LoadLocation(importOptions.timezone)
+	if err != nil {
+		return err
+	}
+	conf, err := config.Load(configFile)
+	if err != nil {
+		return err
+	}
+	dbh, err := database.NewDatabase(conf)
+	if err != nil {
+		return err
+	}
+	defer dbh.Close()
+	db := measurementDB.NewMeasurementDB(dbh)
+
+	batchSize := conf.IngestConfig.MaxBatchSize
+	if batchSize <= 0 {
+		batchSize = 5000
+	}
+	ctx := context.Background()
+	for _, file := range files {
+		f, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		parsed, err := drivetest.Parse(f, importOptions.format, drivetest.Options{Location: location, MaxGap: importOptions.maxGap})
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("parse %s: %w", file, err)
+		}
+
+		var total model.BatchResult
+		// fixes go first, so every scan batch references already ingested fixes.
+		for _, batch := range splitBatch(postId, parsed, batchSize) {
+			result, err := db.Ingest(ctx, batch)
+			if err != nil {
+				return fmt.Errorf("ingest %s: %w", file, err)
+			}
+			total.Gps = append(total.Gps, result.Gps...)
+			total.Scans = append(total.Scans, result.Scans...)
+		}
+		log.Printf("%s: %d fixes, %d scans, accepted %d, duplicates %d, rejected %d, unparsed lines %d, scans without fix %d",
+			file, len(parsed.Gps), len(parsed.Scans),
+			total.Count(model.StatusAccepted), total.Count(model.StatusDuplicate), total.Count(model.StatusRejected),
+			parsed.Skipped, parsed.Unaligned)
+		for _, res := range append(total.Gps, total.Scans...) {
+			if res.Status == model.StatusRejected {
+				log.Printf("%s: rejected %s: %s", file, res.Key, res.Reason)
+			}
+		}
+	}
+	return nil
+}
+
+func splitBatch(postId uuid.UUID, parsed *drivetest.Log, size int) []*model.Batch {
+	var batches []*model.Batch
+	for i := 0; i < len(parsed.Gps); i += size {
+		end := i + size
+		if end > len(parsed.Gps) {
+			end = len(parsed.Gps)
+		}
+		batches = append(batches, &model.Batch{PostId: postId, Gps: parsed.Gps[i:end]})
+	}
+	for i := 0; i < len(parsed.Scans); i += size {
+		end := i + size
+		if end > len(parsed.Scans) {
+			end = len(parsed.Scans)
+		}
+		batches = append(batches, &model.Batch{PostId: postId, Scans: parsed.Scans[i:end]})
+	}
+	return batches
+}
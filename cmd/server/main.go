@@ -17,6 +17,8 @@ var rootCmd = &cobra.Command{
 
 func init() {
 	rootCmd.AddCommand(serverCmd)
+	rootCmd.AddCommand(importDriveTestCmd)
+	rootCmd.AddCommand(retentionCmd)
 	rootCmd.PersistentFlags().StringVarP(&configFile, "conf", "", "", "config file path")
 }
 
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"github.com/spf13/cobra"
+	"log"
+	"simpleServer/internal/config"
+	"simpleServer/internal/database"
+	"simpleServer/internal/retention"
+	retentionDB "simpleServer/internal/retention/database"
+)
+
+var retentionCmd = &cobra.Command{
+	Use:   "retention",
+	Short: "Roll up finished days and purge raw samples past their age once",
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := runRetention(); err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+func runRetention() error {
+	conf, err := config.Load(configFile)
+	if err != nil {
+		return err
+	}
+	dbh, err := database.NewDatabase(conf)
+	if err != nil {
+		return err
+	}
+	defer dbh.Close()
+
+	// the periodic run is left to the server, disabled the service needs no lifecycle.
+	once := *conf
+	once.RetentionConfig.Enabled = false
+	service := retention.NewService(nil, &once, retentionDB.NewRetentionDB(dbh))
+	result, err := service.Run(context.Background())
+	if err != nil {
+		return err
+	}
+	log.Printf("rolled up %d days into %d rows, purged %d samples of %d days, archived %d samples into %d files",
+		result.RolledDays, result.RollupRows, result.PurgedSamples, result.PurgedDays, result.ArchivedRecords, result.ArchivedFiles)
+	return nil
+}
@@ -12,16 +12,34 @@ import (
 	"go.uber.org/zap/zapcore"
 	"log"
 	"net/http"
+	"simpleServer/internal/auth"
+	authDB "simpleServer/internal/auth/database"
 	"simpleServer/internal/baseStation"
 	baseStationDB "simpleServer/internal/baseStation/database"
 	"simpleServer/internal/cache"
+	"simpleServer/internal/campaign"
+	campaignDB "simpleServer/internal/campaign/database"
 	"simpleServer/internal/config"
 	"simpleServer/internal/database"
+	"simpleServer/internal/detection"
+	detectionDB "simpleServer/internal/detection/database"
+	"simpleServer/internal/estimation"
+	estimationDB "simpleServer/internal/estimation/database"
+	"simpleServer/internal/geofence"
+	geofenceDB "simpleServer/internal/geofence/database"
 	"simpleServer/internal/heatmap"
 	heatmapDB "simpleServer/internal/heatmap/database"
+	"simpleServer/internal/live"
+	"simpleServer/internal/measurement"
+	measurementDB "simpleServer/internal/measurement/database"
 	"simpleServer/internal/post"
 	postDB "simpleServer/internal/post/database"
+	"simpleServer/internal/ratelimit"
+	"simpleServer/internal/retention"
+	retentionDB "simpleServer/internal/retention/database"
 	"simpleServer/pkg/logging"
+	"simpleServer/pkg/metrics"
+	"simpleServer/pkg/trace"
 	"time"
 )
 
@@ -42,6 +60,22 @@ func runApplication() {
 		Level:       zapcore.Level(conf.LoggingConfig.Level),
 		Development: conf.LoggingConfig.Development,
 	})
+	metrics.SetConfig(&metrics.Config{Namespace: conf.MetricsConfig.Namespace})
+	shutdownTracing, err := trace.Setup(context.Background(), &trace.Config{
+		Exporter:    conf.TracingConfig.Exporter,
+		Endpoint:    conf.TracingConfig.Endpoint,
+		Insecure:    conf.TracingConfig.Insecure,
+		SampleRatio: conf.TracingConfig.SampleRatio,
+		ServiceName: conf.TracingConfig.ServiceName,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer func() {
+		if err := shutdownTracing(context.Background()); err != nil {
+			logging.DefaultLogger().Errorw("failed to flush traces", "err", err)
+		}
+	}()
 	defer logging.DefaultLogger().Sync()
 	app := fx.New(
 		fx.Supply(conf),
@@ -57,15 +91,46 @@ func runApplication() {
 			baseStationDB.NewBaseStationDB,
 			postDB.NewPostDB,
 			heatmapDB.NewHeatmapDB,
+			measurementDB.NewMeasurementDB,
+			estimationDB.NewEstimationDB,
+			estimation.NewJob,
+			detectionDB.NewDetectionDB,
+			detection.NewDetector,
+			retentionDB.NewRetentionDB,
+			retention.NewService,
+			live.NewHub,
+			geofenceDB.NewGeofenceDB,
+			geofence.NewMonitor,
+			campaignDB.NewCampaignDB,
+			authDB.NewAuthDB,
+			auth.NewAuthenticator,
+			ratelimit.NewLimiter,
 			post.NewHandler,
 			heatmap.NewHandler,
 			baseStation.NewHandler,
+			measurement.NewHandler,
+			estimation.NewHandler,
+			detection.NewHandler,
+			live.NewHandler,
+			geofence.NewHandler,
+			campaign.NewHandler,
+			auth.NewHandler,
 			newServer),
 		fx.Invoke(
+			auth.Bootstrap,
+			auth.RouteV1,
 			baseStation.RouteV1,
 			post.RouteV1,
+			post.RouteV2,
 			heatmap.RouteV1,
+			measurement.RouteV1,
+			estimation.RouteV1,
+			detection.RouteV1,
+			live.RouteV1,
+			geofence.RouteV1,
+			campaign.RouteV1,
 			func(r *gin.Engine) {},
+			func(s *retention.Service) {},
 		),
 	)
 	app.Run()
@@ -74,6 +139,11 @@ func runApplication() {
 func newServer(lc fx.Lifecycle, cfg *config.Config) *gin.Engine {
 	gin.SetMode(gin.DebugMode)
 	r := gin.New()
+	r.Use(trace.Middleware())
+	if cfg.MetricsConfig.Enabled {
+		r.Use(metrics.Middleware())
+		r.GET(cfg.MetricsConfig.Path, gin.WrapH(metrics.Default().Handler()))
+	}
 
 	srv := &http.Server{
 		Addr:         fmt.Sprintf("localhost:%d", cfg.ServerConfig.Port),
@@ -0,0 +1,32 @@
+package dbutils
+
+import (
+	"context"
+	"fmt"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/stdlib"
+	"github.com/jmoiron/sqlx"
+)
+
+// CopyFrom streams rows into table with the postgres COPY protocol.
+// It runs on the raw pgx connection behind conn, so it joins a transaction opened on the same conn.
+func CopyFrom(ctx context.Context, conn *sqlx.Conn, table string, columns []string, rows [][]interface{}) (n int64, err error) {
+	if len(rows) == 0 {
+		return 0, nil
+	}
+	ctx, done := instrument(ctx, "copy", fmt.Sprintf(`copy "%s" %v from stdin`, table, columns))
+	defer func() { done(err) }()
+	err = conn.Raw(func(driverConn interface{}) error {
+		c, ok := driverConn.(*stdlib.Conn)
+		if !ok {
+			return fmt.Errorf("copy into %s: unsupported driver connection %T", table, driverConn)
+		}
+		n, err = c.Conn().CopyFrom(ctx, pgx.Identifier{table}, columns, pgx.CopyFromRows(rows))
+		return err
+	})
+	if err != nil {
+		return n, fmt.Errorf(`copy %d rows into "%s" %v: %w`, len(rows), table, columns, err)
+	}
+
+	return n, nil
+}
@@ -0,0 +1,32 @@
+package dbutils
+
+import (
+	"context"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/multierr"
+)
+
+// WithAdvisoryLock runs f only if the session advisory lock key is free, so a job runs on one server instance at a time.
+// It reports whether f was run.
+func WithAdvisoryLock(ctx context.Context, db *sqlx.DB, key int64, f func(ctx context.Context) error) (acquired bool, err error) {
+	conn, err := db.Connx(ctx)
+	if err != nil {
+		return false, fmt.Errorf("acquire connection: %w", err)
+	}
+	defer conn.Close()
+
+	if err := Get(ctx, conn, &acquired, `select pg_try_advisory_lock($1)`, key); err != nil {
+		return false, err
+	}
+	if !acquired {
+		return false, nil
+	}
+	defer func() {
+		// the lock is released with a fresh context, ctx may be done by now.
+		_, unlockErr := Exec(context.Background(), conn, `select pg_advisory_unlock($1)`, key)
+		err = multierr.Combine(err, unlockErr)
+	}()
+
+	return true, f(ctx)
+}
@@ -3,13 +3,52 @@ package dbutils
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"github.com/jmoiron/sqlx"
+	"go.opentelemetry.io/otel/attribute"
 	"go.uber.org/multierr"
+	"simpleServer/pkg/metrics"
+	"simpleServer/pkg/trace"
+	"time"
 )
 
+// instrument times a query for the metrics and runs it in a span carrying the statement, done ends both.
+// Spans are exported, so a failed query records the bare driver error, never the arguments: they carry
+// password, token and key hashes.
+func instrument(ctx context.Context, operation, query string) (context.Context, func(err error)) {
+	start := time.Now()
+	ctx, span := trace.Start(ctx, "db."+operation,
+		attribute.String("db.system", "postgresql"),
+		attribute.String("db.operation", operation),
+		attribute.String("db.statement", query))
+	return ctx, func(err error) {
+		metrics.ObserveQuery(operation, start, err)
+		var qErr *queryError
+		if errors.As(err, &qErr) {
+			err = qErr.err
+		}
+		trace.End(span, err)
+	}
+}
+
+// queryError is a failed query with its statement and arguments, for the logs of the caller.
+type queryError struct {
+	query string
+	args  []interface{}
+	err   error
+}
+
+func (e *queryError) Error() string {
+	return fmt.Sprintf(`run query "%s" with args %+v: %v`, e.query, e.args, e.err)
+}
+
+func (e *queryError) Unwrap() error {
+	return e.err
+}
+
 func sqlErr(err error, query string, args ...interface{}) error {
-	return fmt.Errorf(`run query "%s" with args %+v: %w`, query, args, err)
+	return &queryError{query: query, args: args, err: err}
 }
 
 func namedQuery(query string, arg interface{}) (nq string, args []interface{}, err error) {
@@ -20,8 +59,10 @@ func namedQuery(query string, arg interface{}) (nq string, args []interface{}, e
 	return nq, args, nil
 }
 
-func Exec(ctx context.Context, db sqlx.ExecerContext, query string, args ...interface{}) (sql.Result, error) {
-	res, err := db.ExecContext(ctx, query, args...)
+func Exec(ctx context.Context, db sqlx.ExecerContext, query string, args ...interface{}) (res sql.Result, err error) {
+	ctx, done := instrument(ctx, "exec", query)
+	defer func() { done(err) }()
+	res, err = db.ExecContext(ctx, query, args...)
 	if err != nil {
 		return res, sqlErr(err, query, args...)
 	}
@@ -38,7 +79,9 @@ func NamedExec(ctx context.Context, db sqlx.ExtContext, query string, arg interf
 	return Exec(ctx, db, db.Rebind(nq), args...)
 }
 
-func Select(ctx context.Context, db sqlx.ExtContext, dest interface{}, query string, args ...interface{}) error {
+func Select(ctx context.Context, db sqlx.ExtContext, dest interface{}, query string, args ...interface{}) (err error) {
+	ctx, done := instrument(ctx, "select", query)
+	defer func() { done(err) }()
 	if err := sqlx.SelectContext(ctx, db, dest, query, args...); err != nil {
 		return sqlErr(err, query, args...)
 	}
@@ -55,7 +98,9 @@ func NamedSelect(ctx context.Context, db sqlx.ExtContext, dest interface{}, quer
 	return Select(ctx, db, dest, db.Rebind(nq), args...)
 }
 
-func Get(ctx context.Context, db sqlx.QueryerContext, dest interface{}, query string, args ...interface{}) error {
+func Get(ctx context.Context, db sqlx.QueryerContext, dest interface{}, query string, args ...interface{}) (err error) {
+	ctx, done := instrument(ctx, "get", query)
+	defer func() { done(err) }()
 	if err := sqlx.GetContext(ctx, db, dest, query, args...); err != nil {
 		return sqlErr(err, query, args...)
 	}
@@ -69,10 +114,12 @@ func NamedGet(ctx context.Context, db sqlx.ExtContext, dest interface{}, query s
 		return err
 	}
 
-	return Get(ctx, db, dest, db.Rebind(nq), args)
+	return Get(ctx, db, dest, db.Rebind(nq), args...)
 }
 
 func SelectMaps(ctx context.Context, db sqlx.QueryerContext, query string, args ...interface{}) (ret []map[string]interface{}, err error) {
+	ctx, done := instrument(ctx, "select", query)
+	defer func() { done(err) }()
 	rows, err := db.QueryxContext(ctx, query, args...)
 	if err != nil {
 		return nil, sqlErr(err, query, args...)
@@ -116,6 +163,8 @@ func NamedSelectMaps(ctx context.Context, db sqlx.ExtContext, query string, arg
 }
 
 func GetMap(ctx context.Context, db sqlx.QueryerContext, query string, args ...interface{}) (ret map[string]interface{}, err error) {
+	ctx, done := instrument(ctx, "get", query)
+	defer func() { done(err) }()
 	row := db.QueryRowxContext(ctx, query, args...)
 	if row.Err() != nil {
 		return nil, sqlErr(row.Err(), query, args)
@@ -0,0 +1,41 @@
+package dbutils
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"testing"
+)
+
+type failingExecer struct{ err error }
+
+func (e failingExecer) ExecContext(context.Context, string, ...interface{}) (sql.Result, error) {
+	return nil, e.err
+}
+
+func TestFailedQuerySpanLeavesArgsOut(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(sdktrace.NewTracerProvider()) })
+
+	driverErr := errors.New("connection reset")
+	_, err := Exec(context.Background(), failingExecer{driverErr}, `update "User" set password = $1`, "hash-of-password")
+	require.ErrorIs(t, err, driverErr)
+	assert.Contains(t, err.Error(), "hash-of-password", "the caller still logs the arguments")
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 1)
+	assert.Equal(t, codes.Error, spans[0].Status().Code)
+	assert.Equal(t, "connection reset", spans[0].Status().Description)
+	for _, event := range spans[0].Events() {
+		for _, attr := range event.Attributes {
+			assert.NotContains(t, attr.Value.Emit(), "hash-of-password")
+		}
+	}
+}
@@ -0,0 +1,197 @@
+package auth
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"github.com/gofrs/uuid"
+	"net/http"
+	"simpleServer/internal/auth/database"
+	"simpleServer/internal/auth/model"
+	"simpleServer/internal/middleware/handler"
+	"simpleServer/pkg/logging"
+	"simpleServer/pkg/validate"
+	"time"
+)
+
+// defaultRotationGrace is how long a rotated key keeps working unless the request says otherwise.
+const defaultRotationGrace = 24 * time.Hour
+
+func apiKeyErrorResponse(err error) *handler.Response {
+	switch {
+	case errors.Is(err, database.ErrApiKeyNotFound):
+		return handler.NewErrorResponse(http.StatusNotFound, handler.NotFoundEntity, "api key not found", nil)
+	case errors.Is(err, database.ErrApiKeyRevoked):
+		return handler.NewErrorResponse(http.StatusConflict, handler.DuplicateEntry, err.Error(), nil)
+	case errors.Is(err, database.ErrUnknownPost):
+		return handler.NewErrorResponse(http.StatusBadRequest, handler.InvalidBodyValue, err.Error(),
+			validate.NewValidationErrorDetails("postId", "existing post id", ""))
+	}
+	return handler.NewInternalErrorResponse(err)
+}
+
+func bindApiKeyId(c *gin.Context) (uuid.UUID, *handler.Response) {
+	id, err := uuid.FromString(c.Param("id"))
+	if err != nil {
+		return uuid.Nil, handler.NewErrorResponse(http.StatusBadRequest, handler.InvalidUriValue, "invalid id in uri",
+			validate.NewValidationErrorDetails("id", "required uuid format", c.Param("id")))
+	}
+	return id, nil
+}
+
+// issueApiKey generates a key into input, created by the caller.
+func (h *Handler) issueApiKey(c *gin.Context, input *model.ApiKeyInput) (string, error) {
+	key, prefix, hash, err := NewApiKey()
+	if err != nil {
+		return "", err
+	}
+	input.Prefix, input.Hash = prefix, hash
+	if claims := FromContext(c); claims != nil && claims.ApiKeyId == nil {
+		input.CreatedBy = &claims.UserId
+	}
+	return key, nil
+}
+
+func (h *Handler) GetApiKeys(c *gin.Context) {
+	handler.HandleRequest(c, func(c *gin.Context) *handler.Response {
+		var postId *uuid.UUID
+		if value := c.Query("postId"); value != "" {
+			id, err := uuid.FromString(value)
+			if err != nil {
+				return handler.NewErrorResponse(http.StatusBadRequest, handler.InvalidQueryValue, "invalid postId",
+					validate.NewValidationErrorDetails("postId", "uuid format", value))
+			}
+			postId = &id
+		}
+		keys, err := h.authDB.GetApiKeys(c.Request.Context(), postId)
+		if err != nil {
+			logging.FromContext(c).Errorw("auth.GetApiKeys failed", "err", err)
+			return handler.NewInternalErrorResponse(err)
+		}
+		return handler.NewSuccessResponse(http.StatusOK, NewApiKeysResponse(keys, time.Now()))
+	})
+}
+
+func (h *Handler) GetApiKey(c *gin.Context) {
+	handler.HandleRequest(c, func(c *gin.Context) *handler.Response {
+		id, res := bindApiKeyId(c)
+		if res != nil {
+			return res
+		}
+		key, err := h.authDB.GetApiKey(c.Request.Context(), id)
+		if err != nil {
+			return apiKeyErrorResponse(err)
+		}
+		return handler.NewSuccessResponse(http.StatusOK, NewApiKeyResponse(key, time.Now()))
+	})
+}
+
+// CreateApiKey issues a key, the key itself is in the response and can't be read again.
+func (h *Handler) CreateApiKey(c *gin.Context) {
+	handler.HandleRequest(c, func(c *gin.Context) *handler.Response {
+		logger := logging.FromContext(c)
+		type RequestBody struct {
+			Name        string     `json:"name" binding:"required"`
+			PostId      *uuid.UUID `json:"postId"`
+			Permissions []string   `json:"permissions" binding:"required,min=1"`
+			ExpiresAt   *time.Time `json:"expiresAt"`
+		}
+		var body RequestBody
+		if err := c.ShouldBindJSON(&body); err != nil {
+			var details []*validate.ValidationErrDetail
+			if vErrs, ok := err.(validator.ValidationErrors); ok {
+				details = validate.ValidationErrorDetails(&body, "json", vErrs)
+			}
+			return handler.NewErrorResponse(http.StatusBadRequest, handler.InvalidBodyValue, "invalid api key", details)
+		}
+		for _, permission := range body.Permissions {
+			if !model.ValidKeyPermission(permission) {
+				return handler.NewErrorResponse(http.StatusBadRequest, handler.InvalidBodyValue, "invalid permission",
+					validate.NewValidationErrorDetails("permissions", "each one of read, export, ingest", permission))
+			}
+		}
+		if body.ExpiresAt != nil && !body.ExpiresAt.After(time.Now()) {
+			return handler.NewErrorResponse(http.StatusBadRequest, handler.InvalidBodyValue, "expiry in the past",
+				validate.NewValidationErrorDetails("expiresAt", "in the future", body.ExpiresAt.String()))
+		}
+		input := &model.ApiKeyInput{
+			Name:        body.Name,
+			PostId:      body.PostId,
+			Permissions: body.Permissions,
+			ExpiresAt:   body.ExpiresAt,
+		}
+		secret, err := h.issueApiKey(c, input)
+		if err != nil {
+			logger.Errorw("auth.CreateApiKey failed", "name", body.Name, "err", err)
+			return handler.NewInternalErrorResponse(err)
+		}
+		key, err := h.authDB.CreateApiKey(c.Request.Context(), input)
+		if err != nil {
+			logger.Errorw("auth.CreateApiKey failed", "name", body.Name, "err", err)
+			return apiKeyErrorResponse(err)
+		}
+		logger.Infow("auth.CreateApiKey", "apiKeyId", key.Id, "postId", key.PostId, "permissions", key.Permissions)
+		return handler.NewSuccessResponse(http.StatusCreated, &IssuedApiKeyResponse{NewApiKeyResponse(key, time.Now()), secret})
+	})
+}
+
+// RotateApiKey issues a key in place of another one, which keeps working for the grace period so the post
+// can switch over.
+func (h *Handler) RotateApiKey(c *gin.Context) {
+	handler.HandleRequest(c, func(c *gin.Context) *handler.Response {
+		logger := logging.FromContext(c)
+		id, res := bindApiKeyId(c)
+		if res != nil {
+			return res
+		}
+		type RequestBody struct {
+			// Grace is in seconds, 0 ends the old key right away.
+			Grace     *int       `json:"grace" binding:"omitempty,min=0"`
+			ExpiresAt *time.Time `json:"expiresAt"`
+		}
+		var body RequestBody
+		if c.Request.ContentLength != 0 {
+			if err := c.ShouldBindJSON(&body); err != nil {
+				var details []*validate.ValidationErrDetail
+				if vErrs, ok := err.(validator.ValidationErrors); ok {
+					details = validate.ValidationErrorDetails(&body, "json", vErrs)
+				}
+				return handler.NewErrorResponse(http.StatusBadRequest, handler.InvalidBodyValue, "invalid rotation", details)
+			}
+		}
+		grace := defaultRotationGrace
+		if body.Grace != nil {
+			grace = time.Duration(*body.Grace) * time.Second
+		}
+		input := &model.ApiKeyInput{ExpiresAt: body.ExpiresAt}
+		secret, err := h.issueApiKey(c, input)
+		if err != nil {
+			logger.Errorw("auth.RotateApiKey failed", "id", id, "err", err)
+			return handler.NewInternalErrorResponse(err)
+		}
+		key, err := h.authDB.RotateApiKey(c.Request.Context(), id, input, grace)
+		if err != nil {
+			logger.Errorw("auth.RotateApiKey failed", "id", id, "err", err)
+			return apiKeyErrorResponse(err)
+		}
+		logger.Infow("auth.RotateApiKey", "apiKeyId", id, "replacedBy", key.Id, "grace", grace)
+		return handler.NewSuccessResponse(http.StatusCreated, &IssuedApiKeyResponse{NewApiKeyResponse(key, time.Now()), secret})
+	})
+}
+
+func (h *Handler) RevokeApiKey(c *gin.Context) {
+	handler.HandleRequest(c, func(c *gin.Context) *handler.Response {
+		logger := logging.FromContext(c)
+		id, res := bindApiKeyId(c)
+		if res != nil {
+			return res
+		}
+		key, err := h.authDB.RevokeApiKey(c.Request.Context(), id)
+		if err != nil {
+			logger.Errorw("auth.RevokeApiKey failed", "id", id, "err", err)
+			return apiKeyErrorResponse(err)
+		}
+		logger.Infow("auth.RevokeApiKey", "apiKeyId", id)
+		return handler.NewSuccessResponse(http.StatusOK, NewApiKeyResponse(key, time.Now()))
+	})
+}
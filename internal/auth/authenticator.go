@@ -0,0 +1,300 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/gofrs/uuid"
+	"github.com/golang-jwt/jwt/v5"
+	"net/http"
+	"simpleServer/internal/auth/database"
+	"simpleServer/internal/auth/model"
+	"simpleServer/internal/config"
+	"simpleServer/internal/middleware/handler"
+	"simpleServer/pkg/logging"
+	"simpleServer/pkg/trace"
+	"strings"
+	"time"
+)
+
+// accessTokenQuery carries the access token of clients that can't set headers, browsers opening an
+// EventSource or a WebSocket.
+const accessTokenQuery = "access_token"
+
+const (
+	// ApiKeyHeader carries an API key, which may also be sent as a bearer token.
+	ApiKeyHeader = "X-API-Key"
+	// apiKeyMark starts every API key, telling it apart from access tokens.
+	apiKeyMark = "ssk_"
+	// apiKeyPrefixLength is the length of the start of a key kept in clear to tell keys apart.
+	apiKeyPrefixLength = len(apiKeyMark) + 8
+)
+
+// FromContext returns the caller of the request, nil on routes without authentication.
+func FromContext(ctx context.Context) *model.Claims {
+	if gCtx, ok := ctx.(*gin.Context); ok && gCtx != nil {
+		ctx = gCtx.Request.Context()
+	}
+	return model.FromContext(ctx)
+}
+
+func WithClaims(ctx context.Context, claims *model.Claims) context.Context {
+	return model.WithClaims(ctx, claims)
+}
+
+// accessClaims are the claims of an access token, the user id is the subject.
+type accessClaims struct {
+	jwt.RegisteredClaims
+	Username string     `json:"name"`
+	Role     string     `json:"role"`
+	PostId   *uuid.UUID `json:"post,omitempty"`
+}
+
+// Authenticator issues and checks HS256 access tokens and API keys and guards routes by permission.
+type Authenticator struct {
+	authDB      database.AuthDB
+	secret      []byte
+	issuer      string
+	accessTime  time.Duration
+	sessionTime time.Duration
+	// ingestTokens are static tokens of field equipment predating user accounts.
+	ingestTokens []string
+	now          func() time.Time
+}
+
+// minSecretLength is the length of the shortest signing secret accepted, the length of a HS256 key.
+const minSecretLength = 32
+
+// defaultSecret was the secret shipped with the configuration, tokens signed with it can be forged by anyone.
+const defaultSecret = "secret-key"
+
+func NewAuthenticator(cfg *config.Config, db database.AuthDB) (*Authenticator, error) {
+	secret := cfg.JWTConfig.Secret
+	if secret == defaultSecret || len(secret) < minSecretLength {
+		return nil, fmt.Errorf("jwt.secret must be a private secret of at least %d bytes", minSecretLength)
+	}
+	return &Authenticator{
+		authDB:       db,
+		secret:       []byte(cfg.JWTConfig.Secret),
+		issuer:       cfg.JWTConfig.Issuer,
+		accessTime:   cfg.JWTConfig.AccessTime,
+		sessionTime:  cfg.JWTConfig.SessionTime,
+		ingestTokens: cfg.IngestConfig.Tokens,
+		now:          time.Now,
+	}, nil
+}
+
+// Issue signs an access token for user.
+func (a *Authenticator) Issue(user *model.User) (string, time.Time, error) {
+	now := a.now()
+	expiresAt := now.Add(a.accessTime)
+	claims := &accessClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    a.issuer,
+			Subject:   user.Id.String(),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
+		Username: user.Username,
+		Role:     user.Role,
+		PostId:   user.PostId,
+	}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(a.secret)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return token, expiresAt, nil
+}
+
+// Parse checks the signature, issuer and expiry of an access token.
+func (a *Authenticator) Parse(token string) (*model.Claims, error) {
+	var claims accessClaims
+	_, err := jwt.ParseWithClaims(token, &claims, func(*jwt.Token) (interface{}, error) { return a.secret, nil },
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+		jwt.WithIssuer(a.issuer),
+		jwt.WithExpirationRequired(),
+		jwt.WithTimeFunc(a.now))
+	if err != nil {
+		return nil, err
+	}
+	userId, err := uuid.FromString(claims.Subject)
+	if err != nil {
+		return nil, errors.New("token subject is not a user id")
+	}
+	if !model.ValidRole(claims.Role) {
+		return nil, errors.New("token carries an unknown role")
+	}
+	return &model.Claims{UserId: userId, Username: claims.Username, Role: claims.Role, PostId: claims.PostId}, nil
+}
+
+// NewRefreshToken returns a random refresh token with the hash it is stored by and its expiry.
+func (a *Authenticator) NewRefreshToken() (token string, hash []byte, expiresAt time.Time, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", nil, time.Time{}, err
+	}
+	token = base64.RawURLEncoding.EncodeToString(b)
+	return token, HashRefreshToken(token), a.now().Add(a.sessionTime), nil
+}
+
+func HashRefreshToken(token string) []byte {
+	sum := sha256.Sum256([]byte(token))
+	return sum[:]
+}
+
+// NewApiKey returns a random API key with the prefix and the hash it is stored by.
+func NewApiKey() (key, prefix string, hash []byte, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", nil, err
+	}
+	key = apiKeyMark + base64.RawURLEncoding.EncodeToString(b)
+	return key, key[:apiKeyPrefixLength], HashApiKey(key), nil
+}
+
+func HashApiKey(key string) []byte {
+	sum := sha256.Sum256([]byte(key))
+	return sum[:]
+}
+
+func isApiKey(token string) bool {
+	return strings.HasPrefix(token, apiKeyMark)
+}
+
+func bearerToken(c *gin.Context) string {
+	if key := c.Request.Header.Get(ApiKeyHeader); key != "" {
+		return strings.TrimSpace(key)
+	}
+	header := c.Request.Header.Get("Authorization")
+	if token, ok := strings.CutPrefix(header, "Bearer "); ok {
+		return strings.TrimSpace(token)
+	}
+	return ""
+}
+
+func unauthorized(c *gin.Context, message string) {
+	c.AbortWithStatusJSON(http.StatusUnauthorized, &handler.ErrorResponse{Code: handler.Unauthorized, Message: message})
+}
+
+// authenticateKey lets requests with a usable API key through and records the use on the key.
+func (a *Authenticator) authenticateKey(c *gin.Context, token string) {
+	ctx := c.Request.Context()
+	logger := logging.FromContext(ctx)
+	key, err := a.authDB.GetApiKeyByHash(ctx, HashApiKey(token))
+	if errors.Is(err, database.ErrApiKeyNotFound) || (err == nil && !key.Usable(a.now())) {
+		logger.Infow("api key rejected", "prefix", token[:min(len(token), apiKeyPrefixLength)])
+		unauthorized(c, "invalid, expired or revoked api key")
+		return
+	}
+	if err != nil {
+		logger.Errorw("api key lookup failed", "err", err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, &handler.ErrorResponse{Code: handler.InternalServerError, Message: "api key lookup failed"})
+		return
+	}
+	claims := &model.Claims{Username: key.Name, PostId: key.PostId, ApiKeyId: &key.Id, Permissions: key.Permissions}
+	logger = logger.With("apiKeyId", key.Id)
+	logger.Infow("api key used", "name", key.Name, "postId", key.PostId, "method", c.Request.Method, "path", c.FullPath())
+	// a failed update of the last use must not fail the request.
+	if err := a.authDB.TouchApiKey(ctx, key.Id, trace.RequestIDFromContext(ctx)); err != nil {
+		logger.Errorw("api key touch failed", "err", err)
+	}
+	c.Request = c.Request.WithContext(logging.WithLogger(WithClaims(ctx, claims), logger))
+	c.Next()
+}
+
+func (a *Authenticator) authenticate(c *gin.Context, token string) {
+	if token == "" {
+		unauthorized(c, "missing access token")
+		return
+	}
+	if isApiKey(token) {
+		a.authenticateKey(c, token)
+		return
+	}
+	claims, err := a.Parse(token)
+	if err != nil {
+		logging.FromContext(c).Debugw("access token rejected", "err", err)
+		unauthorized(c, "invalid or expired access token")
+		return
+	}
+	ctx := WithClaims(c.Request.Context(), claims)
+	logger := logging.FromContext(ctx).With("userId", claims.UserId)
+	c.Request = c.Request.WithContext(logging.WithLogger(ctx, logger))
+	c.Next()
+}
+
+// Authenticate accepts requests carrying a valid access token as "Authorization: Bearer <token>" or a
+// usable API key, as a bearer token or in the X-API-Key header.
+func (a *Authenticator) Authenticate() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		a.authenticate(c, bearerToken(c))
+	}
+}
+
+// AuthenticateStream also takes the access token from the access_token query parameter, for streams
+// opened by browsers.
+func (a *Authenticator) AuthenticateStream() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := bearerToken(c)
+		if token == "" {
+			token = c.Query(accessTokenQuery)
+		}
+		a.authenticate(c, token)
+	}
+}
+
+// AuthenticateIngest accepts access tokens as well as the static ingest tokens, which upload as a
+// field post not bound to any post.
+func (a *Authenticator) AuthenticateIngest() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := bearerToken(c)
+		for _, t := range a.ingestTokens {
+			if token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(t)) == 1 {
+				c.Request = c.Request.WithContext(WithClaims(c.Request.Context(), &model.Claims{Role: model.RoleFieldPost}))
+				c.Next()
+				return
+			}
+		}
+		a.authenticate(c, token)
+	}
+}
+
+// Require lets only callers holding permission through. It must follow one of the authenticating
+// middlewares.
+func (a *Authenticator) Require(permission string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims := FromContext(c)
+		if claims == nil {
+			unauthorized(c, "missing access token")
+			return
+		}
+		if !claims.Can(permission) {
+			c.AbortWithStatusJSON(http.StatusForbidden, &handler.ErrorResponse{Code: handler.Forbidden, Message: "missing permission " + permission})
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequirePost lets only callers that may access the post given by the param through, callers bound to
+// another post are refused. It must follow one of the authenticating middlewares.
+func (a *Authenticator) RequirePost(param string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims := FromContext(c)
+		if claims == nil {
+			unauthorized(c, "missing access token")
+			return
+		}
+		// malformed ids are left to the handlers, which answer them with a validation error.
+		if postId, err := uuid.FromString(c.Param(param)); err == nil && !claims.MayAccess(postId) {
+			c.AbortWithStatusJSON(http.StatusForbidden, &handler.ErrorResponse{Code: handler.Forbidden, Message: "caller may not access this post"})
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,162 @@
+package auth
+
+import (
+	"context"
+	"github.com/gin-gonic/gin"
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"simpleServer/internal/auth/database"
+	"simpleServer/internal/auth/model"
+	"simpleServer/internal/config"
+	"simpleServer/pkg/trace"
+	"testing"
+	"time"
+)
+
+// keyDB serves the keys by hash, the methods not needed by the middleware are left nil.
+type keyDB struct {
+	database.AuthDB
+	keys    map[string]*model.ApiKey
+	touched map[uuid.UUID]string
+}
+
+func (d *keyDB) GetApiKeyByHash(_ context.Context, hash []byte) (*model.ApiKey, error) {
+	if key, ok := d.keys[string(hash)]; ok {
+		return key, nil
+	}
+	return nil, database.ErrApiKeyNotFound
+}
+
+func (d *keyDB) TouchApiKey(_ context.Context, id uuid.UUID, requestId string) error {
+	d.touched[id] = requestId
+	return nil
+}
+
+const (
+	testSecret  = "0123456789abcdef0123456789abcdef"
+	otherSecret = "fedcba9876543210fedcba9876543210"
+)
+
+func testAuthenticator(secret string) *Authenticator {
+	cfg := &config.Config{}
+	cfg.JWTConfig.Secret = secret
+	cfg.JWTConfig.Issuer = "simpleServer"
+	cfg.JWTConfig.AccessTime = 15 * time.Minute
+	cfg.JWTConfig.SessionTime = 24 * time.Hour
+	a, err := NewAuthenticator(cfg, &keyDB{keys: map[string]*model.ApiKey{}, touched: map[uuid.UUID]string{}})
+	if err != nil {
+		panic(err)
+	}
+	now := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	a.now = func() time.Time { return now }
+	return a
+}
+
+func TestNewAuthenticatorRefusesWeakSecret(t *testing.T) {
+	for _, secret := range []string{"", "secret-key", "short"} {
+		cfg := &config.Config{}
+		cfg.JWTConfig.Secret = secret
+		_, err := NewAuthenticator(cfg, nil)
+		assert.Error(t, err, secret)
+	}
+}
+
+func TestIssueAndParse(t *testing.T) {
+	a := testAuthenticator(testSecret)
+	postId := uuid.Must(uuid.NewV4())
+	user := &model.User{Id: uuid.Must(uuid.NewV4()), Username: "van-1", Role: model.RoleFieldPost, PostId: &postId}
+
+	token, expiresAt, err := a.Issue(user)
+	require.NoError(t, err)
+	assert.Equal(t, a.now().Add(15*time.Minute), expiresAt)
+
+	claims, err := a.Parse(token)
+	require.NoError(t, err)
+	assert.Equal(t, &model.Claims{UserId: user.Id, Username: "van-1", Role: model.RoleFieldPost, PostId: &postId}, claims)
+
+	_, err = testAuthenticator(otherSecret).Parse(token)
+	assert.Error(t, err, "signed with another secret")
+
+	later := expiresAt.Add(time.Second)
+	a.now = func() time.Time { return later }
+	_, err = a.Parse(token)
+	assert.Error(t, err, "expired")
+}
+
+func TestParseRejectsOtherIssuer(t *testing.T) {
+	a := testAuthenticator(testSecret)
+	token, _, err := a.Issue(&model.User{Id: uuid.Must(uuid.NewV4()), Role: model.RoleViewer})
+	require.NoError(t, err)
+	b := testAuthenticator(testSecret)
+	b.issuer = "elsewhere"
+	_, err = b.Parse(token)
+	assert.Error(t, err)
+}
+
+func TestNewRefreshToken(t *testing.T) {
+	a := testAuthenticator(testSecret)
+	token, hash, expiresAt, err := a.NewRefreshToken()
+	require.NoError(t, err)
+	assert.Len(t, token, 43)
+	assert.Equal(t, HashRefreshToken(token), hash)
+	assert.Equal(t, a.now().Add(24*time.Hour), expiresAt)
+
+	other, _, _, err := a.NewRefreshToken()
+	require.NoError(t, err)
+	assert.NotEqual(t, token, other)
+}
+
+func TestNewApiKey(t *testing.T) {
+	key, prefix, hash, err := NewApiKey()
+	require.NoError(t, err)
+	assert.True(t, isApiKey(key))
+	assert.Len(t, key, len(apiKeyMark)+43)
+	assert.Equal(t, key[:12], prefix)
+	assert.Equal(t, HashApiKey(key), hash)
+	assert.NotEqual(t, HashApiKey(key+"x"), hash)
+}
+
+func TestAuthenticateApiKey(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	a := testAuthenticator(testSecret)
+	db := a.authDB.(*keyDB)
+	postId, otherPost := uuid.Must(uuid.NewV4()), uuid.Must(uuid.NewV4())
+	key, prefix, hash, err := NewApiKey()
+	require.NoError(t, err)
+	stored := &model.ApiKey{Id: uuid.Must(uuid.NewV4()), Name: "van-1", Prefix: prefix, PostId: &postId,
+		Permissions: []string{model.PermissionIngest}}
+	db.keys[string(hash)] = stored
+
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		c.Request = c.Request.WithContext(trace.WithRequestID(c, "request-1"))
+	})
+	r.POST("/ingest/:id", a.Authenticate(), a.Require(model.PermissionIngest), a.RequirePost("id"), func(c *gin.Context) {
+		assert.Equal(t, &stored.Id, FromContext(c).ApiKeyId)
+		c.Status(http.StatusNoContent)
+	})
+	r.GET("/read", a.Authenticate(), a.Require(model.PermissionRead), func(c *gin.Context) { c.Status(http.StatusNoContent) })
+	serve := func(method, path string, header map[string]string) int {
+		req := httptest.NewRequest(method, path, nil)
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusNoContent, serve(http.MethodPost, "/ingest/"+postId.String(), map[string]string{ApiKeyHeader: key}))
+	assert.Equal(t, "request-1", db.touched[stored.Id])
+	assert.Equal(t, http.StatusNoContent, serve(http.MethodPost, "/ingest/"+postId.String(), map[string]string{"Authorization": "Bearer " + key}))
+	assert.Equal(t, http.StatusForbidden, serve(http.MethodPost, "/ingest/"+otherPost.String(), map[string]string{ApiKeyHeader: key}))
+	assert.Equal(t, http.StatusForbidden, serve(http.MethodGet, "/read", map[string]string{ApiKeyHeader: key}))
+	assert.Equal(t, http.StatusUnauthorized, serve(http.MethodGet, "/read", map[string]string{ApiKeyHeader: key + "x"}))
+
+	revokedAt := a.now().Add(-time.Minute)
+	stored.RevokedAt = &revokedAt
+	assert.Equal(t, http.StatusUnauthorized, serve(http.MethodPost, "/ingest/"+postId.String(), map[string]string{ApiKeyHeader: key}))
+}
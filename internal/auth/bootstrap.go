@@ -0,0 +1,46 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"go.uber.org/fx"
+	"simpleServer/internal/auth/database"
+	"simpleServer/internal/auth/model"
+	"simpleServer/internal/config"
+	"simpleServer/pkg/logging"
+)
+
+// Bootstrap creates the configured admin on startup while there are no users, so a fresh installation
+// can be signed in to. A password the API would refuse stops the startup.
+func Bootstrap(lc fx.Lifecycle, cfg *config.Config, db database.AuthDB) error {
+	admin := cfg.JWTConfig.Admin
+	if admin.Username == "" {
+		return nil
+	}
+	if len(admin.Password) < minPasswordLength {
+		return fmt.Errorf("jwt.admin.password must have at least %d characters", minPasswordLength)
+	}
+	lc.Append(fx.Hook{
+		OnStart: func(ctx context.Context) error {
+			logger := logging.FromContext(ctx)
+			count, err := db.CountUsers(ctx)
+			if err != nil {
+				return err
+			}
+			if count > 0 {
+				return nil
+			}
+			hash, err := HashPassword(admin.Password)
+			if err != nil {
+				return err
+			}
+			input := &model.UserInput{Username: admin.Username, PasswordHash: hash, Role: model.RoleAdmin, Active: true}
+			if _, err := db.CreateUser(ctx, input); err != nil {
+				return err
+			}
+			logger.Warnw("created the configured admin, change its password", "username", admin.Username)
+			return nil
+		},
+	})
+	return nil
+}
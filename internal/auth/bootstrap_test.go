@@ -0,0 +1,19 @@
+package auth
+
+import (
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/fx/fxtest"
+	"simpleServer/internal/config"
+	"testing"
+)
+
+func TestBootstrapRefusesShortPassword(t *testing.T) {
+	cfg := &config.Config{}
+	lc := fxtest.NewLifecycle(t)
+	assert.NoError(t, Bootstrap(lc, cfg, nil))
+
+	cfg.JWTConfig.Admin.Username = "admin"
+	assert.Error(t, Bootstrap(lc, cfg, nil))
+	cfg.JWTConfig.Admin.Password = "admin"
+	assert.Error(t, Bootstrap(lc, cfg, nil))
+}
@@ -0,0 +1,422 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gofrs/uuid"
+	"github.com/jmoiron/sqlx"
+	"simpleServer/dbutils"
+	"simpleServer/internal/auth/model"
+	"simpleServer/pkg/logging"
+	"time"
+)
+
+var (
+	ErrUserNotFound  = errors.New("user not found")
+	ErrDuplicateUser = errors.New("username already taken")
+	ErrUnknownPost   = errors.New("unknown post")
+	// ErrInvalidToken covers unknown, expired and revoked refresh tokens and tokens of inactive users.
+	ErrInvalidToken   = errors.New("invalid refresh token")
+	ErrApiKeyNotFound = errors.New("api key not found")
+	// ErrApiKeyRevoked is returned when rotating a key that is no longer usable.
+	ErrApiKeyRevoked = errors.New("api key revoked or expired")
+)
+
+type AuthDB interface {
+	GetUsers(ctx context.Context) ([]model.User, error)
+
+	GetUser(ctx context.Context, id uuid.UUID) (*model.User, error)
+
+	GetUserByName(ctx context.Context, username string) (*model.User, error)
+
+	CountUsers(ctx context.Context) (int, error)
+
+	CreateUser(ctx context.Context, input *model.UserInput) (*model.User, error)
+
+	// UpdateUser replaces the user, refresh tokens are revoked when the password changes or the user is
+	// deactivated.
+	UpdateUser(ctx context.Context, id uuid.UUID, input *model.UserInput) (*model.User, error)
+
+	SaveRefreshToken(ctx context.Context, userId uuid.UUID, hash []byte, expiresAt time.Time) error
+
+	// RotateRefreshToken revokes the token with hash and saves newHash for its user in its place. Using a
+	// revoked token again revokes every token of the user, as it was likely stolen.
+	RotateRefreshToken(ctx context.Context, hash, newHash []byte, expiresAt time.Time) (*model.User, error)
+
+	RevokeRefreshToken(ctx context.Context, hash []byte) error
+
+	GetApiKeys(ctx context.Context, postId *uuid.UUID) ([]model.ApiKey, error)
+
+	GetApiKey(ctx context.Context, id uuid.UUID) (*model.ApiKey, error)
+
+	// GetApiKeyByHash returns the key with hash, usable or not.
+	GetApiKeyByHash(ctx context.Context, hash []byte) (*model.ApiKey, error)
+
+	CreateApiKey(ctx context.Context, input *model.ApiKeyInput) (*model.ApiKey, error)
+
+	// RotateApiKey issues a key with the name, post and permissions of key id, which expires after grace.
+	RotateApiKey(ctx context.Context, id uuid.UUID, input *model.ApiKeyInput, grace time.Duration) (*model.ApiKey, error)
+
+	RevokeApiKey(ctx context.Context, id uuid.UUID) (*model.ApiKey, error)
+
+	// TouchApiKey records the use of a key by the request with requestId.
+	TouchApiKey(ctx context.Context, id uuid.UUID, requestId string) error
+}
+
+type authDB struct {
+	dbh *sqlx.DB
+}
+
+func NewAuthDB(dbh *sqlx.DB) AuthDB {
+	return &authDB{dbh: dbh}
+}
+
+const userColumns = `id, username, password_hash, role, post_id, active, created_at, updated_at`
+
+func getUser(ctx context.Context, db sqlx.ExtContext, filter string, arg interface{}) (*model.User, error) {
+	var user model.User
+	err := dbutils.Get(ctx, db, &user, `select `+userColumns+` from "Users" where `+filter, arg)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (a *authDB) GetUsers(ctx context.Context) ([]model.User, error) {
+	logger := logging.FromContext(ctx)
+	logger.Debugw("user list")
+	var users []model.User
+	if err := dbutils.Select(ctx, a.dbh, &users, `select `+userColumns+` from "Users" order by username`); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+func (a *authDB) GetUser(ctx context.Context, id uuid.UUID) (*model.User, error) {
+	return getUser(ctx, a.dbh, `id = $1`, id)
+}
+
+func (a *authDB) GetUserByName(ctx context.Context, username string) (*model.User, error) {
+	return getUser(ctx, a.dbh, `username = $1`, username)
+}
+
+func (a *authDB) CountUsers(ctx context.Context) (int, error) {
+	var count int
+	if err := dbutils.Get(ctx, a.dbh, &count, `select count(*) from "Users"`); err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+func checkPost(ctx context.Context, tx *sqlx.Tx, postId *uuid.UUID) error {
+	if postId == nil {
+		return nil
+	}
+	var exists bool
+	if err := dbutils.Get(ctx, tx, &exists, `select exists(select 1 from "Post" where id = $1)`, *postId); err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("%w %s", ErrUnknownPost, *postId)
+	}
+	return nil
+}
+
+func userArgs(id uuid.UUID, input *model.UserInput) map[string]interface{} {
+	return map[string]interface{}{
+		"Id":           id,
+		"Username":     input.Username,
+		"PasswordHash": input.PasswordHash,
+		"Role":         input.Role,
+		"PostId":       input.PostId,
+		"Active":       input.Active,
+	}
+}
+
+func (a *authDB) CreateUser(ctx context.Context, input *model.UserInput) (*model.User, error) {
+	logger := logging.FromContext(ctx)
+	logger.Debugw("user create", "username", input.Username, "role", input.Role)
+	id, err := uuid.NewV4()
+	if err != nil {
+		return nil, err
+	}
+	var created *model.User
+	err = dbutils.RunTx(ctx, a.dbh, func(tx *sqlx.Tx) error {
+		if err := checkPost(ctx, tx, input.PostId); err != nil {
+			return err
+		}
+		query := `insert into "Users" (id, username, password_hash, role, post_id, active)
+			values (:Id, :Username, :PasswordHash, :Role, :PostId, :Active)
+			on conflict (username) do nothing`
+		res, err := dbutils.NamedExec(ctx, tx, query, userArgs(id, input))
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err == nil && n == 0 {
+			return ErrDuplicateUser
+		}
+		created, err = getUser(ctx, tx, `id = $1`, id)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return created, nil
+}
+
+func (a *authDB) UpdateUser(ctx context.Context, id uuid.UUID, input *model.UserInput) (*model.User, error) {
+	logger := logging.FromContext(ctx)
+	logger.Debugw("user update", "id", id, "role", input.Role, "active", input.Active)
+	var updated *model.User
+	err := dbutils.RunTx(ctx, a.dbh, func(tx *sqlx.Tx) error {
+		if err := checkPost(ctx, tx, input.PostId); err != nil {
+			return err
+		}
+		var taken bool
+		query := `select exists(select 1 from "Users" where username = $1 and id <> $2)`
+		if err := dbutils.Get(ctx, tx, &taken, query, input.Username, id); err != nil {
+			return err
+		}
+		if taken {
+			return ErrDuplicateUser
+		}
+		query = `update "Users"
+			set username = :Username, password_hash = coalesce(nullif(:PasswordHash, ''), password_hash),
+				role = :Role, post_id = :PostId, active = :Active, updated_at = now()
+			where id = :Id`
+		res, err := dbutils.NamedExec(ctx, tx, query, userArgs(id, input))
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err == nil && n == 0 {
+			return ErrUserNotFound
+		}
+		if input.PasswordHash != "" || !input.Active {
+			query = `update "RefreshTokens" set revoked_at = now() where user_id = $1 and revoked_at is null`
+			if _, err := dbutils.Exec(ctx, tx, query, id); err != nil {
+				return err
+			}
+		}
+		updated, err = getUser(ctx, tx, `id = $1`, id)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return updated, nil
+}
+
+func saveRefreshToken(ctx context.Context, db sqlx.ExtContext, userId uuid.UUID, hash []byte, expiresAt time.Time) error {
+	id, err := uuid.NewV4()
+	if err != nil {
+		return err
+	}
+	query := `insert into "RefreshTokens" (id, user_id, token_hash, expires_at) values ($1, $2, $3, $4)`
+	_, err = dbutils.Exec(ctx, db, query, id, userId, hash, expiresAt)
+	return err
+}
+
+func (a *authDB) SaveRefreshToken(ctx context.Context, userId uuid.UUID, hash []byte, expiresAt time.Time) error {
+	return saveRefreshToken(ctx, a.dbh, userId, hash, expiresAt)
+}
+
+func (a *authDB) RotateRefreshToken(ctx context.Context, hash, newHash []byte, expiresAt time.Time) (*model.User, error) {
+	var user *model.User
+	var reused bool
+	err := dbutils.RunTx(ctx, a.dbh, func(tx *sqlx.Tx) error {
+		var token struct {
+			UserId    uuid.UUID  `db:"user_id"`
+			ExpiresAt time.Time  `db:"expires_at"`
+			RevokedAt *time.Time `db:"revoked_at"`
+		}
+		query := `select user_id, expires_at, revoked_at from "RefreshTokens" where token_hash = $1 for update`
+		err := dbutils.Get(ctx, tx, &token, query, hash)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrInvalidToken
+		}
+		if err != nil {
+			return err
+		}
+		if token.RevokedAt != nil {
+			// the revocation is committed, so the error is returned after the transaction.
+			reused = true
+			query = `update "RefreshTokens" set revoked_at = now() where user_id = $1 and revoked_at is null`
+			_, err := dbutils.Exec(ctx, tx, query, token.UserId)
+			return err
+		}
+		if !token.ExpiresAt.After(time.Now()) {
+			return ErrInvalidToken
+		}
+		if user, err = getUser(ctx, tx, `id = $1`, token.UserId); err != nil {
+			return err
+		}
+		if !user.Active {
+			return ErrInvalidToken
+		}
+		query = `update "RefreshTokens" set revoked_at = now() where token_hash = $1`
+		if _, err := dbutils.Exec(ctx, tx, query, hash); err != nil {
+			return err
+		}
+		return saveRefreshToken(ctx, tx, user.Id, newHash, expiresAt)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if reused {
+		logging.FromContext(ctx).Warnw("revoked refresh token reused, revoked every token of the user")
+		return nil, ErrInvalidToken
+	}
+	return user, nil
+}
+
+func (a *authDB) RevokeRefreshToken(ctx context.Context, hash []byte) error {
+	query := `update "RefreshTokens" set revoked_at = now() where token_hash = $1 and revoked_at is null`
+	_, err := dbutils.Exec(ctx, a.dbh, query, hash)
+	return err
+}
+
+const apiKeyColumns = `id, name, prefix, post_id, cast(array_to_json(permissions) as text) as permissions, created_by,
+	created_at, expires_at, revoked_at, last_used_at, last_request_id, replaced_by`
+
+// apiKeysQuery selects the keys matching filter, lock is a locking clause such as "for update", which
+// postgres only takes after the order by.
+func apiKeysQuery(filter, lock string) string {
+	query := `select ` + apiKeyColumns + ` from "ApiKeys" ` + filter + ` order by created_at desc`
+	if lock != "" {
+		query += ` ` + lock
+	}
+	return query
+}
+
+func selectApiKeys(ctx context.Context, db sqlx.ExtContext, filter, lock string, args ...interface{}) ([]model.ApiKey, error) {
+	var keys []model.ApiKey
+	query := apiKeysQuery(filter, lock)
+	if err := dbutils.Select(ctx, db, &keys, query, args...); err != nil {
+		return nil, err
+	}
+	for i := range keys {
+		if err := json.Unmarshal([]byte(keys[i].PermissionsJSON), &keys[i].Permissions); err != nil {
+			return nil, err
+		}
+	}
+	return keys, nil
+}
+
+func getApiKey(ctx context.Context, db sqlx.ExtContext, filter, lock string, arg interface{}) (*model.ApiKey, error) {
+	keys, err := selectApiKeys(ctx, db, filter, lock, arg)
+	if err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 {
+		return nil, ErrApiKeyNotFound
+	}
+	return &keys[0], nil
+}
+
+func (a *authDB) GetApiKeys(ctx context.Context, postId *uuid.UUID) ([]model.ApiKey, error) {
+	logger := logging.FromContext(ctx)
+	logger.Debugw("api key list", "postId", postId)
+	if postId != nil {
+		return selectApiKeys(ctx, a.dbh, `where post_id = $1`, "", *postId)
+	}
+	return selectApiKeys(ctx, a.dbh, "", "")
+}
+
+func (a *authDB) GetApiKey(ctx context.Context, id uuid.UUID) (*model.ApiKey, error) {
+	return getApiKey(ctx, a.dbh, `where id = $1`, "", id)
+}
+
+func (a *authDB) GetApiKeyByHash(ctx context.Context, hash []byte) (*model.ApiKey, error) {
+	return getApiKey(ctx, a.dbh, `where key_hash = $1`, "", hash)
+}
+
+func createApiKey(ctx context.Context, tx *sqlx.Tx, input *model.ApiKeyInput) (uuid.UUID, error) {
+	if err := checkPost(ctx, tx, input.PostId); err != nil {
+		return uuid.Nil, err
+	}
+	id, err := uuid.NewV4()
+	if err != nil {
+		return uuid.Nil, err
+	}
+	query := `insert into "ApiKeys" (id, name, prefix, key_hash, post_id, permissions, created_by, expires_at)
+		values ($1, $2, $3, $4, $5, cast($6 as text[]), $7, $8)`
+	_, err = dbutils.Exec(ctx, tx, query, id, input.Name, input.Prefix, input.Hash, input.PostId, input.Permissions,
+		input.CreatedBy, input.ExpiresAt)
+	return id, err
+}
+
+func (a *authDB) CreateApiKey(ctx context.Context, input *model.ApiKeyInput) (*model.ApiKey, error) {
+	logger := logging.FromContext(ctx)
+	logger.Debugw("api key create", "name", input.Name, "postId", input.PostId, "permissions", input.Permissions)
+	var created *model.ApiKey
+	err := dbutils.RunTx(ctx, a.dbh, func(tx *sqlx.Tx) error {
+		id, err := createApiKey(ctx, tx, input)
+		if err != nil {
+			return err
+		}
+		created, err = getApiKey(ctx, tx, `where id = $1`, "", id)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return created, nil
+}
+
+func (a *authDB) RotateApiKey(ctx context.Context, id uuid.UUID, input *model.ApiKeyInput, grace time.Duration) (*model.ApiKey, error) {
+	logger := logging.FromContext(ctx)
+	logger.Debugw("api key rotate", "id", id, "grace", grace)
+	var rotated *model.ApiKey
+	err := dbutils.RunTx(ctx, a.dbh, func(tx *sqlx.Tx) error {
+		old, err := getApiKey(ctx, tx, `where id = $1`, "for update", id)
+		if err != nil {
+			return err
+		}
+		if !old.Usable(time.Now()) || old.ReplacedBy != nil {
+			return ErrApiKeyRevoked
+		}
+		input.Name, input.PostId, input.Permissions = old.Name, old.PostId, old.Permissions
+		newId, err := createApiKey(ctx, tx, input)
+		if err != nil {
+			return err
+		}
+		// the old key keeps working for grace so clients can switch over, never past its own expiry.
+		query := `update "ApiKeys"
+			set replaced_by = $2, expires_at = least(coalesce(expires_at, 'infinity'), now() + make_interval(secs => $3))
+			where id = $1`
+		if _, err := dbutils.Exec(ctx, tx, query, id, newId, grace.Seconds()); err != nil {
+			return err
+		}
+		rotated, err = getApiKey(ctx, tx, `where id = $1`, "", newId)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return rotated, nil
+}
+
+func (a *authDB) RevokeApiKey(ctx context.Context, id uuid.UUID) (*model.ApiKey, error) {
+	logger := logging.FromContext(ctx)
+	logger.Debugw("api key revoke", "id", id)
+	res, err := dbutils.Exec(ctx, a.dbh, `update "ApiKeys" set revoked_at = coalesce(revoked_at, now()) where id = $1`, id)
+	if err != nil {
+		return nil, err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return nil, ErrApiKeyNotFound
+	}
+	return a.GetApiKey(ctx, id)
+}
+
+func (a *authDB) TouchApiKey(ctx context.Context, id uuid.UUID, requestId string) error {
+	query := `update "ApiKeys" set last_used_at = now(), last_request_id = $2 where id = $1`
+	_, err := dbutils.Exec(ctx, a.dbh, query, id, requestId)
+	return err
+}
@@ -0,0 +1,13 @@
+package database
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestApiKeysQuery(t *testing.T) {
+	query := apiKeysQuery(`where id = $1`, "for update")
+	assert.True(t, strings.HasSuffix(query, `where id = $1 order by created_at desc for update`), query)
+	assert.True(t, strings.HasSuffix(apiKeysQuery("", ""), `from "ApiKeys"  order by created_at desc`))
+}
@@ -0,0 +1,318 @@
+package auth
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"github.com/gofrs/uuid"
+	"golang.org/x/crypto/bcrypt"
+	"net/http"
+	"simpleServer/internal/auth/database"
+	"simpleServer/internal/auth/model"
+	"simpleServer/internal/config"
+	"simpleServer/internal/middleware"
+	"simpleServer/internal/middleware/handler"
+	"simpleServer/internal/ratelimit"
+	"simpleServer/pkg/logging"
+	"simpleServer/pkg/validate"
+	"time"
+)
+
+const minPasswordLength = 8
+
+type Handler struct {
+	authDB database.AuthDB
+	auth   *Authenticator
+	// dummyHash is compared against for unknown users, so they take as long as wrong passwords.
+	dummyHash []byte
+}
+
+func NewHandler(db database.AuthDB, a *Authenticator) (*Handler, error) {
+	dummyHash, err := bcrypt.GenerateFromPassword([]byte("not a password"), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+	return &Handler{authDB: db, auth: a, dummyHash: dummyHash}, nil
+}
+
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+func userErrorResponse(err error) *handler.Response {
+	switch {
+	case errors.Is(err, database.ErrUserNotFound):
+		return handler.NewErrorResponse(http.StatusNotFound, handler.NotFoundEntity, "user not found", nil)
+	case errors.Is(err, database.ErrDuplicateUser):
+		return handler.NewErrorResponse(http.StatusConflict, handler.DuplicateEntry, err.Error(), nil)
+	case errors.Is(err, database.ErrUnknownPost):
+		return handler.NewErrorResponse(http.StatusBadRequest, handler.InvalidBodyValue, err.Error(),
+			validate.NewValidationErrorDetails("postId", "existing post id", ""))
+	}
+	return handler.NewInternalErrorResponse(err)
+}
+
+// issue signs in user with a new access token and the refresh token it was given.
+func (h *Handler) issue(user *model.User, refreshToken string, refreshExpiresAt time.Time) (*TokenResponse, error) {
+	accessToken, expiresAt, err := h.auth.Issue(user)
+	if err != nil {
+		return nil, err
+	}
+	return &TokenResponse{
+		AccessToken:      accessToken,
+		TokenType:        "Bearer",
+		ExpiresIn:        int(h.auth.accessTime.Seconds()),
+		ExpiresAt:        expiresAt,
+		RefreshToken:     refreshToken,
+		RefreshExpiresAt: refreshExpiresAt,
+		User:             NewUserResponse(user),
+	}, nil
+}
+
+func (h *Handler) Login(c *gin.Context) {
+	handler.HandleRequest(c, func(c *gin.Context) *handler.Response {
+		logger := logging.FromContext(c)
+		type RequestBody struct {
+			Username string `json:"username" binding:"required"`
+			Password string `json:"password" binding:"required"`
+		}
+		var body RequestBody
+		if err := c.ShouldBindJSON(&body); err != nil {
+			var details []*validate.ValidationErrDetail
+			if vErrs, ok := err.(validator.ValidationErrors); ok {
+				details = validate.ValidationErrorDetails(&body, "json", vErrs)
+			}
+			return handler.NewErrorResponse(http.StatusBadRequest, handler.InvalidBodyValue, "invalid username or password", details)
+		}
+		ctx := c.Request.Context()
+		user, err := h.authDB.GetUserByName(ctx, body.Username)
+		if err != nil && !errors.Is(err, database.ErrUserNotFound) {
+			logger.Errorw("auth.Login failed", "username", body.Username, "err", err)
+			return handler.NewInternalErrorResponse(err)
+		}
+		hash := h.dummyHash
+		if user != nil {
+			hash = []byte(user.PasswordHash)
+		}
+		if err := bcrypt.CompareHashAndPassword(hash, []byte(body.Password)); err != nil || user == nil || !user.Active {
+			logger.Infow("auth.Login rejected", "username", body.Username)
+			return handler.NewErrorResponse(http.StatusUnauthorized, handler.Unauthorized, "wrong username or password", nil)
+		}
+
+		refreshToken, refreshHash, refreshExpiresAt, err := h.auth.NewRefreshToken()
+		if err == nil {
+			err = h.authDB.SaveRefreshToken(ctx, user.Id, refreshHash, refreshExpiresAt)
+		}
+		if err != nil {
+			logger.Errorw("auth.Login failed", "username", body.Username, "err", err)
+			return handler.NewInternalErrorResponse(err)
+		}
+		tokens, err := h.issue(user, refreshToken, refreshExpiresAt)
+		if err != nil {
+			logger.Errorw("auth.Login failed", "username", body.Username, "err", err)
+			return handler.NewInternalErrorResponse(err)
+		}
+		logger.Infow("auth.Login", "userId", user.Id, "role", user.Role)
+		return handler.NewSuccessResponse(http.StatusOK, tokens)
+	})
+}
+
+func bindRefreshToken(c *gin.Context) (string, *handler.Response) {
+	type RequestBody struct {
+		RefreshToken string `json:"refreshToken" binding:"required"`
+	}
+	var body RequestBody
+	if err := c.ShouldBindJSON(&body); err != nil {
+		return "", handler.NewErrorResponse(http.StatusBadRequest, handler.InvalidBodyValue, "invalid refresh token",
+			validate.NewValidationErrorDetails("refreshToken", "required", ""))
+	}
+	return body.RefreshToken, nil
+}
+
+// Refresh trades a refresh token for a new access token and a new refresh token, the old one can't be
+// used again.
+func (h *Handler) Refresh(c *gin.Context) {
+	handler.HandleRequest(c, func(c *gin.Context) *handler.Response {
+		logger := logging.FromContext(c)
+		token, res := bindRefreshToken(c)
+		if res != nil {
+			return res
+		}
+		refreshToken, refreshHash, refreshExpiresAt, err := h.auth.NewRefreshToken()
+		if err != nil {
+			logger.Errorw("auth.Refresh failed", "err", err)
+			return handler.NewInternalErrorResponse(err)
+		}
+		user, err := h.authDB.RotateRefreshToken(c.Request.Context(), HashRefreshToken(token), refreshHash, refreshExpiresAt)
+		if errors.Is(err, database.ErrInvalidToken) {
+			return handler.NewErrorResponse(http.StatusUnauthorized, handler.Unauthorized, err.Error(), nil)
+		}
+		if err != nil {
+			logger.Errorw("auth.Refresh failed", "err", err)
+			return handler.NewInternalErrorResponse(err)
+		}
+		tokens, err := h.issue(user, refreshToken, refreshExpiresAt)
+		if err != nil {
+			logger.Errorw("auth.Refresh failed", "userId", user.Id, "err", err)
+			return handler.NewInternalErrorResponse(err)
+		}
+		return handler.NewSuccessResponse(http.StatusOK, tokens)
+	})
+}
+
+// Logout revokes the refresh token, access tokens issued with it stay valid until they expire.
+func (h *Handler) Logout(c *gin.Context) {
+	handler.HandleRequest(c, func(c *gin.Context) *handler.Response {
+		token, res := bindRefreshToken(c)
+		if res != nil {
+			return res
+		}
+		if err := h.authDB.RevokeRefreshToken(c.Request.Context(), HashRefreshToken(token)); err != nil {
+			logging.FromContext(c).Errorw("auth.Logout failed", "err", err)
+			return handler.NewInternalErrorResponse(err)
+		}
+		return handler.NewSuccessResponse(http.StatusNoContent, nil)
+	})
+}
+
+func (h *Handler) GetMe(c *gin.Context) {
+	handler.HandleRequest(c, func(c *gin.Context) *handler.Response {
+		claims := FromContext(c)
+		if claims.ApiKeyId != nil {
+			return handler.NewErrorResponse(http.StatusForbidden, handler.Forbidden, "api keys have no user", nil)
+		}
+		user, err := h.authDB.GetUser(c.Request.Context(), claims.UserId)
+		if err != nil {
+			return userErrorResponse(err)
+		}
+		return handler.NewSuccessResponse(http.StatusOK, NewUserResponse(user))
+	})
+}
+
+// bindUser reads a user body, the password may be left out on update only.
+func bindUser(c *gin.Context, update bool) (*model.UserInput, *handler.Response) {
+	type RequestBody struct {
+		Username string     `json:"username" binding:"required"`
+		Password string     `json:"password"`
+		Role     string     `json:"role" binding:"required"`
+		PostId   *uuid.UUID `json:"postId"`
+		Active   *bool      `json:"active"`
+	}
+	var body RequestBody
+	if err := c.ShouldBindJSON(&body); err != nil {
+		var details []*validate.ValidationErrDetail
+		if vErrs, ok := err.(validator.ValidationErrors); ok {
+			details = validate.ValidationErrorDetails(&body, "json", vErrs)
+		}
+		return nil, handler.NewErrorResponse(http.StatusBadRequest, handler.InvalidBodyValue, "invalid user", details)
+	}
+	if !model.ValidRole(body.Role) {
+		return nil, handler.NewErrorResponse(http.StatusBadRequest, handler.InvalidBodyValue, "invalid role",
+			validate.NewValidationErrorDetails("role", "one of viewer, analyst, field-post, admin", body.Role))
+	}
+	if body.PostId != nil && body.Role != model.RoleFieldPost {
+		return nil, handler.NewErrorResponse(http.StatusBadRequest, handler.InvalidBodyValue, "only field posts are bound to a post",
+			validate.NewValidationErrorDetails("postId", "empty unless role is field-post", body.PostId.String()))
+	}
+	if (body.Password != "" || !update) && len(body.Password) < minPasswordLength {
+		return nil, handler.NewErrorResponse(http.StatusBadRequest, handler.InvalidBodyValue, "password too short",
+			validate.NewValidationErrorDetails("password", "at least 8 characters", ""))
+	}
+	input := &model.UserInput{
+		Username: body.Username,
+		Role:     body.Role,
+		PostId:   body.PostId,
+		Active:   body.Active == nil || *body.Active,
+	}
+	if body.Password != "" {
+		hash, err := HashPassword(body.Password)
+		if err != nil {
+			return nil, handler.NewInternalErrorResponse(err)
+		}
+		input.PasswordHash = hash
+	}
+	return input, nil
+}
+
+func (h *Handler) GetUsers(c *gin.Context) {
+	handler.HandleRequest(c, func(c *gin.Context) *handler.Response {
+		users, err := h.authDB.GetUsers(c.Request.Context())
+		if err != nil {
+			logging.FromContext(c).Errorw("auth.GetUsers failed", "err", err)
+			return handler.NewInternalErrorResponse(err)
+		}
+		return handler.NewSuccessResponse(http.StatusOK, NewUsersResponse(users))
+	})
+}
+
+func (h *Handler) CreateUser(c *gin.Context) {
+	handler.HandleRequest(c, func(c *gin.Context) *handler.Response {
+		input, res := bindUser(c, false)
+		if res != nil {
+			return res
+		}
+		user, err := h.authDB.CreateUser(c.Request.Context(), input)
+		if err != nil {
+			logging.FromContext(c).Errorw("auth.CreateUser failed", "username", input.Username, "err", err)
+			return userErrorResponse(err)
+		}
+		return handler.NewSuccessResponse(http.StatusCreated, NewUserResponse(user))
+	})
+}
+
+// UpdateUser replaces a user, changing the password or deactivating the user signs it out everywhere.
+func (h *Handler) UpdateUser(c *gin.Context) {
+	handler.HandleRequest(c, func(c *gin.Context) *handler.Response {
+		id, err := uuid.FromString(c.Param("id"))
+		if err != nil {
+			return handler.NewErrorResponse(http.StatusBadRequest, handler.InvalidUriValue, "invalid id in uri",
+				validate.NewValidationErrorDetails("id", "required uuid format", c.Param("id")))
+		}
+		input, res := bindUser(c, true)
+		if res != nil {
+			return res
+		}
+		user, err := h.authDB.UpdateUser(c.Request.Context(), id, input)
+		if err != nil {
+			logging.FromContext(c).Errorw("auth.UpdateUser failed", "id", id, "err", err)
+			return userErrorResponse(err)
+		}
+		return handler.NewSuccessResponse(http.StatusOK, NewUserResponse(user))
+	})
+}
+
+func RouteV1(cfg *config.Config, h *Handler, a *Authenticator, l *ratelimit.Limiter, r *gin.Engine) {
+	v1 := r.Group("v1/api")
+	v1.Use(middleware.CorsMiddleware(), middleware.RequestIDMiddleware(), middleware.TimeoutMiddleware(cfg.ServerConfig.WriteTimeout))
+
+	// signing in is anonymous, so the strict auth limits apply per IP and slow password guessing down.
+	authV1 := v1.Group("auth")
+	{
+		authV1.POST("/login", l.Limit("auth"), h.Login)
+		authV1.POST("/refresh", l.Limit("auth"), h.Refresh)
+		authV1.POST("/logout", l.Limit("auth"), h.Logout)
+		authV1.GET("/me", a.Authenticate(), h.GetMe)
+	}
+
+	usersV1 := v1.Group("users")
+	usersV1.Use(a.Authenticate(), a.Require(model.PermissionAdmin))
+	{
+		usersV1.GET("", h.GetUsers)
+		usersV1.POST("", h.CreateUser)
+		usersV1.PUT("/:id", h.UpdateUser)
+	}
+
+	apiKeysV1 := v1.Group("apiKeys")
+	apiKeysV1.Use(a.Authenticate(), a.Require(model.PermissionAdmin))
+	{
+		apiKeysV1.GET("", h.GetApiKeys)
+		apiKeysV1.POST("", h.CreateApiKey)
+		apiKeysV1.GET("/:id", h.GetApiKey)
+		apiKeysV1.POST("/:id/rotate", h.RotateApiKey)
+		apiKeysV1.POST("/:id/revoke", h.RevokeApiKey)
+	}
+}
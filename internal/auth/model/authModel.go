@@ -0,0 +1,165 @@
+package model
+
+import (
+	"context"
+	"github.com/gofrs/uuid"
+	"time"
+)
+
+const (
+	// RoleViewer reads maps, posts and alerts.
+	RoleViewer = "viewer"
+	// RoleAnalyst also exports raw measurements and works on candidates, alerts, geofences and campaigns.
+	RoleAnalyst = "analyst"
+	// RoleFieldPost uploads measurements, for its own post only when bound to one.
+	RoleFieldPost = "field-post"
+	// RoleAdmin may do anything, including managing posts and users.
+	RoleAdmin = "admin"
+)
+
+func ValidRole(role string) bool {
+	return role == RoleViewer || role == RoleAnalyst || role == RoleFieldPost || role == RoleAdmin
+}
+
+// Permissions guard the routes, roles and API keys grant them.
+const (
+	// PermissionRead reads maps, posts, alerts and their like.
+	PermissionRead = "read"
+	// PermissionExport downloads raw measurements and reports.
+	PermissionExport = "export"
+	// PermissionAnalyze works on candidates, alerts, geofences and campaigns.
+	PermissionAnalyze = "analyze"
+	// PermissionIngest uploads measurements.
+	PermissionIngest = "ingest"
+	// PermissionAdmin manages posts, users and API keys.
+	PermissionAdmin = "admin"
+)
+
+var rolePermissions = map[string][]string{
+	RoleViewer:    {PermissionRead},
+	RoleAnalyst:   {PermissionRead, PermissionExport, PermissionAnalyze},
+	RoleFieldPost: {PermissionIngest},
+	RoleAdmin:     {PermissionRead, PermissionExport, PermissionAnalyze, PermissionIngest, PermissionAdmin},
+}
+
+// ValidKeyPermission tells if an API key may be granted permission, keys never administer.
+func ValidKeyPermission(permission string) bool {
+	return permission == PermissionRead || permission == PermissionExport || permission == PermissionIngest
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+type User struct {
+	Id           uuid.UUID  `db:"id"`
+	Username     string     `db:"username"`
+	PasswordHash string     `db:"password_hash"`
+	Role         string     `db:"role"`
+	PostId       *uuid.UUID `db:"post_id"`
+	Active       bool       `db:"active"`
+	CreatedAt    time.Time  `db:"created_at"`
+	UpdatedAt    time.Time  `db:"updated_at"`
+}
+
+// UserInput creates or updates a user, an empty PasswordHash keeps the current one on update.
+type UserInput struct {
+	Username     string
+	PasswordHash string
+	Role         string
+	PostId       *uuid.UUID
+	Active       bool
+}
+
+// ApiKey lets a post or a machine client call the API without a user. Only the hash of the key is kept,
+// Prefix tells keys apart in listings.
+type ApiKey struct {
+	Id     uuid.UUID  `db:"id"`
+	Name   string     `db:"name"`
+	Prefix string     `db:"prefix"`
+	PostId *uuid.UUID `db:"post_id"`
+	// PermissionsJSON is the json array of the permissions, decoded into Permissions.
+	PermissionsJSON string     `db:"permissions"`
+	Permissions     []string   `db:"-"`
+	CreatedBy       *uuid.UUID `db:"created_by"`
+	CreatedAt       time.Time  `db:"created_at"`
+	ExpiresAt       *time.Time `db:"expires_at"`
+	RevokedAt       *time.Time `db:"revoked_at"`
+	LastUsedAt      *time.Time `db:"last_used_at"`
+	LastRequestId   *string    `db:"last_request_id"`
+	// ReplacedBy is the key this one was rotated to.
+	ReplacedBy *uuid.UUID `db:"replaced_by"`
+}
+
+// Usable tells if the key is neither revoked nor expired at now.
+func (k *ApiKey) Usable(now time.Time) bool {
+	return k.RevokedAt == nil && (k.ExpiresAt == nil || now.Before(*k.ExpiresAt))
+}
+
+// ApiKeyInput issues a key, Hash and Prefix come from the generated key.
+type ApiKeyInput struct {
+	Name        string
+	Prefix      string
+	Hash        []byte
+	PostId      *uuid.UUID
+	Permissions []string
+	CreatedBy   *uuid.UUID
+	ExpiresAt   *time.Time
+}
+
+// Claims identify the caller of a request, a user or an API key.
+type Claims struct {
+	UserId   uuid.UUID
+	Username string
+	Role     string
+	// PostId binds the caller to one post, nil allows any post.
+	PostId *uuid.UUID
+	// ApiKeyId is set for API keys, which hold Permissions instead of a role.
+	ApiKeyId    *uuid.UUID
+	Permissions []string
+}
+
+// Can tells if the caller holds permission.
+func (c *Claims) Can(permission string) bool {
+	if c.ApiKeyId != nil {
+		return contains(c.Permissions, permission)
+	}
+	return contains(rolePermissions[c.Role], permission)
+}
+
+// MayAccess tells if the caller may work with the data of postId.
+func (c *Claims) MayAccess(postId uuid.UUID) bool {
+	return c.PostId == nil || *c.PostId == postId || c.Can(PermissionAdmin)
+}
+
+// ScopedPost is the only post listings may show the caller, nil for callers seeing every post.
+func (c *Claims) ScopedPost() *uuid.UUID {
+	if c.PostId == nil || c.Can(PermissionAdmin) {
+		return nil
+	}
+	return c.PostId
+}
+
+// MayUpload tells if the caller may upload measurements of postId.
+func (c *Claims) MayUpload(postId uuid.UUID) bool {
+	return c.Can(PermissionIngest) && c.MayAccess(postId)
+}
+
+type contextKey struct{}
+
+var claimsKey = contextKey{}
+
+// FromContext returns the claims WithClaims stored in ctx, nil when there are none.
+func FromContext(ctx context.Context) *Claims {
+	claims, _ := ctx.Value(claimsKey).(*Claims)
+	return claims
+}
+
+func WithClaims(ctx context.Context, claims *Claims) context.Context {
+	return context.WithValue(ctx, claimsKey, claims)
+}
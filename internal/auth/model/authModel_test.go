@@ -0,0 +1,48 @@
+package model
+
+import (
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestCan(t *testing.T) {
+	viewer := &Claims{Role: RoleViewer}
+	assert.True(t, viewer.Can(PermissionRead))
+	assert.False(t, viewer.Can(PermissionExport))
+	assert.False(t, (&Claims{Role: RoleFieldPost}).Can(PermissionRead))
+	assert.True(t, (&Claims{Role: RoleAdmin}).Can(PermissionIngest))
+	assert.False(t, (&Claims{}).Can(PermissionRead))
+
+	// keys hold their own permissions whatever the role says.
+	keyId := uuid.Must(uuid.NewV4())
+	key := &Claims{ApiKeyId: &keyId, Role: RoleAdmin, Permissions: []string{PermissionIngest}}
+	assert.True(t, key.Can(PermissionIngest))
+	assert.False(t, key.Can(PermissionRead))
+	assert.False(t, key.Can(PermissionAdmin))
+}
+
+func TestMayUpload(t *testing.T) {
+	van, other := uuid.Must(uuid.NewV4()), uuid.Must(uuid.NewV4())
+	bound := &Claims{Role: RoleFieldPost, PostId: &van}
+	assert.True(t, bound.MayUpload(van))
+	assert.False(t, bound.MayUpload(other))
+	assert.True(t, (&Claims{Role: RoleFieldPost}).MayUpload(other))
+	assert.True(t, (&Claims{Role: RoleAdmin, PostId: &van}).MayUpload(other))
+	assert.False(t, (&Claims{Role: RoleAnalyst}).MayUpload(van))
+
+	keyId := uuid.Must(uuid.NewV4())
+	key := &Claims{ApiKeyId: &keyId, PostId: &van, Permissions: []string{PermissionIngest}}
+	assert.True(t, key.MayUpload(van))
+	assert.False(t, key.MayUpload(other))
+}
+
+func TestApiKeyUsable(t *testing.T) {
+	now := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	later := now.Add(time.Hour)
+	assert.True(t, (&ApiKey{}).Usable(now))
+	assert.True(t, (&ApiKey{ExpiresAt: &later}).Usable(now))
+	assert.False(t, (&ApiKey{ExpiresAt: &now}).Usable(now))
+	assert.False(t, (&ApiKey{RevokedAt: &now}).Usable(later))
+}
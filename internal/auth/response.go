@@ -0,0 +1,97 @@
+package auth
+
+import (
+	"github.com/gofrs/uuid"
+	"simpleServer/internal/auth/model"
+	"time"
+)
+
+type UserResponse struct {
+	Id        uuid.UUID  `json:"id"`
+	Username  string     `json:"username"`
+	Role      string     `json:"role"`
+	PostId    *uuid.UUID `json:"postId"`
+	Active    bool       `json:"active"`
+	CreatedAt time.Time  `json:"createdAt"`
+	UpdatedAt time.Time  `json:"updatedAt"`
+}
+
+func NewUserResponse(user *model.User) *UserResponse {
+	return &UserResponse{
+		Id:        user.Id,
+		Username:  user.Username,
+		Role:      user.Role,
+		PostId:    user.PostId,
+		Active:    user.Active,
+		CreatedAt: user.CreatedAt,
+		UpdatedAt: user.UpdatedAt,
+	}
+}
+
+func NewUsersResponse(users []model.User) []*UserResponse {
+	data := make([]*UserResponse, 0, len(users))
+	for i := range users {
+		data = append(data, NewUserResponse(&users[i]))
+	}
+	return data
+}
+
+// TokenResponse is returned on login and refresh, ExpiresIn is the access token lifetime in seconds.
+type TokenResponse struct {
+	AccessToken      string        `json:"accessToken"`
+	TokenType        string        `json:"tokenType"`
+	ExpiresIn        int           `json:"expiresIn"`
+	ExpiresAt        time.Time     `json:"expiresAt"`
+	RefreshToken     string        `json:"refreshToken"`
+	RefreshExpiresAt time.Time     `json:"refreshExpiresAt"`
+	User             *UserResponse `json:"user"`
+}
+
+// ApiKeyResponse describes a key without the key itself, which is shown once on issue.
+type ApiKeyResponse struct {
+	Id            uuid.UUID  `json:"id"`
+	Name          string     `json:"name"`
+	Prefix        string     `json:"prefix"`
+	PostId        *uuid.UUID `json:"postId"`
+	Permissions   []string   `json:"permissions"`
+	CreatedBy     *uuid.UUID `json:"createdBy"`
+	CreatedAt     time.Time  `json:"createdAt"`
+	ExpiresAt     *time.Time `json:"expiresAt"`
+	RevokedAt     *time.Time `json:"revokedAt"`
+	LastUsedAt    *time.Time `json:"lastUsedAt"`
+	LastRequestId *string    `json:"lastRequestId"`
+	ReplacedBy    *uuid.UUID `json:"replacedBy"`
+	Usable        bool       `json:"usable"`
+}
+
+func NewApiKeyResponse(key *model.ApiKey, now time.Time) *ApiKeyResponse {
+	return &ApiKeyResponse{
+		Id:            key.Id,
+		Name:          key.Name,
+		Prefix:        key.Prefix,
+		PostId:        key.PostId,
+		Permissions:   key.Permissions,
+		CreatedBy:     key.CreatedBy,
+		CreatedAt:     key.CreatedAt,
+		ExpiresAt:     key.ExpiresAt,
+		RevokedAt:     key.RevokedAt,
+		LastUsedAt:    key.LastUsedAt,
+		LastRequestId: key.LastRequestId,
+		ReplacedBy:    key.ReplacedBy,
+		Usable:        key.Usable(now),
+	}
+}
+
+func NewApiKeysResponse(keys []model.ApiKey, now time.Time) []*ApiKeyResponse {
+	data := make([]*ApiKeyResponse, 0, len(keys))
+	for i := range keys {
+		data = append(data, NewApiKeyResponse(&keys[i], now))
+	}
+	return data
+}
+
+// IssuedApiKeyResponse is returned when a key is issued or rotated, the only time Key can be read.
+type IssuedApiKeyResponse struct {
+	*ApiKeyResponse
+	Key string `json:"key"`
+}
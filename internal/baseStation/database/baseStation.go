@@ -2,15 +2,23 @@ package database
 
 import (
 	"context"
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	cluster "github.com/aliakseiz/gocluster"
+	"github.com/gofrs/uuid"
 	"github.com/jmoiron/sqlx"
+	"go.opentelemetry.io/otel/attribute"
 	"log"
 	"simpleServer/dbutils"
 	"simpleServer/internal/baseStation/model"
 	"simpleServer/internal/cache"
+	campaignDB "simpleServer/internal/campaign/database"
 	"simpleServer/pkg/logging"
+	"simpleServer/pkg/metrics"
+	"simpleServer/pkg/trace"
+	"time"
 )
 
 type BaseStationDB interface {
@@ -31,6 +39,8 @@ type BaseStationDB interface {
 	GetAllOperators(ctx context.Context) ([]string, error)
 
 	Fetch(ctx context.Context) ([]model.BaseStation, error)
+
+	GetSignalStats(ctx context.Context, id uint64, q *model.SignalQuery) (*model.SignalStats, error)
 }
 
 type baseStationDB struct {
@@ -67,8 +77,11 @@ type ZoomInfo struct {
 	SE   []float64 `json:"se"`
 }
 
-func createCluster(baseStations []model.BaseStation) *cluster.Cluster {
+func createCluster(ctx context.Context, baseStations []model.BaseStation) *cluster.Cluster {
 	fmt.Println("generating clusters")
+	_, span := trace.Start(ctx, "cluster.build", attribute.Int("cluster.points", len(baseStations)))
+	defer span.End()
+	defer func(start time.Time) { metrics.Default().ClusterBuild.Observe(time.Since(start).Seconds()) }(time.Now())
 
 	coords := make([]cluster.GeoPoint, len(baseStations))
 	for i := range baseStations {
@@ -97,7 +110,7 @@ func NewBaseStationDB(dbh *sqlx.DB, cacheProvider cache.ICacheProvider) BaseStat
 	}
 	baseStations, err := dbObtain.Fetch(ctx)
 	if err == nil {
-		dbObtain.clusterProvider = createCluster(baseStations)
+		dbObtain.clusterProvider = createCluster(ctx, baseStations)
 	}
 	return dbObtain
 }
@@ -311,7 +324,11 @@ func (bs *baseStationDB) GetClusters(ctx context.Context, n float64, w float64,
 	} else {
 		nw := latLng{Lat: n, Lng: w}
 		se := latLng{Lat: s, Lng: e}
+		_, span := trace.Start(ctx, "cluster.query", attribute.Int("cluster.zoom", int(zoom)),
+			attribute.Float64Slice("cluster.bbox", []float64{n, w, s, e}))
 		points, _ = bs.clusterProvider.GetClusters(nw, se, int(zoom), -1)
+		span.SetAttributes(attribute.Int("cluster.points", len(points)))
+		span.End()
 	}
 	zoomInfo = &ZoomInfo{
 		Zoom: int(zoom),
@@ -414,6 +431,87 @@ func (bs *baseStationDB) GetAllOperators(ctx context.Context) ([]string, error)
 	return operators, nil
 }
 
+// signalSamples selects the samples of the cells registered on the station, matched by arfcn, cid and lac/tac,
+// only the ones of the campaign unless campaignId is nil.
+func signalSamples(campaignId *uuid.UUID) string {
+	return `with samples as (
+		select GH.dbm, coalesce(GH.time, GPS.time) as time, GPS.post_id, GPS.coordinates, BS.coordinates as station
+		from "BsInfo" BI
+		inner join "BaseStations" BS on BS.id = BI.bs
+		inner join "GsmData" GD on GD.arfcn = BI.arfcn and GD.cid = BI.cid and GD.lac_tac = BI.lac_tac
+		inner join "GsmHistory" GH on GH.gsm = GD.id
+		inner join "GpsData" GPS on GPS.id = GH.gps
+		where BI.bs = :Bs
+		and (:AnySector or BI.sector_number = :Sector)
+		and GH.dbm is not null
+		and GPS.time >= :From and GPS.time < :To` + campaignDB.Filter("GPS", campaignId) + `
+	)`
+}
+
+func (bs *baseStationDB) GetSignalStats(ctx context.Context, id uint64, q *model.SignalQuery) (*model.SignalStats, error) {
+	logger := logging.FromContext(ctx)
+	logger.Debugw("base station signal stats", "id", id, "bucket", q.Bucket, "sector", q.Sector, "campaignId", q.CampaignId)
+	args := map[string]interface{}{
+		"Bs":         id,
+		"AnySector":  q.AnySector(),
+		"Sector":     q.Sector,
+		"From":       q.From,
+		"To":         q.To,
+		"Bucket":     q.Bucket,
+		"Width":      q.HistogramWidth,
+		"CampaignId": q.CampaignId,
+	}
+	stats := &model.SignalStats{}
+
+	query := signalSamples(q.CampaignId) + `
+		select date_trunc(:Bucket, time) as start,
+			count(*) as samples,
+			cast(min(dbm) as float8) as min,
+			cast(max(dbm) as float8) as max,
+			cast(avg(dbm) as float8) as avg,
+			cast(percentile_cont(0.1) within group (order by dbm) as float8) as p10,
+			cast(percentile_cont(0.5) within group (order by dbm) as float8) as p50,
+			cast(percentile_cont(0.9) within group (order by dbm) as float8) as p90,
+			cast(array_to_json(array_agg(distinct post_id)) as text) as posts
+		from samples
+		group by 1
+		order by 1`
+	if err := dbutils.NamedSelect(ctx, bs.dbh, &stats.Buckets, query, args); err != nil {
+		return nil, err
+	}
+	for i := range stats.Buckets {
+		if err := json.Unmarshal([]byte(stats.Buckets[i].Posts), &stats.Buckets[i].PostIds); err != nil {
+			return nil, fmt.Errorf("decode posts of bucket %s: %w", stats.Buckets[i].Start, err)
+		}
+	}
+
+	query = signalSamples(q.CampaignId) + `
+		select cast(floor(dbm / cast(:Width as float8)) * :Width as integer) as from_dbm, count(*) as count
+		from samples
+		group by 1
+		order by 1`
+	if err := dbutils.NamedSelect(ctx, bs.dbh, &stats.Histogram, query, args); err != nil {
+		return nil, err
+	}
+
+	query = signalSamples(q.CampaignId) + `
+		select cast(st_distance(cast(station as geography), cast(coordinates as geography)) as float8) as distance,
+			cast(dbm as float8) as dbm, time, post_id, st_asewkb(coordinates) as coordinates
+		from samples
+		order by distance desc
+		limit 1`
+	var cellRange model.CellRange
+	err := dbutils.NamedGet(ctx, bs.dbh, &cellRange, query, args)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+	case err != nil:
+		return nil, err
+	default:
+		stats.Range = &cellRange
+	}
+	return stats, nil
+}
+
 const (
 	cacheKeyBsById          = "bs-by-id"
 	cacheKeyClusterByCoords = "cluster-by-coords"
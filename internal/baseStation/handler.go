@@ -6,21 +6,30 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/go-playground/validator/v10"
 	"net/http"
+	"simpleServer/internal/auth"
+	authModel "simpleServer/internal/auth/model"
 	"simpleServer/internal/baseStation/database"
+	"simpleServer/internal/baseStation/model"
+	"simpleServer/internal/campaign"
+	campaignDB "simpleServer/internal/campaign/database"
 	"simpleServer/internal/config"
 	"simpleServer/internal/middleware"
 	"simpleServer/internal/middleware/handler"
+	"simpleServer/internal/ratelimit"
 	"simpleServer/pkg/logging"
 	"simpleServer/pkg/validate"
+	"time"
 )
 
 type Handler struct {
 	baseStationDB database.BaseStationDB
+	campaignDB    campaignDB.CampaignDB
 }
 
-func NewHandler(baseStationDB database.BaseStationDB) *Handler {
+func NewHandler(baseStationDB database.BaseStationDB, campaigns campaignDB.CampaignDB) *Handler {
 	return &Handler{
 		baseStationDB: baseStationDB,
+		campaignDB:    campaigns,
 	}
 }
 
@@ -200,12 +209,63 @@ func (h *Handler) GetOperatorsListByBsId(c *gin.Context) {
 	})
 }
 
-func RouteV1(cfg *config.Config, h *Handler, r *gin.Engine) {
+// GetSignalStats returns the levels the station, or one of its sectors, was received with over time. With
+// campaign only the samples of that campaign are kept.
+func (h *Handler) GetSignalStats(c *gin.Context) {
+	handler.HandleRequest(c, func(c *gin.Context) *handler.Response {
+		logger := logging.FromContext(c)
+		type RequestUri struct {
+			Id uint64 `uri:"id"`
+		}
+		type RequestQuery struct {
+			Sector   *int16    `form:"sector"`
+			Bucket   string    `form:"bucket"`
+			From     time.Time `form:"from" time_format:"2006-01-02T15:04:05Z07:00"`
+			To       time.Time `form:"to" time_format:"2006-01-02T15:04:05Z07:00"`
+			Width    int       `form:"histogramWidth"`
+			Campaign string    `form:"campaign" binding:"omitempty,uuid"`
+		}
+		var uri RequestUri
+		if err := c.ShouldBindUri(&uri); err != nil {
+			logger.Errorw("baseStations.GetSignalStats failed to bind", "err", err)
+			var details []*validate.ValidationErrDetail
+			if vErrs, ok := err.(validator.ValidationErrors); ok {
+				details = validate.ValidationErrorDetails(&uri, "uri", vErrs)
+			}
+			return handler.NewErrorResponse(http.StatusBadRequest, handler.InvalidUriValue, "invalid id", details)
+		}
+		var query RequestQuery
+		if err := c.ShouldBindQuery(&query); err != nil {
+			var details []*validate.ValidationErrDetail
+			if vErrs, ok := err.(validator.ValidationErrors); ok {
+				details = validate.ValidationErrorDetails(&query, "form", vErrs)
+			}
+			return handler.NewErrorResponse(http.StatusBadRequest, handler.InvalidQueryValue, "invalid signal query", details)
+		}
+		signalQuery, err := model.NewSignalQuery(query.Sector, query.Bucket, query.From, query.To, query.Width)
+		if err != nil {
+			return handler.NewErrorResponse(http.StatusBadRequest, handler.InvalidQueryValue, err.Error(), nil)
+		}
+		var res *handler.Response
+		if signalQuery.CampaignId, res = campaign.FilterId(c.Request.Context(), h.campaignDB, query.Campaign); res != nil {
+			return res
+		}
+
+		stats, err := h.baseStationDB.GetSignalStats(c.Request.Context(), uri.Id, signalQuery)
+		if err != nil {
+			logger.Errorw("baseStations.GetSignalStats failed", "err", err)
+			return handler.NewInternalErrorResponse(err)
+		}
+		return handler.NewSuccessResponse(http.StatusOK, NewSignalStatsResponse(stats, signalQuery))
+	})
+}
+
+func RouteV1(cfg *config.Config, h *Handler, a *auth.Authenticator, l *ratelimit.Limiter, r *gin.Engine) {
 	v1 := r.Group("v1/api")
 	v1.Use(middleware.CorsMiddleware(), middleware.RequestIDMiddleware(), middleware.TimeoutMiddleware(cfg.ServerConfig.WriteTimeout))
 
 	baseStationV1 := v1.Group("baseStations")
-	baseStationV1.Use()
+	baseStationV1.Use(a.Authenticate(), a.Require(authModel.PermissionRead), l.Limit("baseStations"))
 	{
 		baseStationV1.GET("/nw/:n/:w/se/:s/:e/zoom/:zoom", h.GetClusters)
 		baseStationV1.GET("/id/:id", h.GetBaseStationById)
@@ -213,5 +273,6 @@ func RouteV1(cfg *config.Config, h *Handler, r *gin.Engine) {
 		baseStationV1.GET("/operatorsListByBs/:id", h.GetOperatorsListByBsId)
 		baseStationV1.GET("/allOperators", h.GetAllOperators)
 		baseStationV1.GET("/getBsInfoById/id/:id", h.GetBsInfoById)
+		baseStationV1.GET("/id/:id/signal", h.GetSignalStats)
 	}
 }
@@ -0,0 +1,117 @@
+package model
+
+import (
+	"fmt"
+	"github.com/gofrs/uuid"
+	"github.com/twpayne/go-geom/encoding/ewkb"
+	"time"
+)
+
+const (
+	BucketHour = "hour"
+	BucketDay  = "day"
+	BucketWeek = "week"
+)
+
+const (
+	defaultSignalPeriod         = 30 * 24 * time.Hour
+	defaultHistogramWidth       = 5
+	maxSignalBuckets            = 5000
+	anySector             int16 = -1
+)
+
+var bucketDurations = map[string]time.Duration{
+	BucketHour: time.Hour,
+	BucketDay:  24 * time.Hour,
+	BucketWeek: 7 * 24 * time.Hour,
+}
+
+// SignalQuery selects the samples of a station, or of one of its sectors, received between From and To.
+type SignalQuery struct {
+	Sector int16
+	Bucket string
+	From   time.Time
+	To     time.Time
+	// HistogramWidth is the width of histogram bins in dB.
+	HistogramWidth int
+	// CampaignId keeps only the samples of that campaign.
+	CampaignId *uuid.UUID
+}
+
+// NewSignalQuery fills defaults: the last 30 days in daily buckets over all sectors.
+func NewSignalQuery(sector *int16, bucket string, from, to time.Time, histogramWidth int) (*SignalQuery, error) {
+	q := &SignalQuery{Sector: anySector, Bucket: bucket, From: from, To: to, HistogramWidth: histogramWidth}
+	if sector != nil {
+		if *sector < 0 {
+			return nil, fmt.Errorf("negative sector number")
+		}
+		q.Sector = *sector
+	}
+	if q.Bucket == "" {
+		q.Bucket = BucketDay
+	}
+	duration, ok := bucketDurations[q.Bucket]
+	if !ok {
+		return nil, fmt.Errorf("unknown bucket %q", bucket)
+	}
+	if q.To.IsZero() {
+		q.To = time.Now()
+	}
+	if q.From.IsZero() {
+		q.From = q.To.Add(-defaultSignalPeriod)
+	}
+	if !q.From.Before(q.To) {
+		return nil, fmt.Errorf("from must be before to")
+	}
+	if q.To.Sub(q.From)/duration > maxSignalBuckets {
+		return nil, fmt.Errorf("range holds more than %d %s buckets", maxSignalBuckets, q.Bucket)
+	}
+	if q.HistogramWidth == 0 {
+		q.HistogramWidth = defaultHistogramWidth
+	}
+	if q.HistogramWidth < 0 {
+		return nil, fmt.Errorf("negative histogram width")
+	}
+	return q, nil
+}
+
+// AnySector tells if samples of all sectors of the station are taken.
+func (q *SignalQuery) AnySector() bool {
+	return q.Sector == anySector
+}
+
+type SignalBucket struct {
+	Start   time.Time `db:"start"`
+	Samples int       `db:"samples"`
+	Min     float64   `db:"min"`
+	Max     float64   `db:"max"`
+	Avg     float64   `db:"avg"`
+	P10     float64   `db:"p10"`
+	P50     float64   `db:"p50"`
+	P90     float64   `db:"p90"`
+	// Posts is a json array of the ids of posts that took the samples.
+	Posts   string      `db:"posts"`
+	PostIds []uuid.UUID `db:"-"`
+}
+
+// HistogramBin counts samples from From inclusive to From plus the bin width.
+type HistogramBin struct {
+	From  int `db:"from_dbm"`
+	Count int `db:"count"`
+}
+
+// CellRange is the farthest sample from the station.
+type CellRange struct {
+	Distance    float64    `db:"distance"`
+	Dbm         float64    `db:"dbm"`
+	Time        time.Time  `db:"time"`
+	PostId      uuid.UUID  `db:"post_id"`
+	Coordinates ewkb.Point `db:"coordinates"`
+}
+
+type SignalStats struct {
+	Buckets   []SignalBucket
+	Histogram []HistogramBin
+	// Range is nil when there are no samples.
+	Range *CellRange
+}
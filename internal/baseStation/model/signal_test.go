@@ -0,0 +1,31 @@
+package model
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestNewSignalQuery(t *testing.T) {
+	q, err := NewSignalQuery(nil, "", time.Time{}, time.Time{}, 0)
+	require.NoError(t, err)
+	assert.Equal(t, BucketDay, q.Bucket)
+	assert.True(t, q.AnySector())
+	assert.Equal(t, 30*24*time.Hour, q.To.Sub(q.From))
+	assert.Equal(t, 5, q.HistogramWidth)
+
+	sector := int16(2)
+	to := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	q, err = NewSignalQuery(&sector, BucketHour, to.Add(-48*time.Hour), to, 10)
+	require.NoError(t, err)
+	assert.False(t, q.AnySector())
+	assert.Equal(t, int16(2), q.Sector)
+
+	_, err = NewSignalQuery(nil, "month", time.Time{}, time.Time{}, 0)
+	assert.Error(t, err)
+	_, err = NewSignalQuery(nil, BucketHour, to.Add(-365*24*time.Hour), to, 0)
+	assert.Error(t, err, "too many hourly buckets")
+	_, err = NewSignalQuery(nil, BucketWeek, to, to.Add(-time.Hour), 0)
+	assert.Error(t, err, "reversed range")
+}
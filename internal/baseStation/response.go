@@ -4,6 +4,7 @@ import (
 	cluster "github.com/aliakseiz/gocluster"
 	"github.com/gofrs/uuid"
 	"simpleServer/internal/baseStation/model"
+	"time"
 )
 
 type PointInfo struct {
@@ -99,3 +100,76 @@ func NewBsInfoResponse(bsInfo []model.BsInfo) []interface{} {
 	}
 	return data
 }
+
+type SignalBucket struct {
+	Start   time.Time   `json:"start"`
+	Samples int         `json:"samples"`
+	Min     float64     `json:"min"`
+	Max     float64     `json:"max"`
+	Avg     float64     `json:"avg"`
+	P10     float64     `json:"p10"`
+	P50     float64     `json:"p50"`
+	P90     float64     `json:"p90"`
+	Posts   []uuid.UUID `json:"posts"`
+}
+
+type HistogramBin struct {
+	From  int `json:"from"`
+	To    int `json:"to"`
+	Count int `json:"count"`
+}
+
+type CellRange struct {
+	Distance    float64   `json:"distance"`
+	Dbm         float64   `json:"dbm"`
+	Time        time.Time `json:"time"`
+	PostId      uuid.UUID `json:"postId"`
+	Coordinates []float64 `json:"coordinates"`
+}
+
+type SignalStatsResponse struct {
+	Bucket    string         `json:"bucket"`
+	From      time.Time      `json:"from"`
+	To        time.Time      `json:"to"`
+	Samples   int            `json:"samples"`
+	Buckets   []SignalBucket `json:"buckets"`
+	Histogram []HistogramBin `json:"histogram"`
+	Range     *CellRange     `json:"range"`
+}
+
+func NewSignalStatsResponse(stats *model.SignalStats, q *model.SignalQuery) *SignalStatsResponse {
+	res := &SignalStatsResponse{
+		Bucket:    q.Bucket,
+		From:      q.From,
+		To:        q.To,
+		Buckets:   make([]SignalBucket, 0, len(stats.Buckets)),
+		Histogram: make([]HistogramBin, 0, len(stats.Histogram)),
+	}
+	for _, b := range stats.Buckets {
+		res.Samples += b.Samples
+		res.Buckets = append(res.Buckets, SignalBucket{
+			Start:   b.Start,
+			Samples: b.Samples,
+			Min:     b.Min,
+			Max:     b.Max,
+			Avg:     b.Avg,
+			P10:     b.P10,
+			P50:     b.P50,
+			P90:     b.P90,
+			Posts:   b.PostIds,
+		})
+	}
+	for _, bin := range stats.Histogram {
+		res.Histogram = append(res.Histogram, HistogramBin{From: bin.From, To: bin.From + q.HistogramWidth, Count: bin.Count})
+	}
+	if stats.Range != nil {
+		res.Range = &CellRange{
+			Distance:    stats.Range.Distance,
+			Dbm:         stats.Range.Dbm,
+			Time:        stats.Range.Time,
+			PostId:      stats.Range.PostId,
+			Coordinates: []float64{stats.Range.Coordinates.X(), stats.Range.Coordinates.Y()},
+		}
+	}
+	return res
+}
@@ -5,8 +5,12 @@ import (
 	"fmt"
 	"github.com/go-redis/cache/v8"
 	"github.com/go-redis/redis/v8"
+	"go.opentelemetry.io/otel/attribute"
+	oteltrace "go.opentelemetry.io/otel/trace"
 	"simpleServer/internal/config"
 	"simpleServer/pkg/logging"
+	"simpleServer/pkg/metrics"
+	"simpleServer/pkg/trace"
 	"strings"
 	"time"
 )
@@ -53,13 +57,22 @@ func (r *RedisCacheProvider) Fetch(ctx context.Context, key string, value interf
 		TTL:            r.ttl,
 		SkipLocalCache: true,
 	}
+	missed := false
 	if fetchFunc != nil {
 		item.Do = func(item *cache.Item) (interface{}, error) {
+			missed = true
 			return fetchFunc()
 		}
 	}
 
-	return r.cache.Once(&item)
+	err := r.cache.Once(&item)
+	switch {
+	case missed || err == cache.ErrCacheMiss:
+		observeLookup("fetch", ErrCacheMiss)
+	default:
+		observeLookup("fetch", err)
+	}
+	return err
 }
 
 func (r *RedisCacheProvider) Get(ctx context.Context, key string, value interface{}) error {
@@ -67,8 +80,11 @@ func (r *RedisCacheProvider) Get(ctx context.Context, key string, value interfac
 		return ErrInvalidKey
 	}
 	if err := r.cache.Get(ctx, r.computeKey(key), value); err != nil {
-		return r.wrapError(err)
+		err = r.wrapError(err)
+		observeLookup("get", err)
+		return err
 	}
+	observeLookup("get", nil)
 	return nil
 }
 
@@ -109,6 +125,11 @@ func (r *RedisCacheProvider) Delete(ctx context.Context, key string) error {
 	return nil
 }
 
+// Client is the redis client behind the cache, for features that need more than key/value access.
+func (r *RedisCacheProvider) Client() redis.UniversalClient {
+	return r.cli
+}
+
 func (r *RedisCacheProvider) Close() error {
 	if r.cli != nil {
 		return r.cli.Close()
@@ -116,6 +137,18 @@ func (r *RedisCacheProvider) Close() error {
 	return nil
 }
 
+// observeLookup counts a lookup as a hit, a miss or an error.
+func observeLookup(operation string, err error) {
+	result := "hit"
+	switch {
+	case err == ErrCacheMiss:
+		result = "miss"
+	case err != nil:
+		result = "error"
+	}
+	metrics.Default().CacheLookups.WithLabelValues(operation, result).Inc()
+}
+
 func (r *RedisCacheProvider) computeKey(key string) string {
 	return r.prefix + key
 }
@@ -137,7 +170,64 @@ func (r *RedisCacheProvider) wrapError(err error) error {
 	return err
 }
 
+// tracingHook runs every redis command in a span, pipelines in one span for all their commands. Arguments
+// are left out as they carry cached values.
+type tracingHook struct{}
+
+var _ redis.Hook = tracingHook{}
+
+type spanKey struct{}
+
+func (tracingHook) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
+	ctx, span := trace.Start(ctx, "redis."+cmd.FullName(),
+		attribute.String("db.system", "redis"),
+		attribute.String("db.operation", cmd.FullName()))
+	return context.WithValue(ctx, spanKey{}, span), nil
+}
+
+func (tracingHook) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
+	if span, ok := ctx.Value(spanKey{}).(oteltrace.Span); ok {
+		err := cmd.Err()
+		if err == redis.Nil {
+			err = nil
+		}
+		trace.End(span, err)
+	}
+	return nil
+}
+
+func (tracingHook) BeforeProcessPipeline(ctx context.Context, cmds []redis.Cmder) (context.Context, error) {
+	names := make([]string, len(cmds))
+	for i, cmd := range cmds {
+		names[i] = cmd.FullName()
+	}
+	ctx, span := trace.Start(ctx, "redis.pipeline",
+		attribute.String("db.system", "redis"),
+		attribute.StringSlice("db.operations", names))
+	return context.WithValue(ctx, spanKey{}, span), nil
+}
+
+func (tracingHook) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
+	if span, ok := ctx.Value(spanKey{}).(oteltrace.Span); ok {
+		var err error
+		for _, cmd := range cmds {
+			if cmdErr := cmd.Err(); cmdErr != nil && cmdErr != redis.Nil {
+				err = cmdErr
+				break
+			}
+		}
+		trace.End(span, err)
+	}
+	return nil
+}
+
 func openRedisCli(conf *config.Config) redis.UniversalClient {
+	cli := newRedisCli(conf)
+	cli.AddHook(tracingHook{})
+	return cli
+}
+
+func newRedisCli(conf *config.Config) redis.UniversalClient {
 	var (
 		rconf = conf.CacheConfig.RedisConfig
 	)
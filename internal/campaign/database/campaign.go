@@ -0,0 +1,250 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/gofrs/uuid"
+	"github.com/jmoiron/sqlx"
+	"simpleServer/dbutils"
+	"simpleServer/internal/campaign/model"
+	"simpleServer/pkg/logging"
+)
+
+var (
+	ErrCampaignNotFound = errors.New("campaign not found")
+	ErrUnknownPost      = errors.New("unknown post")
+)
+
+type CampaignDB interface {
+	GetCampaigns(ctx context.Context) ([]model.Campaign, error)
+
+	GetCampaign(ctx context.Context, id uuid.UUID) (*model.Campaign, error)
+
+	CreateCampaign(ctx context.Context, input *model.CampaignInput) (*model.Campaign, error)
+
+	// UpdateCampaign replaces the campaign with its posts.
+	UpdateCampaign(ctx context.Context, id uuid.UUID, input *model.CampaignInput) (*model.Campaign, error)
+
+	DeleteCampaign(ctx context.Context, id uuid.UUID) error
+
+	// GetProgress sums up the campaign fixes on a grid of that many degrees.
+	GetProgress(ctx context.Context, id uuid.UUID, grid float64) (*model.Progress, error)
+}
+
+// SampleFilter is the sql condition keeping the fixes of the campaign given by the campaignId expression,
+// gps is the alias of "GpsData". A fix belongs to a campaign when its post takes part in it, it was taken
+// within the window of the post and it lies in the campaign area.
+func SampleFilter(gps, campaignId string) string {
+	return fmt.Sprintf(`exists (
+		select 1 from "CampaignPosts" CFP
+		inner join "Campaigns" CFC on CFC.id = CFP.campaign_id
+		where CFP.campaign_id = %[2]s and CFP.post_id = %[1]s.post_id
+		and %[1]s.time >= coalesce(CFP.starts_at, CFC.starts_at) and %[1]s.time < coalesce(CFP.ends_at, CFC.ends_at)
+		and st_intersects(%[1]s.coordinates, CFC.area)
+	)`, gps, campaignId)
+}
+
+// Filter is SampleFilter of gps for the campaign bound to :CampaignId, as an and condition, or empty when
+// campaignId is nil.
+func Filter(gps string, campaignId *uuid.UUID) string {
+	if campaignId == nil {
+		return ""
+	}
+	return " and " + SampleFilter(gps, ":CampaignId")
+}
+
+type campaignDB struct {
+	dbh *sqlx.DB
+}
+
+func NewCampaignDB(dbh *sqlx.DB) CampaignDB {
+	return &campaignDB{dbh: dbh}
+}
+
+const campaignColumns = `C.id, C.name, C.customer, C.description, st_asgeojson(C.area) as area, C.starts_at, C.ends_at,
+	C.created_at, C.updated_at`
+
+func (d *campaignDB) selectCampaigns(ctx context.Context, db sqlx.ExtContext, filter string, args ...interface{}) ([]model.Campaign, error) {
+	var campaigns []model.Campaign
+	query := `select ` + campaignColumns + ` from "Campaigns" C ` + filter + ` order by C.starts_at desc, C.name`
+	if err := dbutils.Select(ctx, db, &campaigns, query, args...); err != nil {
+		return nil, err
+	}
+	if len(campaigns) == 0 {
+		return campaigns, nil
+	}
+
+	ids := make([]string, len(campaigns))
+	byId := make(map[uuid.UUID]*model.Campaign, len(campaigns))
+	for i := range campaigns {
+		ids[i] = campaigns[i].Id.String()
+		byId[campaigns[i].Id] = &campaigns[i]
+	}
+	var posts []model.CampaignPost
+	query = `select campaign_id, post_id, starts_at, ends_at from "CampaignPosts"
+		where campaign_id = any(cast($1 as uuid[])) order by post_id`
+	if err := dbutils.Select(ctx, db, &posts, query, ids); err != nil {
+		return nil, err
+	}
+	for _, post := range posts {
+		campaign := byId[post.CampaignId]
+		campaign.Posts = append(campaign.Posts, post)
+	}
+	return campaigns, nil
+}
+
+func (d *campaignDB) getCampaign(ctx context.Context, db sqlx.ExtContext, id uuid.UUID) (*model.Campaign, error) {
+	campaigns, err := d.selectCampaigns(ctx, db, `where C.id = $1`, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(campaigns) == 0 {
+		return nil, ErrCampaignNotFound
+	}
+	return &campaigns[0], nil
+}
+
+func (d *campaignDB) GetCampaigns(ctx context.Context) ([]model.Campaign, error) {
+	logger := logging.FromContext(ctx)
+	logger.Debugw("campaign list")
+	return d.selectCampaigns(ctx, d.dbh, "")
+}
+
+func (d *campaignDB) GetCampaign(ctx context.Context, id uuid.UUID) (*model.Campaign, error) {
+	return d.getCampaign(ctx, d.dbh, id)
+}
+
+func campaignArgs(id uuid.UUID, input *model.CampaignInput) map[string]interface{} {
+	return map[string]interface{}{
+		"Id":          id,
+		"Name":        input.Name,
+		"Customer":    input.Customer,
+		"Description": input.Description,
+		"Area":        input.Area,
+		"StartsAt":    input.StartsAt,
+		"EndsAt":      input.EndsAt,
+	}
+}
+
+func setCampaignPosts(ctx context.Context, tx *sqlx.Tx, campaignId uuid.UUID, posts []model.CampaignPost) error {
+	if _, err := dbutils.Exec(ctx, tx, `delete from "CampaignPosts" where campaign_id = $1`, campaignId); err != nil {
+		return err
+	}
+	for _, post := range posts {
+		var exists bool
+		if err := dbutils.Get(ctx, tx, &exists, `select exists(select 1 from "Post" where id = $1)`, post.PostId); err != nil {
+			return err
+		}
+		if !exists {
+			return fmt.Errorf("%w %s", ErrUnknownPost, post.PostId)
+		}
+		query := `insert into "CampaignPosts" (campaign_id, post_id, starts_at, ends_at) values ($1, $2, $3, $4)
+			on conflict (campaign_id, post_id) do update set starts_at = excluded.starts_at, ends_at = excluded.ends_at`
+		if _, err := dbutils.Exec(ctx, tx, query, campaignId, post.PostId, post.StartsAt, post.EndsAt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *campaignDB) CreateCampaign(ctx context.Context, input *model.CampaignInput) (*model.Campaign, error) {
+	logger := logging.FromContext(ctx)
+	logger.Debugw("campaign create", "name", input.Name, "customer", input.Customer)
+	id, err := uuid.NewV4()
+	if err != nil {
+		return nil, err
+	}
+	var created *model.Campaign
+	err = dbutils.RunTx(ctx, d.dbh, func(tx *sqlx.Tx) error {
+		query := `insert into "Campaigns" (id, name, customer, description, area, starts_at, ends_at)
+			values (:Id, :Name, :Customer, :Description, st_multi(st_setsrid(st_geomfromgeojson(:Area), 4326)),
+				:StartsAt, :EndsAt)`
+		if _, err := dbutils.NamedExec(ctx, tx, query, campaignArgs(id, input)); err != nil {
+			return err
+		}
+		if err := setCampaignPosts(ctx, tx, id, input.Posts); err != nil {
+			return err
+		}
+		created, err = d.getCampaign(ctx, tx, id)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return created, nil
+}
+
+func (d *campaignDB) UpdateCampaign(ctx context.Context, id uuid.UUID, input *model.CampaignInput) (*model.Campaign, error) {
+	logger := logging.FromContext(ctx)
+	logger.Debugw("campaign update", "id", id)
+	var updated *model.Campaign
+	err := dbutils.RunTx(ctx, d.dbh, func(tx *sqlx.Tx) error {
+		query := `update "Campaigns"
+			set name = :Name, customer = :Customer, description = :Description,
+				area = st_multi(st_setsrid(st_geomfromgeojson(:Area), 4326)),
+				starts_at = :StartsAt, ends_at = :EndsAt, updated_at = now()
+			where id = :Id`
+		res, err := dbutils.NamedExec(ctx, tx, query, campaignArgs(id, input))
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err == nil && n == 0 {
+			return ErrCampaignNotFound
+		}
+		if err := setCampaignPosts(ctx, tx, id, input.Posts); err != nil {
+			return err
+		}
+		updated, err = d.getCampaign(ctx, tx, id)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return updated, nil
+}
+
+func (d *campaignDB) DeleteCampaign(ctx context.Context, id uuid.UUID) error {
+	logger := logging.FromContext(ctx)
+	logger.Debugw("campaign delete", "id", id)
+	res, err := dbutils.Exec(ctx, d.dbh, `delete from "Campaigns" where id = $1`, id)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrCampaignNotFound
+	}
+	return nil
+}
+
+func (d *campaignDB) GetProgress(ctx context.Context, id uuid.UUID, grid float64) (*model.Progress, error) {
+	logger := logging.FromContext(ctx)
+	logger.Debugw("campaign progress", "id", id, "grid", grid)
+	// every fix covers the grid square around its snapped position, the union of the squares is clipped to
+	// the area so squares on its border count only with their inside part.
+	query := `with fixes as (
+		select GPS.time, st_snaptogrid(GPS.coordinates, :Grid) as square
+		from "GpsData" GPS
+		where GPS.post_id in (select post_id from "CampaignPosts" where campaign_id = :Id)
+		and ` + SampleFilter("GPS", ":Id") + `
+	), squares as (
+		select distinct square from fixes
+	)
+	select cast(:Grid as float8) as grid,
+		st_area(geography(C.area)) as planned_area,
+		coalesce(st_area(geography(st_intersection(C.area,
+			(select st_union(st_expand(st_setsrid(square, 4326), cast(:Grid as float8) / 2)) from squares)))), 0) as covered_area,
+		(select count(*) from squares) as squares,
+		(select count(*) from fixes) as samples,
+		(select max(time) from fixes) as last_sample
+	from "Campaigns" C
+	where C.id = :Id`
+	var progress []model.Progress
+	if err := dbutils.NamedSelect(ctx, d.dbh, &progress, query, map[string]interface{}{"Id": id, "Grid": grid}); err != nil {
+		return nil, err
+	}
+	if len(progress) == 0 {
+		return nil, ErrCampaignNotFound
+	}
+	return &progress[0], nil
+}
@@ -0,0 +1,257 @@
+package campaign
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"github.com/gofrs/uuid"
+	"github.com/twpayne/go-geom"
+	"github.com/twpayne/go-geom/encoding/geojson"
+	"net/http"
+	"simpleServer/internal/auth"
+	authModel "simpleServer/internal/auth/model"
+	"simpleServer/internal/campaign/database"
+	"simpleServer/internal/campaign/model"
+	"simpleServer/internal/config"
+	"simpleServer/internal/middleware"
+	"simpleServer/internal/middleware/handler"
+	"simpleServer/pkg/logging"
+	"simpleServer/pkg/validate"
+	"time"
+)
+
+type Handler struct {
+	campaignDB database.CampaignDB
+}
+
+func NewHandler(db database.CampaignDB) *Handler {
+	return &Handler{campaignDB: db}
+}
+
+func bindId(c *gin.Context) (uuid.UUID, *handler.Response) {
+	id, err := uuid.FromString(c.Param("id"))
+	if err != nil {
+		return uuid.Nil, handler.NewErrorResponse(http.StatusBadRequest, handler.InvalidUriValue, "invalid id in uri",
+			validate.NewValidationErrorDetails("id", "required uuid format", c.Param("id")))
+	}
+	return id, nil
+}
+
+// FilterId resolves the campaign query parameter of a view filtered by campaign, already validated as a uuid.
+// It is nil without the parameter, an unknown campaign answers 404 rather than an empty view.
+func FilterId(ctx context.Context, db database.CampaignDB, value string) (*uuid.UUID, *handler.Response) {
+	if value == "" {
+		return nil, nil
+	}
+	id := uuid.FromStringOrNil(value)
+	if _, err := db.GetCampaign(ctx, id); err != nil {
+		if !errors.Is(err, database.ErrCampaignNotFound) {
+			logging.FromContext(ctx).Errorw("campaign filter failed", "campaignId", id, "err", err)
+		}
+		return nil, campaignErrorResponse(err)
+	}
+	return &id, nil
+}
+
+func campaignErrorResponse(err error) *handler.Response {
+	switch {
+	case errors.Is(err, database.ErrCampaignNotFound):
+		return handler.NewErrorResponse(http.StatusNotFound, handler.NotFoundEntity, "campaign not found", nil)
+	case errors.Is(err, database.ErrUnknownPost):
+		return handler.NewErrorResponse(http.StatusBadRequest, handler.InvalidBodyValue, err.Error(),
+			validate.NewValidationErrorDetails("posts", "existing post ids", ""))
+	}
+	return handler.NewInternalErrorResponse(err)
+}
+
+// bindCampaign reads a campaign body, area must be a GeoJSON Polygon or MultiPolygon in WGS 84 and every
+// window must end after it starts.
+func bindCampaign(c *gin.Context) (*model.CampaignInput, *handler.Response) {
+	type RequestPost struct {
+		PostId   uuid.UUID  `json:"postId" binding:"required"`
+		StartsAt *time.Time `json:"startsAt"`
+		EndsAt   *time.Time `json:"endsAt"`
+	}
+	type RequestBody struct {
+		Name        string          `json:"name" binding:"required"`
+		Customer    string          `json:"customer"`
+		Description string          `json:"description"`
+		Area        json.RawMessage `json:"area" binding:"required"`
+		StartsAt    time.Time       `json:"startsAt" binding:"required"`
+		EndsAt      time.Time       `json:"endsAt" binding:"required"`
+		Posts       []RequestPost   `json:"posts" binding:"dive"`
+	}
+	var body RequestBody
+	if err := c.ShouldBindJSON(&body); err != nil {
+		var details []*validate.ValidationErrDetail
+		if vErrs, ok := err.(validator.ValidationErrors); ok {
+			details = validate.ValidationErrorDetails(&body, "json", vErrs)
+		}
+		return nil, handler.NewErrorResponse(http.StatusBadRequest, handler.InvalidBodyValue, "invalid campaign", details)
+	}
+	var area geom.T
+	if err := geojson.Unmarshal(body.Area, &area); err != nil || area.Empty() {
+		return nil, invalidAreaResponse()
+	}
+	switch area.(type) {
+	case *geom.Polygon, *geom.MultiPolygon:
+	default:
+		return nil, invalidAreaResponse()
+	}
+	if !body.StartsAt.Before(body.EndsAt) {
+		return nil, handler.NewErrorResponse(http.StatusBadRequest, handler.InvalidBodyValue, "campaign ends before it starts",
+			validate.NewValidationErrorDetails("endsAt", "after startsAt", body.EndsAt.Format(time.RFC3339)))
+	}
+	input := &model.CampaignInput{
+		Name:        body.Name,
+		Customer:    body.Customer,
+		Description: body.Description,
+		Area:        string(body.Area),
+		StartsAt:    body.StartsAt,
+		EndsAt:      body.EndsAt,
+		Posts:       make([]model.CampaignPost, len(body.Posts)),
+	}
+	for i, post := range body.Posts {
+		input.Posts[i] = model.CampaignPost{PostId: post.PostId, StartsAt: post.StartsAt, EndsAt: post.EndsAt}
+		from, to := body.StartsAt, body.EndsAt
+		if post.StartsAt != nil {
+			from = *post.StartsAt
+		}
+		if post.EndsAt != nil {
+			to = *post.EndsAt
+		}
+		if !from.Before(to) {
+			return nil, handler.NewErrorResponse(http.StatusBadRequest, handler.InvalidBodyValue, "post window ends before it starts",
+				validate.NewValidationErrorDetails("posts", "window ending after it starts", post.PostId.String()))
+		}
+	}
+	return input, nil
+}
+
+func invalidAreaResponse() *handler.Response {
+	return handler.NewErrorResponse(http.StatusBadRequest, handler.InvalidBodyValue, "invalid area",
+		validate.NewValidationErrorDetails("area", "GeoJSON Polygon or MultiPolygon", ""))
+}
+
+func (h *Handler) GetCampaigns(c *gin.Context) {
+	handler.HandleRequest(c, func(c *gin.Context) *handler.Response {
+		campaigns, err := h.campaignDB.GetCampaigns(c.Request.Context())
+		if err != nil {
+			logging.FromContext(c).Errorw("campaign.GetCampaigns failed", "err", err)
+			return handler.NewInternalErrorResponse(err)
+		}
+		return handler.NewSuccessResponse(http.StatusOK, NewCampaignsResponse(campaigns))
+	})
+}
+
+func (h *Handler) GetCampaign(c *gin.Context) {
+	handler.HandleRequest(c, func(c *gin.Context) *handler.Response {
+		id, res := bindId(c)
+		if res != nil {
+			return res
+		}
+		campaign, err := h.campaignDB.GetCampaign(c.Request.Context(), id)
+		if err != nil {
+			return campaignErrorResponse(err)
+		}
+		return handler.NewSuccessResponse(http.StatusOK, NewCampaignResponse(campaign))
+	})
+}
+
+func (h *Handler) CreateCampaign(c *gin.Context) {
+	handler.HandleRequest(c, func(c *gin.Context) *handler.Response {
+		input, res := bindCampaign(c)
+		if res != nil {
+			return res
+		}
+		campaign, err := h.campaignDB.CreateCampaign(c.Request.Context(), input)
+		if err != nil {
+			logging.FromContext(c).Errorw("campaign.CreateCampaign failed", "err", err)
+			return campaignErrorResponse(err)
+		}
+		return handler.NewSuccessResponse(http.StatusCreated, NewCampaignResponse(campaign))
+	})
+}
+
+func (h *Handler) UpdateCampaign(c *gin.Context) {
+	handler.HandleRequest(c, func(c *gin.Context) *handler.Response {
+		id, res := bindId(c)
+		if res != nil {
+			return res
+		}
+		input, res := bindCampaign(c)
+		if res != nil {
+			return res
+		}
+		campaign, err := h.campaignDB.UpdateCampaign(c.Request.Context(), id, input)
+		if err != nil {
+			logging.FromContext(c).Errorw("campaign.UpdateCampaign failed", "id", id, "err", err)
+			return campaignErrorResponse(err)
+		}
+		return handler.NewSuccessResponse(http.StatusOK, NewCampaignResponse(campaign))
+	})
+}
+
+// DeleteCampaign removes the campaign, its measurements stay with the posts.
+func (h *Handler) DeleteCampaign(c *gin.Context) {
+	handler.HandleRequest(c, func(c *gin.Context) *handler.Response {
+		id, res := bindId(c)
+		if res != nil {
+			return res
+		}
+		if err := h.campaignDB.DeleteCampaign(c.Request.Context(), id); err != nil {
+			logging.FromContext(c).Errorw("campaign.DeleteCampaign failed", "id", id, "err", err)
+			return campaignErrorResponse(err)
+		}
+		return handler.NewSuccessResponse(http.StatusNoContent, nil)
+	})
+}
+
+// GetProgress compares the area measured by the campaign posts with the planned area, on a grid of grid
+// degrees.
+func (h *Handler) GetProgress(c *gin.Context) {
+	handler.HandleRequest(c, func(c *gin.Context) *handler.Response {
+		type RequestQuery struct {
+			Grid float64 `form:"grid" binding:"omitempty,min=0.0001,max=1"`
+		}
+		id, res := bindId(c)
+		if res != nil {
+			return res
+		}
+		var query RequestQuery
+		if err := c.ShouldBindQuery(&query); err != nil {
+			var details []*validate.ValidationErrDetail
+			if vErrs, ok := err.(validator.ValidationErrors); ok {
+				details = validate.ValidationErrorDetails(&query, "form", vErrs)
+			}
+			return handler.NewErrorResponse(http.StatusBadRequest, handler.InvalidQueryValue, "invalid grid", details)
+		}
+		if query.Grid == 0 {
+			query.Grid = model.DefaultProgressGrid
+		}
+		progress, err := h.campaignDB.GetProgress(c.Request.Context(), id, query.Grid)
+		if err != nil {
+			logging.FromContext(c).Errorw("campaign.GetProgress failed", "id", id, "err", err)
+			return campaignErrorResponse(err)
+		}
+		return handler.NewSuccessResponse(http.StatusOK, NewProgressResponse(id, progress))
+	})
+}
+
+func RouteV1(cfg *config.Config, h *Handler, a *auth.Authenticator, r *gin.Engine) {
+	v1 := r.Group("v1/api")
+	v1.Use(middleware.CorsMiddleware(), middleware.RequestIDMiddleware(), middleware.TimeoutMiddleware(cfg.ServerConfig.WriteTimeout))
+
+	campaignV1 := v1.Group("campaigns")
+	campaignV1.Use(a.Authenticate(), a.Require(authModel.PermissionRead))
+	{
+		campaignV1.GET("", h.GetCampaigns)
+		campaignV1.POST("", a.Require(authModel.PermissionAnalyze), h.CreateCampaign)
+		campaignV1.GET("/:id", h.GetCampaign)
+		campaignV1.PUT("/:id", a.Require(authModel.PermissionAnalyze), h.UpdateCampaign)
+		campaignV1.DELETE("/:id", a.Require(authModel.PermissionAnalyze), h.DeleteCampaign)
+		campaignV1.GET("/:id/progress", h.GetProgress)
+	}
+}
@@ -0,0 +1,42 @@
+package campaign
+
+import (
+	"context"
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"simpleServer/internal/campaign/database"
+	"simpleServer/internal/campaign/model"
+	"testing"
+)
+
+// knownCampaignDB only knows the campaign id.
+type knownCampaignDB struct {
+	database.CampaignDB
+	id uuid.UUID
+}
+
+func (d *knownCampaignDB) GetCampaign(_ context.Context, id uuid.UUID) (*model.Campaign, error) {
+	if id != d.id {
+		return nil, database.ErrCampaignNotFound
+	}
+	return &model.Campaign{Id: id}, nil
+}
+
+func TestFilterId(t *testing.T) {
+	db := &knownCampaignDB{id: uuid.Must(uuid.NewV4())}
+
+	id, res := FilterId(context.Background(), db, "")
+	assert.Nil(t, id)
+	assert.Nil(t, res)
+
+	id, res = FilterId(context.Background(), db, db.id.String())
+	require.Nil(t, res)
+	assert.Equal(t, db.id, *id)
+
+	id, res = FilterId(context.Background(), db, uuid.Must(uuid.NewV4()).String())
+	assert.Nil(t, id)
+	require.NotNil(t, res)
+	assert.Equal(t, http.StatusNotFound, res.StatusCode)
+}
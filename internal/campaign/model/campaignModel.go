@@ -0,0 +1,83 @@
+package model
+
+import (
+	"github.com/gofrs/uuid"
+	"time"
+)
+
+// DefaultProgressGrid is the size in degrees of the squares a fix marks as covered, about 100 m.
+const DefaultProgressGrid = 0.001
+
+type Campaign struct {
+	Id          uuid.UUID `db:"id"`
+	Name        string    `db:"name"`
+	Customer    string    `db:"customer"`
+	Description string    `db:"description"`
+	// Area is the GeoJSON MultiPolygon of the region planned to be measured.
+	Area      string    `db:"area"`
+	StartsAt  time.Time `db:"starts_at"`
+	EndsAt    time.Time `db:"ends_at"`
+	CreatedAt time.Time `db:"created_at"`
+	UpdatedAt time.Time `db:"updated_at"`
+	Posts     []CampaignPost
+}
+
+// CampaignPost is a post taking part in a campaign, nil bounds take the ones of the campaign.
+type CampaignPost struct {
+	CampaignId uuid.UUID  `db:"campaign_id"`
+	PostId     uuid.UUID  `db:"post_id"`
+	StartsAt   *time.Time `db:"starts_at"`
+	EndsAt     *time.Time `db:"ends_at"`
+}
+
+// Window returns the time range the post measures for the campaign, ok is false for posts outside it.
+func (c *Campaign) Window(postId uuid.UUID) (from, to time.Time, ok bool) {
+	for _, post := range c.Posts {
+		if post.PostId != postId {
+			continue
+		}
+		from, to = c.StartsAt, c.EndsAt
+		if post.StartsAt != nil {
+			from = *post.StartsAt
+		}
+		if post.EndsAt != nil {
+			to = *post.EndsAt
+		}
+		return from, to, true
+	}
+	return time.Time{}, time.Time{}, false
+}
+
+// CampaignInput creates or replaces a campaign, Area is a GeoJSON Polygon or MultiPolygon.
+type CampaignInput struct {
+	Name        string
+	Customer    string
+	Description string
+	Area        string
+	StartsAt    time.Time
+	EndsAt      time.Time
+	Posts       []CampaignPost
+}
+
+// Progress compares the part of the campaign area measured so far with the planned one. Areas are in
+// square metres, a fix covers the grid square it falls in.
+type Progress struct {
+	Grid        float64    `db:"grid"`
+	PlannedArea float64    `db:"planned_area"`
+	CoveredArea float64    `db:"covered_area"`
+	Squares     int        `db:"squares"`
+	Samples     int        `db:"samples"`
+	LastSample  *time.Time `db:"last_sample"`
+}
+
+// Share is the covered part of the planned area.
+func (p *Progress) Share() float64 {
+	if p.PlannedArea <= 0 {
+		return 0
+	}
+	share := p.CoveredArea / p.PlannedArea
+	if share > 1 {
+		share = 1
+	}
+	return share
+}
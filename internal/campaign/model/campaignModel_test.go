@@ -0,0 +1,40 @@
+package model
+
+import (
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestCampaignWindow(t *testing.T) {
+	start := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	end := start.AddDate(0, 0, 14)
+	late := start.AddDate(0, 0, 7)
+	vanA, vanB := uuid.Must(uuid.NewV4()), uuid.Must(uuid.NewV4())
+	campaign := &Campaign{
+		StartsAt: start,
+		EndsAt:   end,
+		Posts:    []CampaignPost{{PostId: vanA}, {PostId: vanB, StartsAt: &late}},
+	}
+
+	from, to, ok := campaign.Window(vanA)
+	assert.True(t, ok)
+	assert.Equal(t, start, from)
+	assert.Equal(t, end, to)
+
+	from, to, ok = campaign.Window(vanB)
+	assert.True(t, ok)
+	assert.Equal(t, late, from)
+	assert.Equal(t, end, to)
+
+	_, _, ok = campaign.Window(uuid.Must(uuid.NewV4()))
+	assert.False(t, ok)
+}
+
+func TestProgressShare(t *testing.T) {
+	assert.Zero(t, (&Progress{}).Share())
+	assert.Equal(t, 0.25, (&Progress{PlannedArea: 4e6, CoveredArea: 1e6}).Share())
+	// rounding of the geography areas never shows more than all of it.
+	assert.Equal(t, 1.0, (&Progress{PlannedArea: 4e6, CoveredArea: 4e6 + 1e-6}).Share())
+}
@@ -0,0 +1,79 @@
+package campaign
+
+import (
+	"encoding/json"
+	"github.com/gofrs/uuid"
+	"simpleServer/internal/campaign/model"
+	"time"
+)
+
+type CampaignPostResponse struct {
+	PostId   uuid.UUID  `json:"postId"`
+	StartsAt *time.Time `json:"startsAt"`
+	EndsAt   *time.Time `json:"endsAt"`
+}
+
+type CampaignResponse struct {
+	Id          uuid.UUID               `json:"id"`
+	Name        string                  `json:"name"`
+	Customer    string                  `json:"customer"`
+	Description string                  `json:"description"`
+	Area        json.RawMessage         `json:"area"`
+	StartsAt    time.Time               `json:"startsAt"`
+	EndsAt      time.Time               `json:"endsAt"`
+	Posts       []*CampaignPostResponse `json:"posts"`
+	CreatedAt   time.Time               `json:"createdAt"`
+	UpdatedAt   time.Time               `json:"updatedAt"`
+}
+
+func NewCampaignResponse(campaign *model.Campaign) *CampaignResponse {
+	posts := make([]*CampaignPostResponse, 0, len(campaign.Posts))
+	for _, post := range campaign.Posts {
+		posts = append(posts, &CampaignPostResponse{PostId: post.PostId, StartsAt: post.StartsAt, EndsAt: post.EndsAt})
+	}
+	return &CampaignResponse{
+		Id:          campaign.Id,
+		Name:        campaign.Name,
+		Customer:    campaign.Customer,
+		Description: campaign.Description,
+		Area:        json.RawMessage(campaign.Area),
+		StartsAt:    campaign.StartsAt,
+		EndsAt:      campaign.EndsAt,
+		Posts:       posts,
+		CreatedAt:   campaign.CreatedAt,
+		UpdatedAt:   campaign.UpdatedAt,
+	}
+}
+
+func NewCampaignsResponse(campaigns []model.Campaign) []*CampaignResponse {
+	data := make([]*CampaignResponse, 0, len(campaigns))
+	for i := range campaigns {
+		data = append(data, NewCampaignResponse(&campaigns[i]))
+	}
+	return data
+}
+
+// ProgressResponse areas are in square metres, Share is the covered part of the planned area.
+type ProgressResponse struct {
+	CampaignId  uuid.UUID  `json:"campaignId"`
+	Grid        float64    `json:"grid"`
+	PlannedArea float64    `json:"plannedArea"`
+	CoveredArea float64    `json:"coveredArea"`
+	Share       float64    `json:"share"`
+	Squares     int        `json:"squares"`
+	Samples     int        `json:"samples"`
+	LastSample  *time.Time `json:"lastSample"`
+}
+
+func NewProgressResponse(campaignId uuid.UUID, progress *model.Progress) *ProgressResponse {
+	return &ProgressResponse{
+		CampaignId:  campaignId,
+		Grid:        progress.Grid,
+		PlannedArea: progress.PlannedArea,
+		CoveredArea: progress.CoveredArea,
+		Share:       progress.Share(),
+		Squares:     progress.Squares,
+		Samples:     progress.Samples,
+		LastSample:  progress.LastSample,
+	}
+}
@@ -16,11 +16,21 @@ import (
 )
 
 type Config struct {
-	ServerConfig  ServerConfig  `json:"server"`
-	LoggingConfig LoggingConfig `json:"logging" yaml:"logging"`
-	JWTConfig     JWTConfig     `json:"jwt"`
-	DbConfig      DbConfig      `json:"db"`
-	CacheConfig   CacheConfig   `json:"cache"`
+	ServerConfig     ServerConfig     `json:"server"`
+	LoggingConfig    LoggingConfig    `json:"logging" yaml:"logging"`
+	JWTConfig        JWTConfig        `json:"jwt"`
+	DbConfig         DbConfig         `json:"db"`
+	CacheConfig      CacheConfig      `json:"cache"`
+	IngestConfig     IngestConfig     `json:"ingest"`
+	EstimationConfig EstimationConfig `json:"estimation"`
+	DetectionConfig  DetectionConfig  `json:"detection"`
+	RetentionConfig  RetentionConfig  `json:"retention"`
+	PostConfig       PostConfig       `json:"post"`
+	LiveConfig       LiveConfig       `json:"live"`
+	GeofenceConfig   GeofenceConfig   `json:"geofence"`
+	RateLimitConfig  RateLimitConfig  `json:"rateLimit"`
+	MetricsConfig    MetricsConfig    `json:"metrics"`
+	TracingConfig    TracingConfig    `json:"tracing"`
 }
 
 type ServerConfig struct {
@@ -37,8 +47,17 @@ type LoggingConfig struct {
 }
 
 type JWTConfig struct {
-	Secret      string        `json:"secret"`
+	Secret string `json:"secret"`
+	// SessionTime is how long a sign-in lasts, every refresh token is good for that long.
 	SessionTime time.Duration `json:"sessionTime"`
+	// AccessTime is how long an access token is accepted before it must be refreshed.
+	AccessTime time.Duration `json:"accessTime"`
+	Issuer     string        `json:"issuer"`
+	// Admin is created on startup while there are no users at all, an empty username creates none.
+	Admin struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+	} `json:"admin"`
 }
 
 type DbConfig struct {
@@ -75,6 +94,104 @@ type RedisConfig struct {
 	IdleTimeout  time.Duration `json:"idleTimeout"`
 }
 
+type IngestConfig struct {
+	Tokens       []string `json:"tokens"`
+	MaxBatchSize int      `json:"maxBatchSize"`
+}
+
+type EstimationConfig struct {
+	Enabled  bool          `json:"enabled"`
+	Interval time.Duration `json:"interval"`
+	Method   string        `json:"method"`
+	// MinSamples is the least number of samples a cell needs before its location is estimated.
+	MinSamples int `json:"minSamples"`
+	// MaxSamples limits the strongest samples of a cell taken into account.
+	MaxSamples int `json:"maxSamples"`
+}
+
+type DetectionConfig struct {
+	Enabled  bool          `json:"enabled"`
+	Interval time.Duration `json:"interval"`
+	// Lookback is the window of scans evaluated on every run, it should exceed Interval.
+	Lookback          time.Duration `json:"lookback"`
+	HighPowerDbm      float64       `json:"highPowerDbm"`
+	HighPowerDistance float64       `json:"highPowerDistance"`
+	DuplicateDistance float64       `json:"duplicateDistance"`
+	DowngradeShare    float64       `json:"downgradeShare"`
+	MinEntries        int           `json:"minEntries"`
+}
+
+type RetentionConfig struct {
+	Enabled  bool          `json:"enabled"`
+	Interval time.Duration `json:"interval"`
+	// RollupGrid is the grid size in degrees of daily rollups, fixed once the first day is rolled up.
+	RollupGrid float64 `json:"rollupGrid"`
+	// RawAge is how long raw samples are kept after they are rolled up, 0 keeps them forever.
+	RawAge time.Duration `json:"rawAge"`
+	// ArchiveDir receives purged samples as gzipped csv files, they are dropped when empty.
+	ArchiveDir string `json:"archiveDir"`
+}
+
+type PostConfig struct {
+	// SessionGap splits post tracks into sessions where consecutive fixes are further apart in time.
+	SessionGap time.Duration `json:"sessionGap"`
+}
+
+type GeofenceConfig struct {
+	// Enabled runs the periodic check for silent posts, geofences are evaluated on ingest regardless.
+	Enabled  bool          `json:"enabled"`
+	Interval time.Duration `json:"interval"`
+	// SilenceAfter is how long an active post may send no fix before a silent event is raised.
+	SilenceAfter time.Duration `json:"silenceAfter"`
+}
+
+type LiveConfig struct {
+	// Channel is the redis pub/sub channel positions are fanned out on, after the cache prefix.
+	Channel string `json:"channel"`
+	// BufferSize is how many positions a slow subscriber may fall behind before positions are dropped.
+	BufferSize int `json:"bufferSize"`
+	// KeepAlive is the interval of comments and pings that keep idle streams open through proxies.
+	KeepAlive time.Duration `json:"keepAlive"`
+}
+
+type MetricsConfig struct {
+	Enabled bool `json:"enabled"`
+	// Namespace prefixes the names of all metrics.
+	Namespace string `json:"namespace"`
+	// Path serves the metrics to prometheus, outside of the authenticated api.
+	Path string `json:"path"`
+}
+
+type TracingConfig struct {
+	// Exporter is one of none, stdout and otlp, none still propagates and logs trace ids.
+	Exporter string `json:"exporter"`
+	// Endpoint is the host:port of the OTLP/HTTP collector.
+	Endpoint string `json:"endpoint"`
+	Insecure bool   `json:"insecure"`
+	// SampleRatio is the share of traces started here that are recorded.
+	SampleRatio float64 `json:"sampleRatio"`
+	ServiceName string  `json:"serviceName"`
+}
+
+type RateLimitConfig struct {
+	Enabled bool `json:"enabled"`
+	// Default limits the route groups missing from Groups.
+	Default RateLimit            `json:"default"`
+	Groups  map[string]RateLimit `json:"groups"`
+}
+
+// RateLimit limits the requests of each client, an API key, a user or else an IP, to one route group.
+type RateLimit struct {
+	// Rate is how many requests per second a client may make on average, 0 for no limit.
+	Rate float64 `json:"rate"`
+	// Burst is how many requests a client may make at once after being idle.
+	Burst int `json:"burst"`
+	// Concurrency is how many requests of the group an instance serves at once, 0 for no limit.
+	Concurrency int `json:"concurrency"`
+	// ClientConcurrency is how many of them may come from one client, 0 for no limit.
+	ClientConcurrency int `json:"clientConcurrency"`
+}
+
 func Load(configPath string) (*Config, error) {
 	k := koanf.New(".")
 
@@ -133,14 +250,23 @@ func (c *Config) MarshalJSON() ([]byte, error) {
 	}
 
 	maskKeys := map[string]struct{}{
-		"jwt.secret": {},
+		"jwt.secret":         {},
+		"jwt.admin.password": {},
 	}
+	// list values are flattened into "<key>.<index>", so they are masked by prefix.
+	maskPrefixes := []string{"ingest.tokens."}
 
 	for key, val := range m {
 		if v, ok := val.(string); ok {
 			m[key] = maskPassword(v)
 		}
-		if _, ok := maskKeys[key]; ok {
+		_, masked := maskKeys[key]
+		for _, prefix := range maskPrefixes {
+			if strings.HasPrefix(key, prefix) {
+				masked = true
+			}
+		}
+		if masked {
 			switch v := val.(type) {
 			case string:
 				if v != "" {
@@ -9,6 +9,7 @@ import (
 	"github.com/jackc/pgx/v4/stdlib"
 	"github.com/jmoiron/sqlx"
 	"simpleServer/internal/config"
+	"simpleServer/pkg/metrics"
 )
 
 type pgxLogger struct{}
@@ -41,6 +42,15 @@ func NewDatabase(cfg *config.Config) (*sqlx.DB, error) {
 	if err != nil {
 		return nil, fmt.Errorf("prepare db connection: %w", err)
 	}
+	if err := metrics.Default().RegisterDB(connConfig.Database, dbh.DB); err != nil {
+		return nil, fmt.Errorf("register db metrics: %w", err)
+	}
+
+	if cfg.DbConfig.Migrate.Enable {
+		if err := Migrate(context.Background(), dbh, cfg.DbConfig.Migrate.Dir); err != nil {
+			return nil, fmt.Errorf("migrate db: %w", err)
+		}
+	}
 
 	return dbh, nil
 }
@@ -0,0 +1,70 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"os"
+	"path/filepath"
+	"simpleServer/dbutils"
+	"simpleServer/pkg/logging"
+	"sort"
+	"strings"
+)
+
+const defaultMigrationsDir = "migrations"
+
+// Migrate applies every *.sql file from dir which is not yet recorded in "SchemaMigrations".
+// Files are applied in lexical order, each one in its own transaction.
+func Migrate(ctx context.Context, dbh *sqlx.DB, dir string) error {
+	logger := logging.FromContext(ctx)
+	if dir == "" {
+		dir = defaultMigrationsDir
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.sql"))
+	if err != nil {
+		return fmt.Errorf("list migrations in %s: %w", dir, err)
+	}
+	sort.Strings(files)
+
+	query := `create table if not exists "SchemaMigrations" (
+				version    text primary key,
+				applied_at timestamptz not null default now())`
+	if _, err := dbutils.Exec(ctx, dbh, query); err != nil {
+		return err
+	}
+
+	var applied []string
+	if err := dbutils.Select(ctx, dbh, &applied, `select version from "SchemaMigrations"`); err != nil {
+		return err
+	}
+	done := make(map[string]struct{}, len(applied))
+	for _, version := range applied {
+		done[version] = struct{}{}
+	}
+
+	for _, file := range files {
+		version := strings.TrimSuffix(filepath.Base(file), ".sql")
+		if _, ok := done[version]; ok {
+			continue
+		}
+		body, err := os.ReadFile(file)
+		if err != nil {
+			return fmt.Errorf("read migration %s: %w", file, err)
+		}
+		err = dbutils.RunTx(ctx, dbh, func(tx *sqlx.Tx) error {
+			if _, err := dbutils.Exec(ctx, tx, string(body)); err != nil {
+				return err
+			}
+			_, err := dbutils.Exec(ctx, tx, `insert into "SchemaMigrations" (version) values ($1)`, version)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("apply migration %s: %w", version, err)
+		}
+		logger.Infow("migration applied", "version", version)
+	}
+
+	return nil
+}
@@ -0,0 +1,263 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/gofrs/uuid"
+	"github.com/jmoiron/sqlx"
+	"simpleServer/dbutils"
+	"simpleServer/internal/detection/model"
+	"simpleServer/pkg/logging"
+)
+
+var ErrAlertNotFound = errors.New("alert not found")
+
+type DetectionDB interface {
+	// Find evaluates one rule over the samples taken in the query window.
+	Find(ctx context.Context, query *model.FindingQuery) ([]model.Finding, error)
+
+	// SaveAlert stores the alert of a rule and cell, or refreshes the existing one keeping its status.
+	SaveAlert(ctx context.Context, alert *model.Alert) error
+
+	GetAlerts(ctx context.Context, filter *model.AlertFilter) ([]model.Alert, error)
+
+	GetAlertById(ctx context.Context, id uuid.UUID) (*model.Alert, error)
+
+	SetAlertStatus(ctx context.Context, id uuid.UUID, status model.AlertStatus, comment *string) (*model.Alert, error)
+
+	// RunExclusive runs f unless another server instance is already detecting.
+	RunExclusive(ctx context.Context, f func(ctx context.Context) error) (bool, error)
+}
+
+type detectionDB struct {
+	dbh *sqlx.DB
+}
+
+func NewDetectionDB(dbh *sqlx.DB) DetectionDB {
+	return &detectionDB{dbh: dbh}
+}
+
+// detectionLockKey is the advisory lock held while rules are evaluated.
+const detectionLockKey = 0x726f677565
+
+// samplesCTE selects the samples of the window, every rule query starts with it.
+const samplesCTE = `with samples as (
+		select GH.gsm, GPS.post_id, coalesce(GH.time, GPS.time) as time, GH.dbm, GPS.coordinates
+		from "GsmHistory" GH
+		inner join "GpsData" GPS on GPS.id = GH.gps
+		where GPS.time >= :From and GPS.time < :To and GH.dbm is not null
+	)`
+
+// findingColumns summarises the samples S of one group, the position and post are those of the strongest sample.
+func findingColumns(gsm, measure string) string {
+	return fmt.Sprintf(`%s as gsm_id,
+		(array_agg(S.post_id order by S.dbm desc))[1] as post_id,
+		min(S.time) as first_seen,
+		max(S.time) as last_seen,
+		count(*) as samples,
+		cast(max(S.dbm) as float8) as max_dbm,
+		st_asewkb((array_agg(S.coordinates order by S.dbm desc))[1]) as coordinates,
+		cast(%s as float8) as measure`, gsm, measure)
+}
+
+var ruleQueries = map[string]string{
+	model.RuleUnregisteredCell: samplesCTE + `
+	select ` + findingColumns("S.gsm", "count(distinct S.post_id)") + `
+	from samples S
+	inner join "GsmData" GD on GD.id = S.gsm
+	where not exists (
+		select 1 from "BsInfo" BI
+		where BI.arfcn = GD.arfcn and BI.cid = GD.cid and BI.lac_tac = GD.lac_tac
+	)
+	group by S.gsm`,
+
+	model.RuleIsolatedAreaCode: samplesCTE + `, heard as (
+		select distinct S.gsm, GD.lac_tac, GD.operator_id
+		from samples S inner join "GsmData" GD on GD.id = S.gsm
+	)
+	select ` + findingColumns("S.gsm", "extract(epoch from max(S.time) - min(S.time)) / 60") + `
+	from samples S
+	inner join "GsmData" GD on GD.id = S.gsm
+	where GD.lac_tac is not null
+	and not exists (
+		select 1 from "BsInfo" BI
+		where BI.lac_tac = GD.lac_tac and BI.operator_id = GD.operator_id
+	)
+	and not exists (
+		select 1 from heard H
+		where H.lac_tac = GD.lac_tac and H.operator_id = GD.operator_id and H.gsm <> GD.id
+	)
+	group by S.gsm`,
+
+	model.RuleHighPower: samplesCTE + `
+	select ` + findingColumns("S.gsm", "min(R.distance)") + `
+	from samples S
+	inner join "GsmData" GD on GD.id = S.gsm
+	inner join lateral (
+		select min(st_distance(cast(BS.coordinates as geography), cast(S.coordinates as geography))) as distance
+		from "BsInfo" BI
+		inner join "BaseStations" BS on BS.id = BI.bs
+		where BI.arfcn = GD.arfcn and BI.cid = GD.cid and BI.lac_tac = GD.lac_tac
+	) R on true
+	where S.dbm >= :HighPowerDbm and R.distance >= :HighPowerDistance
+	group by S.gsm`,
+
+	// the strongest cell of a post at a time is taken as its serving cell.
+	model.RuleDowngradeOnly: samplesCTE + `, serving as (
+		select distinct on (S.post_id, S.time) S.*
+		from samples S
+		order by S.post_id, S.time, S.dbm desc
+	), entries as (
+		select T.*
+		from (
+			select V.*, lag(V.gsm) over w as prev_gsm, lag(V.time) over w as prev_time
+			from serving V
+			window w as (partition by V.post_id order by V.time)
+		) T
+		where T.prev_gsm is distinct from T.gsm
+	)
+	select ` + findingColumns("S.gsm", `cast(count(*) filter (
+			where upper(PCT.type) in ('UMTS', 'LTE', 'NR')
+			and PGD.operator_id = GD.operator_id
+			and S.time - S.prev_time <= interval '1 minute'
+		) as float8) / count(*)`) + `
+	from entries S
+	inner join "GsmData" GD on GD.id = S.gsm
+	inner join arfcn on arfcn.id = GD.arfcn
+	inner join "CellularNetworkType" CT on CT.id = arfcn."CellularNetworkType"
+	left join "GsmData" PGD on PGD.id = S.prev_gsm
+	left join arfcn PA on PA.id = PGD.arfcn
+	left join "CellularNetworkType" PCT on PCT.id = PA."CellularNetworkType"
+	where upper(CT.type) = 'GSM'
+	group by S.gsm
+	having count(*) >= :MinEntries`,
+
+	model.RuleDuplicateCell: samplesCTE + `
+	select ` + findingColumns("(array_agg(S.gsm order by S.dbm desc))[1]", `st_distance(
+			cast(st_setsrid(st_makepoint(st_xmin(st_extent(S.coordinates)), st_ymin(st_extent(S.coordinates))), 4326) as geography),
+			cast(st_setsrid(st_makepoint(st_xmax(st_extent(S.coordinates)), st_ymax(st_extent(S.coordinates))), 4326) as geography))`) + `
+	from samples S
+	inner join "GsmData" GD on GD.id = S.gsm
+	where GD.cid is not null and GD.lac_tac is not null
+	group by GD.operator_id, GD.lac_tac, GD.cid
+	having count(*) > 1`,
+}
+
+// ruleFilters drop findings below the rule threshold, applied on the summarised rows.
+var ruleFilters = map[string]string{
+	model.RuleDowngradeOnly: `where F.measure >= :DowngradeShare`,
+	model.RuleDuplicateCell: `where F.measure >= :DuplicateDistance`,
+}
+
+func (d *detectionDB) Find(ctx context.Context, q *model.FindingQuery) ([]model.Finding, error) {
+	logger := logging.FromContext(ctx)
+	logger.Debugw("detection evaluate rule", "rule", q.Rule, "from", q.From, "to", q.To)
+
+	query, ok := ruleQueries[q.Rule]
+	if !ok {
+		return nil, fmt.Errorf("unknown rule %q", q.Rule)
+	}
+	if filter, ok := ruleFilters[q.Rule]; ok {
+		query = fmt.Sprintf(`select F.* from (%s) F %s`, query, filter)
+	}
+
+	var findings []model.Finding
+	if err := dbutils.NamedSelect(ctx, d.dbh, &findings, query, map[string]interface{}{
+		"From":              q.From,
+		"To":                q.To,
+		"HighPowerDbm":      q.Thresholds.HighPowerDbm,
+		"HighPowerDistance": q.Thresholds.HighPowerDistance,
+		"DuplicateDistance": q.Thresholds.DuplicateDistance,
+		"DowngradeShare":    q.Thresholds.DowngradeShare,
+		"MinEntries":        q.Thresholds.MinEntries,
+	}); err != nil {
+		return nil, err
+	}
+	return findings, nil
+}
+
+func (d *detectionDB) SaveAlert(ctx context.Context, alert *model.Alert) error {
+	query := `insert into "Alerts" (id, rule, gsm, post_id, score, evidence, coordinates, first_seen, last_seen)
+		values (:Id, :Rule, :Gsm, :PostId, :Score, cast(:Evidence as jsonb), st_setsrid(st_makepoint(:Lng, :Lat), 4326), :FirstSeen, :LastSeen)
+		on conflict (rule, gsm) do update
+		set post_id = excluded.post_id,
+			score = excluded.score,
+			evidence = excluded.evidence,
+			coordinates = excluded.coordinates,
+			first_seen = least("Alerts".first_seen, excluded.first_seen),
+			last_seen = greatest("Alerts".last_seen, excluded.last_seen),
+			updated_at = now()`
+	_, err := dbutils.NamedExec(ctx, d.dbh, query, map[string]interface{}{
+		"Id":        alert.Id,
+		"Rule":      alert.Rule,
+		"Gsm":       alert.GsmId,
+		"PostId":    alert.PostId,
+		"Score":     alert.Score,
+		"Evidence":  alert.Evidence,
+		"Lng":       alert.Coordinates.X(),
+		"Lat":       alert.Coordinates.Y(),
+		"FirstSeen": alert.FirstSeen,
+		"LastSeen":  alert.LastSeen,
+	})
+	return err
+}
+
+const alertColumns = `A.id, A.rule, A.gsm, A.post_id, cast(A.score as float8) as score, cast(A.evidence as text) as evidence,
+		st_asewkb(A.coordinates) as coordinates, A.first_seen, A.last_seen, A.status, A.comment, A.created_at, A.updated_at,
+		GD.cid, GD.lac_tac, arfcn.arfcn_number, "CellularNetworkType".type as technology
+	from "Alerts" A
+	inner join "GsmData" GD on GD.id = A.gsm
+	inner join arfcn on arfcn.id = GD.arfcn
+	left join "CellularNetworkType" on arfcn."CellularNetworkType" = "CellularNetworkType".id`
+
+func (d *detectionDB) GetAlerts(ctx context.Context, filter *model.AlertFilter) ([]model.Alert, error) {
+	logger := logging.FromContext(ctx)
+	logger.Debugw("detection fetch alerts", "status", filter.Status, "rule", filter.Rule)
+	query := `select ` + alertColumns + `
+		where A.status = :Status
+		and (:Rule = '' or A.rule = :Rule)
+		and A.score >= :MinScore
+		order by A.score desc, A.last_seen desc
+		limit :Limit offset :Offset`
+
+	var alerts []model.Alert
+	if err := dbutils.NamedSelect(ctx, d.dbh, &alerts, query, map[string]interface{}{
+		"Status":   filter.Status,
+		"Rule":     filter.Rule,
+		"MinScore": filter.MinScore,
+		"Limit":    filter.Limit,
+		"Offset":   filter.Offset,
+	}); err != nil {
+		return nil, err
+	}
+	return alerts, nil
+}
+
+func (d *detectionDB) GetAlertById(ctx context.Context, id uuid.UUID) (*model.Alert, error) {
+	var alert model.Alert
+	if err := dbutils.Get(ctx, d.dbh, &alert, `select `+alertColumns+` where A.id = $1`, id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrAlertNotFound
+		}
+		return nil, err
+	}
+	return &alert, nil
+}
+
+func (d *detectionDB) SetAlertStatus(ctx context.Context, id uuid.UUID, status model.AlertStatus, comment *string) (*model.Alert, error) {
+	query := `update "Alerts" set status = $1, comment = coalesce($2, comment), updated_at = now() where id = $3`
+	res, err := dbutils.Exec(ctx, d.dbh, query, status, comment, id)
+	if err != nil {
+		return nil, err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return nil, ErrAlertNotFound
+	}
+	return d.GetAlertById(ctx, id)
+}
+
+func (d *detectionDB) RunExclusive(ctx context.Context, f func(ctx context.Context) error) (bool, error) {
+	return dbutils.WithAdvisoryLock(ctx, d.dbh, detectionLockKey, f)
+}
@@ -0,0 +1,106 @@
+package detection
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/gofrs/uuid"
+	"go.uber.org/fx"
+	"simpleServer/internal/config"
+	"simpleServer/internal/detection/database"
+	"simpleServer/internal/detection/model"
+	"simpleServer/pkg/logging"
+	"simpleServer/pkg/periodic"
+	"time"
+)
+
+var ErrAlreadyRunning = fmt.Errorf("detection is %w", periodic.ErrAlreadyRunning)
+
+// Detector evaluates the rules over recent scans, periodically when enabled and on demand.
+type Detector struct {
+	detectionDB database.DetectionDB
+	cfg         config.DetectionConfig
+}
+
+func NewDetector(lc fx.Lifecycle, cfg *config.Config, db database.DetectionDB) *Detector {
+	detector := &Detector{detectionDB: db, cfg: cfg.DetectionConfig}
+	if !detector.cfg.Enabled || detector.cfg.Interval <= 0 {
+		return detector
+	}
+
+	// every run looks back over a window longer than the interval, so scans ingested late are still evaluated.
+	periodic.Start(lc, "rogue cell detection", detector.cfg.Interval, func(ctx context.Context) error {
+		to := time.Now()
+		result, err := detector.Run(ctx, to.Add(-detector.cfg.Lookback), to)
+		if err == nil {
+			logging.DefaultLogger().Infow("rogue cell detection done", "alerts", result.Alerts)
+		}
+		return err
+	})
+	return detector
+}
+
+func (d *Detector) thresholds() model.Thresholds {
+	return model.Thresholds{
+		HighPowerDbm:      d.cfg.HighPowerDbm,
+		HighPowerDistance: d.cfg.HighPowerDistance,
+		DuplicateDistance: d.cfg.DuplicateDistance,
+		DowngradeShare:    d.cfg.DowngradeShare,
+		MinEntries:        d.cfg.MinEntries,
+	}
+}
+
+// Run evaluates every rule over the scans taken between from and to and stores the findings as alerts.
+func (d *Detector) Run(ctx context.Context, from, to time.Time) (*model.RunResult, error) {
+	result := &model.RunResult{From: from, To: to, Alerts: make(map[string]int, len(rules))}
+	thresholds := d.thresholds()
+	acquired, err := d.detectionDB.RunExclusive(ctx, func(ctx context.Context) error {
+		for i := range rules {
+			rule := &rules[i]
+			findings, err := d.detectionDB.Find(ctx, &model.FindingQuery{Rule: rule.Name, From: from, To: to, Thresholds: thresholds})
+			if err != nil {
+				return err
+			}
+			for j := range findings {
+				alert, err := newAlert(rule, &findings[j], &thresholds)
+				if err != nil {
+					return err
+				}
+				if err := d.detectionDB.SaveAlert(ctx, alert); err != nil {
+					return err
+				}
+			}
+			result.Alerts[rule.Name] = len(findings)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !acquired {
+		return nil, ErrAlreadyRunning
+	}
+	return result, nil
+}
+
+func newAlert(rule *Rule, finding *model.Finding, thresholds *model.Thresholds) (*model.Alert, error) {
+	id, err := uuid.NewV4()
+	if err != nil {
+		return nil, err
+	}
+	evidence, err := json.Marshal(rule.Evidence(finding))
+	if err != nil {
+		return nil, err
+	}
+	return &model.Alert{
+		Id:          id,
+		Rule:        rule.Name,
+		GsmId:       finding.GsmId,
+		PostId:      finding.PostId,
+		Score:       rule.Score(finding, thresholds),
+		Evidence:    string(evidence),
+		Coordinates: finding.Coordinates,
+		FirstSeen:   finding.FirstSeen,
+		LastSeen:    finding.LastSeen,
+	}, nil
+}
@@ -0,0 +1,185 @@
+package detection
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"github.com/gofrs/uuid"
+	"net/http"
+	"simpleServer/internal/auth"
+	authModel "simpleServer/internal/auth/model"
+	"simpleServer/internal/config"
+	"simpleServer/internal/detection/database"
+	"simpleServer/internal/detection/model"
+	"simpleServer/internal/middleware"
+	"simpleServer/internal/middleware/handler"
+	"simpleServer/pkg/logging"
+	"simpleServer/pkg/validate"
+	"time"
+)
+
+const (
+	defaultAlertsLimit = 100
+	maxAlertsLimit     = 1000
+)
+
+type Handler struct {
+	detectionDB database.DetectionDB
+	detector    *Detector
+}
+
+func NewHandler(db database.DetectionDB, detector *Detector) *Handler {
+	return &Handler{detectionDB: db, detector: detector}
+}
+
+func bindAlertId(c *gin.Context) (uuid.UUID, *handler.Response) {
+	id, err := uuid.FromString(c.Param("id"))
+	if err != nil {
+		return uuid.Nil, handler.NewErrorResponse(http.StatusBadRequest, handler.InvalidUriValue, "invalid id in uri",
+			validate.NewValidationErrorDetails("id", "required uuid format", c.Param("id")))
+	}
+	return id, nil
+}
+
+func (h *Handler) GetRules(c *gin.Context) {
+	handler.HandleRequest(c, func(c *gin.Context) *handler.Response {
+		return handler.NewSuccessResponse(http.StatusOK, Rules())
+	})
+}
+
+func (h *Handler) GetAlerts(c *gin.Context) {
+	handler.HandleRequest(c, func(c *gin.Context) *handler.Response {
+		type RequestQuery struct {
+			Status   string  `form:"status" binding:"omitempty,oneof=open acknowledged dismissed"`
+			Rule     string  `form:"rule"`
+			MinScore float64 `form:"minScore" binding:"min=0,max=1"`
+			Limit    int     `form:"limit" binding:"min=0"`
+			Offset   int     `form:"offset" binding:"min=0"`
+		}
+		var query RequestQuery
+		if err := c.ShouldBindQuery(&query); err != nil {
+			var details []*validate.ValidationErrDetail
+			if vErrs, ok := err.(validator.ValidationErrors); ok {
+				details = validate.ValidationErrorDetails(&query, "form", vErrs)
+			}
+			return handler.NewErrorResponse(http.StatusBadRequest, handler.InvalidQueryValue, "invalid alert query", details)
+		}
+		if _, ok := RuleByName(query.Rule); query.Rule != "" && !ok {
+			return handler.NewErrorResponse(http.StatusBadRequest, handler.InvalidQueryValue, "unknown rule", nil)
+		}
+		filter := &model.AlertFilter{
+			Status:   model.AlertStatus(query.Status),
+			Rule:     query.Rule,
+			MinScore: query.MinScore,
+			Limit:    query.Limit,
+			Offset:   query.Offset,
+		}
+		if filter.Status == "" {
+			filter.Status = model.StatusOpen
+		}
+		if filter.Limit == 0 || filter.Limit > maxAlertsLimit {
+			filter.Limit = defaultAlertsLimit
+		}
+		alerts, err := h.detectionDB.GetAlerts(c, filter)
+		if err != nil {
+			logging.FromContext(c).Errorw("detection.GetAlerts failed", "err", err)
+			return handler.NewInternalErrorResponse(err)
+		}
+		return handler.NewSuccessResponse(http.StatusOK, NewAlertsResponse(alerts))
+	})
+}
+
+func (h *Handler) GetAlertById(c *gin.Context) {
+	handler.HandleRequest(c, func(c *gin.Context) *handler.Response {
+		id, res := bindAlertId(c)
+		if res != nil {
+			return res
+		}
+		alert, err := h.detectionDB.GetAlertById(c, id)
+		if errors.Is(err, database.ErrAlertNotFound) {
+			return handler.NewErrorResponse(http.StatusNotFound, handler.NotFoundEntity, "alert not found", nil)
+		}
+		if err != nil {
+			return handler.NewInternalErrorResponse(err)
+		}
+		return handler.NewSuccessResponse(http.StatusOK, NewAlertResponse(alert))
+	})
+}
+
+// setStatus builds the handler moving an alert to status, with an optional analyst comment.
+func (h *Handler) setStatus(status model.AlertStatus) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		handler.HandleRequest(c, func(c *gin.Context) *handler.Response {
+			id, res := bindAlertId(c)
+			if res != nil {
+				return res
+			}
+			type RequestBody struct {
+				Comment *string `json:"comment"`
+			}
+			var body RequestBody
+			if c.Request.ContentLength != 0 {
+				if err := c.ShouldBindJSON(&body); err != nil {
+					return handler.NewErrorResponse(http.StatusBadRequest, handler.InvalidBodyValue, "invalid alert review", nil)
+				}
+			}
+			alert, err := h.detectionDB.SetAlertStatus(c, id, status, body.Comment)
+			if errors.Is(err, database.ErrAlertNotFound) {
+				return handler.NewErrorResponse(http.StatusNotFound, handler.NotFoundEntity, "alert not found", nil)
+			}
+			if err != nil {
+				logging.FromContext(c).Errorw("detection.setStatus failed", "id", id, "status", status, "err", err)
+				return handler.NewInternalErrorResponse(err)
+			}
+			return handler.NewSuccessResponse(http.StatusOK, NewAlertResponse(alert))
+		})
+	}
+}
+
+// RunDetection evaluates the rules over the given window, the last configured lookback by default.
+func (h *Handler) RunDetection(c *gin.Context) {
+	handler.HandleRequest(c, func(c *gin.Context) *handler.Response {
+		type RequestQuery struct {
+			From time.Time `form:"from" time_format:"2006-01-02T15:04:05Z07:00"`
+			To   time.Time `form:"to" time_format:"2006-01-02T15:04:05Z07:00"`
+		}
+		var query RequestQuery
+		if err := c.ShouldBindQuery(&query); err != nil {
+			return handler.NewErrorResponse(http.StatusBadRequest, handler.InvalidQueryValue, "invalid from, to", nil)
+		}
+		if query.To.IsZero() {
+			query.To = time.Now()
+		}
+		if query.From.IsZero() {
+			query.From = query.To.Add(-h.detector.cfg.Lookback)
+		}
+		if !query.From.Before(query.To) {
+			return handler.NewErrorResponse(http.StatusBadRequest, handler.InvalidQueryValue, "from must be before to", nil)
+		}
+		result, err := h.detector.Run(c.Request.Context(), query.From, query.To)
+		if errors.Is(err, ErrAlreadyRunning) {
+			return handler.NewErrorResponse(http.StatusConflict, handler.DuplicateEntry, err.Error(), nil)
+		}
+		if err != nil {
+			logging.FromContext(c).Errorw("detection.RunDetection failed", "err", err)
+			return handler.NewInternalErrorResponse(err)
+		}
+		return handler.NewSuccessResponse(http.StatusOK, result)
+	})
+}
+
+func RouteV1(cfg *config.Config, h *Handler, a *auth.Authenticator, r *gin.Engine) {
+	v1 := r.Group("v1/api")
+	v1.Use(middleware.CorsMiddleware(), middleware.RequestIDMiddleware(), middleware.TimeoutMiddleware(cfg.ServerConfig.WriteTimeout))
+
+	alertsV1 := v1.Group("alerts")
+	alertsV1.Use(a.Authenticate(), a.Require(authModel.PermissionRead))
+	{
+		alertsV1.GET("", h.GetAlerts)
+		alertsV1.GET("/rules", h.GetRules)
+		alertsV1.GET("/:id", h.GetAlertById)
+		alertsV1.POST("/:id/acknowledge", a.Require(authModel.PermissionAnalyze), h.setStatus(model.StatusAcknowledged))
+		alertsV1.POST("/:id/dismiss", a.Require(authModel.PermissionAnalyze), h.setStatus(model.StatusDismissed))
+		alertsV1.POST("/run", a.Require(authModel.PermissionAnalyze), h.RunDetection)
+	}
+}
@@ -0,0 +1,91 @@
+package model
+
+import (
+	"github.com/gofrs/uuid"
+	"github.com/twpayne/go-geom/encoding/ewkb"
+	"time"
+)
+
+const (
+	RuleUnregisteredCell = "unregistered_cell"
+	RuleIsolatedAreaCode = "isolated_area_code"
+	RuleHighPower        = "high_power"
+	RuleDowngradeOnly    = "downgrade_only"
+	RuleDuplicateCell    = "duplicate_cell"
+)
+
+type AlertStatus string
+
+const (
+	StatusOpen         AlertStatus = "open"
+	StatusAcknowledged AlertStatus = "acknowledged"
+	StatusDismissed    AlertStatus = "dismissed"
+)
+
+// Thresholds tune when the rules fire.
+type Thresholds struct {
+	// HighPowerDbm and HighPowerDistance flag a cell received at least that strong
+	// farther than that many meters from its registered station.
+	HighPowerDbm      float64
+	HighPowerDistance float64
+	// DuplicateDistance is the span in meters one cell identity may be heard over.
+	DuplicateDistance float64
+	// DowngradeShare is the least share of entries into a 2G cell that come from 3G and newer.
+	DowngradeShare float64
+	MinEntries     int
+}
+
+// FindingQuery selects the samples rules are evaluated on.
+type FindingQuery struct {
+	Rule       string
+	From       time.Time
+	To         time.Time
+	Thresholds Thresholds
+}
+
+// Finding is one cell matched by a rule in the evaluated samples. Measure holds the
+// rule specific quantity, see Rule.Measure.
+type Finding struct {
+	GsmId       uuid.UUID  `db:"gsm_id"`
+	PostId      *uuid.UUID `db:"post_id"`
+	FirstSeen   time.Time  `db:"first_seen"`
+	LastSeen    time.Time  `db:"last_seen"`
+	Samples     int        `db:"samples"`
+	MaxDbm      float64    `db:"max_dbm"`
+	Coordinates ewkb.Point `db:"coordinates"`
+	Measure     float64    `db:"measure"`
+}
+
+type Alert struct {
+	Id          uuid.UUID   `db:"id"`
+	Rule        string      `db:"rule"`
+	GsmId       uuid.UUID   `db:"gsm"`
+	PostId      *uuid.UUID  `db:"post_id"`
+	Score       float64     `db:"score"`
+	Evidence    string      `db:"evidence"`
+	Coordinates ewkb.Point  `db:"coordinates"`
+	FirstSeen   time.Time   `db:"first_seen"`
+	LastSeen    time.Time   `db:"last_seen"`
+	Status      AlertStatus `db:"status"`
+	Comment     *string     `db:"comment"`
+	CreatedAt   time.Time   `db:"created_at"`
+	UpdatedAt   time.Time   `db:"updated_at"`
+	Cid         *int32      `db:"cid"`
+	LacTac      *int32      `db:"lac_tac"`
+	ArfcnNumber int64       `db:"arfcn_number"`
+	Technology  *string     `db:"technology"`
+}
+
+type AlertFilter struct {
+	Status   AlertStatus
+	Rule     string
+	MinScore float64
+	Limit    int
+	Offset   int
+}
+
+type RunResult struct {
+	From   time.Time      `json:"from"`
+	To     time.Time      `json:"to"`
+	Alerts map[string]int `json:"alerts"`
+}
@@ -0,0 +1,58 @@
+package detection
+
+import (
+	"encoding/json"
+	"github.com/gofrs/uuid"
+	"simpleServer/internal/detection/model"
+	"time"
+)
+
+type AlertResponse struct {
+	Id          uuid.UUID         `json:"id"`
+	Rule        string            `json:"rule"`
+	GsmId       uuid.UUID         `json:"gsmId"`
+	Cid         *int32            `json:"cid"`
+	LacTac      *int32            `json:"lacTac"`
+	Arfcn       int64             `json:"arfcn"`
+	Technology  *string           `json:"technology"`
+	PostId      *uuid.UUID        `json:"postId"`
+	Score       float64           `json:"score"`
+	Evidence    json.RawMessage   `json:"evidence"`
+	Coordinates []float64         `json:"coordinates"`
+	FirstSeen   time.Time         `json:"firstSeen"`
+	LastSeen    time.Time         `json:"lastSeen"`
+	Status      model.AlertStatus `json:"status"`
+	Comment     *string           `json:"comment"`
+	CreatedAt   time.Time         `json:"createdAt"`
+	UpdatedAt   time.Time         `json:"updatedAt"`
+}
+
+func NewAlertResponse(alert *model.Alert) *AlertResponse {
+	return &AlertResponse{
+		Id:          alert.Id,
+		Rule:        alert.Rule,
+		GsmId:       alert.GsmId,
+		Cid:         alert.Cid,
+		LacTac:      alert.LacTac,
+		Arfcn:       alert.ArfcnNumber,
+		Technology:  alert.Technology,
+		PostId:      alert.PostId,
+		Score:       alert.Score,
+		Evidence:    json.RawMessage(alert.Evidence),
+		Coordinates: []float64{alert.Coordinates.X(), alert.Coordinates.Y()},
+		FirstSeen:   alert.FirstSeen,
+		LastSeen:    alert.LastSeen,
+		Status:      alert.Status,
+		Comment:     alert.Comment,
+		CreatedAt:   alert.CreatedAt,
+		UpdatedAt:   alert.UpdatedAt,
+	}
+}
+
+func NewAlertsResponse(alerts []model.Alert) []*AlertResponse {
+	data := make([]*AlertResponse, 0, len(alerts))
+	for i := range alerts {
+		data = append(data, NewAlertResponse(&alerts[i]))
+	}
+	return data
+}
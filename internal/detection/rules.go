@@ -0,0 +1,110 @@
+package detection
+
+import (
+	"math"
+	"simpleServer/internal/detection/model"
+	"time"
+)
+
+// Rule flags cells that look like a fake base station. Findings come from the database,
+// the rule turns them into a score between 0 and 1.
+type Rule struct {
+	Name        string `json:"name"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	// Measure names the rule specific quantity of a finding in the alert evidence.
+	Measure string `json:"measure"`
+	score   func(f *model.Finding, t *model.Thresholds) float64
+}
+
+var rules = []Rule{
+	{
+		Name:        model.RuleUnregisteredCell,
+		Title:       "Unregistered cell",
+		Description: "The cell is heard by posts but has no matching sector in the registry.",
+		Measure:     "posts",
+		score: func(f *model.Finding, _ *model.Thresholds) float64 {
+			// a strong cell seen by a single post is more suspicious than a faint one everybody hears.
+			score := 0.3 + 0.5*strength(f.MaxDbm)
+			if f.Measure <= 1 {
+				score += 0.2
+			}
+			return score
+		},
+	},
+	{
+		Name:        model.RuleIsolatedAreaCode,
+		Title:       "Isolated LAC/TAC",
+		Description: "The cell announces a location or tracking area code no registered or neighbouring cell of the operator uses.",
+		Measure:     "activeMinutes",
+		score: func(f *model.Finding, _ *model.Thresholds) float64 {
+			// catchers change the area code to force location updates and rarely stay for long.
+			return 0.5 + 0.3*(1-clamp(f.Measure/(24*60))) + 0.2*strength(f.MaxDbm)
+		},
+	},
+	{
+		Name:        model.RuleHighPower,
+		Title:       "Abnormally high power",
+		Description: "The cell is received very strong far away from its registered station.",
+		Measure:     "stationDistance",
+		score: func(f *model.Finding, t *model.Thresholds) float64 {
+			return 0.5 + 0.25*clamp((f.MaxDbm-t.HighPowerDbm)/20) + 0.25*clamp((f.Measure-t.HighPowerDistance)/(4*t.HighPowerDistance))
+		},
+	},
+	{
+		Name:        model.RuleDowngradeOnly,
+		Title:       "2G downgrade",
+		Description: "Posts almost only reach the 2G cell by leaving a 3G, LTE or NR cell of the same operator.",
+		Measure:     "downgradeShare",
+		score: func(f *model.Finding, _ *model.Thresholds) float64 {
+			return 0.4 + 0.6*clamp(f.Measure)
+		},
+	},
+	{
+		Name:        model.RuleDuplicateCell,
+		Title:       "Duplicated cell identity",
+		Description: "The same operator, LAC/TAC and cell id is heard in places too far apart for one sector.",
+		Measure:     "span",
+		score: func(f *model.Finding, t *model.Thresholds) float64 {
+			return 0.5 + 0.5*clamp((f.Measure-t.DuplicateDistance)/t.DuplicateDistance)
+		},
+	},
+}
+
+func Rules() []Rule {
+	return rules
+}
+
+func RuleByName(name string) (*Rule, bool) {
+	for i := range rules {
+		if rules[i].Name == name {
+			return &rules[i], true
+		}
+	}
+	return nil, false
+}
+
+func (r *Rule) Score(f *model.Finding, t *model.Thresholds) float64 {
+	return clamp(r.score(f, t))
+}
+
+// Evidence lists what the score of a finding is based on.
+func (r *Rule) Evidence(f *model.Finding) map[string]interface{} {
+	return map[string]interface{}{
+		"samples":   f.Samples,
+		"maxDbm":    f.MaxDbm,
+		"firstSeen": f.FirstSeen.Format(time.RFC3339),
+		"lastSeen":  f.LastSeen.Format(time.RFC3339),
+		"postId":    f.PostId,
+		r.Measure:   f.Measure,
+	}
+}
+
+// strength maps levels from -110 to -50 dBm onto 0..1.
+func strength(dbm float64) float64 {
+	return clamp((dbm + 110) / 60)
+}
+
+func clamp(v float64) float64 {
+	return math.Max(0, math.Min(1, v))
+}
@@ -0,0 +1,57 @@
+package detection
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"simpleServer/internal/detection/model"
+	"testing"
+	"time"
+)
+
+var thresholds = model.Thresholds{
+	HighPowerDbm:      -55,
+	HighPowerDistance: 1000,
+	DuplicateDistance: 30000,
+	DowngradeShare:    0.8,
+	MinEntries:        3,
+}
+
+func score(t *testing.T, name string, f model.Finding) float64 {
+	rule, ok := RuleByName(name)
+	require.True(t, ok)
+	return rule.Score(&f, &thresholds)
+}
+
+func TestRuleScores(t *testing.T) {
+	// a strong unregistered cell seen by one post outranks a faint one seen by many.
+	assert.Greater(t,
+		score(t, model.RuleUnregisteredCell, model.Finding{MaxDbm: -50, Measure: 1}),
+		score(t, model.RuleUnregisteredCell, model.Finding{MaxDbm: -105, Measure: 4}))
+	assert.InDelta(t, 1, score(t, model.RuleUnregisteredCell, model.Finding{MaxDbm: -40, Measure: 1}), 1e-9)
+
+	assert.Greater(t,
+		score(t, model.RuleIsolatedAreaCode, model.Finding{MaxDbm: -70, Measure: 10}),
+		score(t, model.RuleIsolatedAreaCode, model.Finding{MaxDbm: -70, Measure: 3 * 24 * 60}))
+
+	assert.InDelta(t, 0.5, score(t, model.RuleHighPower, model.Finding{MaxDbm: -55, Measure: 1000}), 1e-9)
+	assert.InDelta(t, 1, score(t, model.RuleHighPower, model.Finding{MaxDbm: -30, Measure: 10000}), 1e-9)
+
+	assert.InDelta(t, 1, score(t, model.RuleDowngradeOnly, model.Finding{Measure: 1}), 1e-9)
+	assert.InDelta(t, 0.75, score(t, model.RuleDuplicateCell, model.Finding{Measure: 45000}), 1e-9)
+}
+
+func TestRulesComplete(t *testing.T) {
+	for _, rule := range Rules() {
+		assert.NotNil(t, rule.score, rule.Name)
+		assert.NotEmpty(t, rule.Measure, rule.Name)
+	}
+}
+
+func TestEvidence(t *testing.T) {
+	rule, _ := RuleByName(model.RuleHighPower)
+	seen := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	evidence := rule.Evidence(&model.Finding{Samples: 4, MaxDbm: -41, Measure: 2500, FirstSeen: seen, LastSeen: seen.Add(time.Hour)})
+	assert.Equal(t, 2500.0, evidence["stationDistance"])
+	assert.Equal(t, "2024-05-01T11:00:00Z", evidence["lastSeen"])
+	assert.Equal(t, 4, evidence["samples"])
+}
@@ -0,0 +1,147 @@
+package drivetest
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"simpleServer/internal/measurement/model"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	FormatGNetTrack = "gnettrack"
+	FormatNMEA      = "nmea"
+)
+
+type Options struct {
+	// Location is used for timestamps written without a zone, G-NetTrack exports use the phone's local time.
+	Location *time.Location
+	// MaxGap is the largest distance in time between a scan and the GPS fix it is attached to.
+	MaxGap time.Duration
+}
+
+// Log is the content of one drive test file, with every scan attached to a GPS fix.
+type Log struct {
+	Gps     []model.GpsFix
+	Scans   []model.Scan
+	Skipped int
+	// Unaligned counts scans dropped because there was no GPS fix within MaxGap.
+	Unaligned int
+}
+
+// Parse reads a drive test file of the given format. Record keys are derived from the file content,
+// so importing the same file twice is deduplicated by the ingestion.
+func Parse(r io.Reader, format string, opts Options) (*Log, error) {
+	if opts.Location == nil {
+		opts.Location = time.UTC
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(data)
+	source := hex.EncodeToString(sum[:6])
+
+	var parsed *Log
+	switch format {
+	case FormatGNetTrack:
+		parsed, err = parseGNetTrack(bytes.NewReader(data), source, opts)
+	case FormatNMEA:
+		parsed, err = parseNMEA(bytes.NewReader(data), source, opts)
+	default:
+		return nil, fmt.Errorf("unknown drive test format: %s", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	parsed.Unaligned = Align(parsed.Gps, parsed.Scans, opts.MaxGap)
+	aligned := parsed.Scans[:0]
+	for _, scan := range parsed.Scans {
+		if scan.GpsKey != "" {
+			aligned = append(aligned, scan)
+		}
+	}
+	parsed.Scans = aligned
+	return parsed, nil
+}
+
+// Align attaches every scan to the GPS fix closest in time, as long as it is within maxGap.
+// Scans left without a fix get an empty GpsKey; their count is returned.
+func Align(fixes []model.GpsFix, scans []model.Scan, maxGap time.Duration) int {
+	sorted := make([]model.GpsFix, len(fixes))
+	copy(sorted, fixes)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Time.Before(sorted[j].Time) })
+
+	unaligned := 0
+	for i := range scans {
+		scans[i].GpsKey = ""
+		if len(sorted) == 0 {
+			unaligned++
+			continue
+		}
+		t := scans[i].Time
+		j := sort.Search(len(sorted), func(k int) bool { return !sorted[k].Time.Before(t) })
+		best := -1
+		var bestGap time.Duration
+		for _, k := range []int{j - 1, j} {
+			if k < 0 || k >= len(sorted) {
+				continue
+			}
+			gap := sorted[k].Time.Sub(t)
+			if gap < 0 {
+				gap = -gap
+			}
+			if best < 0 || gap < bestGap {
+				best, bestGap = k, gap
+			}
+		}
+		if bestGap > maxGap {
+			unaligned++
+			continue
+		}
+		scans[i].GpsKey = sorted[best].Key
+	}
+	return unaligned
+}
+
+func recordKey(source string, line int) string {
+	return fmt.Sprintf("%s:%d", source, line)
+}
+
+// eachLine calls f for every non-empty line with its 1-based number.
+func eachLine(r io.Reader, f func(line int, text string)) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		f(line, text)
+	}
+	return scanner.Err()
+}
+
+// splitOperator splits "25001" into mcc 250 and mnc 1.
+func splitOperator(code string) (mcc, mnc int16, ok bool) {
+	code = strings.TrimSpace(code)
+	if len(code) < 4 || len(code) > 6 {
+		return 0, 0, false
+	}
+	var m, n int
+	if _, err := fmt.Sscanf(code[:3], "%d", &m); err != nil {
+		return 0, 0, false
+	}
+	if _, err := fmt.Sscanf(code[3:], "%d", &n); err != nil {
+		return 0, 0, false
+	}
+	return int16(m), int16(n), true
+}
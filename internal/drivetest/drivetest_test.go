@@ -0,0 +1,100 @@
+package drivetest
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"simpleServer/internal/measurement/model"
+	"strings"
+	"testing"
+	"time"
+)
+
+const nmeaLog = `AT+COPS?
++COPS: 0,2,"25001",7
+OK
+$GPRMC,101500.00,A,5957.1234,N,03018.5678,E,10.0,90.0,010524,,,A*5D
+$GPGGA,101500.00,5957.1234,N,03018.5678,E,1,08,0.9,25.5,M,,M,,*48
+AT+QENG="servingcell"
++QENG: "servingcell","NOCONN","LTE","FDD",250,01,1A2B3C4,123,1602,3,5,5,7D1,-95,-10,-65,15,-
+OK
+$GPRMC,101510.00,A,5957.2234,N,03018.6678,E,12.0,95.0,010524,,,A*5B
++CREG: 2,1,"00C8","0000A1B2",0
+[2024-05-01 10:15:40] +QENG: "servingcell","NOCONN","GSM",250,01,-,-,32,62,0,-71,255,255,0,37,37,1,-,-,-,-,-,-,-,-,-,"-"
+$GPRMC,101511.00,A,5957.2234,N,03018.6678,E,12.0,95.0,010524,,,A*00
+`
+
+func TestParseNMEA(t *testing.T) {
+	log, err := Parse(strings.NewReader(nmeaLog), FormatNMEA, Options{MaxGap: 5 * time.Second})
+	require.NoError(t, err)
+
+	require.Len(t, log.Gps, 2)
+	fix := log.Gps[0]
+	assert.Equal(t, time.Date(2024, 5, 1, 10, 15, 0, 0, time.UTC), fix.Time)
+	assert.InDelta(t, 59.952056, fix.Lat, 1e-6)
+	assert.InDelta(t, 30.309463, fix.Lng, 1e-6)
+	assert.InDelta(t, 25.5, fix.Altitude, 1e-6)
+	assert.InDelta(t, 5.14444, fix.Speed, 1e-4)
+
+	// the GSM report is 30 seconds away from any fix, the last RMC has a bad checksum.
+	assert.Equal(t, 1, log.Unaligned)
+	assert.Equal(t, 1, log.Skipped)
+	require.Len(t, log.Scans, 1)
+	scan := log.Scans[0]
+	assert.Equal(t, model.TechLTE, scan.Technology)
+	assert.EqualValues(t, 1602, scan.Arfcn)
+	assert.EqualValues(t, 0x1A2B3C4, scan.Cid)
+	assert.EqualValues(t, 0x7D1, scan.LacTac)
+	assert.EqualValues(t, -95, scan.Dbm)
+	assert.EqualValues(t, 250, scan.Mcc)
+	assert.EqualValues(t, 1, scan.Mnc)
+	assert.Equal(t, fix.Key, scan.GpsKey)
+	assert.EqualValues(t, -95, *scan.Metrics.Rsrp)
+	assert.EqualValues(t, -10, *scan.Metrics.Rsrq)
+	assert.EqualValues(t, -17, *scan.Metrics.Sinr)
+	assert.Nil(t, scan.Metrics.Rscp)
+}
+
+func TestParseNMEACellFromCreg(t *testing.T) {
+	log, err := Parse(strings.NewReader(nmeaLog), FormatNMEA, Options{MaxGap: time.Minute})
+	require.NoError(t, err)
+
+	require.Len(t, log.Scans, 2)
+	scan := log.Scans[1]
+	assert.Equal(t, model.TechGSM, scan.Technology)
+	assert.EqualValues(t, 0xC8, scan.LacTac)
+	assert.EqualValues(t, 0xA1B2, scan.Cid)
+	assert.EqualValues(t, 62, scan.Arfcn)
+	assert.EqualValues(t, -71, scan.Dbm)
+	assert.Equal(t, log.Gps[1].Key, scan.GpsKey)
+}
+
+const gNetTrackLog = "Timestamp\tLongitude\tLatitude\tSpeed\tOperatorname\tOperator\tCellID\tLAC\tNetworkTech\tLevel\tARFCN\tAltitude\tHeading\n" +
+	"2024.05.01_13.15.00\t30.3094\t59.9520\t36\tMegaFon\t25002\t21045\t7801\t4G\t-101\t1300\t20\t180\n" +
+	"2024.05.01_13.15.01\t30.3095\t59.9521\t36\tMegaFon\t25002\t21045\t7801\tNONE\t-\t\t20\t180\n" +
+	"broken line\n"
+
+func TestParseGNetTrack(t *testing.T) {
+	msk := time.FixedZone("MSK", 3*60*60)
+	log, err := Parse(strings.NewReader(gNetTrackLog), FormatGNetTrack, Options{Location: msk, MaxGap: time.Second})
+	require.NoError(t, err)
+
+	assert.Len(t, log.Gps, 2)
+	assert.Equal(t, 1, log.Skipped)
+	require.Len(t, log.Scans, 1)
+	assert.Equal(t, time.Date(2024, 5, 1, 10, 15, 0, 0, time.UTC), log.Gps[0].Time.UTC())
+	assert.InDelta(t, 10, log.Gps[0].Speed, 1e-6)
+	rsrp := float32(-101)
+	assert.Equal(t, model.Scan{
+		Key: log.Gps[0].Key, GpsKey: log.Gps[0].Key, Time: log.Gps[0].Time, Technology: model.TechLTE,
+		Arfcn: 1300, Mcc: 250, Mnc: 2, LacTac: 7801, Cid: 21045, Dbm: -101,
+		Metrics: model.Metrics{Rsrp: &rsrp},
+	}, log.Scans[0])
+}
+
+func TestParseKeysAreStable(t *testing.T) {
+	first, err := Parse(strings.NewReader(gNetTrackLog), FormatGNetTrack, Options{})
+	require.NoError(t, err)
+	second, err := Parse(strings.NewReader(gNetTrackLog), FormatGNetTrack, Options{})
+	require.NoError(t, err)
+	assert.Equal(t, first.Gps[0].Key, second.Gps[0].Key)
+}
@@ -0,0 +1,155 @@
+package drivetest
+
+import (
+	"fmt"
+	"io"
+	"simpleServer/internal/measurement/model"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const gNetTrackTimeLayout = "2006.01.02_15.04.05"
+
+var gNetTrackTechnologies = map[string]string{
+	"2G": model.TechGSM,
+	"3G": model.TechUMTS,
+	"4G": model.TechLTE,
+	"5G": model.TechNR,
+}
+
+// parseGNetTrack reads a tab separated G-NetTrack Pro export. Every row holds a position and a serving cell,
+// so each row gives one GPS fix and one scan sharing its time.
+func parseGNetTrack(r io.Reader, source string, opts Options) (*Log, error) {
+	result := &Log{}
+	var columns map[string]int
+	err := eachLine(r, func(line int, text string) {
+		fields := strings.Split(text, "\t")
+		if columns == nil {
+			columns = make(map[string]int, len(fields))
+			for i, name := range fields {
+				columns[strings.ToLower(strings.TrimSpace(name))] = i
+			}
+			return
+		}
+		row := gNetTrackRow{columns: columns, fields: fields}
+
+		ts, err := time.ParseInLocation(gNetTrackTimeLayout, row.get("timestamp"), opts.Location)
+		if err != nil {
+			result.Skipped++
+			return
+		}
+		lng, errLng := row.float("longitude")
+		lat, errLat := row.float("latitude")
+		if errLng != nil || errLat != nil {
+			result.Skipped++
+			return
+		}
+		key := recordKey(source, line)
+		speed, _ := row.float("speed")
+		altitude, _ := row.float("altitude")
+		heading, _ := row.float("heading")
+		result.Gps = append(result.Gps, model.GpsFix{
+			Key:      key,
+			Time:     ts,
+			Lng:      lng,
+			Lat:      lat,
+			Altitude: float32(altitude),
+			// G-NetTrack reports km/h, GpsData keeps m/s.
+			Speed:   float32(speed / 3.6),
+			Heading: float32(heading),
+		})
+
+		scan, err := row.scan()
+		if err != nil {
+			return
+		}
+		scan.Key, scan.Time = key, ts
+		result.Scans = append(result.Scans, *scan)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if columns == nil {
+		return nil, fmt.Errorf("empty G-NetTrack export")
+	}
+	return result, nil
+}
+
+type gNetTrackRow struct {
+	columns map[string]int
+	fields  []string
+}
+
+func (r gNetTrackRow) get(column string) string {
+	i, ok := r.columns[column]
+	if !ok || i >= len(r.fields) {
+		return ""
+	}
+	return strings.TrimSpace(r.fields[i])
+}
+
+func (r gNetTrackRow) float(column string) (float64, error) {
+	return strconv.ParseFloat(r.get(column), 64)
+}
+
+func (r gNetTrackRow) optionalFloat(column string) *float32 {
+	value, err := r.float(column)
+	if err != nil {
+		return nil
+	}
+	v := float32(value)
+	return &v
+}
+
+func (r gNetTrackRow) int(column string) (int64, error) {
+	return strconv.ParseInt(r.get(column), 10, 64)
+}
+
+func (r gNetTrackRow) scan() (*model.Scan, error) {
+	technology, ok := gNetTrackTechnologies[strings.ToUpper(r.get("networktech"))]
+	if !ok {
+		return nil, fmt.Errorf("unknown network technology %q", r.get("networktech"))
+	}
+	mcc, mnc, ok := splitOperator(r.get("operator"))
+	if !ok {
+		return nil, fmt.Errorf("invalid operator %q", r.get("operator"))
+	}
+	arfcn, err := r.int("arfcn")
+	if err != nil {
+		return nil, err
+	}
+	cid, err := r.int("cellid")
+	if err != nil {
+		return nil, err
+	}
+	lac, err := r.int("lac")
+	if err != nil {
+		return nil, err
+	}
+	level, err := r.int("level")
+	if err != nil {
+		return nil, err
+	}
+	scan := &model.Scan{
+		Technology: technology,
+		Arfcn:      arfcn,
+		Mcc:        mcc,
+		Mnc:        mnc,
+		LacTac:     int32(lac),
+		Cid:        int32(cid),
+		Dbm:        int32(level),
+	}
+	// Level and Qual hold the pilot power and quality of the serving technology.
+	switch technology {
+	case model.TechLTE, model.TechNR:
+		scan.Metrics.Rsrp, scan.Metrics.Rsrq, scan.Metrics.Sinr = r.optionalFloat("level"), r.optionalFloat("qual"), r.optionalFloat("snr")
+	case model.TechUMTS:
+		scan.Metrics.Rscp, scan.Metrics.EcIo = r.optionalFloat("level"), r.optionalFloat("qual")
+	}
+	if ta, err := r.int("ta"); err == nil {
+		value := int16(ta)
+		scan.Metrics.TimingAdvance = &value
+	}
+	return scan, nil
+}
@@ -0,0 +1,367 @@
+package drivetest
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"simpleServer/internal/measurement/model"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const knotsToMetersPerSecond = 0.514444
+
+// linePrefixTime matches an optional capture timestamp written by logging tools, e.g. "[2024-05-01 10:12:13.250]".
+var linePrefixTime = regexp.MustCompile(`^\[(\d{4}-\d{2}-\d{2}[ T]\d{2}:\d{2}:\d{2}(?:\.\d+)?)\]\s*`)
+
+// nmeaState carries the context AT responses are interpreted in: the last known time
+// and the registration reported by +COPS/+CREG, which incomplete +QENG reports are completed with.
+type nmeaState struct {
+	result *Log
+	source string
+	opts   Options
+
+	date     time.Time
+	lastTime time.Time
+
+	mcc, mnc   int16
+	technology string
+	lac, cid   int64
+}
+
+// parseNMEA reads a raw modem log: NMEA sentences interleaved with AT command output.
+// GPS fixes come from RMC/GGA sentences, scans from +QENG serving cell reports.
+func parseNMEA(r io.Reader, source string, opts Options) (*Log, error) {
+	s := &nmeaState{result: &Log{}, source: source, opts: opts}
+	err := eachLine(r, func(line int, text string) {
+		var lineTime time.Time
+		if m := linePrefixTime.FindStringSubmatch(text); m != nil {
+			if t, err := time.ParseInLocation("2006-01-02 15:04:05", strings.Replace(m[1], "T", " ", 1), opts.Location); err == nil {
+				lineTime = t
+			}
+			text = text[len(m[0]):]
+		}
+
+		var err error
+		switch {
+		case strings.HasPrefix(text, "$"):
+			err = s.sentence(line, text)
+		case strings.HasPrefix(text, "+COPS:"):
+			err = s.cops(strings.TrimPrefix(text, "+COPS:"))
+		case strings.HasPrefix(text, "+CREG:"), strings.HasPrefix(text, "+CEREG:"), strings.HasPrefix(text, "+CGREG:"):
+			err = s.creg(text[strings.Index(text, ":")+1:])
+		case strings.HasPrefix(text, "+QENG:"):
+			err = s.qeng(line, strings.TrimPrefix(text, "+QENG:"), lineTime)
+		default:
+			// AT commands echo, OK, and anything else the modem prints.
+			return
+		}
+		if err != nil {
+			s.result.Skipped++
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.result, nil
+}
+
+func (s *nmeaState) sentence(line int, text string) error {
+	if i := strings.Index(text, "*"); i >= 0 {
+		if !validChecksum(text[1:i], text[i+1:]) {
+			return fmt.Errorf("bad checksum")
+		}
+		text = text[:i]
+	}
+	fields := strings.Split(text, ",")
+	if len(fields[0]) < 6 {
+		return fmt.Errorf("short sentence")
+	}
+	switch fields[0][3:] {
+	case "RMC":
+		return s.rmc(line, fields)
+	case "GGA":
+		return s.gga(fields)
+	}
+	return nil
+}
+
+// rmc handles $xxRMC,hhmmss.ss,A,llll.ll,a,yyyyy.yy,a,x.x,x.x,ddmmyy,...
+func (s *nmeaState) rmc(line int, fields []string) error {
+	if len(fields) < 10 {
+		return fmt.Errorf("short RMC")
+	}
+	date, err := time.Parse("020106", fields[9])
+	if err != nil {
+		return err
+	}
+	s.date = date
+	ts, err := s.timeOfDay(fields[1])
+	if err != nil {
+		return err
+	}
+	s.lastTime = ts
+	if fields[2] != "A" {
+		// void fix, the receiver has no position yet.
+		return nil
+	}
+	lat, err := nmeaCoordinate(fields[3], fields[4])
+	if err != nil {
+		return err
+	}
+	lng, err := nmeaCoordinate(fields[5], fields[6])
+	if err != nil {
+		return err
+	}
+	speed, _ := strconv.ParseFloat(fields[7], 64)
+	heading, _ := strconv.ParseFloat(fields[8], 64)
+	s.result.Gps = append(s.result.Gps, model.GpsFix{
+		Key:     recordKey(s.source, line),
+		Time:    ts,
+		Lng:     lng,
+		Lat:     lat,
+		Speed:   float32(speed * knotsToMetersPerSecond),
+		Heading: float32(heading),
+	})
+	return nil
+}
+
+// gga handles $xxGGA,hhmmss.ss,llll.ll,a,yyyyy.yy,a,q,nn,h.h,alt,M,... and is only used for the altitude
+// of the RMC fix with the same time, since GGA carries no date.
+func (s *nmeaState) gga(fields []string) error {
+	if len(fields) < 10 || s.date.IsZero() {
+		return nil
+	}
+	ts, err := s.timeOfDay(fields[1])
+	if err != nil {
+		return err
+	}
+	altitude, err := strconv.ParseFloat(fields[9], 64)
+	if err != nil {
+		return nil
+	}
+	for i := len(s.result.Gps) - 1; i >= 0 && i >= len(s.result.Gps)-2; i-- {
+		if s.result.Gps[i].Time.Equal(ts) {
+			s.result.Gps[i].Altitude = float32(altitude)
+		}
+	}
+	return nil
+}
+
+func (s *nmeaState) timeOfDay(value string) (time.Time, error) {
+	if len(value) < 6 {
+		return time.Time{}, fmt.Errorf("invalid time %q", value)
+	}
+	clock, err := time.Parse("150405", value[:6])
+	if err != nil {
+		return time.Time{}, err
+	}
+	var nanos int
+	if len(value) > 7 && value[6] == '.' {
+		frac, _ := strconv.ParseFloat("0"+value[6:], 64)
+		nanos = int(frac * float64(time.Second))
+	}
+	// NMEA time is always UTC.
+	return time.Date(s.date.Year(), s.date.Month(), s.date.Day(), clock.Hour(), clock.Minute(), clock.Second(), nanos, time.UTC), nil
+}
+
+func nmeaCoordinate(value, hemisphere string) (float64, error) {
+	dot := strings.Index(value, ".")
+	if dot < 3 {
+		return 0, fmt.Errorf("invalid coordinate %q", value)
+	}
+	degrees, err := strconv.ParseFloat(value[:dot-2], 64)
+	if err != nil {
+		return 0, err
+	}
+	minutes, err := strconv.ParseFloat(value[dot-2:], 64)
+	if err != nil {
+		return 0, err
+	}
+	coordinate := degrees + minutes/60
+	if hemisphere == "S" || hemisphere == "W" {
+		coordinate = -coordinate
+	}
+	return coordinate, nil
+}
+
+func validChecksum(body, checksum string) bool {
+	expected, err := strconv.ParseUint(strings.TrimSpace(checksum), 16, 8)
+	if err != nil {
+		return false
+	}
+	var sum byte
+	for i := 0; i < len(body); i++ {
+		sum ^= body[i]
+	}
+	return sum == byte(expected)
+}
+
+// 3GPP TS 27.007 access technology values.
+var accessTechnologies = map[string]string{
+	"0": model.TechGSM, "1": model.TechGSM, "3": model.TechGSM,
+	"2": model.TechUMTS, "4": model.TechUMTS, "5": model.TechUMTS, "6": model.TechUMTS,
+	"7": model.TechLTE, "9": model.TechLTE,
+	"11": model.TechNR, "12": model.TechNR, "13": model.TechNR,
+}
+
+// cops handles +COPS: <mode>[,<format>,<oper>[,<AcT>]] with a numeric operator.
+func (s *nmeaState) cops(value string) error {
+	fields := splitATFields(value)
+	if len(fields) < 3 {
+		return nil
+	}
+	if fields[1] == "2" {
+		mcc, mnc, ok := splitOperator(fields[2])
+		if !ok {
+			return fmt.Errorf("invalid operator %q", fields[2])
+		}
+		s.mcc, s.mnc = mcc, mnc
+	}
+	if len(fields) > 3 {
+		if technology, ok := accessTechnologies[fields[3]]; ok {
+			s.technology = technology
+		}
+	}
+	return nil
+}
+
+// creg handles both the query response +CREG: <n>,<stat>[,<lac>,<ci>[,<AcT>]]
+// and the unsolicited +CREG: <stat>[,<lac>,<ci>[,<AcT>]]. The quoted lac tells the two forms apart.
+func (s *nmeaState) creg(value string) error {
+	raw := strings.Split(strings.TrimSpace(value), ",")
+	i := -1
+	for k := range raw {
+		if strings.HasPrefix(strings.TrimSpace(raw[k]), "\"") {
+			i = k
+			break
+		}
+	}
+	fields := splitATFields(value)
+	if i < 0 || i+1 >= len(fields) {
+		return nil
+	}
+	lac, err := strconv.ParseInt(fields[i], 16, 64)
+	if err != nil {
+		return err
+	}
+	cid, err := strconv.ParseInt(fields[i+1], 16, 64)
+	if err != nil {
+		return err
+	}
+	s.lac, s.cid = lac, cid
+	if len(fields) > i+2 {
+		if technology, ok := accessTechnologies[fields[i+2]]; ok {
+			s.technology = technology
+		}
+	}
+	return nil
+}
+
+// qeng handles Quectel +QENG: "servingcell",<state>,<rat>,... reports, which carry a full cell identity and level.
+func (s *nmeaState) qeng(line int, value string, lineTime time.Time) error {
+	fields := splitATFields(value)
+	if len(fields) < 3 || fields[0] != "servingcell" {
+		return nil
+	}
+	ts := lineTime
+	if ts.IsZero() {
+		ts = s.lastTime
+	}
+	if ts.IsZero() {
+		return fmt.Errorf("scan without time")
+	}
+
+	scan := model.Scan{Key: recordKey(s.source, line), Time: ts, Mcc: s.mcc, Mnc: s.mnc}
+	var err error
+	switch fields[2] {
+	case "GSM":
+		// "servingcell",<state>,"GSM",<mcc>,<mnc>,<lac>,<cellid>,<bsic>,<arfcn>,<band>,<rxlev>,<txp>,<rla>,<drx>,
+		// <c1>,<c2>,<gprs>,<tch>,<ts>,<ta>,...
+		err = s.qengFields(&scan, fields, model.TechGSM, 3, 4, 5, 6, 8, 10)
+		if ta := optionalFloat(fields, 19); ta != nil {
+			value := int16(*ta)
+			scan.Metrics.TimingAdvance = &value
+		}
+	case "WCDMA":
+		// "servingcell",<state>,"WCDMA",<mcc>,<mnc>,<lac>,<cellid>,<uarfcn>,<psc>,<rac>,<rscp>,<ecio>,...
+		err = s.qengFields(&scan, fields, model.TechUMTS, 3, 4, 5, 6, 7, 10)
+		scan.Metrics.Rscp, scan.Metrics.EcIo = optionalFloat(fields, 10), optionalFloat(fields, 11)
+	case "LTE":
+		// "servingcell",<state>,"LTE",<is_tdd>,<mcc>,<mnc>,<cellid>,<pcid>,<earfcn>,<band>,<ul_bw>,<dl_bw>,<tac>,
+		// <rsrp>,<rsrq>,<rssi>,<sinr>,...
+		err = s.qengFields(&scan, fields, model.TechLTE, 4, 5, 12, 6, 8, 13)
+		scan.Metrics.Rsrp, scan.Metrics.Rsrq = optionalFloat(fields, 13), optionalFloat(fields, 14)
+		if sinr := optionalFloat(fields, 16); sinr != nil {
+			// reported in 1/5 dB steps over -20..30 dB.
+			*sinr = *sinr/5 - 20
+			scan.Metrics.Sinr = sinr
+		}
+	case "NR5G-SA":
+		// "servingcell",<state>,"NR5G-SA",<duplex>,<mcc>,<mnc>,<cellid>,<pcid>,<tac>,<arfcn>,<band>,<dl_bw>,
+		// <rsrp>,<rsrq>,<sinr>,...
+		err = s.qengFields(&scan, fields, model.TechNR, 4, 5, 8, 6, 9, 12)
+		scan.Metrics.Rsrp, scan.Metrics.Rsrq, scan.Metrics.Sinr = optionalFloat(fields, 12), optionalFloat(fields, 13), optionalFloat(fields, 14)
+	default:
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	s.result.Scans = append(s.result.Scans, scan)
+	return nil
+}
+
+func (s *nmeaState) qengFields(scan *model.Scan, fields []string, technology string, mcc, mnc, lac, cid, arfcn, level int) error {
+	if len(fields) <= level {
+		return fmt.Errorf("short %s report", technology)
+	}
+	scan.Technology = technology
+	if m, err := strconv.Atoi(fields[mcc]); err == nil {
+		scan.Mcc = int16(m)
+	}
+	if n, err := strconv.Atoi(fields[mnc]); err == nil {
+		scan.Mnc = int16(n)
+	}
+	// cell identity is "-" while the modem is searching, then the last +CREG registration is used.
+	lacValue, errLac := strconv.ParseInt(fields[lac], 16, 64)
+	cidValue, errCid := strconv.ParseInt(fields[cid], 16, 64)
+	if errLac != nil || errCid != nil {
+		if s.cid == 0 || s.technology != technology {
+			return fmt.Errorf("%s report without cell identity", technology)
+		}
+		lacValue, cidValue = s.lac, s.cid
+	}
+	arfcnValue, err := strconv.ParseInt(fields[arfcn], 10, 64)
+	if err != nil {
+		return err
+	}
+	dbm, err := strconv.Atoi(fields[level])
+	if err != nil {
+		return err
+	}
+	scan.LacTac, scan.Cid, scan.Arfcn, scan.Dbm = int32(lacValue), int32(cidValue), arfcnValue, int32(dbm)
+	s.technology, s.lac, s.cid = technology, lacValue, cidValue
+	return nil
+}
+
+func optionalFloat(fields []string, i int) *float32 {
+	if i >= len(fields) {
+		return nil
+	}
+	value, err := strconv.ParseFloat(fields[i], 32)
+	if err != nil {
+		return nil
+	}
+	v := float32(value)
+	return &v
+}
+
+func splitATFields(value string) []string {
+	fields := strings.Split(strings.TrimSpace(value), ",")
+	for i := range fields {
+		fields[i] = strings.Trim(strings.TrimSpace(fields[i]), "\"")
+	}
+	return fields
+}
@@ -0,0 +1,239 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/gofrs/uuid"
+	"github.com/jmoiron/sqlx"
+	"simpleServer/dbutils"
+	"simpleServer/internal/estimation/model"
+	"simpleServer/pkg/logging"
+)
+
+var (
+	ErrCandidateNotFound = errors.New("cell candidate not found")
+	ErrCandidateReviewed = errors.New("cell candidate already reviewed")
+)
+
+type EstimationDB interface {
+	// GetUnknownCells returns cells without "BsInfo" that have at least minSamples samples
+	// and were not reviewed yet.
+	GetUnknownCells(ctx context.Context, minSamples int) ([]model.UnknownCell, error)
+
+	GetCellSamples(ctx context.Context, gsmId uuid.UUID, limit int) ([]model.Sample, error)
+
+	SaveCandidate(ctx context.Context, gsmId uuid.UUID, estimate *model.Estimate) error
+
+	GetCandidates(ctx context.Context, status model.CandidateStatus) ([]model.Candidate, error)
+
+	GetCandidateById(ctx context.Context, id uuid.UUID) (*model.Candidate, error)
+
+	Promote(ctx context.Context, id uuid.UUID, promotion *model.Promotion) (*model.Candidate, error)
+
+	Reject(ctx context.Context, id uuid.UUID, comment *string) (*model.Candidate, error)
+
+	// RunExclusive runs f unless another server instance is already estimating.
+	RunExclusive(ctx context.Context, f func(ctx context.Context) error) (bool, error)
+}
+
+type estimationDB struct {
+	dbh *sqlx.DB
+}
+
+func NewEstimationDB(dbh *sqlx.DB) EstimationDB {
+	return &estimationDB{dbh: dbh}
+}
+
+// estimationLockKey is the advisory lock held while candidates are recomputed.
+const estimationLockKey = 0x63656c6c
+
+const candidateColumns = `CC.id, CC.gsm, CC.method, st_asewkb(CC.coordinates) as coordinates, CC.azimuth, CC.spread, CC.samples,
+		CC.status, CC.bs, CC.comment, CC.created_at, CC.updated_at,
+		GD.cid, GD.lac_tac, GD.operator_id, arfcn.arfcn_number, "CellularNetworkType".type as technology
+	from "CellCandidates" CC
+	inner join "GsmData" GD on GD.id = CC.gsm
+	inner join arfcn on arfcn.id = GD.arfcn
+	left join "CellularNetworkType" on arfcn."CellularNetworkType" = "CellularNetworkType".id`
+
+func (e *estimationDB) GetUnknownCells(ctx context.Context, minSamples int) ([]model.UnknownCell, error) {
+	logger := logging.FromContext(ctx)
+	logger.Debugw("estimation fetch unknown cells", "minSamples", minSamples)
+	query := `select GD.id as gsm_id, GD.cid, GD.lac_tac, GD.operator_id, arfcn.arfcn_number, count(*) as samples
+		from "GsmData" GD
+		inner join arfcn on arfcn.id = GD.arfcn
+		inner join "GsmHistory" GH on GH.gsm = GD.id
+		where not exists (
+			select 1 from "BsInfo"
+			where "BsInfo".arfcn = GD.arfcn and "BsInfo".cid = GD.cid and "BsInfo".lac_tac = GD.lac_tac
+		)
+		and not exists (
+			select 1 from "CellCandidates" CC where CC.gsm = GD.id and CC.status <> 'pending'
+		)
+		group by GD.id, arfcn.arfcn_number
+		having count(*) >= :MinSamples`
+
+	var cells []model.UnknownCell
+	if err := dbutils.NamedSelect(ctx, e.dbh, &cells, query, map[string]interface{}{"MinSamples": minSamples}); err != nil {
+		return nil, err
+	}
+	return cells, nil
+}
+
+func (e *estimationDB) GetCellSamples(ctx context.Context, gsmId uuid.UUID, limit int) ([]model.Sample, error) {
+	query := `select st_x(GPS.coordinates) as lng, st_y(GPS.coordinates) as lat, cast(GH.dbm as float8) as dbm
+		from "GsmHistory" GH
+		inner join "GpsData" GPS on GPS.id = GH.gps
+		where GH.gsm = :Gsm and GH.dbm is not null
+		order by GH.dbm desc
+		limit :Limit`
+
+	var samples []model.Sample
+	if err := dbutils.NamedSelect(ctx, e.dbh, &samples, query, map[string]interface{}{"Gsm": gsmId, "Limit": limit}); err != nil {
+		return nil, err
+	}
+	return samples, nil
+}
+
+// SaveCandidate replaces the pending estimate of the cell, so reruns refine it as samples arrive.
+func (e *estimationDB) SaveCandidate(ctx context.Context, gsmId uuid.UUID, estimate *model.Estimate) error {
+	id, err := uuid.NewV4()
+	if err != nil {
+		return err
+	}
+	query := `insert into "CellCandidates" (id, gsm, method, coordinates, azimuth, spread, samples)
+		values (:Id, :Gsm, :Method, st_setsrid(st_makepoint(:Lng, :Lat), 4326), :Azimuth, :Spread, :Samples)
+		on conflict (gsm) where status = 'pending' do update
+		set method = excluded.method,
+			coordinates = excluded.coordinates,
+			azimuth = excluded.azimuth,
+			spread = excluded.spread,
+			samples = excluded.samples,
+			updated_at = now()`
+	_, err = dbutils.NamedExec(ctx, e.dbh, query, map[string]interface{}{
+		"Id":      id,
+		"Gsm":     gsmId,
+		"Method":  estimate.Method,
+		"Lng":     estimate.Lng,
+		"Lat":     estimate.Lat,
+		"Azimuth": estimate.Azimuth,
+		"Spread":  estimate.Spread,
+		"Samples": estimate.Samples,
+	})
+	return err
+}
+
+func (e *estimationDB) GetCandidates(ctx context.Context, status model.CandidateStatus) ([]model.Candidate, error) {
+	logger := logging.FromContext(ctx)
+	logger.Debugw("estimation fetch candidates", "status", status)
+	query := `select ` + candidateColumns + `
+		where CC.status = :Status
+		order by CC.samples desc, CC.created_at`
+
+	var candidates []model.Candidate
+	if err := dbutils.NamedSelect(ctx, e.dbh, &candidates, query, map[string]interface{}{"Status": status}); err != nil {
+		return nil, err
+	}
+	return candidates, nil
+}
+
+func (e *estimationDB) GetCandidateById(ctx context.Context, id uuid.UUID) (*model.Candidate, error) {
+	return e.getCandidate(ctx, e.dbh, id, false)
+}
+
+func (e *estimationDB) getCandidate(ctx context.Context, db sqlx.QueryerContext, id uuid.UUID, forUpdate bool) (*model.Candidate, error) {
+	query := `select ` + candidateColumns + ` where CC.id = $1`
+	if forUpdate {
+		query += ` for update of CC`
+	}
+	var candidate model.Candidate
+	if err := dbutils.Get(ctx, db, &candidate, query, id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrCandidateNotFound
+		}
+		return nil, err
+	}
+	return &candidate, nil
+}
+
+// Promote registers the candidate cell in "BsInfo", on a new station or on an existing one.
+func (e *estimationDB) Promote(ctx context.Context, id uuid.UUID, promotion *model.Promotion) (*model.Candidate, error) {
+	logger := logging.FromContext(ctx)
+	logger.Debugw("estimation promote candidate", "id", id)
+
+	var candidate *model.Candidate
+	err := dbutils.RunTx(ctx, e.dbh, func(tx *sqlx.Tx) error {
+		var err error
+		if candidate, err = e.getCandidate(ctx, tx, id, true); err != nil {
+			return err
+		}
+		if candidate.Status != model.StatusPending {
+			return ErrCandidateReviewed
+		}
+
+		bs := promotion.Bs
+		if bs == nil {
+			lng, lat := candidate.Coordinates.X(), candidate.Coordinates.Y()
+			if promotion.Lng != nil && promotion.Lat != nil {
+				lng, lat = *promotion.Lng, *promotion.Lat
+			}
+			var created uint64
+			query := `insert into "BaseStations" (address, coordinates, region, comment)
+				values ($1, st_setsrid(st_makepoint($2, $3), 4326), $4, $5) returning id`
+			if err := dbutils.Get(ctx, tx, &created, query, promotion.Address, lng, lat, promotion.RegionId, promotion.Comment); err != nil {
+				return err
+			}
+			bs = &created
+		}
+
+		azimuth := promotion.Azimuth
+		if azimuth == nil && candidate.Azimuth != nil {
+			value := int16(*candidate.Azimuth)
+			azimuth = &value
+		}
+		query := `insert into "BsInfo" (bs, arfcn, cid, lac_tac, operator_id, azimuth, sector_number, using_start, comment)
+			select $1, GD.arfcn, GD.cid, GD.lac_tac, GD.operator_id, $2, $3, now(), $4
+			from "GsmData" GD where GD.id = $5`
+		if _, err := dbutils.Exec(ctx, tx, query, *bs, azimuth, promotion.SectorNumber, promotion.Comment, candidate.GsmId); err != nil {
+			return err
+		}
+
+		query = `update "CellCandidates" set status = $1, bs = $2, comment = $3, updated_at = now() where id = $4`
+		if _, err := dbutils.Exec(ctx, tx, query, model.StatusPromoted, *bs, promotion.Comment, id); err != nil {
+			return err
+		}
+		candidate, err = e.getCandidate(ctx, tx, id, false)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return candidate, nil
+}
+
+func (e *estimationDB) Reject(ctx context.Context, id uuid.UUID, comment *string) (*model.Candidate, error) {
+	var candidate *model.Candidate
+	err := dbutils.RunTx(ctx, e.dbh, func(tx *sqlx.Tx) error {
+		var err error
+		if candidate, err = e.getCandidate(ctx, tx, id, true); err != nil {
+			return err
+		}
+		if candidate.Status != model.StatusPending {
+			return ErrCandidateReviewed
+		}
+		query := `update "CellCandidates" set status = $1, comment = $2, updated_at = now() where id = $3`
+		if _, err := dbutils.Exec(ctx, tx, query, model.StatusRejected, comment, id); err != nil {
+			return err
+		}
+		candidate, err = e.getCandidate(ctx, tx, id, false)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return candidate, nil
+}
+
+func (e *estimationDB) RunExclusive(ctx context.Context, f func(ctx context.Context) error) (bool, error) {
+	return dbutils.WithAdvisoryLock(ctx, e.dbh, estimationLockKey, f)
+}
@@ -0,0 +1,176 @@
+package estimation
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"github.com/gofrs/uuid"
+	"net/http"
+	"simpleServer/internal/auth"
+	authModel "simpleServer/internal/auth/model"
+	"simpleServer/internal/config"
+	"simpleServer/internal/estimation/database"
+	"simpleServer/internal/estimation/model"
+	"simpleServer/internal/middleware"
+	"simpleServer/internal/middleware/handler"
+	"simpleServer/pkg/logging"
+	"simpleServer/pkg/validate"
+)
+
+type Handler struct {
+	estimationDB database.EstimationDB
+	job          *Job
+}
+
+func NewHandler(db database.EstimationDB, job *Job) *Handler {
+	return &Handler{estimationDB: db, job: job}
+}
+
+func bindCandidateId(c *gin.Context) (uuid.UUID, *handler.Response) {
+	id, err := uuid.FromString(c.Param("id"))
+	if err != nil {
+		return uuid.Nil, handler.NewErrorResponse(http.StatusBadRequest, handler.InvalidUriValue, "invalid id in uri",
+			validate.NewValidationErrorDetails("id", "required uuid format", c.Param("id")))
+	}
+	return id, nil
+}
+
+// candidateErrorResponse maps review errors to responses, other errors are internal.
+func candidateErrorResponse(err error) *handler.Response {
+	switch {
+	case errors.Is(err, database.ErrCandidateNotFound):
+		return handler.NewErrorResponse(http.StatusNotFound, handler.NotFoundEntity, "cell candidate not found", nil)
+	case errors.Is(err, database.ErrCandidateReviewed):
+		return handler.NewErrorResponse(http.StatusConflict, handler.DuplicateEntry, "cell candidate already reviewed", nil)
+	}
+	return handler.NewInternalErrorResponse(err)
+}
+
+func (h *Handler) GetCandidates(c *gin.Context) {
+	handler.HandleRequest(c, func(c *gin.Context) *handler.Response {
+		status := model.CandidateStatus(c.DefaultQuery("status", string(model.StatusPending)))
+		if status != model.StatusPending && status != model.StatusPromoted && status != model.StatusRejected {
+			return handler.NewErrorResponse(http.StatusBadRequest, handler.InvalidQueryValue, "invalid status",
+				validate.NewValidationErrorDetails("status", "one of pending, promoted, rejected", string(status)))
+		}
+		candidates, err := h.estimationDB.GetCandidates(c, status)
+		if err != nil {
+			logging.FromContext(c).Errorw("estimation.GetCandidates failed", "err", err)
+			return handler.NewInternalErrorResponse(err)
+		}
+		return handler.NewSuccessResponse(http.StatusOK, NewCandidatesResponse(candidates))
+	})
+}
+
+func (h *Handler) GetCandidateById(c *gin.Context) {
+	handler.HandleRequest(c, func(c *gin.Context) *handler.Response {
+		id, res := bindCandidateId(c)
+		if res != nil {
+			return res
+		}
+		candidate, err := h.estimationDB.GetCandidateById(c, id)
+		if err != nil {
+			return candidateErrorResponse(err)
+		}
+		return handler.NewSuccessResponse(http.StatusOK, NewCandidateResponse(candidate))
+	})
+}
+
+func (h *Handler) PromoteCandidate(c *gin.Context) {
+	handler.HandleRequest(c, func(c *gin.Context) *handler.Response {
+		logger := logging.FromContext(c)
+		id, res := bindCandidateId(c)
+		if res != nil {
+			return res
+		}
+		type RequestBody struct {
+			Bs           *uint64    `json:"bs"`
+			Address      string     `json:"address"`
+			RegionId     *uuid.UUID `json:"regionId"`
+			Coordinates  []float64  `json:"coordinates" binding:"omitempty,len=2"`
+			Azimuth      *int16     `json:"azimuth" binding:"omitempty,min=0,max=359"`
+			SectorNumber int16      `json:"sectorNumber"`
+			Comment      *string    `json:"comment"`
+		}
+		var body RequestBody
+		if err := c.ShouldBindJSON(&body); err != nil {
+			logger.Errorw("estimation.PromoteCandidate failed to bind", "err", err)
+			var details []*validate.ValidationErrDetail
+			if vErrs, ok := err.(validator.ValidationErrors); ok {
+				details = validate.ValidationErrorDetails(&body, "json", vErrs)
+			}
+			return handler.NewErrorResponse(http.StatusBadRequest, handler.InvalidBodyValue, "invalid promotion", details)
+		}
+		promotion := &model.Promotion{
+			Bs:           body.Bs,
+			Address:      body.Address,
+			RegionId:     body.RegionId,
+			Azimuth:      body.Azimuth,
+			SectorNumber: body.SectorNumber,
+			Comment:      body.Comment,
+		}
+		if len(body.Coordinates) == 2 {
+			promotion.Lng, promotion.Lat = &body.Coordinates[0], &body.Coordinates[1]
+		}
+		candidate, err := h.estimationDB.Promote(c, id, promotion)
+		if err != nil {
+			logger.Errorw("estimation.PromoteCandidate failed", "id", id, "err", err)
+			return candidateErrorResponse(err)
+		}
+		return handler.NewSuccessResponse(http.StatusOK, NewCandidateResponse(candidate))
+	})
+}
+
+func (h *Handler) RejectCandidate(c *gin.Context) {
+	handler.HandleRequest(c, func(c *gin.Context) *handler.Response {
+		id, res := bindCandidateId(c)
+		if res != nil {
+			return res
+		}
+		type RequestBody struct {
+			Comment *string `json:"comment"`
+		}
+		var body RequestBody
+		if c.Request.ContentLength != 0 {
+			if err := c.ShouldBindJSON(&body); err != nil {
+				return handler.NewErrorResponse(http.StatusBadRequest, handler.InvalidBodyValue, "invalid rejection", nil)
+			}
+		}
+		candidate, err := h.estimationDB.Reject(c, id, body.Comment)
+		if err != nil {
+			logging.FromContext(c).Errorw("estimation.RejectCandidate failed", "id", id, "err", err)
+			return candidateErrorResponse(err)
+		}
+		return handler.NewSuccessResponse(http.StatusOK, NewCandidateResponse(candidate))
+	})
+}
+
+// RunEstimation recomputes candidates right away instead of waiting for the next scheduled run.
+func (h *Handler) RunEstimation(c *gin.Context) {
+	handler.HandleRequest(c, func(c *gin.Context) *handler.Response {
+		result, err := h.job.Run(c.Request.Context())
+		if errors.Is(err, ErrAlreadyRunning) {
+			return handler.NewErrorResponse(http.StatusConflict, handler.DuplicateEntry, err.Error(), nil)
+		}
+		if err != nil {
+			logging.FromContext(c).Errorw("estimation.RunEstimation failed", "err", err)
+			return handler.NewInternalErrorResponse(err)
+		}
+		return handler.NewSuccessResponse(http.StatusOK, result)
+	})
+}
+
+func RouteV1(cfg *config.Config, h *Handler, a *auth.Authenticator, r *gin.Engine) {
+	v1 := r.Group("v1/api")
+	v1.Use(middleware.CorsMiddleware(), middleware.RequestIDMiddleware(), middleware.TimeoutMiddleware(cfg.ServerConfig.WriteTimeout))
+
+	candidatesV1 := v1.Group("cellCandidates")
+	candidatesV1.Use(a.Authenticate(), a.Require(authModel.PermissionAnalyze))
+	{
+		candidatesV1.GET("", h.GetCandidates)
+		candidatesV1.GET("/:id", h.GetCandidateById)
+		candidatesV1.POST("/:id/promote", h.PromoteCandidate)
+		candidatesV1.POST("/:id/reject", h.RejectCandidate)
+		candidatesV1.POST("/run", h.RunEstimation)
+	}
+}
@@ -0,0 +1,76 @@
+package estimation
+
+import (
+	"context"
+	"fmt"
+	"go.uber.org/fx"
+	"simpleServer/internal/config"
+	"simpleServer/internal/estimation/database"
+	"simpleServer/internal/estimation/model"
+	"simpleServer/pkg/logging"
+	"simpleServer/pkg/periodic"
+)
+
+var ErrAlreadyRunning = fmt.Errorf("estimation is %w", periodic.ErrAlreadyRunning)
+
+// Job recomputes location candidates of unknown cells, periodically when enabled and on demand.
+type Job struct {
+	estimationDB database.EstimationDB
+	cfg          config.EstimationConfig
+}
+
+func NewJob(lc fx.Lifecycle, cfg *config.Config, db database.EstimationDB) *Job {
+	job := &Job{estimationDB: db, cfg: cfg.EstimationConfig}
+	if !job.cfg.Enabled || job.cfg.Interval <= 0 {
+		return job
+	}
+
+	periodic.Start(lc, "cell estimation", job.cfg.Interval, func(ctx context.Context) error {
+		result, err := job.Run(ctx)
+		if err == nil {
+			logging.DefaultLogger().Infow("cell estimation done", "cells", result.Cells, "estimated", result.Estimated, "failed", result.Failed)
+		}
+		return err
+	})
+	return job
+}
+
+// Run estimates every unknown cell with enough samples and stores the results as pending candidates.
+func (j *Job) Run(ctx context.Context) (*model.RunResult, error) {
+	result := &model.RunResult{}
+	acquired, err := j.estimationDB.RunExclusive(ctx, func(ctx context.Context) error {
+		logger := logging.FromContext(ctx)
+		cells, err := j.estimationDB.GetUnknownCells(ctx, j.cfg.MinSamples)
+		if err != nil {
+			return err
+		}
+		result.Cells = len(cells)
+		for _, cell := range cells {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			samples, err := j.estimationDB.GetCellSamples(ctx, cell.GsmId, j.cfg.MaxSamples)
+			if err != nil {
+				return err
+			}
+			estimate, err := Locate(samples, Options{Method: j.cfg.Method, MinSamples: j.cfg.MinSamples})
+			if err != nil {
+				logger.Debugw("cell estimation skipped cell", "gsm", cell.GsmId, "err", err)
+				result.Failed++
+				continue
+			}
+			if err := j.estimationDB.SaveCandidate(ctx, cell.GsmId, estimate); err != nil {
+				return err
+			}
+			result.Estimated++
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !acquired {
+		return nil, ErrAlreadyRunning
+	}
+	return result, nil
+}
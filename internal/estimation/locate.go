@@ -0,0 +1,241 @@
+package estimation
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"simpleServer/internal/estimation/model"
+	"simpleServer/pkg/geo"
+)
+
+const (
+	// samples closer than linkDistance meters belong to the same cluster.
+	linkDistance = 1000.0
+	// gradient search looks for the station this far from the centroid at most.
+	maxSearchDistance = 5000.0
+	searchStep        = 25.0
+	// the gradient of a plane fitted to the levels is ignored below minGradient dB per meter.
+	minGradient = 0.001
+	// samples pointing in directions this close to uniform give no azimuth.
+	minAzimuthResultant = 0.3
+	pathLossExponent    = 3.0
+)
+
+var ErrNotEnoughSamples = errors.New("not enough samples")
+
+type Options struct {
+	Method     string
+	MinSamples int
+}
+
+type point struct {
+	x, y, dbm, weight float64
+}
+
+// Locate estimates where the station of a cell stands from the levels its samples were received with.
+// Only the cluster of samples with the largest total weight is used, so reflections and
+// overshooting far away from the main coverage area don't drag the estimate.
+func Locate(samples []model.Sample, opts Options) (*model.Estimate, error) {
+	if opts.Method == "" {
+		opts.Method = model.MethodCentroid
+	}
+	if opts.Method != model.MethodCentroid && opts.Method != model.MethodGradient {
+		return nil, fmt.Errorf("unknown estimation method %q", opts.Method)
+	}
+	if len(samples) == 0 || len(samples) < opts.MinSamples {
+		return nil, ErrNotEnoughSamples
+	}
+
+	strongest := 0
+	for i := range samples {
+		if samples[i].Dbm > samples[strongest].Dbm {
+			strongest = i
+		}
+	}
+	proj := geo.NewProjection(samples[strongest].Lng, samples[strongest].Lat)
+	points := make([]point, len(samples))
+	for i, s := range samples {
+		x, y := proj.Forward(s.Lng, s.Lat)
+		// amplitude relative to the strongest sample, so a 6 dB weaker sample counts half.
+		points[i] = point{x: x, y: y, dbm: s.Dbm, weight: math.Pow(10, (s.Dbm-samples[strongest].Dbm)/20)}
+	}
+	points = heaviestCluster(points)
+	if len(points) < opts.MinSamples {
+		return nil, ErrNotEnoughSamples
+	}
+
+	estimate := &model.Estimate{Method: model.MethodCentroid, Samples: len(points)}
+	x, y := weightedCentroid(points)
+	if opts.Method == model.MethodGradient {
+		if gx, gy, ok := levelGradient(points); ok {
+			x, y = searchAlong(points, x, y, gx, gy)
+			estimate.Method = model.MethodGradient
+		}
+	}
+	estimate.Lng, estimate.Lat = proj.Inverse(x, y)
+	estimate.Azimuth = azimuth(points, x, y)
+	estimate.Spread = spread(points, x, y)
+	return estimate, nil
+}
+
+// heaviestCluster groups points by single linkage and returns the group with the largest total weight.
+// Points are bucketed into a grid of linkDistance cells, so only neighbouring buckets are compared.
+func heaviestCluster(points []point) []point {
+	type bucket struct{ i, j int }
+	buckets := make(map[bucket][]int)
+	for idx, p := range points {
+		b := bucket{int(math.Floor(p.x / linkDistance)), int(math.Floor(p.y / linkDistance))}
+		buckets[b] = append(buckets[b], idx)
+	}
+
+	labels := make([]int, len(points))
+	for i := range labels {
+		labels[i] = -1
+	}
+	var weights []float64
+	for start := range points {
+		if labels[start] >= 0 {
+			continue
+		}
+		label := len(weights)
+		weights = append(weights, 0)
+		labels[start] = label
+		queue := []int{start}
+		for len(queue) > 0 {
+			idx := queue[0]
+			queue = queue[1:]
+			p := points[idx]
+			weights[label] += p.weight
+			bi, bj := int(math.Floor(p.x/linkDistance)), int(math.Floor(p.y/linkDistance))
+			for di := -1; di <= 1; di++ {
+				for dj := -1; dj <= 1; dj++ {
+					for _, other := range buckets[bucket{bi + di, bj + dj}] {
+						if labels[other] < 0 && math.Hypot(points[other].x-p.x, points[other].y-p.y) <= linkDistance {
+							labels[other] = label
+							queue = append(queue, other)
+						}
+					}
+				}
+			}
+		}
+	}
+
+	best := 0
+	for label, weight := range weights {
+		if weight > weights[best] {
+			best = label
+		}
+	}
+	cluster := make([]point, 0, len(points))
+	for idx, p := range points {
+		if labels[idx] == best {
+			cluster = append(cluster, p)
+		}
+	}
+	return cluster
+}
+
+func weightedCentroid(points []point) (x, y float64) {
+	var total float64
+	for _, p := range points {
+		x += p.x * p.weight
+		y += p.y * p.weight
+		total += p.weight
+	}
+	return x / total, y / total
+}
+
+// levelGradient fits the plane dbm = a + b*x + c*y by least squares and returns its unit gradient,
+// the direction the level grows in.
+func levelGradient(points []point) (gx, gy float64, ok bool) {
+	if len(points) < 3 {
+		return 0, 0, false
+	}
+	var n, sx, sy, sz, sxx, syy, sxy, sxz, syz float64
+	for _, p := range points {
+		n++
+		sx += p.x
+		sy += p.y
+		sz += p.dbm
+		sxx += p.x * p.x
+		syy += p.y * p.y
+		sxy += p.x * p.y
+		sxz += p.x * p.dbm
+		syz += p.y * p.dbm
+	}
+	// centred sums eliminate the intercept.
+	cxx, cyy, cxy := sxx-sx*sx/n, syy-sy*sy/n, sxy-sx*sy/n
+	cxz, cyz := sxz-sx*sz/n, syz-sy*sz/n
+	det := cxx*cyy - cxy*cxy
+	if math.Abs(det) < 1e-9 {
+		return 0, 0, false
+	}
+	b := (cxz*cyy - cyz*cxy) / det
+	c := (cyz*cxx - cxz*cxy) / det
+	norm := math.Hypot(b, c)
+	if norm < minGradient {
+		return 0, 0, false
+	}
+	return b / norm, c / norm, true
+}
+
+// searchAlong walks from x, y in the gradient direction and keeps the position where a
+// log-distance path loss model explains the levels best.
+func searchAlong(points []point, x, y, gx, gy float64) (float64, float64) {
+	bestX, bestY := x, y
+	bestResidual := math.Inf(1)
+	for t := 0.0; t <= maxSearchDistance; t += searchStep {
+		cx, cy := x+gx*t, y+gy*t
+		if residual := pathLossResidual(points, cx, cy); residual < bestResidual {
+			bestX, bestY, bestResidual = cx, cy, residual
+		}
+	}
+	return bestX, bestY
+}
+
+// pathLossResidual fits dbm = p0 - 10*n*log10(d) with a known exponent and returns the sum of squared errors.
+func pathLossResidual(points []point, x, y float64) float64 {
+	loss := make([]float64, len(points))
+	var p0 float64
+	for i, p := range points {
+		d := math.Max(math.Hypot(p.x-x, p.y-y), 10)
+		loss[i] = 10 * pathLossExponent * math.Log10(d)
+		p0 += p.dbm + loss[i]
+	}
+	p0 /= float64(len(points))
+	var residual float64
+	for i, p := range points {
+		e := p.dbm - (p0 - loss[i])
+		residual += e * e
+	}
+	return residual
+}
+
+// azimuth is the direction of the weighted resultant of unit vectors pointing from the station to the samples.
+func azimuth(points []point, x, y float64) *float64 {
+	var rx, ry, total float64
+	for _, p := range points {
+		dx, dy := p.x-x, p.y-y
+		d := math.Hypot(dx, dy)
+		if d < 1 {
+			continue
+		}
+		rx += dx / d * p.weight
+		ry += dy / d * p.weight
+		total += p.weight
+	}
+	if total == 0 || math.Hypot(rx, ry)/total < minAzimuthResultant {
+		return nil
+	}
+	deg := math.Mod(math.Atan2(rx, ry)*180/math.Pi+360, 360)
+	return &deg
+}
+
+func spread(points []point, x, y float64) float64 {
+	var sum, total float64
+	for _, p := range points {
+		sum += math.Hypot(p.x-x, p.y-y) * p.weight
+		total += p.weight
+	}
+	return sum / total
+}
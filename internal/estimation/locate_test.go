@@ -0,0 +1,78 @@
+package estimation
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"math"
+	"simpleServer/internal/estimation/model"
+	"simpleServer/pkg/geo"
+	"testing"
+)
+
+const towerLng, towerLat = 30.3, 59.95
+
+// sectorSamples simulates a sector pointing east: samples spread over ±60° around the azimuth,
+// their level falling with a log-distance path loss.
+func sectorSamples() []model.Sample {
+	proj := geo.NewProjection(towerLng, towerLat)
+	var samples []model.Sample
+	for d := 200.0; d <= 2000; d += 100 {
+		for a := 30.0; a <= 150; a += 10 {
+			rad := a * math.Pi / 180
+			lng, lat := proj.Inverse(d*math.Sin(rad), d*math.Cos(rad))
+			samples = append(samples, model.Sample{Lng: lng, Lat: lat, Dbm: -30 - 30*math.Log10(d)})
+		}
+	}
+	return samples
+}
+
+func TestLocateGradient(t *testing.T) {
+	samples := sectorSamples()
+	// a weak overshoot far away must not drag the estimate.
+	outlier := geo.NewProjection(towerLng, towerLat)
+	for i := 0; i < 5; i++ {
+		lng, lat := outlier.Inverse(-12000, float64(i)*50)
+		samples = append(samples, model.Sample{Lng: lng, Lat: lat, Dbm: -112})
+	}
+
+	estimate, err := Locate(samples, Options{Method: model.MethodGradient, MinSamples: 10})
+	require.NoError(t, err)
+	assert.Equal(t, model.MethodGradient, estimate.Method)
+	assert.Equal(t, len(samples)-5, estimate.Samples)
+	assert.Less(t, geo.Distance(towerLng, towerLat, estimate.Lng, estimate.Lat), 200.0)
+	require.NotNil(t, estimate.Azimuth)
+	assert.InDelta(t, 90, *estimate.Azimuth, 20)
+}
+
+func TestLocateCentroid(t *testing.T) {
+	estimate, err := Locate(sectorSamples(), Options{Method: model.MethodCentroid, MinSamples: 10})
+	require.NoError(t, err)
+	assert.Equal(t, model.MethodCentroid, estimate.Method)
+	// the centroid lies inside the covered area, east of the station.
+	assert.InDelta(t, 90, geo.Bearing(towerLng, towerLat, estimate.Lng, estimate.Lat), 10)
+	assert.Greater(t, estimate.Spread, 0.0)
+}
+
+func TestLocateOmni(t *testing.T) {
+	proj := geo.NewProjection(towerLng, towerLat)
+	var samples []model.Sample
+	for a := 0.0; a < 360; a += 15 {
+		rad := a * math.Pi / 180
+		lng, lat := proj.Inverse(500*math.Sin(rad), 500*math.Cos(rad))
+		samples = append(samples, model.Sample{Lng: lng, Lat: lat, Dbm: -80})
+	}
+	estimate, err := Locate(samples, Options{Method: model.MethodGradient})
+	require.NoError(t, err)
+	// a flat level gives no gradient, the estimate falls back to the centroid.
+	assert.Equal(t, model.MethodCentroid, estimate.Method)
+	assert.Less(t, geo.Distance(towerLng, towerLat, estimate.Lng, estimate.Lat), 10.0)
+	assert.Nil(t, estimate.Azimuth)
+}
+
+func TestLocateErrors(t *testing.T) {
+	_, err := Locate(sectorSamples()[:5], Options{MinSamples: 10})
+	assert.ErrorIs(t, err, ErrNotEnoughSamples)
+
+	_, err = Locate(sectorSamples(), Options{Method: "trilateration"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,86 @@
+package model
+
+import (
+	"github.com/gofrs/uuid"
+	"github.com/twpayne/go-geom/encoding/ewkb"
+	"time"
+)
+
+const (
+	MethodCentroid = "centroid"
+	MethodGradient = "gradient"
+)
+
+type CandidateStatus string
+
+const (
+	StatusPending  CandidateStatus = "pending"
+	StatusPromoted CandidateStatus = "promoted"
+	StatusRejected CandidateStatus = "rejected"
+)
+
+// Sample is one level measurement of a cell at the position of its GPS fix.
+type Sample struct {
+	Lng float64 `db:"lng"`
+	Lat float64 `db:"lat"`
+	Dbm float64 `db:"dbm"`
+}
+
+// UnknownCell is a cell heard by posts that has no matching "BsInfo" row.
+type UnknownCell struct {
+	GsmId       uuid.UUID  `db:"gsm_id"`
+	Cid         *int32     `db:"cid"`
+	LacTac      *int32     `db:"lac_tac"`
+	OperatorId  *uuid.UUID `db:"operator_id"`
+	ArfcnNumber int64      `db:"arfcn_number"`
+	Samples     int        `db:"samples"`
+}
+
+type Estimate struct {
+	Method string
+	Lng    float64
+	Lat    float64
+	// Azimuth is the direction the sector points to, nil when samples surround the estimate.
+	Azimuth *float64
+	// Spread is the weighted mean distance in meters from the estimate to the samples used.
+	Spread  float64
+	Samples int
+}
+
+type Candidate struct {
+	Id          uuid.UUID       `db:"id"`
+	GsmId       uuid.UUID       `db:"gsm"`
+	Method      string          `db:"method"`
+	Coordinates ewkb.Point      `db:"coordinates"`
+	Azimuth     *float32        `db:"azimuth"`
+	Spread      float32         `db:"spread"`
+	Samples     int             `db:"samples"`
+	Status      CandidateStatus `db:"status"`
+	Bs          *uint64         `db:"bs"`
+	Comment     *string         `db:"comment"`
+	CreatedAt   time.Time       `db:"created_at"`
+	UpdatedAt   time.Time       `db:"updated_at"`
+	Cid         *int32          `db:"cid"`
+	LacTac      *int32          `db:"lac_tac"`
+	OperatorId  *uuid.UUID      `db:"operator_id"`
+	ArfcnNumber int64           `db:"arfcn_number"`
+	Technology  *string         `db:"technology"`
+}
+
+// Promotion registers a candidate as a sector. A new station is created at the given
+// or estimated position unless Bs names an existing one.
+type Promotion struct {
+	Bs           *uint64
+	Address      string
+	RegionId     *uuid.UUID
+	Lng, Lat     *float64
+	Azimuth      *int16
+	SectorNumber int16
+	Comment      *string
+}
+
+type RunResult struct {
+	Cells     int `json:"cells"`
+	Estimated int `json:"estimated"`
+	Failed    int `json:"failed"`
+}
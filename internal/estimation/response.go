@@ -0,0 +1,57 @@
+package estimation
+
+import (
+	"github.com/gofrs/uuid"
+	"simpleServer/internal/estimation/model"
+	"time"
+)
+
+type CandidateResponse struct {
+	Id          uuid.UUID             `json:"id"`
+	GsmId       uuid.UUID             `json:"gsmId"`
+	Cid         *int32                `json:"cid"`
+	LacTac      *int32                `json:"lacTac"`
+	OperatorId  *uuid.UUID            `json:"operatorId"`
+	Arfcn       int64                 `json:"arfcn"`
+	Technology  *string               `json:"technology"`
+	Method      string                `json:"method"`
+	Coordinates []float64             `json:"coordinates"`
+	Azimuth     *float32              `json:"azimuth"`
+	Spread      float32               `json:"spread"`
+	Samples     int                   `json:"samples"`
+	Status      model.CandidateStatus `json:"status"`
+	Bs          *uint64               `json:"bs"`
+	Comment     *string               `json:"comment"`
+	CreatedAt   time.Time             `json:"createdAt"`
+	UpdatedAt   time.Time             `json:"updatedAt"`
+}
+
+func NewCandidateResponse(candidate *model.Candidate) *CandidateResponse {
+	return &CandidateResponse{
+		Id:          candidate.Id,
+		GsmId:       candidate.GsmId,
+		Cid:         candidate.Cid,
+		LacTac:      candidate.LacTac,
+		OperatorId:  candidate.OperatorId,
+		Arfcn:       candidate.ArfcnNumber,
+		Technology:  candidate.Technology,
+		Method:      candidate.Method,
+		Coordinates: []float64{candidate.Coordinates.X(), candidate.Coordinates.Y()},
+		Azimuth:     candidate.Azimuth,
+		Spread:      candidate.Spread,
+		Samples:     candidate.Samples,
+		Status:      candidate.Status,
+		Bs:          candidate.Bs,
+		Comment:     candidate.Comment,
+		CreatedAt:   candidate.CreatedAt,
+		UpdatedAt:   candidate.UpdatedAt,
+	}
+}
+
+func NewCandidatesResponse(candidates []model.Candidate) []*CandidateResponse {
+	data := make([]*CandidateResponse, 0, len(candidates))
+	for i := range candidates {
+		data = append(data, NewCandidateResponse(&candidates[i]))
+	}
+	return data
+}
@@ -0,0 +1,477 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gofrs/uuid"
+	"github.com/jmoiron/sqlx"
+	"simpleServer/dbutils"
+	"simpleServer/internal/geofence/model"
+	"simpleServer/pkg/logging"
+	"time"
+)
+
+var (
+	ErrGeofenceNotFound = errors.New("geofence not found")
+	ErrEventNotFound    = errors.New("event not found")
+	ErrUnknownPost      = errors.New("unknown post")
+)
+
+type GeofenceDB interface {
+	GetGeofences(ctx context.Context) ([]model.Geofence, error)
+
+	GetGeofence(ctx context.Context, id uuid.UUID) (*model.Geofence, error)
+
+	CreateGeofence(ctx context.Context, input *model.GeofenceInput) (*model.Geofence, error)
+
+	// UpdateGeofence replaces the geofence, states of posts it no longer applies to are dropped.
+	UpdateGeofence(ctx context.Context, id uuid.UUID, input *model.GeofenceInput) (*model.Geofence, error)
+
+	DeleteGeofence(ctx context.Context, id uuid.UUID) error
+
+	// Track evaluates new fixes of a post against its active geofences and stores the events they raise.
+	Track(ctx context.Context, postId uuid.UUID, fixes []model.Fix) ([]model.Event, error)
+
+	GetEvents(ctx context.Context, filter *model.EventFilter) ([]model.Event, error)
+
+	AcknowledgeEvent(ctx context.Context, id uuid.UUID) (*model.Event, error)
+
+	// FindSilences returns the active posts whose last fix is older than before and that got no silent
+	// event since that fix.
+	FindSilences(ctx context.Context, before time.Time) ([]model.Silence, error)
+
+	SaveEvent(ctx context.Context, event *model.Event) error
+
+	// RunExclusive runs f unless another server instance is already looking for silent posts.
+	RunExclusive(ctx context.Context, f func(ctx context.Context) error) (bool, error)
+}
+
+type geofenceDB struct {
+	dbh *sqlx.DB
+}
+
+func NewGeofenceDB(dbh *sqlx.DB) GeofenceDB {
+	return &geofenceDB{dbh: dbh}
+}
+
+// geofenceLockKey is the advisory lock held while looking for silent posts.
+const geofenceLockKey = 0x67656f66
+
+const geofenceColumns = `G.id, G.name, G.kind, st_asgeojson(G.area) as area, G.dwell_limit, G.active, G.created_at, G.updated_at`
+
+func (g *geofenceDB) selectGeofences(ctx context.Context, db sqlx.ExtContext, filter string, args ...interface{}) ([]model.Geofence, error) {
+	var geofences []model.Geofence
+	query := `select ` + geofenceColumns + ` from "Geofences" G ` + filter + ` order by G.name`
+	if err := dbutils.Select(ctx, db, &geofences, query, args...); err != nil {
+		return nil, err
+	}
+	if len(geofences) == 0 {
+		return geofences, nil
+	}
+
+	ids := make([]string, len(geofences))
+	byId := make(map[uuid.UUID]*model.Geofence, len(geofences))
+	for i := range geofences {
+		ids[i] = geofences[i].Id.String()
+		byId[geofences[i].Id] = &geofences[i]
+	}
+	var posts []struct {
+		GeofenceId uuid.UUID `db:"geofence_id"`
+		PostId     uuid.UUID `db:"post_id"`
+	}
+	query = `select geofence_id, post_id from "GeofencePosts" where geofence_id = any(cast($1 as uuid[])) order by post_id`
+	if err := dbutils.Select(ctx, db, &posts, query, ids); err != nil {
+		return nil, err
+	}
+	for _, post := range posts {
+		geofence := byId[post.GeofenceId]
+		geofence.Posts = append(geofence.Posts, post.PostId)
+	}
+	return geofences, nil
+}
+
+func (g *geofenceDB) getGeofence(ctx context.Context, db sqlx.ExtContext, id uuid.UUID) (*model.Geofence, error) {
+	geofences, err := g.selectGeofences(ctx, db, `where G.id = $1`, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(geofences) == 0 {
+		return nil, ErrGeofenceNotFound
+	}
+	return &geofences[0], nil
+}
+
+func (g *geofenceDB) GetGeofences(ctx context.Context) ([]model.Geofence, error) {
+	logger := logging.FromContext(ctx)
+	logger.Debugw("geofence list")
+	return g.selectGeofences(ctx, g.dbh, "")
+}
+
+func (g *geofenceDB) GetGeofence(ctx context.Context, id uuid.UUID) (*model.Geofence, error) {
+	return g.getGeofence(ctx, g.dbh, id)
+}
+
+func geofenceArgs(id uuid.UUID, input *model.GeofenceInput) map[string]interface{} {
+	return map[string]interface{}{
+		"Id":         id,
+		"Name":       input.Name,
+		"Kind":       input.Kind,
+		"Area":       input.Area,
+		"DwellLimit": input.DwellLimit,
+		"Active":     input.Active,
+	}
+}
+
+func setGeofencePosts(ctx context.Context, tx *sqlx.Tx, geofenceId uuid.UUID, posts []uuid.UUID) error {
+	if _, err := dbutils.Exec(ctx, tx, `delete from "GeofencePosts" where geofence_id = $1`, geofenceId); err != nil {
+		return err
+	}
+	for _, post := range posts {
+		var exists bool
+		if err := dbutils.Get(ctx, tx, &exists, `select exists(select 1 from "Post" where id = $1)`, post); err != nil {
+			return err
+		}
+		if !exists {
+			return fmt.Errorf("%w %s", ErrUnknownPost, post)
+		}
+		query := `insert into "GeofencePosts" (geofence_id, post_id) values ($1, $2) on conflict do nothing`
+		if _, err := dbutils.Exec(ctx, tx, query, geofenceId, post); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (g *geofenceDB) CreateGeofence(ctx context.Context, input *model.GeofenceInput) (*model.Geofence, error) {
+	logger := logging.FromContext(ctx)
+	logger.Debugw("geofence create", "name", input.Name, "kind", input.Kind)
+	id, err := uuid.NewV4()
+	if err != nil {
+		return nil, err
+	}
+	var created *model.Geofence
+	err = dbutils.RunTx(ctx, g.dbh, func(tx *sqlx.Tx) error {
+		query := `insert into "Geofences" (id, name, kind, area, dwell_limit, active)
+			values (:Id, :Name, :Kind, st_multi(st_setsrid(st_geomfromgeojson(:Area), 4326)), :DwellLimit, :Active)`
+		if _, err := dbutils.NamedExec(ctx, tx, query, geofenceArgs(id, input)); err != nil {
+			return err
+		}
+		if err := setGeofencePosts(ctx, tx, id, input.Posts); err != nil {
+			return err
+		}
+		created, err = g.getGeofence(ctx, tx, id)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return created, nil
+}
+
+func (g *geofenceDB) UpdateGeofence(ctx context.Context, id uuid.UUID, input *model.GeofenceInput) (*model.Geofence, error) {
+	logger := logging.FromContext(ctx)
+	logger.Debugw("geofence update", "id", id)
+	var updated *model.Geofence
+	err := dbutils.RunTx(ctx, g.dbh, func(tx *sqlx.Tx) error {
+		query := `update "Geofences"
+			set name = :Name, kind = :Kind, area = st_multi(st_setsrid(st_geomfromgeojson(:Area), 4326)),
+				dwell_limit = :DwellLimit, active = :Active, updated_at = now()
+			where id = :Id`
+		res, err := dbutils.NamedExec(ctx, tx, query, geofenceArgs(id, input))
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err == nil && n == 0 {
+			return ErrGeofenceNotFound
+		}
+		if err := setGeofencePosts(ctx, tx, id, input.Posts); err != nil {
+			return err
+		}
+		// posts keep their state where the geofence still applies, the changed area is picked up by their next fix.
+		query = `delete from "GeofenceStates" S
+			where S.geofence_id = $1
+			and exists (select 1 from "GeofencePosts" GP where GP.geofence_id = S.geofence_id)
+			and not exists (select 1 from "GeofencePosts" GP where GP.geofence_id = S.geofence_id and GP.post_id = S.post_id)`
+		if _, err := dbutils.Exec(ctx, tx, query, id); err != nil {
+			return err
+		}
+		updated, err = g.getGeofence(ctx, tx, id)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return updated, nil
+}
+
+func (g *geofenceDB) DeleteGeofence(ctx context.Context, id uuid.UUID) error {
+	logger := logging.FromContext(ctx)
+	logger.Debugw("geofence delete", "id", id)
+	res, err := dbutils.Exec(ctx, g.dbh, `delete from "Geofences" where id = $1`, id)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrGeofenceNotFound
+	}
+	return nil
+}
+
+type fenceRow struct {
+	Id         uuid.UUID `db:"id"`
+	Kind       string    `db:"kind"`
+	DwellLimit *int32    `db:"dwell_limit"`
+}
+
+func (g *geofenceDB) Track(ctx context.Context, postId uuid.UUID, fixes []model.Fix) ([]model.Event, error) {
+	logger := logging.FromContext(ctx)
+	logger.Debugw("geofence track", "postId", postId, "fixes", len(fixes))
+	if len(fixes) == 0 {
+		return nil, nil
+	}
+
+	var events []model.Event
+	err := dbutils.RunTx(ctx, g.dbh, func(tx *sqlx.Tx) error {
+		// uploads of one post are evaluated one after another, so concurrent batches can't both see the
+		// same state and raise the same event.
+		if _, err := dbutils.Exec(ctx, tx, `select pg_advisory_xact_lock($1, hashtext(cast($2 as text)))`,
+			geofenceLockKey, postId); err != nil {
+			return err
+		}
+
+		var rows []fenceRow
+		query := `select G.id, G.kind, G.dwell_limit
+			from "Geofences" G
+			where G.active
+			and (
+				not exists (select 1 from "GeofencePosts" GP where GP.geofence_id = G.id)
+				or exists (select 1 from "GeofencePosts" GP where GP.geofence_id = G.id and GP.post_id = $1)
+			)`
+		if err := dbutils.Select(ctx, tx, &rows, query, postId); err != nil {
+			return err
+		}
+		if len(rows) == 0 {
+			return nil
+		}
+		fences := make([]model.Fence, len(rows))
+		kinds := make(map[uuid.UUID]string, len(rows))
+		ids := make([]string, len(rows))
+		for i, row := range rows {
+			fences[i] = model.Fence{Id: row.Id, Kind: row.Kind}
+			if row.DwellLimit != nil {
+				fences[i].DwellLimit = time.Duration(*row.DwellLimit) * time.Second
+			}
+			kinds[row.Id] = row.Kind
+			ids[i] = row.Id.String()
+		}
+
+		lngs, lats := make([]float64, len(fixes)), make([]float64, len(fixes))
+		for i, fix := range fixes {
+			lngs[i], lats[i] = fix.Lng, fix.Lat
+		}
+		var contained []struct {
+			Index      int       `db:"idx"`
+			GeofenceId uuid.UUID `db:"geofence_id"`
+		}
+		query = `select cast(F.ord - 1 as int) as idx, G.id as geofence_id
+			from unnest(cast(:Lngs as float8[]), cast(:Lats as float8[])) with ordinality as F(lng, lat, ord)
+			inner join "Geofences" G on st_contains(G.area, st_setsrid(st_makepoint(F.lng, F.lat), 4326))
+			where G.id = any(cast(:Ids as uuid[]))`
+		if err := dbutils.NamedSelect(ctx, tx, &contained, query, map[string]interface{}{
+			"Lngs": lngs,
+			"Lats": lats,
+			"Ids":  ids,
+		}); err != nil {
+			return err
+		}
+		inside := make([]map[uuid.UUID]bool, len(fixes))
+		for i := range inside {
+			inside[i] = make(map[uuid.UUID]bool)
+		}
+		for _, c := range contained {
+			inside[c.Index][c.GeofenceId] = true
+		}
+
+		var stored []model.State
+		query = `select geofence_id, post_id, inside, since, dwell_notified, last_time
+			from "GeofenceStates" where post_id = $1`
+		if err := dbutils.Select(ctx, tx, &stored, query, postId); err != nil {
+			return err
+		}
+		states := make(map[uuid.UUID]*model.State, len(stored))
+		for i := range stored {
+			states[stored[i].GeofenceId] = &stored[i]
+		}
+
+		transitions := model.Evaluate(fences, states, postId, fixes, inside)
+
+		for _, fence := range fences {
+			state, ok := states[fence.Id]
+			if !ok {
+				continue
+			}
+			query = `insert into "GeofenceStates" (geofence_id, post_id, inside, since, dwell_notified, last_time)
+				values (:geofence_id, :post_id, :inside, :since, :dwell_notified, :last_time)
+				on conflict (geofence_id, post_id) do update
+				set inside = excluded.inside,
+					since = excluded.since,
+					dwell_notified = excluded.dwell_notified,
+					last_time = excluded.last_time`
+			if _, err := dbutils.NamedExec(ctx, tx, query, state); err != nil {
+				return err
+			}
+		}
+
+		for _, transition := range transitions {
+			details, err := json.Marshal(map[string]interface{}{
+				"kind":            kinds[transition.GeofenceId],
+				"durationSeconds": int64(transition.Duration / time.Second),
+			})
+			if err != nil {
+				return err
+			}
+			geofenceId := transition.GeofenceId
+			event := model.Event{
+				PostId:     postId,
+				GeofenceId: &geofenceId,
+				Type:       transition.Type,
+				Time:       transition.Fix.Time,
+				Alarm:      transition.Alarm,
+				Details:    string(details),
+			}
+			if err := saveEvent(ctx, tx, &event, &transition.Fix.Lng, &transition.Fix.Lat); err != nil {
+				return err
+			}
+			events = append(events, event)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// saveEvent stores event at lng, lat and fills in its id, nil coordinates store no position.
+func saveEvent(ctx context.Context, db sqlx.ExtContext, event *model.Event, lng, lat *float64) error {
+	id, err := uuid.NewV4()
+	if err != nil {
+		return err
+	}
+	query := `insert into "PostEvents" (id, post_id, geofence_id, type, time, coordinates, alarm, details)
+		values (:Id, :PostId, :GeofenceId, :Type, :Time, st_setsrid(st_makepoint(cast(:Lng as float8), cast(:Lat as float8)), 4326), :Alarm, cast(:Details as jsonb))
+		returning created_at`
+	if err := dbutils.NamedGet(ctx, db, &event.CreatedAt, query, map[string]interface{}{
+		"Id":         id,
+		"PostId":     event.PostId,
+		"GeofenceId": event.GeofenceId,
+		"Type":       event.Type,
+		"Time":       event.Time,
+		"Lng":        lng,
+		"Lat":        lat,
+		"Alarm":      event.Alarm,
+		"Details":    event.Details,
+	}); err != nil {
+		return err
+	}
+	event.Id = id
+	return nil
+}
+
+const eventColumns = `E.id, E.post_id, E.geofence_id, G.name as geofence_name, E.type, E.time,
+		st_asewkb(E.coordinates) as coordinates, E.alarm, cast(E.details as text) as details, E.acknowledged_at, E.created_at
+	from "PostEvents" E
+	left join "Geofences" G on G.id = E.geofence_id`
+
+func (g *geofenceDB) GetEvents(ctx context.Context, filter *model.EventFilter) ([]model.Event, error) {
+	logger := logging.FromContext(ctx)
+	logger.Debugw("geofence fetch events", "postId", filter.PostId, "geofenceId", filter.GeofenceId, "type", filter.Type)
+	query := `select ` + eventColumns + `
+		where (cast(:PostId as uuid) is null or E.post_id = :PostId)
+		and (cast(:GeofenceId as uuid) is null or E.geofence_id = :GeofenceId)
+		and (:Type = '' or E.type = :Type)
+		and (not :AlarmOnly or E.alarm)
+		and (not :Unacknowledged or E.acknowledged_at is null)
+		and (cast(:From as timestamptz) is null or E.time >= :From)
+		and (cast(:To as timestamptz) is null or E.time < :To)
+		order by E.time desc, E.created_at desc
+		limit :Limit offset :Offset`
+
+	var from, to *time.Time
+	if !filter.From.IsZero() {
+		from = &filter.From
+	}
+	if !filter.To.IsZero() {
+		to = &filter.To
+	}
+	var events []model.Event
+	if err := dbutils.NamedSelect(ctx, g.dbh, &events, query, map[string]interface{}{
+		"PostId":         filter.PostId,
+		"GeofenceId":     filter.GeofenceId,
+		"Type":           filter.Type,
+		"AlarmOnly":      filter.AlarmOnly,
+		"Unacknowledged": filter.Unacknowledged,
+		"From":           from,
+		"To":             to,
+		"Limit":          filter.Limit,
+		"Offset":         filter.Offset,
+	}); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+func (g *geofenceDB) AcknowledgeEvent(ctx context.Context, id uuid.UUID) (*model.Event, error) {
+	query := `update "PostEvents" set acknowledged_at = coalesce(acknowledged_at, now()) where id = $1`
+	res, err := dbutils.Exec(ctx, g.dbh, query, id)
+	if err != nil {
+		return nil, err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return nil, ErrEventNotFound
+	}
+	var event model.Event
+	if err := dbutils.Get(ctx, g.dbh, &event, `select `+eventColumns+` where E.id = $1`, id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrEventNotFound
+		}
+		return nil, err
+	}
+	return &event, nil
+}
+
+func (g *geofenceDB) FindSilences(ctx context.Context, before time.Time) ([]model.Silence, error) {
+	logger := logging.FromContext(ctx)
+	logger.Debugw("geofence find silent posts", "before", before)
+	query := `select P.id as post_id, L.time as last_seen, st_asewkb(L.coordinates) as coordinates
+		from "Post" P
+		inner join lateral (
+			select time, coordinates from "GpsData" where post_id = P.id order by time desc limit 1
+		) L on true
+		where P.retired_at is null
+		and L.time < $1
+		and not exists (
+			select 1 from "PostEvents" E where E.post_id = P.id and E.type = $2 and E.time >= L.time
+		)`
+	var silences []model.Silence
+	if err := dbutils.Select(ctx, g.dbh, &silences, query, before, model.EventSilent); err != nil {
+		return nil, err
+	}
+	return silences, nil
+}
+
+func (g *geofenceDB) SaveEvent(ctx context.Context, event *model.Event) error {
+	var lng, lat *float64
+	if event.Coordinates != nil {
+		x, y := event.Coordinates.X(), event.Coordinates.Y()
+		lng, lat = &x, &y
+	}
+	return saveEvent(ctx, g.dbh, event, lng, lat)
+}
+
+func (g *geofenceDB) RunExclusive(ctx context.Context, f func(ctx context.Context) error) (bool, error) {
+	return dbutils.WithAdvisoryLock(ctx, g.dbh, geofenceLockKey, f)
+}
@@ -0,0 +1,268 @@
+package geofence
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"github.com/gofrs/uuid"
+	"github.com/twpayne/go-geom"
+	"github.com/twpayne/go-geom/encoding/geojson"
+	"net/http"
+	"simpleServer/internal/auth"
+	authModel "simpleServer/internal/auth/model"
+	"simpleServer/internal/config"
+	"simpleServer/internal/geofence/database"
+	"simpleServer/internal/geofence/model"
+	"simpleServer/internal/middleware"
+	"simpleServer/internal/middleware/handler"
+	"simpleServer/pkg/logging"
+	"simpleServer/pkg/validate"
+	"time"
+)
+
+const (
+	defaultEventsLimit = 100
+	maxEventsLimit     = 1000
+)
+
+type Handler struct {
+	geofenceDB database.GeofenceDB
+}
+
+func NewHandler(db database.GeofenceDB) *Handler {
+	return &Handler{geofenceDB: db}
+}
+
+func bindId(c *gin.Context) (uuid.UUID, *handler.Response) {
+	id, err := uuid.FromString(c.Param("id"))
+	if err != nil {
+		return uuid.Nil, handler.NewErrorResponse(http.StatusBadRequest, handler.InvalidUriValue, "invalid id in uri",
+			validate.NewValidationErrorDetails("id", "required uuid format", c.Param("id")))
+	}
+	return id, nil
+}
+
+func geofenceErrorResponse(err error) *handler.Response {
+	switch {
+	case errors.Is(err, database.ErrGeofenceNotFound):
+		return handler.NewErrorResponse(http.StatusNotFound, handler.NotFoundEntity, "geofence not found", nil)
+	case errors.Is(err, database.ErrUnknownPost):
+		return handler.NewErrorResponse(http.StatusBadRequest, handler.InvalidBodyValue, err.Error(),
+			validate.NewValidationErrorDetails("posts", "existing post ids", ""))
+	}
+	return handler.NewInternalErrorResponse(err)
+}
+
+// bindGeofence reads a geofence body, area must be a GeoJSON Polygon or MultiPolygon in WGS 84.
+func bindGeofence(c *gin.Context) (*model.GeofenceInput, *handler.Response) {
+	type RequestBody struct {
+		Name       string          `json:"name" binding:"required"`
+		Kind       string          `json:"kind" binding:"required"`
+		Area       json.RawMessage `json:"area" binding:"required"`
+		DwellLimit *int32          `json:"dwellLimit" binding:"omitempty,min=1"`
+		Active     *bool           `json:"active"`
+		Posts      []uuid.UUID     `json:"posts"`
+	}
+	var body RequestBody
+	if err := c.ShouldBindJSON(&body); err != nil {
+		var details []*validate.ValidationErrDetail
+		if vErrs, ok := err.(validator.ValidationErrors); ok {
+			details = validate.ValidationErrorDetails(&body, "json", vErrs)
+		}
+		return nil, handler.NewErrorResponse(http.StatusBadRequest, handler.InvalidBodyValue, "invalid geofence", details)
+	}
+	if !model.ValidKind(body.Kind) {
+		return nil, handler.NewErrorResponse(http.StatusBadRequest, handler.InvalidBodyValue, "invalid kind",
+			validate.NewValidationErrorDetails("kind", "one of assigned, forbidden", body.Kind))
+	}
+	var area geom.T
+	if err := geojson.Unmarshal(body.Area, &area); err != nil || area.Empty() {
+		return nil, invalidAreaResponse()
+	}
+	switch area.(type) {
+	case *geom.Polygon, *geom.MultiPolygon:
+	default:
+		return nil, invalidAreaResponse()
+	}
+	input := &model.GeofenceInput{
+		Name:       body.Name,
+		Kind:       body.Kind,
+		Area:       string(body.Area),
+		DwellLimit: body.DwellLimit,
+		Active:     body.Active == nil || *body.Active,
+		Posts:      body.Posts,
+	}
+	return input, nil
+}
+
+func invalidAreaResponse() *handler.Response {
+	return handler.NewErrorResponse(http.StatusBadRequest, handler.InvalidBodyValue, "invalid area",
+		validate.NewValidationErrorDetails("area", "GeoJSON Polygon or MultiPolygon", ""))
+}
+
+func (h *Handler) GetGeofences(c *gin.Context) {
+	handler.HandleRequest(c, func(c *gin.Context) *handler.Response {
+		geofences, err := h.geofenceDB.GetGeofences(c.Request.Context())
+		if err != nil {
+			logging.FromContext(c).Errorw("geofence.GetGeofences failed", "err", err)
+			return handler.NewInternalErrorResponse(err)
+		}
+		return handler.NewSuccessResponse(http.StatusOK, NewGeofencesResponse(geofences))
+	})
+}
+
+func (h *Handler) GetGeofence(c *gin.Context) {
+	handler.HandleRequest(c, func(c *gin.Context) *handler.Response {
+		id, res := bindId(c)
+		if res != nil {
+			return res
+		}
+		geofence, err := h.geofenceDB.GetGeofence(c.Request.Context(), id)
+		if err != nil {
+			return geofenceErrorResponse(err)
+		}
+		return handler.NewSuccessResponse(http.StatusOK, NewGeofenceResponse(geofence))
+	})
+}
+
+func (h *Handler) CreateGeofence(c *gin.Context) {
+	handler.HandleRequest(c, func(c *gin.Context) *handler.Response {
+		input, res := bindGeofence(c)
+		if res != nil {
+			return res
+		}
+		geofence, err := h.geofenceDB.CreateGeofence(c.Request.Context(), input)
+		if err != nil {
+			logging.FromContext(c).Errorw("geofence.CreateGeofence failed", "err", err)
+			return geofenceErrorResponse(err)
+		}
+		return handler.NewSuccessResponse(http.StatusCreated, NewGeofenceResponse(geofence))
+	})
+}
+
+func (h *Handler) UpdateGeofence(c *gin.Context) {
+	handler.HandleRequest(c, func(c *gin.Context) *handler.Response {
+		id, res := bindId(c)
+		if res != nil {
+			return res
+		}
+		input, res := bindGeofence(c)
+		if res != nil {
+			return res
+		}
+		geofence, err := h.geofenceDB.UpdateGeofence(c.Request.Context(), id, input)
+		if err != nil {
+			logging.FromContext(c).Errorw("geofence.UpdateGeofence failed", "id", id, "err", err)
+			return geofenceErrorResponse(err)
+		}
+		return handler.NewSuccessResponse(http.StatusOK, NewGeofenceResponse(geofence))
+	})
+}
+
+// DeleteGeofence removes the geofence, its past events stay without it.
+func (h *Handler) DeleteGeofence(c *gin.Context) {
+	handler.HandleRequest(c, func(c *gin.Context) *handler.Response {
+		id, res := bindId(c)
+		if res != nil {
+			return res
+		}
+		if err := h.geofenceDB.DeleteGeofence(c.Request.Context(), id); err != nil {
+			logging.FromContext(c).Errorw("geofence.DeleteGeofence failed", "id", id, "err", err)
+			return geofenceErrorResponse(err)
+		}
+		return handler.NewSuccessResponse(http.StatusNoContent, nil)
+	})
+}
+
+// GetEvents returns geofence and silence events newest first, dispatchers poll it with unacknowledged
+// and alarm set.
+func (h *Handler) GetEvents(c *gin.Context) {
+	handler.HandleRequest(c, func(c *gin.Context) *handler.Response {
+		type RequestQuery struct {
+			PostId         string    `form:"postId" binding:"omitempty,uuid"`
+			GeofenceId     string    `form:"geofenceId" binding:"omitempty,uuid"`
+			Type           string    `form:"type" binding:"omitempty,oneof=enter exit dwell silent"`
+			Alarm          bool      `form:"alarm"`
+			Unacknowledged bool      `form:"unacknowledged"`
+			From           time.Time `form:"from" time_format:"2006-01-02T15:04:05Z07:00"`
+			To             time.Time `form:"to" time_format:"2006-01-02T15:04:05Z07:00"`
+			Limit          int       `form:"limit" binding:"min=0"`
+			Offset         int       `form:"offset" binding:"min=0"`
+		}
+		var query RequestQuery
+		if err := c.ShouldBindQuery(&query); err != nil {
+			var details []*validate.ValidationErrDetail
+			if vErrs, ok := err.(validator.ValidationErrors); ok {
+				details = validate.ValidationErrorDetails(&query, "form", vErrs)
+			}
+			return handler.NewErrorResponse(http.StatusBadRequest, handler.InvalidQueryValue, "invalid event query", details)
+		}
+		filter := &model.EventFilter{
+			Type:           query.Type,
+			AlarmOnly:      query.Alarm,
+			Unacknowledged: query.Unacknowledged,
+			From:           query.From,
+			To:             query.To,
+			Limit:          query.Limit,
+			Offset:         query.Offset,
+		}
+		if query.PostId != "" {
+			id := uuid.FromStringOrNil(query.PostId)
+			filter.PostId = &id
+		}
+		if query.GeofenceId != "" {
+			id := uuid.FromStringOrNil(query.GeofenceId)
+			filter.GeofenceId = &id
+		}
+		if filter.Limit == 0 || filter.Limit > maxEventsLimit {
+			filter.Limit = defaultEventsLimit
+		}
+		events, err := h.geofenceDB.GetEvents(c.Request.Context(), filter)
+		if err != nil {
+			logging.FromContext(c).Errorw("geofence.GetEvents failed", "err", err)
+			return handler.NewInternalErrorResponse(err)
+		}
+		return handler.NewSuccessResponse(http.StatusOK, NewEventsResponse(events))
+	})
+}
+
+func (h *Handler) AcknowledgeEvent(c *gin.Context) {
+	handler.HandleRequest(c, func(c *gin.Context) *handler.Response {
+		id, res := bindId(c)
+		if res != nil {
+			return res
+		}
+		event, err := h.geofenceDB.AcknowledgeEvent(c.Request.Context(), id)
+		if errors.Is(err, database.ErrEventNotFound) {
+			return handler.NewErrorResponse(http.StatusNotFound, handler.NotFoundEntity, "event not found", nil)
+		}
+		if err != nil {
+			logging.FromContext(c).Errorw("geofence.AcknowledgeEvent failed", "id", id, "err", err)
+			return handler.NewInternalErrorResponse(err)
+		}
+		return handler.NewSuccessResponse(http.StatusOK, NewEventResponse(event))
+	})
+}
+
+func RouteV1(cfg *config.Config, h *Handler, a *auth.Authenticator, r *gin.Engine) {
+	v1 := r.Group("v1/api")
+	v1.Use(middleware.CorsMiddleware(), middleware.RequestIDMiddleware(), middleware.TimeoutMiddleware(cfg.ServerConfig.WriteTimeout))
+
+	geofenceV1 := v1.Group("geofences")
+	geofenceV1.Use(a.Authenticate(), a.Require(authModel.PermissionRead))
+	{
+		geofenceV1.GET("", h.GetGeofences)
+		geofenceV1.POST("", a.Require(authModel.PermissionAnalyze), h.CreateGeofence)
+		geofenceV1.GET("/:id", h.GetGeofence)
+		geofenceV1.PUT("/:id", a.Require(authModel.PermissionAnalyze), h.UpdateGeofence)
+		geofenceV1.DELETE("/:id", a.Require(authModel.PermissionAnalyze), h.DeleteGeofence)
+	}
+
+	notificationV1 := v1.Group("notifications")
+	notificationV1.Use(a.Authenticate(), a.Require(authModel.PermissionRead))
+	{
+		notificationV1.GET("", h.GetEvents)
+		notificationV1.POST("/:id/acknowledge", a.Require(authModel.PermissionAnalyze), h.AcknowledgeEvent)
+	}
+}
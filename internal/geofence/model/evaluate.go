@@ -0,0 +1,87 @@
+package model
+
+import (
+	"github.com/gofrs/uuid"
+	"time"
+)
+
+// Fence is what Evaluate needs to know of a geofence.
+type Fence struct {
+	Id   uuid.UUID
+	Kind string
+	// DwellLimit is how long a post may stay inside before a dwell event, 0 never raises one.
+	DwellLimit time.Duration
+}
+
+// Transition is an event found by Evaluate, Fix is the fix that raised it.
+type Transition struct {
+	GeofenceId uuid.UUID
+	Type       string
+	Fix        Fix
+	Alarm      bool
+	// Duration is how long the post had been inside when it left or dwelled.
+	Duration time.Duration
+}
+
+// Alarm tells whether an event of eventType in a geofence of kind needs an operator's attention.
+func Alarm(kind, eventType string) bool {
+	switch kind {
+	case KindAssigned:
+		return eventType == EventExit
+	case KindForbidden:
+		return eventType == EventEnter || eventType == EventDwell
+	}
+	return false
+}
+
+// Evaluate walks fixes ordered by time through the states of a post, inside[i] holds the geofences fixes[i]
+// is in. states is updated in place, a geofence without a state gets one at its first fix. Fixes older than
+// the last one evaluated for a geofence are skipped, so retried uploads raise no events twice. A post first
+// seen outside a geofence raises nothing, first seen inside it enters.
+func Evaluate(fences []Fence, states map[uuid.UUID]*State, postId uuid.UUID, fixes []Fix, inside []map[uuid.UUID]bool) []Transition {
+	var transitions []Transition
+	for i, fix := range fixes {
+		for _, fence := range fences {
+			in := inside[i][fence.Id]
+			state, ok := states[fence.Id]
+			if !ok {
+				state = &State{GeofenceId: fence.Id, PostId: postId, Since: fix.Time}
+				states[fence.Id] = state
+				if in {
+					state.Inside = true
+					transitions = append(transitions, newTransition(fence, EventEnter, fix, 0))
+				}
+				state.LastTime = fix.Time
+				continue
+			}
+			if !fix.Time.After(state.LastTime) {
+				continue
+			}
+			state.LastTime = fix.Time
+			if in != state.Inside {
+				eventType, duration := EventEnter, time.Duration(0)
+				if !in {
+					eventType, duration = EventExit, fix.Time.Sub(state.Since)
+				}
+				transitions = append(transitions, newTransition(fence, eventType, fix, duration))
+				state.Inside, state.Since, state.DwellNotified = in, fix.Time, false
+				continue
+			}
+			if in && fence.DwellLimit > 0 && !state.DwellNotified && fix.Time.Sub(state.Since) >= fence.DwellLimit {
+				transitions = append(transitions, newTransition(fence, EventDwell, fix, fix.Time.Sub(state.Since)))
+				state.DwellNotified = true
+			}
+		}
+	}
+	return transitions
+}
+
+func newTransition(fence Fence, eventType string, fix Fix, duration time.Duration) Transition {
+	return Transition{
+		GeofenceId: fence.Id,
+		Type:       eventType,
+		Fix:        fix,
+		Alarm:      Alarm(fence.Kind, eventType),
+		Duration:   duration,
+	}
+}
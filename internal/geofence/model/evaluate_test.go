@@ -0,0 +1,80 @@
+package model
+
+import (
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestEvaluate(t *testing.T) {
+	postId := uuid.Must(uuid.NewV4())
+	assigned := Fence{Id: uuid.Must(uuid.NewV4()), Kind: KindAssigned}
+	forbidden := Fence{Id: uuid.Must(uuid.NewV4()), Kind: KindForbidden, DwellLimit: 5 * time.Minute}
+	fences := []Fence{assigned, forbidden}
+	t0 := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	at := func(minutes int) Fix { return Fix{Time: t0.Add(time.Duration(minutes) * time.Minute)} }
+	in := func(ids ...uuid.UUID) map[uuid.UUID]bool {
+		set := make(map[uuid.UUID]bool)
+		for _, id := range ids {
+			set[id] = true
+		}
+		return set
+	}
+
+	states := make(map[uuid.UUID]*State)
+	fixes := []Fix{at(0), at(1), at(2), at(4), at(8), at(9), at(10)}
+	inside := []map[uuid.UUID]bool{
+		in(assigned.Id),
+		in(assigned.Id),
+		in(),
+		in(forbidden.Id),
+		// the dwell limit passes here, only one dwell event is raised per visit.
+		in(forbidden.Id),
+		in(forbidden.Id),
+		in(assigned.Id),
+	}
+	transitions := Evaluate(fences, states, postId, fixes, inside)
+
+	type event struct {
+		fence    uuid.UUID
+		kind     string
+		minute   int
+		alarm    bool
+		duration time.Duration
+	}
+	var got []event
+	for _, tr := range transitions {
+		got = append(got, event{tr.GeofenceId, tr.Type, int(tr.Fix.Time.Sub(t0) / time.Minute), tr.Alarm, tr.Duration})
+	}
+	assert.Equal(t, []event{
+		{assigned.Id, EventEnter, 0, false, 0},
+		{assigned.Id, EventExit, 2, true, 2 * time.Minute},
+		{forbidden.Id, EventEnter, 4, true, 0},
+		{forbidden.Id, EventDwell, 9, true, 5 * time.Minute},
+		{assigned.Id, EventEnter, 10, false, 0},
+		{forbidden.Id, EventExit, 10, false, 6 * time.Minute},
+	}, got)
+
+	require.Contains(t, states, forbidden.Id)
+	assert.False(t, states[forbidden.Id].Inside)
+	assert.Equal(t, at(10).Time, states[forbidden.Id].LastTime)
+	assert.True(t, states[assigned.Id].Inside)
+
+	// a retried upload of already evaluated fixes raises nothing.
+	assert.Empty(t, Evaluate(fences, states, postId, fixes[3:], inside[3:]))
+}
+
+func TestEvaluateFirstFixOutside(t *testing.T) {
+	postId := uuid.Must(uuid.NewV4())
+	forbidden := Fence{Id: uuid.Must(uuid.NewV4()), Kind: KindForbidden}
+	states := make(map[uuid.UUID]*State)
+	t0 := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+
+	transitions := Evaluate([]Fence{forbidden}, states, postId, []Fix{{Time: t0}}, []map[uuid.UUID]bool{{}})
+	assert.Empty(t, transitions)
+	require.Contains(t, states, forbidden.Id)
+	assert.False(t, states[forbidden.Id].Inside)
+	assert.Equal(t, t0, states[forbidden.Id].Since)
+}
@@ -0,0 +1,110 @@
+package model
+
+import (
+	"github.com/gofrs/uuid"
+	"github.com/twpayne/go-geom/encoding/ewkb"
+	"time"
+)
+
+const (
+	// KindAssigned zones are where a post should work, leaving one raises an alarm.
+	KindAssigned = "assigned"
+	// KindForbidden zones must not be entered, entering or dwelling in one raises an alarm.
+	KindForbidden = "forbidden"
+)
+
+const (
+	EventEnter  = "enter"
+	EventExit   = "exit"
+	EventDwell  = "dwell"
+	EventSilent = "silent"
+)
+
+func ValidKind(kind string) bool {
+	return kind == KindAssigned || kind == KindForbidden
+}
+
+func ValidEventType(eventType string) bool {
+	return eventType == EventEnter || eventType == EventExit || eventType == EventDwell || eventType == EventSilent
+}
+
+type Geofence struct {
+	Id   uuid.UUID `db:"id"`
+	Name string    `db:"name"`
+	Kind string    `db:"kind"`
+	// Area is the GeoJSON MultiPolygon of the zone.
+	Area string `db:"area"`
+	// DwellLimit is in seconds, nil never raises dwell events.
+	DwellLimit *int32    `db:"dwell_limit"`
+	Active     bool      `db:"active"`
+	CreatedAt  time.Time `db:"created_at"`
+	UpdatedAt  time.Time `db:"updated_at"`
+	PostIds    string    `db:"post_ids"`
+	Posts      []uuid.UUID
+}
+
+// GeofenceInput creates or replaces a geofence, Area is a GeoJSON Polygon or MultiPolygon.
+// Empty Posts apply the geofence to every post.
+type GeofenceInput struct {
+	Name       string
+	Kind       string
+	Area       string
+	DwellLimit *int32
+	Active     bool
+	Posts      []uuid.UUID
+}
+
+// Fix is a position of a post checked against its geofences.
+type Fix struct {
+	Time time.Time
+	Lng  float64
+	Lat  float64
+}
+
+// State tells whether a post was inside a geofence at its last evaluated fix and since when.
+type State struct {
+	GeofenceId    uuid.UUID `db:"geofence_id"`
+	PostId        uuid.UUID `db:"post_id"`
+	Inside        bool      `db:"inside"`
+	Since         time.Time `db:"since"`
+	DwellNotified bool      `db:"dwell_notified"`
+	LastTime      time.Time `db:"last_time"`
+}
+
+type Event struct {
+	Id             uuid.UUID   `db:"id"`
+	PostId         uuid.UUID   `db:"post_id"`
+	GeofenceId     *uuid.UUID  `db:"geofence_id"`
+	GeofenceName   *string     `db:"geofence_name"`
+	Type           string      `db:"type"`
+	Time           time.Time   `db:"time"`
+	Coordinates    *ewkb.Point `db:"coordinates"`
+	Alarm          bool        `db:"alarm"`
+	Details        string      `db:"details"`
+	AcknowledgedAt *time.Time  `db:"acknowledged_at"`
+	CreatedAt      time.Time   `db:"created_at"`
+}
+
+// EventFilter selects events, zero values don't filter. From and To bound the time of the event.
+type EventFilter struct {
+	PostId         *uuid.UUID
+	GeofenceId     *uuid.UUID
+	Type           string
+	AlarmOnly      bool
+	Unacknowledged bool
+	From           time.Time
+	To             time.Time
+	Limit          int
+	Offset         int
+}
+
+// Silence is a post that sent no fix since LastSeen.
+type Silence struct {
+	PostId      uuid.UUID  `db:"post_id"`
+	LastSeen    time.Time  `db:"last_seen"`
+	Coordinates ewkb.Point `db:"coordinates"`
+}
+
+type RunResult struct {
+	SilentPosts int `json:"silentPosts"`
+}
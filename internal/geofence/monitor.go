@@ -0,0 +1,97 @@
+package geofence
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/gofrs/uuid"
+	"go.uber.org/fx"
+	"simpleServer/internal/config"
+	"simpleServer/internal/geofence/database"
+	"simpleServer/internal/geofence/model"
+	"simpleServer/pkg/logging"
+	"simpleServer/pkg/periodic"
+	"time"
+)
+
+var ErrAlreadyRunning = fmt.Errorf("silence check is %w", periodic.ErrAlreadyRunning)
+
+// Monitor evaluates new fixes against geofences and periodically raises silent events for posts that
+// stopped sending fixes.
+type Monitor struct {
+	geofenceDB database.GeofenceDB
+	cfg        config.GeofenceConfig
+	now        func() time.Time
+}
+
+func NewMonitor(lc fx.Lifecycle, cfg *config.Config, db database.GeofenceDB) *Monitor {
+	monitor := &Monitor{geofenceDB: db, cfg: cfg.GeofenceConfig, now: time.Now}
+	if !monitor.cfg.Enabled || monitor.cfg.Interval <= 0 || monitor.cfg.SilenceAfter <= 0 {
+		return monitor
+	}
+
+	periodic.Start(lc, "silence check", monitor.cfg.Interval, func(ctx context.Context) error {
+		result, err := monitor.Run(ctx)
+		if err == nil && result.SilentPosts != 0 {
+			logging.DefaultLogger().Infow("silence check done", "silentPosts", result.SilentPosts)
+		}
+		return err
+	})
+	return monitor
+}
+
+// Track evaluates the fixes of a post ordered by time against its geofences.
+func (m *Monitor) Track(ctx context.Context, postId uuid.UUID, fixes []model.Fix) ([]model.Event, error) {
+	events, err := m.geofenceDB.Track(ctx, postId, fixes)
+	if err != nil {
+		return nil, err
+	}
+	for _, event := range events {
+		logging.FromContext(ctx).Infow("geofence event", "postId", postId, "geofenceId", event.GeofenceId,
+			"type", event.Type, "alarm", event.Alarm)
+	}
+	return events, nil
+}
+
+// Run raises one silent event for every active post whose last fix is older than the silence limit. The
+// event is dated when the post turned silent and placed at its last fix; a post that reports again and
+// goes silent once more gets a new event.
+func (m *Monitor) Run(ctx context.Context) (*model.RunResult, error) {
+	result := &model.RunResult{}
+	acquired, err := m.geofenceDB.RunExclusive(ctx, func(ctx context.Context) error {
+		silences, err := m.geofenceDB.FindSilences(ctx, m.now().Add(-m.cfg.SilenceAfter))
+		if err != nil {
+			return err
+		}
+		for i := range silences {
+			silence := &silences[i]
+			details, err := json.Marshal(map[string]interface{}{
+				"lastSeen":      silence.LastSeen,
+				"silentSeconds": int64(m.cfg.SilenceAfter / time.Second),
+			})
+			if err != nil {
+				return err
+			}
+			event := &model.Event{
+				PostId:      silence.PostId,
+				Type:        model.EventSilent,
+				Time:        silence.LastSeen.Add(m.cfg.SilenceAfter),
+				Coordinates: &silence.Coordinates,
+				Alarm:       true,
+				Details:     string(details),
+			}
+			if err := m.geofenceDB.SaveEvent(ctx, event); err != nil {
+				return err
+			}
+			result.SilentPosts++
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !acquired {
+		return nil, ErrAlreadyRunning
+	}
+	return result, nil
+}
@@ -0,0 +1,87 @@
+package geofence
+
+import (
+	"encoding/json"
+	"github.com/gofrs/uuid"
+	"simpleServer/internal/geofence/model"
+	"time"
+)
+
+type GeofenceResponse struct {
+	Id         uuid.UUID       `json:"id"`
+	Name       string          `json:"name"`
+	Kind       string          `json:"kind"`
+	Area       json.RawMessage `json:"area"`
+	DwellLimit *int32          `json:"dwellLimit"`
+	Active     bool            `json:"active"`
+	Posts      []uuid.UUID     `json:"posts"`
+	CreatedAt  time.Time       `json:"createdAt"`
+	UpdatedAt  time.Time       `json:"updatedAt"`
+}
+
+func NewGeofenceResponse(geofence *model.Geofence) *GeofenceResponse {
+	posts := geofence.Posts
+	if posts == nil {
+		posts = []uuid.UUID{}
+	}
+	return &GeofenceResponse{
+		Id:         geofence.Id,
+		Name:       geofence.Name,
+		Kind:       geofence.Kind,
+		Area:       json.RawMessage(geofence.Area),
+		DwellLimit: geofence.DwellLimit,
+		Active:     geofence.Active,
+		Posts:      posts,
+		CreatedAt:  geofence.CreatedAt,
+		UpdatedAt:  geofence.UpdatedAt,
+	}
+}
+
+func NewGeofencesResponse(geofences []model.Geofence) []*GeofenceResponse {
+	data := make([]*GeofenceResponse, 0, len(geofences))
+	for i := range geofences {
+		data = append(data, NewGeofenceResponse(&geofences[i]))
+	}
+	return data
+}
+
+type EventResponse struct {
+	Id             uuid.UUID       `json:"id"`
+	PostId         uuid.UUID       `json:"postId"`
+	GeofenceId     *uuid.UUID      `json:"geofenceId"`
+	GeofenceName   *string         `json:"geofenceName"`
+	Type           string          `json:"type"`
+	Time           time.Time       `json:"time"`
+	Coordinates    []float64       `json:"coordinates"`
+	Alarm          bool            `json:"alarm"`
+	Details        json.RawMessage `json:"details"`
+	AcknowledgedAt *time.Time      `json:"acknowledgedAt"`
+	CreatedAt      time.Time       `json:"createdAt"`
+}
+
+func NewEventResponse(event *model.Event) *EventResponse {
+	res := &EventResponse{
+		Id:             event.Id,
+		PostId:         event.PostId,
+		GeofenceId:     event.GeofenceId,
+		GeofenceName:   event.GeofenceName,
+		Type:           event.Type,
+		Time:           event.Time,
+		Alarm:          event.Alarm,
+		Details:        json.RawMessage(event.Details),
+		AcknowledgedAt: event.AcknowledgedAt,
+		CreatedAt:      event.CreatedAt,
+	}
+	if event.Coordinates != nil && event.Coordinates.Point != nil {
+		res.Coordinates = []float64{event.Coordinates.X(), event.Coordinates.Y()}
+	}
+	return res
+}
+
+func NewEventsResponse(events []model.Event) []*EventResponse {
+	data := make([]*EventResponse, 0, len(events))
+	for i := range events {
+		data = append(data, NewEventResponse(&events[i]))
+	}
+	return data
+}
@@ -2,16 +2,20 @@ package database
 
 import (
 	"context"
+	"fmt"
 	"github.com/jmoiron/sqlx"
 	"simpleServer/dbutils"
+	campaignDB "simpleServer/internal/campaign/database"
 	"simpleServer/internal/heatmap/model"
 	"simpleServer/pkg/logging"
+	"time"
 )
 
 type HeatmapDB interface {
-	GetAllHeatmapPointsInBbox(ctx context.Context, n float64, w float64, s float64, e float64) ([]model.HeatmapPoint, error)
-	GetAllHeatmapPointsByCoordsDB(ctx context.Context, lat float64, Lng float64) ([]model.HeatmapPoint, error)
-	GetHeatmapPointsByIdDB(ctx context.Context, id int) ([]model.HeatmapPoint, error)
+	GetAllHeatmapPointsInBbox(ctx context.Context, n float64, w float64, s float64, e float64, query *model.MetricQuery) ([]model.HeatmapPoint, error)
+	GetAllHeatmapPointsByCoordsDB(ctx context.Context, lat float64, Lng float64, query *model.MetricQuery) ([]model.HeatmapPoint, error)
+	GetHeatmapPointsByIdDB(ctx context.Context, id int, query *model.MetricQuery) ([]model.HeatmapPoint, error)
+	GetDominanceInBbox(ctx context.Context, n float64, w float64, s float64, e float64, query *model.DominanceQuery) ([]model.DominanceCell, error)
 }
 
 type heatmapDB struct {
@@ -20,77 +24,295 @@ type heatmapDB struct {
 
 func NewHeatmapDB(dbh *sqlx.DB) HeatmapDB { return &heatmapDB{dbh: dbh} }
 
-func (h *heatmapDB) GetAllHeatmapPointsInBbox(ctx context.Context, n float64, w float64, s float64, e float64) ([]model.HeatmapPoint, error) {
+// metricPointsQuery aggregates the metric over the samples selected by from and filter.
+// from must join "GsmHistory" as GH and "GpsData" as GPS, prefix may hold a with clause.
+func metricPointsQuery(q *model.MetricQuery, prefix, from, filter string) string {
+	position := "GPS.coordinates"
+	if q.GridSize > 0 {
+		position = "st_snaptogrid(GPS.coordinates, :Grid)"
+	}
+	column := "GH." + q.Metric.Column
+	return fmt.Sprintf(`%s
+	select cast(%s as float8) as value, count(*) as samples, st_asewkb(s.position) as coordinates
+	from (
+		select %s as value, st_setsrid(%s, 4326) as position
+		%s
+		where %s is not null %s %s
+	) s
+	group by s.position`, prefix, q.ValueExpr("s.value"), column, position, from, column, filter, rangeFilter(q, "GPS.time", ":From", ":To"))
+}
+
+// rangeFilter limits column to the time range of the query, bounds are sql expressions.
+func rangeFilter(q *model.MetricQuery, column, from, to string) string {
+	var filter string
+	if !q.From.IsZero() {
+		filter += fmt.Sprintf(" and %s >= %s", column, from)
+	}
+	if !q.To.IsZero() {
+		filter += fmt.Sprintf(" and %s < %s", column, to)
+	}
+	return filter
+}
+
+// bboxFilter keeps the points of geom inside the box bound to :N, :W, :S and :E. Points are stored as
+// (lng, lat), so longitudes are tested against W..E and latitudes against S..N.
+func bboxFilter(geom string) string {
+	return fmt.Sprintf(`and st_x(%[1]s) >= :W
+				and st_x(%[1]s) <= :E
+				and st_y(%[1]s) >= :S
+				and st_y(%[1]s) <= :N`, geom)
+}
+
+// rollupCombine merges partial sums, counts, minimums and maximums into the query aggregation.
+var rollupCombine = map[string]string{
+	model.AggregationAvg:   "sum(s.sum) / nullif(sum(s.count), 0)",
+	model.AggregationMin:   "min(s.min)",
+	model.AggregationMax:   "max(s.max)",
+	model.AggregationCount: "sum(s.count)",
+}
+
+// rollupPointsQuery answers the days before the watermark from "SignalRollups" and the rest from raw samples.
+// rawFilter and rollupFilter restrict GPS.coordinates and R.cell respectively.
+func rollupPointsQuery(q *model.MetricQuery, rawFilter, rollupFilter string) string {
+	column := q.Metric.Column
+	rollupRange := ` and R.day < :Watermark`
+	if !q.From.IsZero() {
+		rollupRange += ` and R.day >= cast(:FromDay as date)`
+	}
+	if !q.To.IsZero() {
+		rollupRange += ` and R.day < cast(:ToDay as date)`
+	}
+	rawRange := ` and GPS.time >= :Watermark`
+	if !q.From.IsZero() {
+		rawRange += ` and GPS.time >= :From`
+	}
+	if !q.To.IsZero() {
+		rawRange += ` and GPS.time < :To`
+	}
+	return fmt.Sprintf(`select cast(%[1]s as float8) as value, cast(sum(s.count) as bigint) as samples, st_asewkb(s.position) as coordinates
+	from (
+		select st_setsrid(st_snaptogrid(GPS.coordinates, :Grid), 4326) as position,
+			cast(sum(GH.%[2]s) as float8) as sum, count(GH.%[2]s) as count,
+			cast(min(GH.%[2]s) as float8) as min, cast(max(GH.%[2]s) as float8) as max
+		from "GsmHistory" GH
+		inner join "GpsData" GPS on GPS.id = GH.gps
+		where GH.%[2]s is not null %[3]s %[4]s
+		group by 1
+		union all
+		select st_setsrid(st_snaptogrid(R.cell, :Grid), 4326) as position,
+			sum(R.%[2]s_sum), cast(sum(R.%[2]s_count) as bigint),
+			cast(min(R.%[2]s_min) as float8), cast(max(R.%[2]s_max) as float8)
+		from "SignalRollups" R
+		where R.%[2]s_count > 0 %[5]s %[6]s
+		group by 1
+	) s
+	group by s.position`, rollupCombine[q.Aggregation], column, rawFilter, rawRange, rollupFilter, rollupRange)
+}
+
+// rollupState returns the rollup watermark and grid, ok is false until a day is rolled up.
+func (h *heatmapDB) rollupState(ctx context.Context) (watermark time.Time, grid float64, ok bool, err error) {
+	var states []struct {
+		RolledUntil time.Time `db:"rolled_until"`
+		Grid        float64   `db:"grid"`
+	}
+	if err := dbutils.Select(ctx, h.dbh, &states, `select rolled_until, grid from "RollupState"`); err != nil {
+		return time.Time{}, 0, false, err
+	}
+	if len(states) == 0 {
+		return time.Time{}, 0, false, nil
+	}
+	return states[0].RolledUntil, states[0].Grid, true, nil
+}
+
+// withRollups answers q from rollups and raw samples when rollups can, rawFilter and rollupFilter as for
+// rollupPointsQuery. Otherwise query, the raw samples query, is kept.
+func (h *heatmapDB) withRollups(ctx context.Context, q *model.MetricQuery, query string, args map[string]interface{}, rawFilter, rollupFilter string) (string, error) {
+	watermark, grid, ok, err := h.rollupState(ctx)
+	if err != nil {
+		return "", err
+	}
+	if !ok || !q.UseRollups(watermark, grid) {
+		return query, nil
+	}
+	logging.FromContext(ctx).Debugw("heatmap uses rollups", "watermark", watermark, "grid", grid)
+	args["Watermark"] = watermark
+	args["FromDay"] = q.From.UTC().Format("2006-01-02")
+	args["ToDay"] = q.To.UTC().Format("2006-01-02")
+	return rollupPointsQuery(q, rawFilter, rollupFilter), nil
+}
+
+// stationCells selects the cells of the stations :Id, joined the way the raw queries join "BsInfo".
+const stationCells = `select GD.id from "BsInfo" BA
+		inner join "GsmData" GD on GD.arfcn = BA.arfcn
+		where BA.bs = :Id`
+
+// nearestStationCells selects the cells of the station nearest to :Lng, :Lat.
+const nearestStationCells = `select GD.id from "BsInfo" BA
+		inner join "GsmData" GD on GD.arfcn = BA.arfcn
+		where BA.bs = (
+			select id from "BaseStations"
+			order by st_distance(coordinates, st_setsrid(st_makepoint(:Lng, :Lat), 4326))
+			limit 1
+		)`
+
+func (h *heatmapDB) GetAllHeatmapPointsInBbox(ctx context.Context, n float64, w float64, s float64, e float64, q *model.MetricQuery) ([]model.HeatmapPoint, error) {
 	logger := logging.FromContext(ctx)
-	logger.Debugw("heatmap fetch data from bbox")
+	logger.Debugw("heatmap fetch data from bbox", "metric", q.Metric.Name, "aggregation", q.Aggregation)
+
+	args := map[string]interface{}{
+		"N":          n,
+		"W":          w,
+		"S":          s,
+		"E":          e,
+		"Grid":       q.GridSize,
+		"From":       q.From,
+		"To":         q.To,
+		"CampaignId": q.CampaignId,
+	}
+	query := metricPointsQuery(q, "",
+		`from "GsmHistory" GH
+				inner join public."GpsData" GPS on GPS.id = GH.gps`,
+		bboxFilter("GPS.coordinates")+campaignDB.Filter("GPS", q.CampaignId))
 
-	query := `select dbm, st_asewkb(coordinates) as coordinates from "GsmHistory" 
-				inner join public."GpsData" GD on GD.id = "GsmHistory".gps
-				where st_x(coordinates) >= :N
-				and st_x(coordinates) <= :W
-				and st_y(coordinates) >= :S
-				and st_y(coordinates) <= :E;`
+	query, err := h.withRollups(ctx, q, query, args,
+		bboxFilter("GPS.coordinates"), bboxFilter("R.cell"))
+	if err != nil {
+		return nil, err
+	}
 
 	var heatmapPoints []model.HeatmapPoint
 
-	if err := dbutils.NamedSelect(ctx, h.dbh, &heatmapPoints, query, map[string]interface{}{
-		"N": n,
-		"W": w,
-		"S": s,
-		"E": e,
-	}); err != nil {
+	if err := dbutils.NamedSelect(ctx, h.dbh, &heatmapPoints, query, args); err != nil {
 		return nil, err
 	}
 
 	return heatmapPoints, nil
 }
 
-func (h *heatmapDB) GetHeatmapPointsByIdDB(ctx context.Context, id int) (heatmapPoints []model.HeatmapPoint, err error) {
+func (h *heatmapDB) GetHeatmapPointsByIdDB(ctx context.Context, id int, q *model.MetricQuery) (heatmapPoints []model.HeatmapPoint, err error) {
 	logger := logging.FromContext(ctx)
 	logger.Debugw("heatmap fetch data from bbox")
 
-	query := `select GH.dbm, st_asewkb(GPS.coordinates) as coordinates
-				from "BaseStations"
+	query := metricPointsQuery(q, "",
+		`from "BaseStations"
     			inner join public."BsInfo" BA on "BaseStations".id = BA.bs
     			inner join public."arfcn" on BA.arfcn = arfcn.id
     			inner join public."GsmData" GD on arfcn.id = GD.arfcn
     			inner join public."GsmHistory" GH on GH.gsm = GD.id
-    			inner join public."GpsData" GPS on GPS.id = GH.gps
-    			where "BaseStations".id = :Id;`
+    			inner join public."GpsData" GPS on GPS.id = GH.gps`,
+		`and "BaseStations".id = :Id`+campaignDB.Filter("GPS", q.CampaignId))
+	args := map[string]interface{}{"Id": id, "Grid": q.GridSize, "From": q.From, "To": q.To, "CampaignId": q.CampaignId}
+	query, err = h.withRollups(ctx, q, query, args, `and GH.gsm in (`+stationCells+`)`, `and R.gsm in (`+stationCells+`)`)
+	if err != nil {
+		return nil, err
+	}
 
 	var heatmapPointsById []model.HeatmapPoint
 
-	if err := dbutils.NamedSelect(ctx, h.dbh, &heatmapPointsById, query, map[string]interface{}{"Id": id}); err != nil {
+	if err := dbutils.NamedSelect(ctx, h.dbh, &heatmapPointsById, query, args); err != nil {
 		return nil, err
 	}
 
 	return heatmapPointsById, nil
 }
 
-func (h *heatmapDB) GetAllHeatmapPointsByCoordsDB(ctx context.Context, lat float64, lng float64) (heatmapPoints []model.HeatmapPoint, err error) {
+func (h *heatmapDB) GetAllHeatmapPointsByCoordsDB(ctx context.Context, lat float64, lng float64, q *model.MetricQuery) (heatmapPoints []model.HeatmapPoint, err error) {
 	logger := logging.FromContext(ctx)
 	logger.Debugw("heatmap fetch data from bbox")
 
-	query := `with Bs as (
+	query := metricPointsQuery(q, `with Bs as (
     select id
     from (select id,
                  st_distance(coordinates, st_setsrid(st_makepoint(:Lng, :Lat), 4326)) distance
           from "BaseStations"
           order by distance
           limit 1) as inner_query
-	)
-	select GH.dbm, st_asewkb(GPS.coordinates) as coordinates 
-	from Bs inner join "BsInfo" on Bs.id = "BsInfo".bs
+	)`,
+		`from Bs inner join "BsInfo" on Bs.id = "BsInfo".bs
         inner join "arfcn" on "BsInfo".arfcn = arfcn.id
         inner join "GsmData" on arfcn.id = "GsmData".arfcn
         inner join public."GsmHistory" GH on GH.gsm = "GsmData".id
-        inner join public."GpsData" GPS on GPS.id = GH.gps;`
+        inner join public."GpsData" GPS on GPS.id = GH.gps`, campaignDB.Filter("GPS", q.CampaignId))
+	args := map[string]interface{}{"Lng": lng, "Lat": lat, "Grid": q.GridSize, "From": q.From, "To": q.To, "CampaignId": q.CampaignId}
+	query, err = h.withRollups(ctx, q, query, args, `and GH.gsm in (`+nearestStationCells+`)`, `and R.gsm in (`+nearestStationCells+`)`)
+	if err != nil {
+		return nil, err
+	}
 
 	var heatmapPointsById []model.HeatmapPoint
 
-	if err := dbutils.NamedSelect(ctx, h.dbh, &heatmapPointsById, query, map[string]interface{}{"Lng": lng, "Lat": lat}); err != nil {
+	if err := dbutils.NamedSelect(ctx, h.dbh, &heatmapPointsById, query, args); err != nil {
 		return nil, err
 	}
 
 	return heatmapPointsById, nil
 }
+
+// GetDominanceInBbox ranks the cells heard in every grid cell of the bbox by their average level.
+// Cells are matched to stations through "BsInfo" by arfcn, cid and lac/tac; unregistered cells have no station.
+func (h *heatmapDB) GetDominanceInBbox(ctx context.Context, n float64, w float64, s float64, e float64, q *model.DominanceQuery) ([]model.DominanceCell, error) {
+	logger := logging.FromContext(ctx)
+	logger.Debugw("heatmap dominance in bbox", "metric", q.Metric.Name, "grid", q.GridSize)
+
+	query := fmt.Sprintf(`with samples as (
+		select st_snaptogrid(GPS.coordinates, :Grid) as cell, GH.gsm, GH.%[1]s as value
+		from "GsmHistory" GH
+		inner join "GpsData" GPS on GPS.id = GH.gps
+		where GPS.coordinates && st_makeenvelope(:W, :S, :E, :N, 4326)
+		and GH.%[1]s is not null %[2]s
+	), servers as (
+		select cell, gsm, avg(value) as value, count(*) as samples,
+			row_number() over w as rank,
+			first_value(avg(value)) over w as best
+		from samples
+		group by cell, gsm
+		window w as (partition by cell order by avg(value) desc)
+	), dominance as (
+		select cell,
+			(array_agg(gsm) filter (where rank = 1))[1] as gsm,
+			max(value) filter (where rank = 1) as best_value,
+			max(value) filter (where rank = 2) as second_value,
+			count(*) filter (where rank > 1 and value >= best - :Window) as servers_in_window,
+			count(*) as servers,
+			sum(samples) as samples
+		from servers
+		group by cell
+	)
+	select st_asewkb(st_setsrid(D.cell, 4326)) as coordinates,
+		D.gsm as gsm_id,
+		GD.cid,
+		GD.lac_tac,
+		arfcn.arfcn_number,
+		"CellularNetworkType".type as technology,
+		BI.bs,
+		BI.sector_number,
+		cast(D.best_value as float8) as best_value,
+		cast(D.second_value as float8) as second_value,
+		D.servers_in_window,
+		D.servers,
+		D.samples
+	from dominance D
+	inner join "GsmData" GD on GD.id = D.gsm
+	inner join arfcn on arfcn.id = GD.arfcn
+	left join "CellularNetworkType" on arfcn."CellularNetworkType" = "CellularNetworkType".id
+	left join lateral (
+		select bs, sector_number from "BsInfo"
+		where "BsInfo".arfcn = GD.arfcn and "BsInfo".cid = GD.cid and "BsInfo".lac_tac = GD.lac_tac
+		limit 1
+	) BI on true`, q.Metric.Column, campaignDB.Filter("GPS", q.CampaignId))
+
+	var cells []model.DominanceCell
+	if err := dbutils.NamedSelect(ctx, h.dbh, &cells, query, map[string]interface{}{
+		"N":          n,
+		"W":          w,
+		"S":          s,
+		"E":          e,
+		"Grid":       q.GridSize,
+		"Window":     q.Window,
+		"CampaignId": q.CampaignId,
+	}); err != nil {
+		return nil, err
+	}
+
+	return cells, nil
+}
@@ -0,0 +1,13 @@
+package database
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestBboxFilter(t *testing.T) {
+	filter := strings.Join(strings.Fields(bboxFilter("GPS.coordinates")), " ")
+	assert.Equal(t, "and st_x(GPS.coordinates) >= :W and st_x(GPS.coordinates) <= :E "+
+		"and st_y(GPS.coordinates) >= :S and st_y(GPS.coordinates) <= :N", filter)
+}
@@ -4,20 +4,68 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/go-playground/validator/v10"
 	"net/http"
+	"simpleServer/internal/auth"
+	authModel "simpleServer/internal/auth/model"
+	"simpleServer/internal/campaign"
+	campaignDB "simpleServer/internal/campaign/database"
 	"simpleServer/internal/config"
 	"simpleServer/internal/heatmap/database"
 	"simpleServer/internal/heatmap/model"
 	"simpleServer/internal/middleware"
 	"simpleServer/internal/middleware/handler"
+	"simpleServer/internal/ratelimit"
 	"simpleServer/pkg/logging"
 	"simpleServer/pkg/validate"
+	"time"
 )
 
 type Handler struct {
-	heatmapDB database.HeatmapDB
+	heatmapDB  database.HeatmapDB
+	campaignDB campaignDB.CampaignDB
 }
 
-func NewHandler(db database.HeatmapDB) *Handler { return &Handler{heatmapDB: db} }
+func NewHandler(db database.HeatmapDB, campaigns campaignDB.CampaignDB) *Handler {
+	return &Handler{heatmapDB: db, campaignDB: campaigns}
+}
+
+// bindMetricQuery reads the metric, aggregation, grid, range and campaign query parameters shared by heatmap
+// endpoints.
+func (h *Handler) bindMetricQuery(c *gin.Context) (*model.MetricQuery, *handler.Response) {
+	type RequestQuery struct {
+		Metric      string    `form:"metric"`
+		Aggregation string    `form:"agg"`
+		Grid        float64   `form:"grid"`
+		From        time.Time `form:"from" time_format:"2006-01-02T15:04:05Z07:00"`
+		To          time.Time `form:"to" time_format:"2006-01-02T15:04:05Z07:00"`
+		Campaign    string    `form:"campaign" binding:"omitempty,uuid"`
+	}
+	var query RequestQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		var details []*validate.ValidationErrDetail
+		if vErrs, ok := err.(validator.ValidationErrors); ok {
+			details = validate.ValidationErrorDetails(&query, "form", vErrs)
+		}
+		return nil, handler.NewErrorResponse(http.StatusBadRequest, handler.InvalidQueryValue, "invalid metric query", details)
+	}
+	metricQuery, err := model.NewMetricQuery(query.Metric, query.Aggregation, query.Grid)
+	if err == nil {
+		err = metricQuery.SetRange(query.From, query.To)
+	}
+	if err != nil {
+		return nil, handler.NewErrorResponse(http.StatusBadRequest, handler.InvalidQueryValue, err.Error(), nil)
+	}
+	var res *handler.Response
+	if metricQuery.CampaignId, res = campaign.FilterId(c.Request.Context(), h.campaignDB, query.Campaign); res != nil {
+		return nil, res
+	}
+	return metricQuery, nil
+}
+
+func (h *Handler) GetMetrics(c *gin.Context) {
+	handler.HandleRequest(c, func(c *gin.Context) *handler.Response {
+		return handler.NewSuccessResponse(http.StatusOK, model.Metrics())
+	})
+}
 
 func (h *Handler) GetHeatMapPointsInBbox(c *gin.Context) {
 	handler.HandleRequest(c, func(c *gin.Context) *handler.Response {
@@ -37,14 +85,18 @@ func (h *Handler) GetHeatMapPointsInBbox(c *gin.Context) {
 			}
 			return handler.NewErrorResponse(http.StatusBadRequest, handler.InvalidUriValue, "invalid nw, se", details)
 		}
+		metricQuery, res := h.bindMetricQuery(c)
+		if res != nil {
+			return res
+		}
 		var points []model.HeatmapPoint
 		var err error
-		if points, err = h.heatmapDB.GetAllHeatmapPointsInBbox(c, uri.N, uri.W, uri.S, uri.W); err != nil {
+		if points, err = h.heatmapDB.GetAllHeatmapPointsInBbox(c, uri.N, uri.W, uri.S, uri.E, metricQuery); err != nil {
 			logger.Errorf("GetHeatMapPointsInBbox err: %v", err)
 			return handler.NewInternalErrorResponse(err)
 		}
 
-		return handler.NewSuccessResponse(http.StatusOK, NewHeatmapPointsInBboxResponse(points))
+		return handler.NewSuccessResponse(http.StatusOK, NewHeatmapPointsInBboxResponse(points, metricQuery))
 	})
 }
 
@@ -63,14 +115,18 @@ func (h *Handler) GetHeatMapPointsByBsId(c *gin.Context) {
 			}
 			return handler.NewErrorResponse(http.StatusBadRequest, handler.InvalidUriValue, "invalid bs id", details)
 		}
+		metricQuery, res := h.bindMetricQuery(c)
+		if res != nil {
+			return res
+		}
 		var points []model.HeatmapPoint
 		var err error
-		if points, err = h.heatmapDB.GetHeatmapPointsByIdDB(c, uri.Id); err != nil {
+		if points, err = h.heatmapDB.GetHeatmapPointsByIdDB(c, uri.Id, metricQuery); err != nil {
 			logger.Errorf("GetHeatMapPointsInBbox err: %v", err)
 			return handler.NewInternalErrorResponse(err)
 		}
 
-		return handler.NewSuccessResponse(http.StatusOK, NewHeatmapPointsInBboxResponse(points))
+		return handler.NewSuccessResponse(http.StatusOK, NewHeatmapPointsInBboxResponse(points, metricQuery))
 	})
 }
 
@@ -90,26 +146,79 @@ func (h *Handler) GetHeatMapPointsByCoords(c *gin.Context) {
 			}
 			return handler.NewErrorResponse(http.StatusBadRequest, handler.InvalidUriValue, "invalid bs id", details)
 		}
+		metricQuery, res := h.bindMetricQuery(c)
+		if res != nil {
+			return res
+		}
 		var points []model.HeatmapPoint
 		var err error
-		if points, err = h.heatmapDB.GetAllHeatmapPointsByCoordsDB(c, uri.Lat, uri.Lng); err != nil {
+		if points, err = h.heatmapDB.GetAllHeatmapPointsByCoordsDB(c, uri.Lat, uri.Lng, metricQuery); err != nil {
 			logger.Errorf("GetHeatmapPointsByCoordsDB err: %v", err)
 			return handler.NewInternalErrorResponse(err)
 		}
 
-		return handler.NewSuccessResponse(http.StatusOK, NewHeatmapPointsInBboxResponse(points))
+		return handler.NewSuccessResponse(http.StatusOK, NewHeatmapPointsInBboxResponse(points, metricQuery))
+	})
+}
+
+func (h *Handler) GetDominanceInBbox(c *gin.Context) {
+	handler.HandleRequest(c, func(c *gin.Context) *handler.Response {
+		logger := logging.FromContext(c)
+		type RequestUri struct {
+			N float64 `uri:"n"`
+			W float64 `uri:"w"`
+			S float64 `uri:"s"`
+			E float64 `uri:"e"`
+		}
+		type RequestQuery struct {
+			Metric   string  `form:"metric"`
+			Grid     float64 `form:"grid"`
+			Window   float64 `form:"window"`
+			Campaign string  `form:"campaign" binding:"omitempty,uuid"`
+		}
+		var uri RequestUri
+		var query RequestQuery
+		if err := c.ShouldBindUri(&uri); err != nil {
+			logger.Errorf("heatmap uri parse error: %v", err)
+			var details []*validate.ValidationErrDetail
+			if vErrs, ok := err.(validator.ValidationErrors); ok {
+				details = validate.ValidationErrorDetails(&uri, "uri", vErrs)
+			}
+			return handler.NewErrorResponse(http.StatusBadRequest, handler.InvalidUriValue, "invalid nw, se", details)
+		}
+		if err := c.ShouldBindQuery(&query); err != nil {
+			return handler.NewErrorResponse(http.StatusBadRequest, handler.InvalidQueryValue, "invalid metric, grid, window or campaign", nil)
+		}
+		dominanceQuery, err := model.NewDominanceQuery(query.Metric, query.Grid, query.Window, uri.N, uri.W, uri.S, uri.E)
+		if err != nil {
+			return handler.NewErrorResponse(http.StatusBadRequest, handler.InvalidQueryValue, err.Error(), nil)
+		}
+		var res *handler.Response
+		if dominanceQuery.CampaignId, res = campaign.FilterId(c.Request.Context(), h.campaignDB, query.Campaign); res != nil {
+			return res
+		}
+
+		cells, err := h.heatmapDB.GetDominanceInBbox(c, uri.N, uri.W, uri.S, uri.E, dominanceQuery)
+		if err != nil {
+			logger.Errorf("GetDominanceInBbox err: %v", err)
+			return handler.NewInternalErrorResponse(err)
+		}
+
+		return handler.NewSuccessResponse(http.StatusOK, NewDominanceResponse(cells, dominanceQuery))
 	})
 }
 
-func RouteV1(cfg *config.Config, h *Handler, r *gin.Engine) {
+func RouteV1(cfg *config.Config, h *Handler, a *auth.Authenticator, l *ratelimit.Limiter, r *gin.Engine) {
 	v1 := r.Group("v1/api")
 	v1.Use(middleware.CorsMiddleware(), middleware.RequestIDMiddleware(), middleware.TimeoutMiddleware(cfg.ServerConfig.WriteTimeout))
 
 	heatmapV1 := v1.Group("heatmap")
-	heatmapV1.Use()
+	heatmapV1.Use(a.Authenticate(), a.Require(authModel.PermissionRead), l.Limit("heatmap"))
 	{
+		heatmapV1.GET("/metrics", h.GetMetrics)
 		heatmapV1.GET("/nw/:n/:w/se/:s/:e", h.GetHeatMapPointsInBbox)
 		heatmapV1.GET("/lat/:lat/lng/:lng", h.GetHeatMapPointsByCoords)
+		heatmapV1.GET("/dominance/nw/:n/:w/se/:s/:e", h.GetDominanceInBbox)
 		// Not work for now but maybe need later
 		//heatmapV1.GET("/id/:id", h.GetHeatMapPointsByBsId)
 	}
@@ -0,0 +1,76 @@
+package model
+
+import (
+	"fmt"
+	"github.com/gofrs/uuid"
+	"github.com/twpayne/go-geom/encoding/ewkb"
+)
+
+const (
+	DefaultDominanceWindow = 6
+	DefaultDominanceGrid   = 0.001
+	// maxDominanceCells bounds the grid a single request may compute.
+	maxDominanceCells = 250000
+	// PollutionServers is the number of servers within the window besides the best one that makes a cell polluted.
+	PollutionServers = 3
+)
+
+// DominanceCell is the best server of one grid cell and how strongly it dominates the others.
+type DominanceCell struct {
+	Coordinates     ewkb.Point `db:"coordinates"`
+	GsmId           uuid.UUID  `db:"gsm_id"`
+	Cid             *int32     `db:"cid"`
+	LacTac          *int32     `db:"lac_tac"`
+	ArfcnNumber     int64      `db:"arfcn_number"`
+	Technology      *string    `db:"technology"`
+	Bs              *uint64    `db:"bs"`
+	SectorNumber    *int16     `db:"sector_number"`
+	BestValue       float64    `db:"best_value"`
+	SecondValue     *float64   `db:"second_value"`
+	ServersInWindow int        `db:"servers_in_window"`
+	Servers         int        `db:"servers"`
+	Samples         int        `db:"samples"`
+}
+
+func (d *DominanceCell) Margin() *float64 {
+	if d.SecondValue == nil {
+		return nil
+	}
+	margin := d.BestValue - *d.SecondValue
+	return &margin
+}
+
+type DominanceQuery struct {
+	Metric   *Metric
+	GridSize float64
+	// Window is the distance in dB from the best server within which other servers are counted.
+	Window float64
+	// CampaignId keeps only the samples of that campaign.
+	CampaignId *uuid.UUID
+}
+
+func NewDominanceQuery(metric string, gridSize, window float64, n, w, s, e float64) (*DominanceQuery, error) {
+	m, err := MetricByName(metric)
+	if err != nil {
+		return nil, err
+	}
+	if !m.Power {
+		return nil, fmt.Errorf("metric %q can't rank servers", m.Name)
+	}
+	if gridSize == 0 {
+		gridSize = DefaultDominanceGrid
+	}
+	if window == 0 {
+		window = DefaultDominanceWindow
+	}
+	if gridSize < 0 || window < 0 {
+		return nil, fmt.Errorf("grid and window must be positive")
+	}
+	if n <= s || e <= w {
+		return nil, fmt.Errorf("invalid bbox")
+	}
+	if cells := (n - s) / gridSize * (e - w) / gridSize; cells > maxDominanceCells {
+		return nil, fmt.Errorf("bbox holds %.0f grid cells, at most %d allowed", cells, maxDominanceCells)
+	}
+	return &DominanceQuery{Metric: m, GridSize: gridSize, Window: window}, nil
+}
@@ -11,18 +11,18 @@ type Coordinate struct {
 	Lng float64
 }
 
+// HeatmapPoint is the aggregated value of one metric over the samples taken at a point.
 type HeatmapPoint struct {
 	Coordinates ewkb.Point `db:"coordinates"`
-	//Coordinates Coordinate
-	Dbm int32 `db:"dbm"`
+	Value       float64    `db:"value"`
+	Samples     int        `db:"samples"`
 }
 
 func (h *HeatmapPoint) String() string {
-	//var coordinates = Coordinate{h.Coordinates.Lat, h.Coordinates.Lng}
-	//coordinates := []Coordinate{h.Coordinates.X(), h.Coordinates.Y()}
 	coordinates := []float64{h.Coordinates.X(), h.Coordinates.Y()}
 	jsonObject := make(map[string]interface{})
-	jsonObject["dbm"] = h.Dbm
+	jsonObject["value"] = h.Value
+	jsonObject["samples"] = h.Samples
 	jsonObject["coordinates"] = coordinates
 
 	js, err := json.Marshal(jsonObject)
@@ -35,7 +35,8 @@ func (h *HeatmapPoint) String() string {
 
 func (h *HeatmapPoint) UnmarshalJSON(bytes []byte) error {
 	var jsonData struct {
-		Dbm         int32     `json:"dbm"`
+		Value       float64   `json:"value"`
+		Samples     int       `json:"samples"`
 		Coordinates []float64 `json:"coordinates"`
 	}
 
@@ -43,10 +44,9 @@ func (h *HeatmapPoint) UnmarshalJSON(bytes []byte) error {
 	if err != nil {
 		return err
 	}
-	h.Dbm = jsonData.Dbm
-	//h.Coordinates = ewkb.Point{Point: geom.NewPoint(geom.XY).MustSetCoords([]float64{jsonData.Coordinates[0], jsonData.Coordinates[1]}).SetSRID(4326)}
+	h.Value = jsonData.Value
+	h.Samples = jsonData.Samples
 	point := ewkb.Point{Point: geom.NewPoint(geom.XY).MustSetCoords([]float64{jsonData.Coordinates[0], jsonData.Coordinates[1]}).SetSRID(4326)}
-	//h.Coordinates = Coordinate{point.X(), point.Y()}
 	h.Coordinates = point
 	return nil
 }
@@ -0,0 +1,199 @@
+package model
+
+import (
+	"fmt"
+	"github.com/gofrs/uuid"
+	"time"
+)
+
+const (
+	AggregationAvg    = "avg"
+	AggregationMin    = "min"
+	AggregationMax    = "max"
+	AggregationMedian = "median"
+	AggregationCount  = "count"
+)
+
+var aggregations = map[string]string{
+	AggregationAvg:    "avg(%s)",
+	AggregationMin:    "min(%s)",
+	AggregationMax:    "max(%s)",
+	AggregationMedian: "percentile_cont(0.5) within group (order by %s)",
+	AggregationCount:  "count(%s)",
+}
+
+// Threshold colours every value greater or equal to From, unless a higher threshold matches first.
+type Threshold struct {
+	From  float64 `json:"from"`
+	Color string  `json:"color"`
+	Label string  `json:"label"`
+}
+
+type Metric struct {
+	Name        string      `json:"name"`
+	Title       string      `json:"title"`
+	Unit        string      `json:"unit"`
+	Technology  []string    `json:"technology"`
+	Aggregation string      `json:"aggregation"`
+	Thresholds  []Threshold `json:"thresholds"`
+	// Power metrics are received power levels, so servers can be ranked by them.
+	Power bool `json:"power"`
+	// Column is the "GsmHistory" column holding the metric.
+	Column string `json:"-"`
+}
+
+const (
+	colorExcellent = "#1a9850"
+	colorGood      = "#91cf60"
+	colorFair      = "#fee08b"
+	colorPoor      = "#fc8d59"
+	colorBad       = "#d73027"
+)
+
+const DefaultMetric = "dbm"
+
+var metrics = []Metric{
+	{
+		Name: "dbm", Title: "Received level", Unit: "dBm", Column: "dbm", Aggregation: AggregationAvg, Power: true,
+		Technology: []string{"GSM", "UMTS", "LTE", "NR"},
+		Thresholds: levels(-70, -85, -95, -105),
+	},
+	{
+		Name: "rsrp", Title: "RSRP", Unit: "dBm", Column: "rsrp", Aggregation: AggregationAvg, Power: true,
+		Technology: []string{"LTE", "NR"},
+		Thresholds: levels(-80, -90, -100, -110),
+	},
+	{
+		Name: "rsrq", Title: "RSRQ", Unit: "dB", Column: "rsrq", Aggregation: AggregationMedian,
+		Technology: []string{"LTE", "NR"},
+		Thresholds: levels(-10, -13, -16, -20),
+	},
+	{
+		Name: "sinr", Title: "SINR", Unit: "dB", Column: "sinr", Aggregation: AggregationMedian,
+		Technology: []string{"LTE", "NR"},
+		Thresholds: levels(20, 13, 5, 0),
+	},
+	{
+		Name: "rscp", Title: "RSCP", Unit: "dBm", Column: "rscp", Aggregation: AggregationAvg, Power: true,
+		Technology: []string{"UMTS"},
+		Thresholds: levels(-75, -85, -95, -105),
+	},
+	{
+		Name: "ecio", Title: "Ec/Io", Unit: "dB", Column: "ecio", Aggregation: AggregationMedian,
+		Technology: []string{"UMTS"},
+		Thresholds: levels(-6, -10, -14, -18),
+	},
+	{
+		// a lower timing advance means the sample was taken closer to the station.
+		Name: "ta", Title: "Timing advance", Unit: "", Column: "timing_advance", Aggregation: AggregationMin,
+		Technology: []string{"GSM", "LTE"},
+		Thresholds: []Threshold{
+			{From: 20, Color: colorBad, Label: "far"},
+			{From: 10, Color: colorPoor, Label: "distant"},
+			{From: 3, Color: colorFair, Label: "middle"},
+			{From: 0, Color: colorExcellent, Label: "near"},
+		},
+	},
+}
+
+// levels builds the usual five colour scale, where a higher value is a better signal.
+func levels(excellent, good, fair, poor float64) []Threshold {
+	return []Threshold{
+		{From: excellent, Color: colorExcellent, Label: "excellent"},
+		{From: good, Color: colorGood, Label: "good"},
+		{From: fair, Color: colorFair, Label: "fair"},
+		{From: poor, Color: colorPoor, Label: "poor"},
+		{From: -1000, Color: colorBad, Label: "bad"},
+	}
+}
+
+func Metrics() []Metric {
+	return metrics
+}
+
+func MetricByName(name string) (*Metric, error) {
+	if name == "" {
+		name = DefaultMetric
+	}
+	for i := range metrics {
+		if metrics[i].Name == name {
+			return &metrics[i], nil
+		}
+	}
+	return nil, fmt.Errorf("unknown metric %q", name)
+}
+
+// Color returns the colour of the first threshold the value reaches, thresholds are ordered from the highest.
+func (m *Metric) Color(value float64) string {
+	for _, threshold := range m.Thresholds {
+		if value >= threshold.From {
+			return threshold.Color
+		}
+	}
+	return ""
+}
+
+// MetricQuery selects which metric heatmap points carry and how samples falling on the same spot are combined.
+type MetricQuery struct {
+	Metric      *Metric
+	Aggregation string
+	// GridSize snaps points to a grid of that many degrees before aggregation, 0 keeps every GPS fix.
+	GridSize float64
+	// From and To limit the samples to that time range, zero values leave it open.
+	From time.Time
+	To   time.Time
+	// CampaignId keeps only the samples of that campaign.
+	CampaignId *uuid.UUID
+}
+
+func NewMetricQuery(metric, aggregation string, gridSize float64) (*MetricQuery, error) {
+	m, err := MetricByName(metric)
+	if err != nil {
+		return nil, err
+	}
+	if aggregation == "" {
+		aggregation = m.Aggregation
+	}
+	if _, ok := aggregations[aggregation]; !ok {
+		return nil, fmt.Errorf("unknown aggregation %q", aggregation)
+	}
+	if gridSize < 0 {
+		return nil, fmt.Errorf("negative grid size")
+	}
+	return &MetricQuery{Metric: m, Aggregation: aggregation, GridSize: gridSize}, nil
+}
+
+// ValueExpr is the aggregate sql expression over column.
+func (q *MetricQuery) ValueExpr(column string) string {
+	return fmt.Sprintf(aggregations[q.Aggregation], column)
+}
+
+// Colored tells if the aggregated value is in the metric unit, so thresholds apply to it.
+func (q *MetricQuery) Colored() bool {
+	return q.Aggregation != AggregationCount
+}
+
+func (q *MetricQuery) SetRange(from, to time.Time) error {
+	if !from.IsZero() && !to.IsZero() && !from.Before(to) {
+		return fmt.Errorf("from must be before to")
+	}
+	q.From, q.To = from, to
+	return nil
+}
+
+// UseRollups tells if daily rollups on a grid of rollupGrid degrees can answer the query for the days
+// before watermark. Medians can't be combined from summaries, and rollups can't be split into finer
+// grids, parts of a day or campaigns.
+func (q *MetricQuery) UseRollups(watermark time.Time, rollupGrid float64) bool {
+	if q.Aggregation == AggregationMedian || q.CampaignId != nil || rollupGrid <= 0 || q.GridSize < rollupGrid*(1-1e-9) {
+		return false
+	}
+	if !q.From.IsZero() && (!q.From.Before(watermark) || !isUTCMidnight(q.From)) {
+		return false
+	}
+	return q.To.IsZero() || !q.To.Before(watermark) || isUTCMidnight(q.To)
+}
+
+func isUTCMidnight(t time.Time) bool {
+	return t.UTC().Truncate(24 * time.Hour).Equal(t)
+}
@@ -0,0 +1,77 @@
+package model
+
+import (
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestMetricColor(t *testing.T) {
+	rsrp, err := MetricByName("rsrp")
+	require.NoError(t, err)
+	assert.Equal(t, colorExcellent, rsrp.Color(-75))
+	assert.Equal(t, colorFair, rsrp.Color(-100))
+	assert.Equal(t, colorBad, rsrp.Color(-130))
+
+	ta, err := MetricByName("ta")
+	require.NoError(t, err)
+	assert.Equal(t, colorExcellent, ta.Color(1))
+	assert.Equal(t, colorBad, ta.Color(40))
+}
+
+func TestNewMetricQuery(t *testing.T) {
+	q, err := NewMetricQuery("", "", 0)
+	require.NoError(t, err)
+	assert.Equal(t, DefaultMetric, q.Metric.Name)
+	assert.Equal(t, "avg(s.value)", q.ValueExpr("s.value"))
+
+	q, err = NewMetricQuery("sinr", "", 0.001)
+	require.NoError(t, err)
+	assert.Equal(t, "percentile_cont(0.5) within group (order by v)", q.ValueExpr("v"))
+
+	_, err = NewMetricQuery("sinr", "sum", 0)
+	assert.Error(t, err)
+	_, err = NewMetricQuery("rssi", "", 0)
+	assert.Error(t, err)
+}
+
+func TestNewDominanceQuery(t *testing.T) {
+	q, err := NewDominanceQuery("rsrp", 0, 0, 60, 30, 59.9, 30.2)
+	require.NoError(t, err)
+	assert.Equal(t, DefaultDominanceGrid, q.GridSize)
+	assert.EqualValues(t, DefaultDominanceWindow, q.Window)
+
+	_, err = NewDominanceQuery("sinr", 0, 0, 60, 30, 59.9, 30.2)
+	assert.Error(t, err)
+	_, err = NewDominanceQuery("dbm", 0.00001, 0, 60, 30, 59, 31)
+	assert.Error(t, err)
+}
+
+func TestUseRollups(t *testing.T) {
+	watermark := time.Date(2024, 5, 10, 0, 0, 0, 0, time.UTC)
+	q, err := NewMetricQuery("rsrp", "", 0.002)
+	require.NoError(t, err)
+	assert.True(t, q.UseRollups(watermark, 0.001))
+	assert.True(t, q.UseRollups(watermark, 0.002))
+	assert.False(t, q.UseRollups(watermark, 0.005), "finer than rollups")
+
+	require.NoError(t, q.SetRange(time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC), time.Date(2024, 5, 12, 13, 0, 0, 0, time.UTC)))
+	assert.True(t, q.UseRollups(watermark, 0.001), "raw samples cover the part after the watermark")
+	require.NoError(t, q.SetRange(time.Date(2024, 5, 1, 6, 0, 0, 0, time.UTC), time.Time{}))
+	assert.False(t, q.UseRollups(watermark, 0.001), "part of a day")
+	require.NoError(t, q.SetRange(time.Date(2024, 5, 11, 0, 0, 0, 0, time.UTC), time.Time{}))
+	assert.False(t, q.UseRollups(watermark, 0.001), "nothing rolled up in range")
+	assert.Error(t, q.SetRange(watermark, watermark))
+
+	q, err = NewMetricQuery("sinr", AggregationMedian, 0.01)
+	require.NoError(t, err)
+	assert.False(t, q.UseRollups(watermark, 0.001))
+
+	q, err = NewMetricQuery("rsrp", "", 0.002)
+	require.NoError(t, err)
+	campaignId := uuid.Must(uuid.NewV4())
+	q.CampaignId = &campaignId
+	assert.False(t, q.UseRollups(watermark, 0.001), "rollups keep no posts")
+}
@@ -1,12 +1,19 @@
 package heatmap
 
 import (
+	"github.com/twpayne/go-geom"
+	"github.com/twpayne/go-geom/encoding/geojson"
+	"math"
 	"simpleServer/internal/heatmap/model"
 )
 
 type Point struct {
-	Dbm    int32     `json:"dbm"`
-	Coords []float64 `'json:"coords"`
+	Dbm     int32     `json:"dbm,omitempty"`
+	Coords  []float64 `'json:"coords"`
+	Metric  string    `json:"metric"`
+	Value   float64   `json:"value"`
+	Samples int       `json:"samples"`
+	Color   string    `json:"color,omitempty"`
 }
 
 type HeatmapResponse struct {
@@ -14,13 +21,58 @@ type HeatmapResponse struct {
 	Coordinates []float64 `json:"coordinates"`
 }
 
-func NewHeatmapPointsInBboxResponse(points []model.HeatmapPoint) []interface{} {
+func NewHeatmapPointsInBboxResponse(points []model.HeatmapPoint, query *model.MetricQuery) []interface{} {
 	data := make([]interface{}, 0)
 	for _, point := range points {
-		data = append(data, Point{
-			Dbm:    point.Dbm,
-			Coords: []float64{point.Coordinates.X(), point.Coordinates.Y()},
-		})
+		p := Point{
+			Coords:  []float64{point.Coordinates.X(), point.Coordinates.Y()},
+			Metric:  query.Metric.Name,
+			Value:   point.Value,
+			Samples: point.Samples,
+		}
+		if query.Colored() {
+			p.Color = query.Metric.Color(point.Value)
+		}
+		// dbm is kept for clients written before metrics could be selected.
+		if query.Metric.Name == model.DefaultMetric {
+			p.Dbm = int32(math.Round(point.Value))
+		}
+		data = append(data, p)
 	}
 	return data
 }
+
+// NewDominanceResponse renders every grid cell as a square polygon with its best server in the properties.
+func NewDominanceResponse(cells []model.DominanceCell, query *model.DominanceQuery) *geojson.FeatureCollection {
+	half := query.GridSize / 2
+	collection := &geojson.FeatureCollection{Features: make([]*geojson.Feature, 0, len(cells))}
+	for i := range cells {
+		cell := &cells[i]
+		x, y := cell.Coordinates.X(), cell.Coordinates.Y()
+		square := geom.NewPolygon(geom.XY).MustSetCoords([][]geom.Coord{{
+			{x - half, y - half}, {x + half, y - half}, {x + half, y + half}, {x - half, y + half}, {x - half, y - half},
+		}})
+		collection.Features = append(collection.Features, &geojson.Feature{
+			Geometry: square,
+			Properties: map[string]interface{}{
+				"gsmId":           cell.GsmId,
+				"cid":             cell.Cid,
+				"lacTac":          cell.LacTac,
+				"arfcn":           cell.ArfcnNumber,
+				"technology":      cell.Technology,
+				"bs":              cell.Bs,
+				"sector":          cell.SectorNumber,
+				"metric":          query.Metric.Name,
+				"value":           cell.BestValue,
+				"color":           query.Metric.Color(cell.BestValue),
+				"secondValue":     cell.SecondValue,
+				"margin":          cell.Margin(),
+				"serversInWindow": cell.ServersInWindow,
+				"servers":         cell.Servers,
+				"pilotPollution":  cell.ServersInWindow >= model.PollutionServers,
+				"samples":         cell.Samples,
+			},
+		})
+	}
+	return collection
+}
@@ -0,0 +1,203 @@
+package live
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/gofrs/uuid"
+	"github.com/gorilla/websocket"
+	"net/http"
+	"simpleServer/internal/auth"
+	authModel "simpleServer/internal/auth/model"
+	"simpleServer/internal/config"
+	"simpleServer/internal/live/model"
+	"simpleServer/internal/middleware"
+	"simpleServer/internal/middleware/handler"
+	"simpleServer/pkg/logging"
+	"simpleServer/pkg/validate"
+	"strconv"
+	"time"
+)
+
+const (
+	writeWait        = 10 * time.Second
+	defaultKeepAlive = 15 * time.Second
+)
+
+type Handler struct {
+	hub       *Hub
+	keepAlive time.Duration
+	upgrader  websocket.Upgrader
+}
+
+func NewHandler(cfg *config.Config, hub *Hub) *Handler {
+	keepAlive := cfg.LiveConfig.KeepAlive
+	if keepAlive <= 0 {
+		keepAlive = defaultKeepAlive
+	}
+	return &Handler{
+		hub:       hub,
+		keepAlive: keepAlive,
+		upgrader: websocket.Upgrader{
+			// the stream is read only and carries no credentials, so any page may open it like the rest of the api.
+			CheckOrigin: func(r *http.Request) bool { return true },
+		},
+	}
+}
+
+// bindFilter reads repeated postId parameters and an optional n, w, s, e bounding box. Callers bound to
+// one post only ever get that post.
+func bindFilter(c *gin.Context) (model.Filter, *handler.Response) {
+	filter := model.Filter{PostIds: make(map[uuid.UUID]bool)}
+	for _, value := range c.QueryArray("postId") {
+		id, err := uuid.FromString(value)
+		if err != nil {
+			return filter, handler.NewErrorResponse(http.StatusBadRequest, handler.InvalidQueryValue, "invalid postId",
+				validate.NewValidationErrorDetails("postId", "required uuid format", value))
+		}
+		filter.PostIds[id] = true
+	}
+	if claims := auth.FromContext(c); claims != nil {
+		if postId := claims.ScopedPost(); postId != nil {
+			filter.PostIds = map[uuid.UUID]bool{*postId: true}
+		}
+	}
+
+	sides := []string{"w", "s", "e", "n"}
+	var bbox [4]float64
+	given := 0
+	for i, side := range sides {
+		value, ok := c.GetQuery(side)
+		if !ok {
+			continue
+		}
+		given++
+		var err error
+		if bbox[i], err = strconv.ParseFloat(value, 64); err != nil {
+			return filter, handler.NewErrorResponse(http.StatusBadRequest, handler.InvalidQueryValue, "invalid bbox",
+				validate.NewValidationErrorDetails(side, "required number", value))
+		}
+	}
+	switch {
+	case given == len(sides):
+		if bbox[0] > bbox[2] || bbox[1] > bbox[3] {
+			return filter, handler.NewErrorResponse(http.StatusBadRequest, handler.InvalidQueryValue, "invalid bbox",
+				validate.NewValidationErrorDetails("bbox", "w <= e and s <= n", fmt.Sprint(bbox)))
+		}
+		filter.Bbox = &bbox
+	case given != 0:
+		return filter, handler.NewErrorResponse(http.StatusBadRequest, handler.InvalidQueryValue, "invalid bbox",
+			validate.NewValidationErrorDetails("bbox", "n, w, s and e together", ""))
+	}
+	return filter, nil
+}
+
+// StreamSSE sends matching positions as server-sent "position" events until the client goes away.
+func (h *Handler) StreamSSE(c *gin.Context) {
+	filter, res := bindFilter(c)
+	if res != nil {
+		handler.HandleRequest(c, func(c *gin.Context) *handler.Response { return res })
+		return
+	}
+	// the stream outlives the server write timeout.
+	if err := http.NewResponseController(c.Writer).SetWriteDeadline(time.Time{}); err != nil {
+		logging.FromContext(c).Errorw("live.StreamSSE failed to clear write deadline", "err", err)
+	}
+	subscription := h.hub.Subscribe(filter)
+	defer h.hub.Unsubscribe(subscription)
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	// proxies like nginx would otherwise hold events back.
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
+
+	keepAlive := time.NewTicker(h.keepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case position := <-subscription.Positions():
+			c.SSEvent("position", position)
+		case <-keepAlive.C:
+			if _, err := c.Writer.WriteString(": keep-alive\n\n"); err != nil {
+				return
+			}
+		}
+		c.Writer.Flush()
+	}
+}
+
+// StreamWebSocket sends every matching position as a JSON text message. Messages from the client are
+// only read to notice when it closes the connection.
+func (h *Handler) StreamWebSocket(c *gin.Context) {
+	logger := logging.FromContext(c)
+	filter, res := bindFilter(c)
+	if res != nil {
+		handler.HandleRequest(c, func(c *gin.Context) *handler.Response { return res })
+		return
+	}
+	conn, err := h.upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		// the upgrader already answered with an error status.
+		logger.Debugw("live.StreamWebSocket failed to upgrade", "err", err)
+		return
+	}
+	defer conn.Close()
+	subscription := h.hub.Subscribe(filter)
+	defer h.hub.Unsubscribe(subscription)
+
+	closed := make(chan struct{})
+	conn.SetReadLimit(512)
+	conn.SetReadDeadline(time.Now().Add(2 * h.keepAlive))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(2 * h.keepAlive))
+	})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+
+	keepAlive := time.NewTicker(h.keepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-closed:
+			return
+		case position := <-subscription.Positions():
+			message, err := json.Marshal(position)
+			if err != nil {
+				logger.Errorw("live.StreamWebSocket failed to encode", "err", err)
+				continue
+			}
+			conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := conn.WriteMessage(websocket.TextMessage, message); err != nil {
+				return
+			}
+		case <-keepAlive.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeWait)); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// RouteV1 leaves the timeout middleware out, streams stay open for as long as the client listens.
+func RouteV1(cfg *config.Config, h *Handler, a *auth.Authenticator, r *gin.Engine) {
+	v1 := r.Group("v1/api")
+	v1.Use(middleware.CorsMiddleware(), middleware.RequestIDMiddleware())
+
+	liveV1 := v1.Group("live")
+	liveV1.Use(a.AuthenticateStream(), a.Require(authModel.PermissionRead))
+	{
+		liveV1.GET("/positions/sse", h.StreamSSE)
+		liveV1.GET("/positions/ws", h.StreamWebSocket)
+	}
+}
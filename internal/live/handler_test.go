@@ -0,0 +1,30 @@
+package live
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"simpleServer/internal/auth"
+	authModel "simpleServer/internal/auth/model"
+	"testing"
+)
+
+func TestBindFilterKeepsToTheBoundPost(t *testing.T) {
+	postId, other := uuid.Must(uuid.NewV4()), uuid.Must(uuid.NewV4())
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodGet, "/?postId="+other.String(), nil)
+
+	filter, res := bindFilter(c)
+	require.Nil(t, res)
+	assert.Equal(t, map[uuid.UUID]bool{other: true}, filter.PostIds)
+
+	keyId := uuid.Must(uuid.NewV4())
+	claims := &authModel.Claims{ApiKeyId: &keyId, PostId: &postId, Permissions: []string{authModel.PermissionRead}}
+	c.Request = c.Request.WithContext(auth.WithClaims(c.Request.Context(), claims))
+	filter, res = bindFilter(c)
+	require.Nil(t, res)
+	assert.Equal(t, map[uuid.UUID]bool{postId: true}, filter.PostIds)
+}
@@ -0,0 +1,132 @@
+package live
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/go-redis/redis/v8"
+	"go.uber.org/fx"
+	"simpleServer/internal/cache"
+	"simpleServer/internal/config"
+	"simpleServer/internal/live/model"
+	"simpleServer/pkg/logging"
+	"sync"
+)
+
+// Subscription receives the positions matching its filter until it is unsubscribed.
+type Subscription struct {
+	filter model.Filter
+	ch     chan *model.Position
+}
+
+func (s *Subscription) Positions() <-chan *model.Position {
+	return s.ch
+}
+
+// Hub fans positions out to the subscribers of this instance. With redis every position goes through a
+// pub/sub channel first, so subscribers on any instance see the positions ingested by all of them.
+type Hub struct {
+	mu          sync.RWMutex
+	subscribers map[*Subscription]struct{}
+	bufferSize  int
+	redis       redis.UniversalClient
+	channel     string
+}
+
+func NewHub(lc fx.Lifecycle, cfg *config.Config, provider cache.ICacheProvider) *Hub {
+	hub := &Hub{
+		subscribers: make(map[*Subscription]struct{}),
+		bufferSize:  cfg.LiveConfig.BufferSize,
+		channel:     cfg.CacheConfig.Prefix + cfg.LiveConfig.Channel,
+	}
+	redisProvider, ok := provider.(*cache.RedisCacheProvider)
+	if !ok || lc == nil {
+		return hub
+	}
+	hub.redis = redisProvider.Client()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	lc.Append(fx.Hook{
+		OnStart: func(context.Context) error {
+			pubsub := hub.redis.Subscribe(ctx, hub.channel)
+			go func() {
+				defer close(done)
+				defer pubsub.Close()
+				hub.receive(ctx, pubsub.Channel())
+			}()
+			return nil
+		},
+		OnStop: func(stopCtx context.Context) error {
+			cancel()
+			select {
+			case <-done:
+			case <-stopCtx.Done():
+			}
+			return nil
+		},
+	})
+	return hub
+}
+
+func (h *Hub) receive(ctx context.Context, messages <-chan *redis.Message) {
+	logger := logging.DefaultLogger()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case message, ok := <-messages:
+			if !ok {
+				return
+			}
+			var position model.Position
+			if err := json.Unmarshal([]byte(message.Payload), &position); err != nil {
+				logger.Errorw("live position decode failed", "err", err)
+				continue
+			}
+			h.broadcast(&position)
+		}
+	}
+}
+
+// Publish sends the position to every matching subscriber, through redis when it is configured.
+func (h *Hub) Publish(ctx context.Context, position *model.Position) error {
+	if h.redis == nil {
+		h.broadcast(position)
+		return nil
+	}
+	payload, err := json.Marshal(position)
+	if err != nil {
+		return err
+	}
+	return h.redis.Publish(ctx, h.channel, payload).Err()
+}
+
+// broadcast never blocks on a slow subscriber, positions it has no room for are dropped. The next
+// position of the same post supersedes them anyway.
+func (h *Hub) broadcast(position *model.Position) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for subscription := range h.subscribers {
+		if !subscription.filter.Match(position) {
+			continue
+		}
+		select {
+		case subscription.ch <- position:
+		default:
+		}
+	}
+}
+
+func (h *Hub) Subscribe(filter model.Filter) *Subscription {
+	subscription := &Subscription{filter: filter, ch: make(chan *model.Position, h.bufferSize)}
+	h.mu.Lock()
+	h.subscribers[subscription] = struct{}{}
+	h.mu.Unlock()
+	return subscription
+}
+
+func (h *Hub) Unsubscribe(subscription *Subscription) {
+	h.mu.Lock()
+	delete(h.subscribers, subscription)
+	h.mu.Unlock()
+}
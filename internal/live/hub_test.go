@@ -0,0 +1,41 @@
+package live
+
+import (
+	"context"
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"simpleServer/internal/config"
+	"simpleServer/internal/live/model"
+	"testing"
+)
+
+func TestHubLocalFanOut(t *testing.T) {
+	cfg := &config.Config{LiveConfig: config.LiveConfig{BufferSize: 1}}
+	hub := NewHub(nil, cfg, nil)
+	van, truck := uuid.Must(uuid.NewV4()), uuid.Must(uuid.NewV4())
+
+	all := hub.Subscribe(model.Filter{})
+	vanOnly := hub.Subscribe(model.Filter{PostIds: map[uuid.UUID]bool{van: true}})
+	inKyiv := hub.Subscribe(model.Filter{Bbox: &[4]float64{30.2, 50.2, 30.8, 50.6}})
+
+	ctx := context.Background()
+	require.NoError(t, hub.Publish(ctx, &model.Position{PostId: truck, Coordinates: []float64{30.5, 50.4}}))
+	assert.Equal(t, truck, (<-all.Positions()).PostId)
+	assert.Equal(t, truck, (<-inKyiv.Positions()).PostId)
+	assert.Empty(t, vanOnly.Positions())
+
+	require.NoError(t, hub.Publish(ctx, &model.Position{PostId: van, Coordinates: []float64{24.0, 49.8}}))
+	assert.Equal(t, van, (<-vanOnly.Positions()).PostId)
+	assert.Empty(t, inKyiv.Positions())
+
+	// a full subscriber drops positions instead of blocking the publisher.
+	require.NoError(t, hub.Publish(ctx, &model.Position{PostId: van, Coordinates: []float64{24.1, 49.8}}))
+	require.NoError(t, hub.Publish(ctx, &model.Position{PostId: van, Coordinates: []float64{24.2, 49.8}}))
+	assert.Len(t, all.Positions(), 1)
+
+	hub.Unsubscribe(all)
+	<-all.Positions()
+	require.NoError(t, hub.Publish(ctx, &model.Position{PostId: van, Coordinates: []float64{24.3, 49.8}}))
+	assert.Empty(t, all.Positions())
+}
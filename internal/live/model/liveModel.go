@@ -0,0 +1,45 @@
+package model
+
+import (
+	"github.com/gofrs/uuid"
+	"time"
+)
+
+// Position is the latest fix of a post as it is ingested, with a summary of the cells heard there.
+type Position struct {
+	PostId      uuid.UUID    `json:"postId"`
+	Time        time.Time    `json:"time"`
+	Coordinates []float64    `json:"coordinates"`
+	Altitude    float32      `json:"altitude"`
+	Speed       float32      `json:"speed"`
+	Heading     float32      `json:"heading"`
+	Scan        *ScanSummary `json:"scan,omitempty"`
+}
+
+// ScanSummary describes the strongest cell heard at a fix and how many cells were heard in all.
+type ScanSummary struct {
+	Technology string `json:"technology"`
+	Arfcn      int64  `json:"arfcn"`
+	LacTac     int32  `json:"lacTac"`
+	Cid        int32  `json:"cid"`
+	Dbm        int32  `json:"dbm"`
+	Cells      int    `json:"cells"`
+}
+
+// Filter selects the positions a subscriber receives, empty PostIds and a nil Bbox let everything through.
+type Filter struct {
+	PostIds map[uuid.UUID]bool
+	// Bbox is west, south, east, north.
+	Bbox *[4]float64
+}
+
+func (f *Filter) Match(p *Position) bool {
+	if len(f.PostIds) != 0 && !f.PostIds[p.PostId] {
+		return false
+	}
+	if f.Bbox != nil {
+		lng, lat := p.Coordinates[0], p.Coordinates[1]
+		return lng >= f.Bbox[0] && lat >= f.Bbox[1] && lng <= f.Bbox[2] && lat <= f.Bbox[3]
+	}
+	return true
+}
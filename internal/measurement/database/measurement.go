@@ -0,0 +1,411 @@
+package database
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/gofrs/uuid"
+	"github.com/jmoiron/sqlx"
+	"simpleServer/dbutils"
+	"simpleServer/internal/measurement/model"
+	"simpleServer/pkg/logging"
+	"sort"
+	"strings"
+	"time"
+)
+
+var ErrUnknownPost = errors.New("unknown post")
+
+var scanColumns = []string{"id", "gsm", "gps", "dbm", "time", "rsrp", "rsrq", "sinr", "rscp", "ecio", "timing_advance"}
+
+type MeasurementDB interface {
+	Ingest(ctx context.Context, batch *model.Batch) (*model.BatchResult, error)
+}
+
+type measurementDB struct {
+	dbh *sqlx.DB
+}
+
+func NewMeasurementDB(dbh *sqlx.DB) MeasurementDB {
+	return &measurementDB{dbh: dbh}
+}
+
+// cellKey identifies a "GsmData" row, it is unique in the table.
+type cellKey struct {
+	arfcn  uuid.UUID
+	cid    int32
+	lacTac int32
+}
+
+// ingestState collects rows of one batch before they are copied into the tables.
+type ingestState struct {
+	batch    *model.Batch
+	result   *model.BatchResult
+	known    map[string]map[string]uuid.UUID
+	gpsIds   map[string]uuid.UUID
+	gpsTimes map[string]time.Time
+	gpsRows  [][]interface{}
+	keyRows  [][]interface{}
+}
+
+func (m *measurementDB) Ingest(ctx context.Context, batch *model.Batch) (*model.BatchResult, error) {
+	logger := logging.FromContext(ctx)
+	logger.Debugw("measurement ingest", "postId", batch.PostId, "gps", len(batch.Gps), "scans", len(batch.Scans))
+
+	conn, err := m.dbh.Connx(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("acquire connection: %w", err)
+	}
+	defer conn.Close()
+
+	var result *model.BatchResult
+	err = dbutils.RunTx(ctx, conn, func(tx *sqlx.Tx) error {
+		// Batches of one post are serialized, so a retried batch always sees the keys of the first attempt.
+		if _, err := dbutils.Exec(ctx, tx, `select pg_advisory_xact_lock(hashtext($1))`, batch.PostId.String()); err != nil {
+			return err
+		}
+		var exists bool
+		if err := dbutils.Get(ctx, tx, &exists, `select exists(select 1 from "Post" where id = $1)`, batch.PostId); err != nil {
+			return err
+		}
+		if !exists {
+			return ErrUnknownPost
+		}
+
+		state := &ingestState{
+			batch: batch,
+			result: &model.BatchResult{
+				Gps:   make([]model.RecordResult, len(batch.Gps)),
+				Scans: make([]model.RecordResult, len(batch.Scans)),
+			},
+			gpsIds:   make(map[string]uuid.UUID),
+			gpsTimes: make(map[string]time.Time),
+		}
+		var err error
+		if state.known, err = m.knownKeys(ctx, tx, batch); err != nil {
+			return err
+		}
+		for key, id := range state.known[model.KindGps] {
+			state.gpsIds[key] = id
+		}
+
+		state.acceptGps()
+		scanRows, err := m.acceptScans(ctx, tx, state)
+		if err != nil {
+			return err
+		}
+
+		if err := m.copyGps(ctx, conn, tx, batch.PostId, state.gpsRows); err != nil {
+			return err
+		}
+		if _, err := dbutils.CopyFrom(ctx, conn, "GsmHistory", scanColumns, scanRows); err != nil {
+			return err
+		}
+		if err := m.markLateScans(ctx, tx, scanRows); err != nil {
+			return err
+		}
+		if _, err := dbutils.CopyFrom(ctx, conn, "IngestKeys", []string{"post_id", "kind", "key", "record_id"}, state.keyRows); err != nil {
+			return err
+		}
+
+		result = state.result
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// markLateScans records the scans of days already rolled up, retention merges them into the rollups.
+// The shared lock on the state makes a concurrent rollup either see the scans or move the watermark first.
+func (m *measurementDB) markLateScans(ctx context.Context, tx *sqlx.Tx, rows [][]interface{}) error {
+	if len(rows) == 0 {
+		return nil
+	}
+	ids := make([]uuid.UUID, 0, len(rows))
+	for _, row := range rows {
+		ids = append(ids, row[0].(uuid.UUID))
+	}
+	if _, err := dbutils.Exec(ctx, tx, `select 1 from "RollupState" for share`); err != nil {
+		return err
+	}
+	query := `insert into "RollupPending" (sample, day)
+				select GH.id, cast(GPS.time at time zone 'UTC' as date)
+				from "GsmHistory" GH
+				inner join "GpsData" GPS on GPS.id = GH.gps
+				where GH.id = any($1) and GPS.time < (select cast(rolled_until as timestamp) at time zone 'UTC' from "RollupState")`
+	_, err := dbutils.Exec(ctx, tx, query, ids)
+	return err
+}
+
+func (m *measurementDB) knownKeys(ctx context.Context, tx *sqlx.Tx, batch *model.Batch) (map[string]map[string]uuid.UUID, error) {
+	gpsKeys := make([]string, 0, len(batch.Gps)+len(batch.Scans))
+	for i := range batch.Gps {
+		gpsKeys = append(gpsKeys, batch.Gps[i].Key)
+	}
+	scanKeys := make([]string, 0, len(batch.Scans))
+	for i := range batch.Scans {
+		gpsKeys = append(gpsKeys, batch.Scans[i].GpsKey)
+		scanKeys = append(scanKeys, batch.Scans[i].Key)
+	}
+
+	query := `select kind, key, record_id from "IngestKeys"
+				where post_id = $1
+				and ((kind = $2 and key = any($3)) or (kind = $4 and key = any($5)))`
+	var keys []model.IngestKey
+	if err := dbutils.Select(ctx, tx, &keys, query, batch.PostId, model.KindGps, gpsKeys, model.KindScan, scanKeys); err != nil {
+		return nil, err
+	}
+
+	known := map[string]map[string]uuid.UUID{
+		model.KindGps:  {},
+		model.KindScan: {},
+	}
+	for _, key := range keys {
+		known[key.Kind][key.Key] = key.RecordId
+	}
+	return known, nil
+}
+
+func (s *ingestState) acceptGps() {
+	for i := range s.batch.Gps {
+		fix := &s.batch.Gps[i]
+		res := &s.result.Gps[i]
+		res.Key = fix.Key
+		if err := fix.Validate(); err != nil {
+			res.Status, res.Reason = model.StatusRejected, err.Error()
+			continue
+		}
+		if id, ok := s.gpsIds[fix.Key]; ok {
+			res.Status, res.Id = model.StatusDuplicate, id
+			continue
+		}
+
+		id, _ := uuid.NewV4()
+		s.gpsIds[fix.Key] = id
+		s.gpsTimes[fix.Key] = fix.Time
+		res.Status, res.Id = model.StatusAccepted, id
+		s.gpsRows = append(s.gpsRows, []interface{}{id, fix.Lng, fix.Lat, fix.Time, fix.Altitude, fix.Speed, fix.Heading})
+		s.keyRows = append(s.keyRows, []interface{}{s.batch.PostId, model.KindGps, fix.Key, id})
+	}
+}
+
+func (m *measurementDB) acceptScans(ctx context.Context, tx *sqlx.Tx, s *ingestState) ([][]interface{}, error) {
+	arfcns, err := m.arfcns(ctx, tx, s.batch.Scans)
+	if err != nil {
+		return nil, err
+	}
+	operators, err := m.operators(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+	cells, err := m.cells(ctx, tx, arfcns)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]uuid.UUID)
+	// new cells take the operator of their first scan.
+	newCells := make(map[cellKey]*uuid.UUID)
+	var rows [][]interface{}
+	var rowCells []cellKey
+	for i := range s.batch.Scans {
+		scan := &s.batch.Scans[i]
+		res := &s.result.Scans[i]
+		res.Key = scan.Key
+		if err := scan.Validate(); err != nil {
+			res.Status, res.Reason = model.StatusRejected, err.Error()
+			continue
+		}
+		if id, ok := s.known[model.KindScan][scan.Key]; ok {
+			res.Status, res.Id = model.StatusDuplicate, id
+			continue
+		}
+		if id, ok := seen[scan.Key]; ok {
+			res.Status, res.Id = model.StatusDuplicate, id
+			continue
+		}
+		gpsId, ok := s.gpsIds[scan.GpsKey]
+		if !ok {
+			res.Status, res.Reason = model.StatusRejected, fmt.Sprintf("unknown gps key %q", scan.GpsKey)
+			continue
+		}
+		arfcn, err := matchArfcn(arfcns[scan.Arfcn], scan.Technology)
+		if err != nil {
+			res.Status, res.Reason = model.StatusRejected, err.Error()
+			continue
+		}
+		key := cellKey{arfcn: arfcn.Id, cid: scan.Cid, lacTac: scan.LacTac}
+		var operatorId *uuid.UUID
+		if scan.Mcc != 0 {
+			id, ok := operators[[2]int16{scan.Mcc, scan.Mnc}]
+			if !ok {
+				res.Status, res.Reason = model.StatusRejected, fmt.Sprintf("unknown operator %d-%d", scan.Mcc, scan.Mnc)
+				continue
+			}
+			operatorId = &id
+		}
+		if _, ok := cells[key]; !ok {
+			if _, ok := newCells[key]; !ok {
+				newCells[key] = operatorId
+			}
+		}
+
+		id, _ := uuid.NewV4()
+		seen[scan.Key] = id
+		res.Status, res.Id = model.StatusAccepted, id
+		// scans without their own time take it from the fix, when the fix is part of this batch.
+		var scanTime interface{} = scan.Time
+		if scan.Time.IsZero() {
+			scanTime = nil
+			if fixTime, ok := s.gpsTimes[scan.GpsKey]; ok {
+				scanTime = fixTime
+			}
+		}
+		metrics := scan.Metrics
+		rows = append(rows, []interface{}{id, nil, gpsId, scan.Dbm, scanTime,
+			metrics.Rsrp, metrics.Rsrq, metrics.Sinr, metrics.Rscp, metrics.EcIo, metrics.TimingAdvance})
+		rowCells = append(rowCells, key)
+		s.keyRows = append(s.keyRows, []interface{}{s.batch.PostId, model.KindScan, scan.Key, id})
+	}
+
+	if len(newCells) != 0 {
+		if cells, err = m.createCells(ctx, tx, arfcns, newCells); err != nil {
+			return nil, err
+		}
+	}
+	for i, key := range rowCells {
+		rows[i][1] = cells[key]
+	}
+	return rows, nil
+}
+
+// createCells adds the cells not known yet and returns every cell of arfcns. A cell created meanwhile by a
+// concurrent ingest is kept, the insert waits for it and then skips it.
+func (m *measurementDB) createCells(ctx context.Context, tx *sqlx.Tx, arfcns map[int64][]model.Arfcn, newCells map[cellKey]*uuid.UUID) (map[cellKey]uuid.UUID, error) {
+	keys := make([]cellKey, 0, len(newCells))
+	for key := range newCells {
+		keys = append(keys, key)
+	}
+	// concurrent ingests insert in the same order, so they wait for each other instead of deadlocking.
+	sort.Slice(keys, func(i, j int) bool {
+		if c := bytes.Compare(keys[i].arfcn.Bytes(), keys[j].arfcn.Bytes()); c != 0 {
+			return c < 0
+		}
+		if keys[i].cid != keys[j].cid {
+			return keys[i].cid < keys[j].cid
+		}
+		return keys[i].lacTac < keys[j].lacTac
+	})
+	query := `insert into "GsmData" (id, arfcn, cid, lac_tac, operator_id) values ($1, $2, $3, $4, $5)
+				on conflict (arfcn, cid, lac_tac) do nothing`
+	for _, key := range keys {
+		id, err := uuid.NewV4()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := dbutils.Exec(ctx, tx, query, id, key.arfcn, key.cid, key.lacTac, newCells[key]); err != nil {
+			return nil, err
+		}
+	}
+	return m.cells(ctx, tx, arfcns)
+}
+
+func (m *measurementDB) arfcns(ctx context.Context, tx *sqlx.Tx, scans []model.Scan) (map[int64][]model.Arfcn, error) {
+	numbers := make([]int64, 0, len(scans))
+	for i := range scans {
+		numbers = append(numbers, scans[i].Arfcn)
+	}
+	query := `select arfcn.id, arfcn_number, "CellularNetworkType".type as technology
+				from arfcn
+				inner join "CellularNetworkType" on arfcn."CellularNetworkType" = "CellularNetworkType".id
+				where arfcn_number = any($1)`
+	var arfcns []model.Arfcn
+	if err := dbutils.Select(ctx, tx, &arfcns, query, numbers); err != nil {
+		return nil, err
+	}
+	byNumber := make(map[int64][]model.Arfcn, len(arfcns))
+	for _, arfcn := range arfcns {
+		byNumber[arfcn.ArfcnNumber] = append(byNumber[arfcn.ArfcnNumber], arfcn)
+	}
+	return byNumber, nil
+}
+
+func matchArfcn(candidates []model.Arfcn, technology string) (*model.Arfcn, error) {
+	var found *model.Arfcn
+	for i := range candidates {
+		if technology != "" && !strings.EqualFold(candidates[i].Technology, technology) {
+			continue
+		}
+		if found != nil {
+			return nil, fmt.Errorf("ambiguous arfcn %d, technology required", candidates[i].ArfcnNumber)
+		}
+		found = &candidates[i]
+	}
+	if found == nil {
+		return nil, fmt.Errorf("unknown arfcn")
+	}
+	return found, nil
+}
+
+func (m *measurementDB) operators(ctx context.Context, tx *sqlx.Tx) (map[[2]int16]uuid.UUID, error) {
+	var operators []model.Operator
+	if err := dbutils.Select(ctx, tx, &operators, `select id, mcc, mnc from "Operators"`); err != nil {
+		return nil, err
+	}
+	byCode := make(map[[2]int16]uuid.UUID, len(operators))
+	for _, operator := range operators {
+		byCode[[2]int16{operator.Mcc, operator.Mnc}] = operator.Id
+	}
+	return byCode, nil
+}
+
+func (m *measurementDB) cells(ctx context.Context, tx *sqlx.Tx, arfcns map[int64][]model.Arfcn) (map[cellKey]uuid.UUID, error) {
+	ids := make([]uuid.UUID, 0, len(arfcns))
+	for _, candidates := range arfcns {
+		for _, arfcn := range candidates {
+			ids = append(ids, arfcn.Id)
+		}
+	}
+	query := `select id, arfcn, coalesce(cid, 0) as cid, coalesce(lac_tac, 0) as lac_tac, operator_id
+				from "GsmData" where arfcn = any($1)`
+	var cells []model.Cell
+	if err := dbutils.Select(ctx, tx, &cells, query, ids); err != nil {
+		return nil, err
+	}
+	byKey := make(map[cellKey]uuid.UUID, len(cells))
+	for _, cell := range cells {
+		byKey[cellKey{arfcn: cell.Arfcn, cid: cell.Cid, lacTac: cell.LacTac}] = cell.Id
+	}
+	return byKey, nil
+}
+
+func (m *measurementDB) copyGps(ctx context.Context, conn *sqlx.Conn, tx *sqlx.Tx, postId uuid.UUID, rows [][]interface{}) error {
+	if len(rows) == 0 {
+		return nil
+	}
+	// COPY can't encode PostGIS geometry, so fixes go through a staging table.
+	query := `create temp table "IngestGps" (
+				id       uuid,
+				lng      double precision,
+				lat      double precision,
+				time     timestamptz,
+				altitude real,
+				speed    real,
+				heading  real
+			) on commit drop`
+	if _, err := dbutils.Exec(ctx, tx, query); err != nil {
+		return err
+	}
+	if _, err := dbutils.CopyFrom(ctx, conn, "IngestGps", []string{"id", "lng", "lat", "time", "altitude", "speed", "heading"}, rows); err != nil {
+		return err
+	}
+	query = `insert into "GpsData" (id, coordinates, time, altitude, speed, heading, post_id)
+				select id, st_setsrid(st_makepoint(lng, lat), 4326), time, altitude, speed, heading, $1
+				from "IngestGps"`
+	_, err := dbutils.Exec(ctx, tx, query, postId)
+	return err
+}
@@ -0,0 +1,20 @@
+package measurement
+
+import (
+	geofenceModel "simpleServer/internal/geofence/model"
+	"simpleServer/internal/measurement/model"
+	"sort"
+)
+
+// acceptedFixes are the fixes the batch added ordered by time, the way geofences are evaluated.
+func acceptedFixes(batch *model.Batch, result *model.BatchResult) []geofenceModel.Fix {
+	var fixes []geofenceModel.Fix
+	for i := range batch.Gps {
+		if result.Gps[i].Status == model.StatusAccepted {
+			fix := &batch.Gps[i]
+			fixes = append(fixes, geofenceModel.Fix{Time: fix.Time, Lng: fix.Lng, Lat: fix.Lat})
+		}
+	}
+	sort.Slice(fixes, func(i, j int) bool { return fixes[i].Time.Before(fixes[j].Time) })
+	return fixes
+}
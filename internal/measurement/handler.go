@@ -0,0 +1,187 @@
+package measurement
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"github.com/gofrs/uuid"
+	"math"
+	"net/http"
+	"simpleServer/internal/auth"
+	authModel "simpleServer/internal/auth/model"
+	"simpleServer/internal/config"
+	"simpleServer/internal/geofence"
+	"simpleServer/internal/live"
+	"simpleServer/internal/measurement/database"
+	"simpleServer/internal/measurement/model"
+	"simpleServer/internal/middleware"
+	"simpleServer/internal/middleware/handler"
+	"simpleServer/internal/ratelimit"
+	"simpleServer/pkg/logging"
+	"simpleServer/pkg/metrics"
+	"simpleServer/pkg/validate"
+	"time"
+)
+
+type Handler struct {
+	measurementDB database.MeasurementDB
+	hub           *live.Hub
+	geofences     *geofence.Monitor
+	maxBatchSize  int
+}
+
+func NewHandler(cfg *config.Config, db database.MeasurementDB, hub *live.Hub, geofences *geofence.Monitor) *Handler {
+	return &Handler{
+		measurementDB: db,
+		hub:           hub,
+		geofences:     geofences,
+		maxBatchSize:  cfg.IngestConfig.MaxBatchSize,
+	}
+}
+
+type gpsFixRequest struct {
+	Key         string    `json:"key"`
+	Time        time.Time `json:"time"`
+	Coordinates []float64 `json:"coordinates"`
+	Altitude    float32   `json:"altitude"`
+	Speed       float32   `json:"speed"`
+	Heading     float32   `json:"heading"`
+}
+
+type scanRequest struct {
+	Key        string    `json:"key"`
+	GpsKey     string    `json:"gpsKey"`
+	Time       time.Time `json:"time"`
+	Technology string    `json:"technology"`
+	Arfcn      int64     `json:"arfcn"`
+	Mcc        int16     `json:"mcc"`
+	Mnc        int16     `json:"mnc"`
+	LacTac     int32     `json:"lacTac"`
+	Cid        int32     `json:"cid"`
+	Dbm        int32     `json:"dbm"`
+	Rsrp       *float32  `json:"rsrp"`
+	Rsrq       *float32  `json:"rsrq"`
+	Sinr       *float32  `json:"sinr"`
+	Rscp       *float32  `json:"rscp"`
+	EcIo       *float32  `json:"ecio"`
+	Ta         *int16    `json:"ta"`
+}
+
+func (h *Handler) PostMeasurements(c *gin.Context) {
+	handler.HandleRequest(c, func(c *gin.Context) *handler.Response {
+		logger := logging.FromContext(c)
+		type RequestBody struct {
+			PostId string          `json:"postId" binding:"required"`
+			Gps    []gpsFixRequest `json:"gps"`
+			Scans  []scanRequest   `json:"scans"`
+		}
+		var body RequestBody
+		if err := c.ShouldBindJSON(&body); err != nil {
+			logger.Errorw("measurement.PostMeasurements failed to bind", "err", err)
+			var details []*validate.ValidationErrDetail
+			if vErrs, ok := err.(validator.ValidationErrors); ok {
+				details = validate.ValidationErrorDetails(&body, "json", vErrs)
+			}
+			return handler.NewErrorResponse(http.StatusBadRequest, handler.InvalidBodyValue, "invalid measurement batch", details)
+		}
+		postId, err := uuid.FromString(body.PostId)
+		if err != nil {
+			return handler.NewErrorResponse(http.StatusBadRequest, handler.InvalidBodyValue, "invalid postId",
+				validate.NewValidationErrorDetails("postId", "required uuid format", body.PostId))
+		}
+		if claims := auth.FromContext(c); claims == nil || !claims.MayUpload(postId) {
+			return handler.NewErrorResponse(http.StatusForbidden, handler.Forbidden, "caller may not upload for this post", nil)
+		}
+		if size := len(body.Gps) + len(body.Scans); h.maxBatchSize > 0 && size > h.maxBatchSize {
+			return handler.NewErrorResponse(http.StatusBadRequest, handler.InvalidBodyValue,
+				fmt.Sprintf("batch of %d records exceeds limit of %d", size, h.maxBatchSize), nil)
+		}
+
+		batch := &model.Batch{
+			PostId: postId,
+			Gps:    make([]model.GpsFix, len(body.Gps)),
+			Scans:  make([]model.Scan, len(body.Scans)),
+		}
+		for i, fix := range body.Gps {
+			batch.Gps[i] = model.GpsFix{
+				Key:      fix.Key,
+				Time:     fix.Time,
+				Altitude: fix.Altitude,
+				Speed:    fix.Speed,
+				Heading:  fix.Heading,
+				// missing coordinates are left as NaN and rejected by validation.
+				Lng: math.NaN(),
+				Lat: math.NaN(),
+			}
+			if len(fix.Coordinates) == 2 {
+				batch.Gps[i].Lng, batch.Gps[i].Lat = fix.Coordinates[0], fix.Coordinates[1]
+			}
+		}
+		for i, scan := range body.Scans {
+			batch.Scans[i] = model.Scan{
+				Key:        scan.Key,
+				GpsKey:     scan.GpsKey,
+				Time:       scan.Time,
+				Technology: scan.Technology,
+				Arfcn:      scan.Arfcn,
+				Mcc:        scan.Mcc,
+				Mnc:        scan.Mnc,
+				LacTac:     scan.LacTac,
+				Cid:        scan.Cid,
+				Dbm:        scan.Dbm,
+				Metrics: model.Metrics{
+					Rsrp:          scan.Rsrp,
+					Rsrq:          scan.Rsrq,
+					Sinr:          scan.Sinr,
+					Rscp:          scan.Rscp,
+					EcIo:          scan.EcIo,
+					TimingAdvance: scan.Ta,
+				},
+			}
+		}
+
+		result, err := h.measurementDB.Ingest(c.Request.Context(), batch)
+		if errors.Is(err, database.ErrUnknownPost) {
+			return handler.NewErrorResponse(http.StatusNotFound, handler.NotFoundEntity, "post not found", nil)
+		}
+		if err != nil {
+			logger.Errorw("measurement.PostMeasurements failed to ingest", "err", err)
+			return handler.NewInternalErrorResponse(err)
+		}
+		observeIngest(result)
+		// the batch is stored, a failed live update or geofence check must not make the post send it again.
+		if fixes := acceptedFixes(batch, result); len(fixes) != 0 {
+			if _, err := h.geofences.Track(c.Request.Context(), postId, fixes); err != nil {
+				logger.Errorw("measurement.PostMeasurements failed to check geofences", "postId", postId, "err", err)
+			}
+		}
+		if position := latestPosition(batch, result); position != nil {
+			if err := h.hub.Publish(c.Request.Context(), position); err != nil {
+				logger.Errorw("measurement.PostMeasurements failed to publish position", "postId", postId, "err", err)
+			}
+		}
+		return handler.NewSuccessResponse(http.StatusOK, NewIngestResponse(result))
+	})
+}
+
+// observeIngest counts the records of a stored batch by kind and status.
+func observeIngest(result *model.BatchResult) {
+	records := metrics.Default().IngestRecords
+	for kind, results := range map[string][]model.RecordResult{model.KindGps: result.Gps, model.KindScan: result.Scans} {
+		for i := range results {
+			records.WithLabelValues(kind, string(results[i].Status)).Inc()
+		}
+	}
+}
+
+func RouteV1(cfg *config.Config, h *Handler, a *auth.Authenticator, l *ratelimit.Limiter, r *gin.Engine) {
+	v1 := r.Group("v1/api")
+	v1.Use(middleware.CorsMiddleware(), middleware.RequestIDMiddleware(), middleware.TimeoutMiddleware(cfg.ServerConfig.WriteTimeout))
+
+	measurementsV1 := v1.Group("measurements")
+	measurementsV1.Use(a.AuthenticateIngest(), a.Require(authModel.PermissionIngest), l.Limit("measurements"))
+	{
+		measurementsV1.POST("", h.PostMeasurements)
+	}
+}
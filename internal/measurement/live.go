@@ -0,0 +1,51 @@
+package measurement
+
+import (
+	liveModel "simpleServer/internal/live/model"
+	"simpleServer/internal/measurement/model"
+)
+
+// latestPosition is the newest fix the batch added, with the cells the batch reported at it. Batches
+// holding no new fix give nil.
+func latestPosition(batch *model.Batch, result *model.BatchResult) *liveModel.Position {
+	var latest *model.GpsFix
+	for i := range batch.Gps {
+		if result.Gps[i].Status == model.StatusAccepted && (latest == nil || batch.Gps[i].Time.After(latest.Time)) {
+			latest = &batch.Gps[i]
+		}
+	}
+	if latest == nil {
+		return nil
+	}
+
+	position := &liveModel.Position{
+		PostId:      batch.PostId,
+		Time:        latest.Time,
+		Coordinates: []float64{latest.Lng, latest.Lat},
+		Altitude:    latest.Altitude,
+		Speed:       latest.Speed,
+		Heading:     latest.Heading,
+	}
+	for i := range batch.Scans {
+		scan := &batch.Scans[i]
+		if scan.GpsKey != latest.Key || result.Scans[i].Status != model.StatusAccepted {
+			continue
+		}
+		if position.Scan == nil {
+			position.Scan = &liveModel.ScanSummary{}
+		}
+		position.Scan.Cells++
+		if position.Scan.Cells == 1 || scan.Dbm > position.Scan.Dbm {
+			cells := position.Scan.Cells
+			*position.Scan = liveModel.ScanSummary{
+				Technology: scan.Technology,
+				Arfcn:      scan.Arfcn,
+				LacTac:     scan.LacTac,
+				Cid:        scan.Cid,
+				Dbm:        scan.Dbm,
+				Cells:      cells,
+			}
+		}
+	}
+	return position
+}
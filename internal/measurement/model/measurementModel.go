@@ -0,0 +1,183 @@
+package model
+
+import (
+	"fmt"
+	"github.com/gofrs/uuid"
+	"time"
+)
+
+const (
+	KindGps  = "gps"
+	KindScan = "scan"
+)
+
+// Technologies as named in "CellularNetworkType".
+const (
+	TechGSM  = "GSM"
+	TechUMTS = "UMTS"
+	TechLTE  = "LTE"
+	TechNR   = "NR"
+)
+
+const (
+	minDbm       = -150
+	maxDbm       = 0
+	maxClockSkew = 5 * time.Minute
+	// LTE timing advance goes up to 1282, GSM up to 63.
+	maxTimingAdvance = 1282
+)
+
+type RecordStatus string
+
+const (
+	StatusAccepted  = RecordStatus("accepted")
+	StatusDuplicate = RecordStatus("duplicate")
+	StatusRejected  = RecordStatus("rejected")
+)
+
+type GpsFix struct {
+	Key      string
+	Time     time.Time
+	Lng      float64
+	Lat      float64
+	Altitude float32
+	// Speed is in m/s, Heading in degrees clockwise from north.
+	Speed   float32
+	Heading float32
+}
+
+type Scan struct {
+	Key        string
+	GpsKey     string
+	Time       time.Time
+	Technology string
+	Arfcn      int64
+	Mcc        int16
+	Mnc        int16
+	LacTac     int32
+	Cid        int32
+	Dbm        int32
+	Metrics    Metrics
+}
+
+// Metrics are the technology specific measurements of a scan, nil when the scanner didn't report them.
+type Metrics struct {
+	// Rsrp and Rsrq are LTE/NR reference signal power (dBm) and quality (dB).
+	Rsrp *float32
+	Rsrq *float32
+	Sinr *float32
+	// Rscp (dBm) and EcIo (dB) are UMTS pilot power and quality.
+	Rscp          *float32
+	EcIo          *float32
+	TimingAdvance *int16
+}
+
+type metricRange struct {
+	name     string
+	value    *float32
+	min, max float32
+}
+
+func (m *Metrics) Validate() error {
+	for _, r := range []metricRange{
+		{"rsrp", m.Rsrp, -156, -31},
+		{"rsrq", m.Rsrq, -43, 20},
+		{"sinr", m.Sinr, -23, 40},
+		{"rscp", m.Rscp, -120, -25},
+		{"ecio", m.EcIo, -25, 0},
+	} {
+		if r.value != nil && !(*r.value >= r.min && *r.value <= r.max) {
+			return fmt.Errorf("%s %.1f out of range [%.0f, %.0f]", r.name, *r.value, r.min, r.max)
+		}
+	}
+	if m.TimingAdvance != nil && (*m.TimingAdvance < 0 || *m.TimingAdvance > maxTimingAdvance) {
+		return fmt.Errorf("timing advance %d out of range [0, %d]", *m.TimingAdvance, maxTimingAdvance)
+	}
+	return nil
+}
+
+// Batch is a set of GPS fixes and scans sent by one post. Scans reference fixes by GpsKey,
+// either from the same batch or from one ingested earlier.
+type Batch struct {
+	PostId uuid.UUID
+	Gps    []GpsFix
+	Scans  []Scan
+}
+
+type RecordResult struct {
+	Key    string
+	Status RecordStatus
+	Id     uuid.UUID
+	Reason string
+}
+
+type BatchResult struct {
+	Gps   []RecordResult
+	Scans []RecordResult
+}
+
+func (r *BatchResult) Count(status RecordStatus) int {
+	count := 0
+	for _, results := range [][]RecordResult{r.Gps, r.Scans} {
+		for i := range results {
+			if results[i].Status == status {
+				count++
+			}
+		}
+	}
+	return count
+}
+
+type Arfcn struct {
+	Id          uuid.UUID `db:"id"`
+	ArfcnNumber int64     `db:"arfcn_number"`
+	Technology  string    `db:"technology"`
+}
+
+type Operator struct {
+	Id  uuid.UUID `db:"id"`
+	Mcc int16     `db:"mcc"`
+	Mnc int16     `db:"mnc"`
+}
+
+type Cell struct {
+	Id         uuid.UUID  `db:"id"`
+	Arfcn      uuid.UUID  `db:"arfcn"`
+	Cid        int32      `db:"cid"`
+	LacTac     int32      `db:"lac_tac"`
+	OperatorId *uuid.UUID `db:"operator_id"`
+}
+
+type IngestKey struct {
+	Kind     string    `db:"kind"`
+	Key      string    `db:"key"`
+	RecordId uuid.UUID `db:"record_id"`
+}
+
+func (f *GpsFix) Validate() error {
+	switch {
+	case f.Key == "":
+		return fmt.Errorf("missing key")
+	case f.Time.IsZero():
+		return fmt.Errorf("missing time")
+	case f.Time.After(time.Now().Add(maxClockSkew)):
+		return fmt.Errorf("time %s is in the future", f.Time.Format(time.RFC3339))
+	case !(f.Lat >= -90 && f.Lat <= 90 && f.Lng >= -180 && f.Lng <= 180):
+		return fmt.Errorf("coordinates (%f, %f) out of range", f.Lng, f.Lat)
+	}
+	return nil
+}
+
+func (s *Scan) Validate() error {
+	switch {
+	case s.Key == "":
+		return fmt.Errorf("missing key")
+	case s.GpsKey == "":
+		return fmt.Errorf("missing gps key")
+	case s.Arfcn < 0:
+		return fmt.Errorf("invalid arfcn %d", s.Arfcn)
+	case s.Dbm < minDbm || s.Dbm > maxDbm:
+		return fmt.Errorf("dbm %d out of range [%d, %d]", s.Dbm, minDbm, maxDbm)
+	}
+	return s.Metrics.Validate()
+}
@@ -0,0 +1,43 @@
+package model
+
+import (
+	"github.com/stretchr/testify/assert"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestGpsFixValidate(t *testing.T) {
+	fix := GpsFix{Key: "a", Time: time.Now(), Lng: 30.3, Lat: 59.9}
+	assert.NoError(t, fix.Validate())
+
+	missing := fix
+	missing.Lng, missing.Lat = math.NaN(), math.NaN()
+	assert.Error(t, missing.Validate())
+
+	future := fix
+	future.Time = time.Now().Add(time.Hour)
+	assert.Error(t, future.Validate())
+
+	noKey := fix
+	noKey.Key = ""
+	assert.Error(t, noKey.Validate())
+}
+
+func TestScanValidate(t *testing.T) {
+	scan := Scan{Key: "s", GpsKey: "a", Arfcn: 62, Dbm: -75}
+	assert.NoError(t, scan.Validate())
+
+	scan.Dbm = 10
+	assert.Error(t, scan.Validate())
+}
+
+func TestBatchResultCount(t *testing.T) {
+	result := BatchResult{
+		Gps:   []RecordResult{{Status: StatusAccepted}, {Status: StatusDuplicate}},
+		Scans: []RecordResult{{Status: StatusAccepted}, {Status: StatusRejected}},
+	}
+	assert.Equal(t, 2, result.Count(StatusAccepted))
+	assert.Equal(t, 1, result.Count(StatusDuplicate))
+	assert.Equal(t, 1, result.Count(StatusRejected))
+}
@@ -0,0 +1,47 @@
+package measurement
+
+import (
+	"github.com/gofrs/uuid"
+	"simpleServer/internal/measurement/model"
+)
+
+type RecordResult struct {
+	Key    string             `json:"key"`
+	Status model.RecordStatus `json:"status"`
+	Id     *uuid.UUID         `json:"id,omitempty"`
+	Reason string             `json:"reason,omitempty"`
+}
+
+type IngestResponse struct {
+	Accepted   int            `json:"accepted"`
+	Duplicates int            `json:"duplicates"`
+	Rejected   int            `json:"rejected"`
+	Gps        []RecordResult `json:"gps"`
+	Scans      []RecordResult `json:"scans"`
+}
+
+func newRecordResults(results []model.RecordResult) []RecordResult {
+	data := make([]RecordResult, 0, len(results))
+	for i := range results {
+		record := RecordResult{
+			Key:    results[i].Key,
+			Status: results[i].Status,
+			Reason: results[i].Reason,
+		}
+		if results[i].Id != uuid.Nil {
+			record.Id = &results[i].Id
+		}
+		data = append(data, record)
+	}
+	return data
+}
+
+func NewIngestResponse(result *model.BatchResult) *IngestResponse {
+	return &IngestResponse{
+		Accepted:   result.Count(model.StatusAccepted),
+		Duplicates: result.Count(model.StatusDuplicate),
+		Rejected:   result.Count(model.StatusRejected),
+		Gps:        newRecordResults(result.Gps),
+		Scans:      newRecordResults(result.Scans),
+	}
+}
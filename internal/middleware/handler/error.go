@@ -13,12 +13,21 @@ const (
 	InvalidUriValue   = ErrorCode("InvalidUriValue")
 	InvalidBodyValue  = ErrorCode("InvalidBodyValue")
 
+	// 401 unauthorized
+	Unauthorized = ErrorCode("Unauthorized")
+
+	// 403 forbidden
+	Forbidden = ErrorCode("Forbidden")
+
 	// 404 not found
 	NotFoundEntity = ErrorCode("NotFoundEntity")
 
 	// 409 duplicate
 	DuplicateEntry = ErrorCode("DuplicateEntry")
 
+	// 429 too many requests
+	TooManyRequests = ErrorCode("TooManyRequests")
+
 	// 500
 	InternalServerError = ErrorCode("InternalServerError")
 )
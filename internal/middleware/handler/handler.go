@@ -2,6 +2,7 @@ package handler
 
 import (
 	"github.com/gin-gonic/gin"
+	"mime"
 	"net/http"
 )
 
@@ -29,7 +30,10 @@ func handleRequestReal(c *gin.Context, res *Response) {
 		if statusCode == 0 {
 			statusCode = http.StatusOK
 		}
-		if res.Data != nil {
+		if res.ContentType != "" {
+			c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": res.FileName}))
+			c.Data(res.StatusCode, res.ContentType, res.Data.([]byte))
+		} else if res.Data != nil {
 			c.JSON(res.StatusCode, res.Data)
 		} else {
 			c.Status(res.StatusCode)
@@ -4,6 +4,9 @@ type Response struct {
 	StatusCode int
 	Data       interface{}
 	Err        error
+	// ContentType is set for file downloads, Data then holds the file content as []byte.
+	ContentType string
+	FileName    string
 }
 
 func NewSuccessResponse(statusCode int, data interface{}) *Response {
@@ -13,6 +16,16 @@ func NewSuccessResponse(statusCode int, data interface{}) *Response {
 	}
 }
 
+// NewFileResponse sends content as an attachment named fileName.
+func NewFileResponse(statusCode int, contentType, fileName string, content []byte) *Response {
+	return &Response{
+		StatusCode:  statusCode,
+		Data:        content,
+		ContentType: contentType,
+		FileName:    fileName,
+	}
+}
+
 func NewErrorResponse(statusCode int, code ErrorCode, message string, details interface{}) *Response {
 	return &Response{
 		StatusCode: statusCode,
@@ -23,7 +23,7 @@ func RequestIDMiddleware() gin.HandlerFunc {
 		}
 
 		context.Request = context.Request.WithContext(trace.WithRequestID(context, requestId))
-		logger := logging.DefaultLogger().With("requestId", requestId)
+		logger := logging.DefaultLogger().With("requestId", requestId).With(trace.LogFields(context)...)
 		context.Request = context.Request.WithContext(logging.WithLogger(context, logger))
 		context.Writer.Header().Set(XRequestIdKey, requestId)
 	}
@@ -47,8 +47,9 @@ func CorsMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
 		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With")
-		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT")
+		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With, X-API-Key, traceparent, tracestate")
+		c.Writer.Header().Set("Access-Control-Expose-Headers", "Retry-After, X-RateLimit-Limit, X-RateLimit-Remaining, X-Request-ID")
+		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, PATCH, DELETE")
 
 		if c.Request.Method == "OPTIONS" {
 			c.AbortWithStatus(204)
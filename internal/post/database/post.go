@@ -2,21 +2,57 @@ package database
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"github.com/gofrs/uuid"
 	"github.com/jmoiron/sqlx"
+	"github.com/twpayne/go-geom/encoding/ewkb"
 	"simpleServer/dbutils"
+	campaignDB "simpleServer/internal/campaign/database"
 	"simpleServer/internal/post/model"
 	"simpleServer/pkg/logging"
+	"strings"
 	"time"
 )
 
+var (
+	ErrPostNotFound    = errors.New("post not found")
+	ErrUnknownOperator = errors.New("unknown operator")
+	ErrSessionNotFound = errors.New("session not found")
+)
+
 type PostDB interface {
 	GetAllPosts(ctx context.Context) ([]model.Post, error)
-	GetPostScanDates(ctx context.Context, postId uuid.UUID) ([]model.GpsData, error)
-	GetPostPath(ctx context.Context, post *model.Post, date time.Time, measure int) error
+	// GetTree returns a page of posts with the sessions of each, summarised in one pass over the fixes, and
+	// the number of posts matching the query.
+	GetTree(ctx context.Context, query *model.TreeQuery) ([]model.TreeRow, int, error)
+	// GetSessions returns the sessions of the post starting between from and to, split where fixes are more
+	// than gap apart. Sessions running past to are returned whole.
+	GetSessions(ctx context.Context, postId uuid.UUID, from, to time.Time, gap time.Duration) ([]model.Session, error)
+	GetSession(ctx context.Context, postId uuid.UUID, sessionId string, gap time.Duration) (*model.Session, error)
+	// GetTrack returns the fixes of the post between from and to, only the ones of the campaign unless
+	// campaignId is nil.
+	GetTrack(ctx context.Context, postId uuid.UUID, from, to time.Time, campaignId *uuid.UUID) ([]model.GpsData, error)
+	// GetTrackScans returns every cell heard along the track between from and to, strongest first at each fix.
+	GetTrackScans(ctx context.Context, postId uuid.UUID, from, to time.Time, campaignId *uuid.UUID) ([]model.TrackScan, error)
 	GetPostById(ctx context.Context, postId uuid.UUID) (*model.Post, error)
+	GetServingCells(ctx context.Context, postId uuid.UUID, from, to time.Time, campaignId *uuid.UUID) ([]model.ServingSample, error)
+	// GetSessionCells returns every cell the post heard between from and to, strongest first, marking cells
+	// missing in "BsInfo" and cells no post heard before from.
+	GetSessionCells(ctx context.Context, postId uuid.UUID, from, to time.Time, campaignId *uuid.UUID) ([]model.ObservedCell, error)
+	CreatePost(ctx context.Context, post *model.Post, simOperators []uuid.UUID) (*model.Post, error)
+	UpdatePost(ctx context.Context, postId uuid.UUID, update *model.PostUpdate) (*model.Post, error)
+	RetirePost(ctx context.Context, postId uuid.UUID) (*model.Post, error)
+	// GetPostDetails returns the post with its SIM operators and status.
+	GetPostDetails(ctx context.Context, postId uuid.UUID) (*model.Post, error)
+	// ListPosts returns posts with their SIM operators and status, retired ones only if asked and only postId
+	// unless it is nil.
+	ListPosts(ctx context.Context, includeRetired bool, postId *uuid.UUID) ([]model.Post, error)
 }
 
+const postColumns = `P.id, P.name, P.kind, P.equipment_serial, P.owner, P.description, P.time_zone, P.retired_at,
+	P.created_at, P.updated_at`
+
 type postDB struct {
 	dbh *sqlx.DB
 }
@@ -28,7 +64,7 @@ func NewPostDB(dbh *sqlx.DB) PostDB {
 func (p *postDB) GetAllPosts(ctx context.Context) ([]model.Post, error) {
 	logger := logging.FromContext(ctx)
 	logger.Debugw("post fetch all")
-	query := `select * from "Post"`
+	query := `select ` + postColumns + ` from "Post" P`
 
 	var posts []model.Post
 	if err := dbutils.Select(ctx, p.dbh, &posts, query); err != nil {
@@ -41,7 +77,7 @@ func (p *postDB) GetAllPosts(ctx context.Context) ([]model.Post, error) {
 func (p *postDB) GetPostById(ctx context.Context, postId uuid.UUID) (*model.Post, error) {
 	logger := logging.FromContext(ctx)
 	logger.Debugw("post get by id")
-	query := `select * from "Post" where id = :Id limit 1`
+	query := `select ` + postColumns + ` from "Post" P where id = :Id limit 1`
 	var posts []model.Post
 	if err := dbutils.NamedSelect(ctx, p.dbh, &posts, query, map[string]interface{}{"Id": postId.String()}); err != nil {
 		return nil, err
@@ -52,50 +88,453 @@ func (p *postDB) GetPostById(ctx context.Context, postId uuid.UUID) (*model.Post
 	return nil, nil
 }
 
-func (p *postDB) GetPostScanDates(ctx context.Context, postId uuid.UUID) ([]model.GpsData, error) {
+// treeSessionsCTE numbers the sessions of every post by counting the gaps before each fix. The first fix
+// at or after From is compared with the fix before From, so a session already running at From gets number
+// 0 and is left out like sessions starting at or after To.
+const treeSessionsCTE = `fixes as (
+		select G.post_id, G.time, coalesce(
+				G.time - lag(G.time) over (partition by G.post_id order by G.time),
+				G.time - (select max(B.time) from "GpsData" B where B.post_id = G.post_id and B.time < :From)
+			) as step
+		from "GpsData" G
+		where (cast(:PostId as uuid) is null or G.post_id = :PostId)
+		and (cast(:From as timestamptz) is null or G.time >= :From)
+		%s
+	), numbered as (
+		select F.post_id, F.time, sum(case when F.step is null or F.step > make_interval(secs => :Gap) then 1 else 0 end)
+			over (partition by F.post_id order by F.time) as session
+		from fixes F
+	), sessions as (
+		select N.post_id, min(N.time) as start, max(N.time) as "end", count(*) as points
+		from numbered N
+		where N.session > 0
+		group by N.post_id, N.session
+		having cast(:To as timestamptz) is null or min(N.time) < :To
+	)`
+
+// treePostsCTE pages the posts, with a range only posts that have a session in it.
+const treePostsCTE = `posts as (
+		select P.id, P.name, P.time_zone from "Post" P
+		where (cast(:PostId as uuid) is null or P.id = :PostId)
+		%s
+	), page as (
+		select * from posts order by name, id limit :Limit offset :Offset
+	)`
+
+func (p *postDB) GetTree(ctx context.Context, q *model.TreeQuery) ([]model.TreeRow, int, error) {
+	logger := logging.FromContext(ctx)
+	logger.Debugw("post tree get", "postId", q.PostId, "from", q.From, "to", q.To, "limit", q.Limit, "offset", q.Offset)
+
+	// without a range the posts are paged first and only their fixes are read, with one the posts depend
+	// on their sessions.
+	var with string
+	if q.From == nil && q.To == nil {
+		with = fmt.Sprintf(treePostsCTE, "") + ", " + fmt.Sprintf(treeSessionsCTE, "and G.post_id in (select id from page)")
+	} else {
+		with = fmt.Sprintf(treeSessionsCTE, "") + ", " +
+			fmt.Sprintf(treePostsCTE, "and exists (select 1 from sessions S where S.post_id = P.id)")
+	}
+	var limit *int
+	if q.Limit > 0 {
+		limit = &q.Limit
+	}
+	args := map[string]interface{}{
+		"PostId": q.PostId,
+		"From":   q.From,
+		"To":     q.To,
+		"Gap":    q.Gap.Seconds(),
+		"Limit":  limit,
+		"Offset": q.Offset,
+	}
+	query := `with ` + with + `
+		select PG.id as post_id, PG.name as post_name, PG.time_zone, S.start, S."end", coalesce(S.points, 0) as points,
+			(select count(*) from posts) as total
+		from page PG
+		left join sessions S on S.post_id = PG.id
+		order by PG.name, PG.id, S.start`
+
+	var rows []struct {
+		model.TreeRow
+		Total int `db:"total"`
+	}
+	if err := dbutils.NamedSelect(ctx, p.dbh, &rows, query, args); err != nil {
+		return nil, 0, err
+	}
+	if len(rows) == 0 {
+		// the page may be past the last post, the total is still wanted.
+		var total int
+		query = `with ` + with + ` select count(*) from posts`
+		if err := dbutils.NamedGet(ctx, p.dbh, &total, query, args); err != nil {
+			return nil, 0, err
+		}
+		return []model.TreeRow{}, total, nil
+	}
+	treeRows := make([]model.TreeRow, len(rows))
+	for i := range rows {
+		treeRows[i] = rows[i].TreeRow
+	}
+	return treeRows, rows[0].Total, nil
+}
+
+func (p *postDB) GetSessions(ctx context.Context, postId uuid.UUID, from, to time.Time, gap time.Duration) ([]model.Session, error) {
+	logger := logging.FromContext(ctx)
+	logger.Debugw("post sessions get", "postId", postId, "from", from, "to", to, "gap", gap)
+	args := map[string]interface{}{"PostId": postId, "From": from, "To": to, "Gap": gap.Seconds()}
+
+	// the track is read up to the first session starting after to, so the last session is complete.
+	var until *time.Time
+	query := `select min(time) from (
+			select time, time - lag(time) over (order by time) as step
+			from "GpsData" where post_id = :PostId and time >= :To
+		) F where step > make_interval(secs => :Gap)`
+	if err := dbutils.NamedGet(ctx, p.dbh, &until, query, args); err != nil {
+		return nil, err
+	}
+	var before *time.Time
+	query = `select max(time) from "GpsData" where post_id = :PostId and time < :From`
+	if err := dbutils.NamedGet(ctx, p.dbh, &before, query, args); err != nil {
+		return nil, err
+	}
+
+	query = `select id, st_asewkb(coordinates) as coordinates, time, altitude, speed, heading, post_id
+		from "GpsData" where post_id = :PostId and time >= :From`
+	if until != nil {
+		query += ` and time < :Until`
+		args["Until"] = *until
+	}
+	query += ` order by time`
+	var fixes []model.GpsData
+	if err := dbutils.NamedSelect(ctx, p.dbh, &fixes, query, args); err != nil {
+		return nil, err
+	}
+
+	sessions := model.SplitSessions(postId, fixes, gap)
+	// a session started before from when the fix preceding the range is close enough.
+	if len(sessions) != 0 && before != nil && sessions[0].Start.Sub(*before) <= gap {
+		sessions = sessions[1:]
+	}
+	for i := range sessions {
+		if !sessions[i].Start.Before(to) {
+			return sessions[:i], nil
+		}
+	}
+	return sessions, nil
+}
+
+func (p *postDB) GetSession(ctx context.Context, postId uuid.UUID, sessionId string, gap time.Duration) (*model.Session, error) {
+	start, err := model.ParseSessionId(sessionId)
+	if err != nil {
+		return nil, ErrSessionNotFound
+	}
+	sessions, err := p.GetSessions(ctx, postId, start, start.Add(time.Microsecond), gap)
+	if err != nil {
+		return nil, err
+	}
+	if len(sessions) == 0 || sessions[0].Id != sessionId {
+		return nil, ErrSessionNotFound
+	}
+	return &sessions[0], nil
+}
+
+func (p *postDB) GetTrack(ctx context.Context, postId uuid.UUID, from, to time.Time, campaignId *uuid.UUID) ([]model.GpsData, error) {
+	logger := logging.FromContext(ctx)
+	logger.Debugw("post track get", "postId", postId, "from", from, "to", to, "campaignId", campaignId)
+	query := `select GPS.id, st_asewkb(GPS.coordinates) as coordinates, GPS.time, GPS.altitude, GPS.speed, GPS.heading,
+			GPS.post_id
+		from "GpsData" GPS
+		where GPS.post_id = :PostId and GPS.time >= :From and GPS.time < :To` + campaignDB.Filter("GPS", campaignId) + `
+		order by GPS.time`
+	var fixes []model.GpsData
+	args := map[string]interface{}{"PostId": postId, "From": from, "To": to, "CampaignId": campaignId}
+	if err := dbutils.NamedSelect(ctx, p.dbh, &fixes, query, args); err != nil {
+		return nil, err
+	}
+	return fixes, nil
+}
+
+func (p *postDB) GetTrackScans(ctx context.Context, postId uuid.UUID, from, to time.Time, campaignId *uuid.UUID) ([]model.TrackScan, error) {
+	logger := logging.FromContext(ctx)
+	logger.Debugw("post track scans get", "postId", postId, "from", from, "to", to, "campaignId", campaignId)
+	query := `select GPS.time, st_asewkb(GPS.coordinates) as coordinates, GPS.altitude,
+			"CellularNetworkType".type as technology, arfcn.arfcn_number, GD.lac_tac, GD.cid, cast(GH.dbm as float8) as dbm
+		from "GpsData" GPS
+		inner join "GsmHistory" GH on GH.gps = GPS.id
+		inner join "GsmData" GD on GD.id = GH.gsm
+		left join arfcn on arfcn.id = GD.arfcn
+		left join "CellularNetworkType" on arfcn."CellularNetworkType" = "CellularNetworkType".id
+		where GPS.post_id = :PostId and GPS.time >= :From and GPS.time < :To` + campaignDB.Filter("GPS", campaignId) + `
+		order by GPS.time, GH.dbm desc nulls last`
+	var scans []model.TrackScan
+	args := map[string]interface{}{"PostId": postId, "From": from, "To": to, "CampaignId": campaignId}
+	if err := dbutils.NamedSelect(ctx, p.dbh, &scans, query, args); err != nil {
+		return nil, err
+	}
+	return scans, nil
+}
+
+// GetServingCells returns the fixes of the post between from and to, each with the strongest cell heard there.
+func (p *postDB) GetServingCells(ctx context.Context, postId uuid.UUID, from, to time.Time, campaignId *uuid.UUID) ([]model.ServingSample, error) {
+	logger := logging.FromContext(ctx)
+	logger.Debugw("post serving cells get", "postId", postId, "from", from, "to", to, "campaignId", campaignId)
+	query := `select * from (
+		select distinct on (GPS.id) GPS.id as gps_id, GPS.time, st_asewkb(GPS.coordinates) as coordinates,
+			GH.gsm, GD.cid, GD.lac_tac, arfcn.arfcn_number, "CellularNetworkType".type as technology,
+			cast(GH.dbm as float8) as dbm
+		from "GpsData" GPS
+		left join "GsmHistory" GH on GH.gps = GPS.id
+		left join "GsmData" GD on GD.id = GH.gsm
+		left join arfcn on arfcn.id = GD.arfcn
+		left join "CellularNetworkType" on arfcn."CellularNetworkType" = "CellularNetworkType".id
+		where GPS.post_id = :PostId and GPS.time >= :From and GPS.time < :To` + campaignDB.Filter("GPS", campaignId) + `
+		order by GPS.id, GH.dbm desc nulls last
+	) serving
+	order by time`
+	args := map[string]interface{}{"PostId": postId, "From": from, "To": to, "CampaignId": campaignId}
+	var samples []model.ServingSample
+	if err := dbutils.NamedSelect(ctx, p.dbh, &samples, query, args); err != nil {
+		return nil, err
+	}
+	return samples, nil
+}
+
+func (p *postDB) GetSessionCells(ctx context.Context, postId uuid.UUID, from, to time.Time, campaignId *uuid.UUID) ([]model.ObservedCell, error) {
+	logger := logging.FromContext(ctx)
+	logger.Debugw("post session cells get", "postId", postId, "from", from, "to", to, "campaignId", campaignId)
+	query := `select GD.id as gsm_id, GD.cid, GD.lac_tac, arfcn.arfcn_number, "CellularNetworkType".type as technology,
+			count(*) as samples, cast(max(GH.dbm) as float8) as max_dbm, min(GPS.time) as first_seen,
+			exists (
+				select 1 from "BsInfo"
+				where "BsInfo".arfcn = GD.arfcn and "BsInfo".cid = GD.cid and "BsInfo".lac_tac = GD.lac_tac
+			) as registered,
+			not exists (
+				select 1 from "GsmHistory" EH
+				inner join "GpsData" EG on EG.id = EH.gps
+				where EH.gsm = GD.id and EG.time < :From
+			) as new
+		from "GpsData" GPS
+		inner join "GsmHistory" GH on GH.gps = GPS.id
+		inner join "GsmData" GD on GD.id = GH.gsm
+		left join arfcn on arfcn.id = GD.arfcn
+		left join "CellularNetworkType" on arfcn."CellularNetworkType" = "CellularNetworkType".id
+		where GPS.post_id = :PostId and GPS.time >= :From and GPS.time < :To` + campaignDB.Filter("GPS", campaignId) + `
+		group by GD.id, arfcn.arfcn_number, "CellularNetworkType".type
+		order by max_dbm desc nulls last, samples desc`
+	args := map[string]interface{}{"PostId": postId, "From": from, "To": to, "CampaignId": campaignId}
+	var cells []model.ObservedCell
+	if err := dbutils.NamedSelect(ctx, p.dbh, &cells, query, args); err != nil {
+		return nil, err
+	}
+	return cells, nil
+}
+
+// postStatusRow is a post joined with its last GPS fix.
+type postStatusRow struct {
+	model.Post
+	LastSeen        *time.Time  `db:"last_seen"`
+	LastCoordinates *ewkb.Point `db:"last_coordinates"`
+}
+
+func (p *postDB) selectPosts(ctx context.Context, db sqlx.ExtContext, filter string, args map[string]interface{}) ([]model.Post, error) {
+	query := `select ` + postColumns + `, L.time as last_seen, st_asewkb(L.coordinates) as last_coordinates
+		from "Post" P
+		left join lateral (
+			select time, coordinates from "GpsData" where post_id = P.id order by time desc limit 1
+		) L on true
+		` + filter + `
+		order by P.name`
+	var rows []postStatusRow
+	if err := dbutils.NamedSelect(ctx, db, &rows, query, args); err != nil {
+		return nil, err
+	}
+
+	posts := make([]model.Post, len(rows))
+	ids := make([]string, len(rows))
+	byId := make(map[uuid.UUID]*model.Post, len(rows))
+	for i := range rows {
+		posts[i] = rows[i].Post
+		if rows[i].LastSeen != nil && rows[i].LastCoordinates != nil {
+			posts[i].Status = &model.PostStatus{LastSeen: *rows[i].LastSeen, Coordinates: *rows[i].LastCoordinates}
+		}
+		ids[i] = posts[i].Id.String()
+		byId[posts[i].Id] = &posts[i]
+	}
+	if len(posts) == 0 {
+		return posts, nil
+	}
+
+	var operators []struct {
+		model.Operator
+		PostId uuid.UUID `db:"post_id"`
+	}
+	query = `select O.id, O.name, O.mcc, O.mnc, PO.post_id
+		from "PostOperators" PO
+		inner join "Operators" O on O.id = PO.operator_id
+		where PO.post_id = any(cast($1 as uuid[]))
+		order by O.mcc, O.mnc`
+	if err := dbutils.Select(ctx, db, &operators, query, ids); err != nil {
+		return nil, err
+	}
+	for _, operator := range operators {
+		post := byId[operator.PostId]
+		post.SimOperators = append(post.SimOperators, operator.Operator)
+	}
+	return posts, nil
+}
+
+func (p *postDB) ListPosts(ctx context.Context, includeRetired bool, postId *uuid.UUID) ([]model.Post, error) {
 	logger := logging.FromContext(ctx)
-	logger.Debugw("post dates get")
-	query := `select id, st_asewkb(coordinates) as coordinates, time, altitude, speed, heading, post_id from "GpsData" where post_id = :PostId order by time`
-	var gpsData []model.GpsData
+	logger.Debugw("post list", "includeRetired", includeRetired, "postId", postId)
+	var conditions []string
+	if !includeRetired {
+		conditions = append(conditions, "P.retired_at is null")
+	}
+	if postId != nil {
+		conditions = append(conditions, "P.id = :Id")
+	}
+	filter := ""
+	if len(conditions) > 0 {
+		filter = "where " + strings.Join(conditions, " and ")
+	}
+	return p.selectPosts(ctx, p.dbh, filter, map[string]interface{}{"Id": postId})
+}
+
+func (p *postDB) GetPostDetails(ctx context.Context, postId uuid.UUID) (*model.Post, error) {
+	return p.getPostDetails(ctx, p.dbh, postId)
+}
 
-	if err := dbutils.NamedSelect(ctx, p.dbh, &gpsData, query, map[string]interface{}{"PostId": postId}); err != nil {
+func (p *postDB) getPostDetails(ctx context.Context, db sqlx.ExtContext, postId uuid.UUID) (*model.Post, error) {
+	posts, err := p.selectPosts(ctx, db, "where P.id = :Id", map[string]interface{}{"Id": postId})
+	if err != nil {
 		return nil, err
 	}
-	return gpsData, nil
+	if len(posts) == 0 {
+		return nil, ErrPostNotFound
+	}
+	return &posts[0], nil
+}
+
+func setSimOperators(ctx context.Context, tx *sqlx.Tx, postId uuid.UUID, operators []uuid.UUID) error {
+	if _, err := dbutils.Exec(ctx, tx, `delete from "PostOperators" where post_id = $1`, postId); err != nil {
+		return err
+	}
+	for _, operator := range operators {
+		var exists bool
+		if err := dbutils.Get(ctx, tx, &exists, `select exists(select 1 from "Operators" where id = $1)`, operator); err != nil {
+			return err
+		}
+		if !exists {
+			return fmt.Errorf("%w %s", ErrUnknownOperator, operator)
+		}
+		query := `insert into "PostOperators" (post_id, operator_id) values ($1, $2) on conflict do nothing`
+		if _, err := dbutils.Exec(ctx, tx, query, postId, operator); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-func (p *postDB) GetPostPath(ctx context.Context, post *model.Post, date time.Time, measure int) error {
+func (p *postDB) CreatePost(ctx context.Context, post *model.Post, simOperators []uuid.UUID) (*model.Post, error) {
 	logger := logging.FromContext(ctx)
-	logger.Debugw("post scan times get")
-	query := `select id, st_asewkb(coordinates) as coordinates, time, altitude, speed, heading, post_id from "GpsData" where post_id = :postId and cast(time as date) = :date order by time`
-	var gpsData []model.GpsData
+	logger.Debugw("post create", "name", post.Name)
+	id, err := uuid.NewV4()
+	if err != nil {
+		return nil, err
+	}
 
-	if err := dbutils.NamedSelect(ctx, p.dbh, &gpsData, query, map[string]interface{}{"postId": post.Id, "date": date}); err != nil {
+	var created *model.Post
+	err = dbutils.RunTx(ctx, p.dbh, func(tx *sqlx.Tx) error {
+		query := `insert into "Post" (id, name, kind, equipment_serial, owner, description, time_zone)
+			values (:Id, :Name, :Kind, :EquipmentSerial, :Owner, :Description, :TimeZone)`
+		if _, err := dbutils.NamedExec(ctx, tx, query, map[string]interface{}{
+			"Id":              id,
+			"Name":            post.Name,
+			"Kind":            post.Kind,
+			"EquipmentSerial": post.EquipmentSerial,
+			"Owner":           post.Owner,
+			"Description":     post.Description,
+			"TimeZone":        post.TimeZone,
+		}); err != nil {
+			return err
+		}
+		if err := setSimOperators(ctx, tx, id, simOperators); err != nil {
+			return err
+		}
+		created, err = p.getPostDetails(ctx, tx, id)
 		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return created, nil
+}
+
+// nullable stores empty optional strings as null.
+func nullable(value *string) interface{} {
+	if *value == "" {
+		return nil
+	}
+	return *value
+}
+
+func (p *postDB) UpdatePost(ctx context.Context, postId uuid.UUID, update *model.PostUpdate) (*model.Post, error) {
+	logger := logging.FromContext(ctx)
+	logger.Debugw("post update", "postId", postId)
+
+	sets := []string{"updated_at = now()"}
+	args := map[string]interface{}{"Id": postId}
+	if update.Name != nil {
+		sets, args["Name"] = append(sets, "name = :Name"), *update.Name
+	}
+	if update.Kind != nil {
+		sets, args["Kind"] = append(sets, "kind = :Kind"), *update.Kind
+	}
+	if update.EquipmentSerial != nil {
+		sets, args["EquipmentSerial"] = append(sets, "equipment_serial = :EquipmentSerial"), nullable(update.EquipmentSerial)
+	}
+	if update.Owner != nil {
+		sets, args["Owner"] = append(sets, "owner = :Owner"), nullable(update.Owner)
+	}
+	if update.Description != nil {
+		sets, args["Description"] = append(sets, "description = :Description"), nullable(update.Description)
+	}
+	if update.TimeZone != nil {
+		sets, args["TimeZone"] = append(sets, "time_zone = :TimeZone"), *update.TimeZone
 	}
 
-	post.Coordinates = make([]model.GpsData, 0)
-	if len(gpsData) != 0 {
-		prev := gpsData[0]
-		iterator := 0
-		if iterator == measure {
-			post.Coordinates = append(post.Coordinates, prev)
+	var updated *model.Post
+	err := dbutils.RunTx(ctx, p.dbh, func(tx *sqlx.Tx) error {
+		res, err := dbutils.NamedExec(ctx, tx, `update "Post" set `+strings.Join(sets, ", ")+` where id = :Id`, args)
+		if err != nil {
+			return err
 		}
-		for i := 1; i < len(gpsData); i++ {
-			curr := gpsData[i]
-			timeDiff := curr.Time.Sub(prev.Time)
-			if timeDiff.Seconds() > 120 {
-				iterator++
-				if iterator > measure {
-					break
-				}
-			}
-			if iterator == measure {
-				post.Coordinates = append(post.Coordinates, curr)
+		if n, err := res.RowsAffected(); err == nil && n == 0 {
+			return ErrPostNotFound
+		}
+		if update.SimOperators != nil {
+			if err := setSimOperators(ctx, tx, postId, *update.SimOperators); err != nil {
+				return err
 			}
-			prev = curr
 		}
+		updated, err = p.getPostDetails(ctx, tx, postId)
+		return err
+	})
+	if err != nil {
+		return nil, err
 	}
+	return updated, nil
+}
 
-	return nil
+// RetirePost takes the post out of service, its measurements are kept. Retiring twice keeps the first date.
+func (p *postDB) RetirePost(ctx context.Context, postId uuid.UUID) (*model.Post, error) {
+	logger := logging.FromContext(ctx)
+	logger.Debugw("post retire", "postId", postId)
+	query := `update "Post" set retired_at = coalesce(retired_at, now()), updated_at = now() where id = $1`
+	res, err := dbutils.Exec(ctx, p.dbh, query, postId)
+	if err != nil {
+		return nil, err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return nil, ErrPostNotFound
+	}
+	return p.GetPostDetails(ctx, postId)
 }
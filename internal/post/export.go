@@ -0,0 +1,297 @@
+package post
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"github.com/twpayne/go-geom"
+	"github.com/twpayne/go-geom/encoding/geojson"
+	"simpleServer/internal/post/model"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	FormatGPX     = "gpx"
+	FormatKML     = "kml"
+	FormatGeoJSON = "geojson"
+)
+
+// Track is the part of a post track being exported, with the cells heard along it when asked for. Times
+// are written in Location where the format allows, GPX always takes UTC.
+type Track struct {
+	Name     string
+	Location *time.Location
+	Fixes    []model.GpsData
+	Scans    []model.TrackScan
+}
+
+type exporter struct {
+	ContentType string
+	Extension   string
+	Write       func(track *Track) ([]byte, error)
+}
+
+var exporters = map[string]exporter{
+	FormatGPX:     {ContentType: "application/gpx+xml", Extension: "gpx", Write: writeGPX},
+	FormatKML:     {ContentType: "application/vnd.google-earth.kml+xml", Extension: "kml", Write: writeKML},
+	FormatGeoJSON: {ContentType: "application/geo+json", Extension: "geojson", Write: writeGeoJSON},
+}
+
+const exportTimeLayout = "2006-01-02T15:04:05.000Z07:00"
+
+func exportTime(t time.Time, loc *time.Location) string {
+	if loc == nil {
+		loc = time.UTC
+	}
+	return t.In(loc).Format(exportTimeLayout)
+}
+
+// scanName names a scan by its technology and cell identity, the way cells are written on the map.
+func scanName(scan *model.TrackScan) string {
+	name := "cell"
+	if scan.Technology != nil {
+		name = *scan.Technology
+	}
+	if scan.LacTac != nil && scan.Cid != nil {
+		name += fmt.Sprintf(" %d/%d", *scan.LacTac, *scan.Cid)
+	}
+	return name
+}
+
+func scanDescription(scan *model.TrackScan) string {
+	var parts []string
+	if scan.ArfcnNumber != nil {
+		parts = append(parts, fmt.Sprintf("ARFCN %d", *scan.ArfcnNumber))
+	}
+	if scan.Dbm != nil {
+		parts = append(parts, fmt.Sprintf("%s dBm", strconv.FormatFloat(*scan.Dbm, 'f', -1, 64)))
+	}
+	return strings.Join(parts, ", ")
+}
+
+type gpxFile struct {
+	XMLName   xml.Name      `xml:"gpx"`
+	Version   string        `xml:"version,attr"`
+	Creator   string        `xml:"creator,attr"`
+	Xmlns     string        `xml:"xmlns,attr"`
+	XmlnsTpx  string        `xml:"xmlns:gpxtpx,attr"`
+	Name      string        `xml:"metadata>name"`
+	Time      string        `xml:"metadata>time,omitempty"`
+	Waypoints []gpxWaypoint `xml:"wpt"`
+	TrackName string        `xml:"trk>name"`
+	Points    []gpxPoint    `xml:"trk>trkseg>trkpt"`
+}
+
+type gpxWaypoint struct {
+	Lat  float64 `xml:"lat,attr"`
+	Lon  float64 `xml:"lon,attr"`
+	Ele  float32 `xml:"ele"`
+	Time string  `xml:"time"`
+	Name string  `xml:"name"`
+	Desc string  `xml:"desc,omitempty"`
+	Type string  `xml:"type,omitempty"`
+}
+
+// gpxPoint carries speed and heading in the Garmin track point extension, GPX 1.1 has no elements for them.
+type gpxPoint struct {
+	Lat    float64 `xml:"lat,attr"`
+	Lon    float64 `xml:"lon,attr"`
+	Ele    float32 `xml:"ele"`
+	Time   string  `xml:"time"`
+	Speed  float32 `xml:"extensions>gpxtpx:TrackPointExtension>gpxtpx:speed"`
+	Course float32 `xml:"extensions>gpxtpx:TrackPointExtension>gpxtpx:course"`
+}
+
+func writeGPX(track *Track) ([]byte, error) {
+	file := gpxFile{
+		Version:   "1.1",
+		Creator:   "simpleServer",
+		Xmlns:     "http://www.topografix.com/GPX/1/1",
+		XmlnsTpx:  "http://www.garmin.com/xmlschemas/TrackPointExtension/v2",
+		Name:      track.Name,
+		TrackName: track.Name,
+		Waypoints: make([]gpxWaypoint, len(track.Scans)),
+		Points:    make([]gpxPoint, len(track.Fixes)),
+	}
+	if len(track.Fixes) != 0 {
+		file.Time = exportTime(track.Fixes[0].Time, time.UTC)
+	}
+	for i := range track.Scans {
+		scan := &track.Scans[i]
+		file.Waypoints[i] = gpxWaypoint{
+			Lat:  scan.Coordinates.Y(),
+			Lon:  scan.Coordinates.X(),
+			Ele:  scan.Altitude,
+			Time: exportTime(scan.Time, time.UTC),
+			Name: scanName(scan),
+			Desc: scanDescription(scan),
+		}
+		if scan.Technology != nil {
+			file.Waypoints[i].Type = *scan.Technology
+		}
+	}
+	for i, fix := range track.Fixes {
+		file.Points[i] = gpxPoint{
+			Lat:    fix.Coordinates.Y(),
+			Lon:    fix.Coordinates.X(),
+			Ele:    fix.Altitude,
+			Time:   exportTime(fix.Time, time.UTC),
+			Speed:  fix.Speed,
+			Course: fix.Heading,
+		}
+	}
+	return marshalXML(file)
+}
+
+type kmlFile struct {
+	XMLName xml.Name     `xml:"kml"`
+	Xmlns   string       `xml:"xmlns,attr"`
+	XmlnsGx string       `xml:"xmlns:gx,attr"`
+	Name    string       `xml:"Document>name"`
+	Schema  kmlSchema    `xml:"Document>Schema"`
+	Track   kmlPlacemark `xml:"Document>Placemark"`
+	Scans   *kmlFolder   `xml:"Document>Folder,omitempty"`
+}
+
+type kmlFolder struct {
+	Name       string    `xml:"name"`
+	Placemarks []kmlScan `xml:"Placemark"`
+}
+
+type kmlSchema struct {
+	Id     string           `xml:"id,attr"`
+	Fields []kmlSchemaField `xml:"gx:SimpleArrayField"`
+}
+
+type kmlSchemaField struct {
+	Name        string `xml:"name,attr"`
+	Type        string `xml:"type,attr"`
+	DisplayName string `xml:"displayName"`
+}
+
+// kmlPlacemark is a gx:Track, it keeps a time for every vertex so Google Earth can replay the drive.
+type kmlPlacemark struct {
+	Name   string        `xml:"name"`
+	When   []string      `xml:"gx:Track>when"`
+	Coords []string      `xml:"gx:Track>gx:coord"`
+	Data   kmlSchemaData `xml:"gx:Track>ExtendedData>SchemaData"`
+}
+
+type kmlSchemaData struct {
+	SchemaUrl string          `xml:"schemaUrl,attr"`
+	Arrays    []kmlArrayField `xml:"gx:SimpleArrayData"`
+}
+
+type kmlArrayField struct {
+	Name   string   `xml:"name,attr"`
+	Values []string `xml:"gx:value"`
+}
+
+type kmlScan struct {
+	Name        string `xml:"name"`
+	Description string `xml:"description,omitempty"`
+	When        string `xml:"TimeStamp>when"`
+	Coordinates string `xml:"Point>coordinates"`
+}
+
+func formatFloat(value float32) string {
+	return strconv.FormatFloat(float64(value), 'f', -1, 32)
+}
+
+func writeKML(track *Track) ([]byte, error) {
+	file := kmlFile{
+		Xmlns:   "http://www.opengis.net/kml/2.2",
+		XmlnsGx: "http://www.google.com/kml/ext/2.2",
+		Name:    track.Name,
+		Schema: kmlSchema{Id: "fix", Fields: []kmlSchemaField{
+			{Name: "speed", Type: "float", DisplayName: "Speed (m/s)"},
+			{Name: "heading", Type: "float", DisplayName: "Heading"},
+		}},
+		Track: kmlPlacemark{
+			Name:   track.Name,
+			When:   make([]string, len(track.Fixes)),
+			Coords: make([]string, len(track.Fixes)),
+		},
+	}
+	speed := kmlArrayField{Name: "speed", Values: make([]string, len(track.Fixes))}
+	heading := kmlArrayField{Name: "heading", Values: make([]string, len(track.Fixes))}
+	for i, fix := range track.Fixes {
+		file.Track.When[i] = exportTime(fix.Time, track.Location)
+		file.Track.Coords[i] = fmt.Sprintf("%s %s %s", strconv.FormatFloat(fix.Coordinates.X(), 'f', -1, 64),
+			strconv.FormatFloat(fix.Coordinates.Y(), 'f', -1, 64), formatFloat(fix.Altitude))
+		speed.Values[i], heading.Values[i] = formatFloat(fix.Speed), formatFloat(fix.Heading)
+	}
+	file.Track.Data = kmlSchemaData{SchemaUrl: "#fix", Arrays: []kmlArrayField{speed, heading}}
+	if len(track.Scans) != 0 {
+		file.Scans = &kmlFolder{Name: "Scans", Placemarks: make([]kmlScan, len(track.Scans))}
+		for i := range track.Scans {
+			scan := &track.Scans[i]
+			file.Scans.Placemarks[i] = kmlScan{
+				Name:        scanName(scan),
+				Description: scanDescription(scan),
+				When:        exportTime(scan.Time, track.Location),
+				Coordinates: fmt.Sprintf("%s,%s", strconv.FormatFloat(scan.Coordinates.X(), 'f', -1, 64),
+					strconv.FormatFloat(scan.Coordinates.Y(), 'f', -1, 64)),
+			}
+		}
+	}
+	return marshalXML(file)
+}
+
+func marshalXML(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	enc := xml.NewEncoder(&buf)
+	enc.Indent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	buf.WriteByte('\n')
+	return buf.Bytes(), nil
+}
+
+// writeGeoJSON writes the track as a LineString feature holding vertex times in coordTimes, the property
+// QGIS and togeojson use, followed by a Point feature for every scan.
+func writeGeoJSON(track *Track) ([]byte, error) {
+	coords := make([]geom.Coord, len(track.Fixes))
+	times := make([]string, len(track.Fixes))
+	speeds := make([]float32, len(track.Fixes))
+	headings := make([]float32, len(track.Fixes))
+	for i, fix := range track.Fixes {
+		coords[i] = geom.Coord{fix.Coordinates.X(), fix.Coordinates.Y(), float64(fix.Altitude)}
+		times[i] = exportTime(fix.Time, track.Location)
+		speeds[i], headings[i] = fix.Speed, fix.Heading
+	}
+	line, err := geom.NewLineString(geom.XYZ).SetCoords(coords)
+	if err != nil {
+		return nil, err
+	}
+	collection := &geojson.FeatureCollection{Features: []*geojson.Feature{{
+		Geometry: line,
+		Properties: map[string]interface{}{
+			"name":       track.Name,
+			"coordTimes": times,
+			"speeds":     speeds,
+			"headings":   headings,
+		},
+	}}}
+	for i := range track.Scans {
+		scan := &track.Scans[i]
+		collection.Features = append(collection.Features, &geojson.Feature{
+			Geometry: geom.NewPointFlat(geom.XY, []float64{scan.Coordinates.X(), scan.Coordinates.Y()}),
+			Properties: map[string]interface{}{
+				"name":       scanName(scan),
+				"time":       exportTime(scan.Time, track.Location),
+				"technology": scan.Technology,
+				"arfcn":      scan.ArfcnNumber,
+				"lacTac":     scan.LacTac,
+				"cid":        scan.Cid,
+				"dbm":        scan.Dbm,
+			},
+		})
+	}
+	return json.Marshal(collection)
+}
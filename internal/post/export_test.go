@@ -0,0 +1,97 @@
+package post
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/twpayne/go-geom"
+	"github.com/twpayne/go-geom/encoding/ewkb"
+	"simpleServer/internal/post/model"
+	"strings"
+	"testing"
+	"time"
+)
+
+func point(lng, lat float64) ewkb.Point {
+	return ewkb.Point{Point: geom.NewPoint(geom.XY).MustSetCoords(geom.Coord{lng, lat})}
+}
+
+func testTrack() *Track {
+	t0 := time.Date(2024, 5, 1, 10, 0, 0, 0, time.FixedZone("EEST", 3*3600))
+	technology, lac, cid, dbm := "LTE", int32(1201), int32(55012), -87.5
+	return &Track{
+		Name: "Van 1",
+		Fixes: []model.GpsData{
+			{Time: t0, Coordinates: point(30.5, 50.4), Altitude: 170, Speed: 12.5, Heading: 90},
+			{Time: t0.Add(time.Second), Coordinates: point(30.5002, 50.4), Altitude: 171, Speed: 13, Heading: 91},
+		},
+		Scans: []model.TrackScan{
+			{Time: t0, Coordinates: point(30.5, 50.4), Technology: &technology, LacTac: &lac, Cid: &cid, Dbm: &dbm},
+		},
+	}
+}
+
+func TestWriteGPX(t *testing.T) {
+	content, err := writeGPX(testTrack())
+	require.NoError(t, err)
+	text := string(content)
+	assert.True(t, strings.HasPrefix(text, xml.Header))
+	assert.Contains(t, text, `<gpx version="1.1" creator="simpleServer" xmlns="http://www.topografix.com/GPX/1/1"`)
+	assert.Contains(t, text, `<trkpt lat="50.4" lon="30.5002">`)
+	assert.Contains(t, text, `<time>2024-05-01T07:00:01.000Z</time>`)
+	assert.Contains(t, text, `<gpxtpx:speed>13</gpxtpx:speed>`)
+	assert.Contains(t, text, `<name>LTE 1201/55012</name>`)
+	assert.Contains(t, text, `<desc>-87.5 dBm</desc>`)
+	// waypoints come before the track, as the GPX schema orders them.
+	assert.Less(t, strings.Index(text, "<wpt"), strings.Index(text, "<trk>"))
+}
+
+func TestWriteKML(t *testing.T) {
+	content, err := writeKML(testTrack())
+	require.NoError(t, err)
+	text := string(content)
+	assert.Contains(t, text, `<when>2024-05-01T07:00:00.000Z</when>`)
+	assert.Contains(t, text, `<gx:coord>30.5002 50.4 171</gx:coord>`)
+	assert.Contains(t, text, `<coordinates>30.5,50.4</coordinates>`)
+
+	track := testTrack()
+	track.Scans = nil
+	content, err = writeKML(track)
+	require.NoError(t, err)
+	assert.NotContains(t, string(content), "<Folder>")
+}
+
+func TestExportTimeZone(t *testing.T) {
+	track := testTrack()
+	track.Location = time.FixedZone("EEST", 3*60*60)
+
+	// GPX only knows UTC, the other formats keep the offset of the post.
+	content, err := writeGPX(track)
+	require.NoError(t, err)
+	assert.Contains(t, string(content), `<time>2024-05-01T07:00:01.000Z</time>`)
+	content, err = writeKML(track)
+	require.NoError(t, err)
+	assert.Contains(t, string(content), `<when>2024-05-01T10:00:00.000+03:00</when>`)
+}
+
+func TestWriteGeoJSON(t *testing.T) {
+	content, err := writeGeoJSON(testTrack())
+	require.NoError(t, err)
+	var collection struct {
+		Features []struct {
+			Geometry struct {
+				Type        string          `json:"type"`
+				Coordinates json.RawMessage `json:"coordinates"`
+			} `json:"geometry"`
+			Properties map[string]interface{} `json:"properties"`
+		} `json:"features"`
+	}
+	require.NoError(t, json.Unmarshal(content, &collection))
+	require.Len(t, collection.Features, 2)
+	line := collection.Features[0]
+	assert.Equal(t, "LineString", line.Geometry.Type)
+	assert.JSONEq(t, `[[30.5,50.4,170],[30.5002,50.4,171]]`, string(line.Geometry.Coordinates))
+	assert.Equal(t, []interface{}{"2024-05-01T07:00:00.000Z", "2024-05-01T07:00:01.000Z"}, line.Properties["coordTimes"])
+	assert.Equal(t, "Point", collection.Features[1].Geometry.Type)
+}
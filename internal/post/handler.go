@@ -1,52 +1,86 @@
 package post
 
 import (
-	"context"
+	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/go-playground/validator/v10"
 	"github.com/gofrs/uuid"
 	"net/http"
+	"simpleServer/internal/auth"
+	authModel "simpleServer/internal/auth/model"
+	"simpleServer/internal/campaign"
+	campaignDB "simpleServer/internal/campaign/database"
 	"simpleServer/internal/config"
 	"simpleServer/internal/middleware"
 	"simpleServer/internal/middleware/handler"
 	"simpleServer/internal/post/database"
 	"simpleServer/internal/post/model"
+	"simpleServer/internal/ratelimit"
 	"simpleServer/pkg/logging"
 	"simpleServer/pkg/validate"
 	"time"
 )
 
+const (
+	// defaultMinDbm is about the level phones drop the connection at.
+	defaultMinDbm         = -115
+	defaultPingPongWindow = 10 * time.Second
+
+	// defaultStopDuration is how long a post stays in place before the fixes are collapsed into a stop.
+	defaultStopDuration = 30 * time.Second
+	minResampleInterval = 100 * time.Millisecond
+	maxResampledPoints  = 100000
+
+	// legacyDateLayout names dates in the v1 tree.
+	legacyDateLayout = "2.January.2006"
+
+	defaultTreeLimit = 50
+	maxTreeLimit     = 500
+)
+
 type Handler struct {
-	postDB database.PostDB
+	postDB     database.PostDB
+	campaignDB campaignDB.CampaignDB
+	sessionGap time.Duration
 }
 
-func NewHandler(db database.PostDB) *Handler {
-	return &Handler{postDB: db}
+func NewHandler(cfg *config.Config, db database.PostDB, campaigns campaignDB.CampaignDB) *Handler {
+	return &Handler{postDB: db, campaignDB: campaigns, sessionGap: cfg.PostConfig.SessionGap}
+}
+
+// scopedPost is the post a caller bound to one post is limited to in listings, nil for other callers.
+func scopedPost(c *gin.Context) *uuid.UUID {
+	if claims := auth.FromContext(c); claims != nil {
+		return claims.ScopedPost()
+	}
+	return nil
 }
 
 func (h *Handler) GetPosts(c *gin.Context) {
 	handler.HandleRequest(c, func(c *gin.Context) *handler.Response {
-		var posts []model.Post
-		var err error
-		if posts, err = h.postDB.GetAllPosts(c); err != nil {
-			return handler.NewInternalErrorResponse(err)
+		loc, res := bindLocation(c)
+		if res != nil {
+			return res
 		}
-
-		if len(posts) != 0 {
-			for i, post := range posts {
-				gpsData, err := h.postDB.GetPostScanDates(c, post.Id)
-				if err != nil {
-					return handler.NewInternalErrorResponse(err)
-				}
-				posts[i].Coordinates = gpsData
-			}
+		rows, _, err := h.postDB.GetTree(c.Request.Context(), &model.TreeQuery{PostId: scopedPost(c), Gap: h.sessionGap})
+		if err != nil {
+			logging.FromContext(c).Errorw("post.GetPosts failed", "err", err)
+			return handler.NewInternalErrorResponse(err)
 		}
-
-		return handler.NewSuccessResponse(http.StatusOK, NewPostDateResponse(posts))
+		return handler.NewSuccessResponse(http.StatusOK, NewPostTreeResponse(model.BuildTree(rows, loc)))
 	})
 }
 
+// parsePathDate reads the day of a GetPostPath uri in loc, an ISO-8601 date or the 2.January.2006 form
+// the v1 tree names dates with.
+func parsePathDate(value string, loc *time.Location) (time.Time, error) {
+	if day, err := model.ParseDate(value, loc); err == nil {
+		return day, nil
+	}
+	return time.ParseInLocation(legacyDateLayout, value, loc)
+}
+
 func (h *Handler) GetPostPath(c *gin.Context) {
 	handler.HandleRequest(c, func(c *gin.Context) *handler.Response {
 		logger := logging.FromContext(c)
@@ -65,33 +99,856 @@ func (h *Handler) GetPostPath(c *gin.Context) {
 			return handler.NewErrorResponse(http.StatusBadRequest, handler.InvalidUriValue, "invalid id in uri", details)
 		}
 
-		ctx := context.Background()
+		interval, res := bindResampleInterval(c)
+		if res != nil {
+			return res
+		}
+		cleaning, res := bindCleanOptions(c)
+		if res != nil {
+			return res
+		}
+
+		ctx := c.Request.Context()
 		post, err := h.postDB.GetPostById(ctx, uuid.FromStringOrNil(uri.Id))
 		if err != nil {
 			return handler.NewInternalErrorResponse(fmt.Errorf("can't find post with such id"))
 		}
-		date, err := time.Parse("02.January.2006", uri.Date)
+		if post == nil {
+			return postErrorResponse(database.ErrPostNotFound)
+		}
+		loc, res := bindLocation(c)
+		if res != nil {
+			return res
+		}
+		if loc == nil {
+			loc = post.Location()
+		}
+		date, err := parsePathDate(uri.Date, loc)
 		if err != nil {
-			return handler.NewInternalErrorResponse(fmt.Errorf("can't parse provided date"))
+			return handler.NewErrorResponse(http.StatusBadRequest, handler.InvalidUriValue, "invalid date in uri",
+				validate.NewValidationErrorDetails("date", "YYYY-MM-DD", uri.Date))
 		}
-		err = h.postDB.GetPostPath(ctx, post, date, uri.Measure)
+		// measure is the ordinal of the session among the sessions started that day.
+		sessions, err := h.postDB.GetSessions(ctx, post.Id, date, date.AddDate(0, 0, 1), h.sessionGap)
 		if err != nil {
 			return handler.NewInternalErrorResponse(fmt.Errorf("can't find post path values"))
 		}
-		//return handler.NewSuccessResponse(http.StatusOK, NewPostPathResponse(post))
+		if uri.Measure < 0 || uri.Measure >= len(sessions) {
+			return handler.NewErrorResponse(http.StatusNotFound, handler.NotFoundEntity, "session not found", nil)
+		}
+		fixes, report := cleanTrack(sessions[uri.Measure].Fixes, cleaning)
+		post.Coordinates, res = resample(fixes, interval)
+		if res != nil {
+			return res
+		}
 		c.Header("Content-Type", "application/json")
-		return handler.NewSuccessResponse(http.StatusOK, NewPostPathResponse(post))
+		return handler.NewSuccessResponse(http.StatusOK, NewPostPathResponse(post, report))
+	})
+}
+
+// GetSessionPath returns the fixes of a session as a TripsLayer path, resampled when interval is given.
+func (h *Handler) GetSessionPath(c *gin.Context) {
+	handler.HandleRequest(c, func(c *gin.Context) *handler.Response {
+		postId, res := bindPostId(c)
+		if res != nil {
+			return res
+		}
+		interval, res := bindResampleInterval(c)
+		if res != nil {
+			return res
+		}
+		cleaning, res := bindCleanOptions(c)
+		if res != nil {
+			return res
+		}
+		session, err := h.postDB.GetSession(c.Request.Context(), postId, c.Param("sessionId"), h.sessionGap)
+		if errors.Is(err, database.ErrSessionNotFound) {
+			return handler.NewErrorResponse(http.StatusNotFound, handler.NotFoundEntity, "session not found", nil)
+		}
+		if err != nil {
+			logging.FromContext(c).Errorw("post.GetSessionPath failed", "postId", postId, "err", err)
+			return handler.NewInternalErrorResponse(err)
+		}
+		post := &model.Post{Id: postId}
+		fixes, report := cleanTrack(session.Fixes, cleaning)
+		if post.Coordinates, res = resample(fixes, interval); res != nil {
+			return res
+		}
+		return handler.NewSuccessResponse(http.StatusOK, NewPostPathResponse(post, report))
+	})
+}
+
+// cleanOptions are the track cleaning query parameters, Zoom is turned into a tolerance once the
+// latitude of the track is known.
+type cleanOptions struct {
+	MaxSpeed     float64       `form:"maxSpeed" binding:"omitempty,gt=0"`
+	StopRadius   float64       `form:"stopRadius" binding:"omitempty,gt=0"`
+	StopDuration time.Duration `form:"stopDuration"`
+	Smooth       bool          `form:"smooth"`
+	Accuracy     float64       `form:"accuracy" binding:"omitempty,gt=0"`
+	Zoom         *float64      `form:"zoom" binding:"omitempty,min=0,max=24"`
+}
+
+func (o *cleanOptions) enabled() bool {
+	return o.MaxSpeed > 0 || o.StopRadius > 0 || o.Smooth || o.Zoom != nil
+}
+
+func bindCleanOptions(c *gin.Context) (*cleanOptions, *handler.Response) {
+	opts := cleanOptions{StopDuration: defaultStopDuration}
+	if err := c.ShouldBindQuery(&opts); err != nil {
+		var details []*validate.ValidationErrDetail
+		if vErrs, ok := err.(validator.ValidationErrors); ok {
+			details = validate.ValidationErrorDetails(&opts, "form", vErrs)
+		}
+		return nil, handler.NewErrorResponse(http.StatusBadRequest, handler.InvalidQueryValue,
+			"invalid maxSpeed, stopRadius, stopDuration, smooth, accuracy or zoom", details)
+	}
+	return &opts, nil
+}
+
+// cleanTrack runs the cleaning stages asked for, the report is nil when none was.
+func cleanTrack(fixes []model.GpsData, opts *cleanOptions) ([]model.GpsData, *model.CleanReport) {
+	if !opts.enabled() {
+		return fixes, nil
+	}
+	clean := model.CleanOptions{
+		MaxSpeed:     opts.MaxSpeed,
+		StopRadius:   opts.StopRadius,
+		StopDuration: opts.StopDuration,
+		Smooth:       opts.Smooth,
+		Accuracy:     opts.Accuracy,
+	}
+	if opts.Zoom != nil && len(fixes) != 0 {
+		clean.Tolerance = model.ZoomTolerance(*opts.Zoom, fixes[0].Coordinates.Y())
+	}
+	fixes, report := model.CleanTrack(fixes, clean)
+	return fixes, &report
+}
+
+func bindResampleInterval(c *gin.Context) (time.Duration, *handler.Response) {
+	value := c.Query("interval")
+	if value == "" {
+		return 0, nil
+	}
+	interval, err := time.ParseDuration(value)
+	if err != nil || interval < minResampleInterval {
+		return 0, handler.NewErrorResponse(http.StatusBadRequest, handler.InvalidQueryValue, "invalid interval",
+			validate.NewValidationErrorDetails("interval", "duration of at least "+minResampleInterval.String(), value))
+	}
+	return interval, nil
+}
+
+// resample refuses intervals that would blow a long session up into too many points.
+func resample(fixes []model.GpsData, interval time.Duration) ([]model.GpsData, *handler.Response) {
+	if interval > 0 && len(fixes) > 1 && fixes[len(fixes)-1].Time.Sub(fixes[0].Time)/interval > maxResampledPoints {
+		return nil, handler.NewErrorResponse(http.StatusBadRequest, handler.InvalidQueryValue, "interval too short for the session",
+			validate.NewValidationErrorDetails("interval", fmt.Sprintf("at most %d points", maxResampledPoints), interval.String()))
+	}
+	return model.Resample(fixes, interval), nil
+}
+
+// GetServingCells returns the serving cell sequence along the post track with handovers,
+// ping-pong handovers, technology fallbacks and coverage gaps marked. With campaign only the fixes of that
+// campaign are kept.
+func (h *Handler) GetServingCells(c *gin.Context) {
+	handler.HandleRequest(c, func(c *gin.Context) *handler.Response {
+		logger := logging.FromContext(c)
+		type RequestQuery struct {
+			MinDbm   *float64      `form:"minDbm"`
+			PingPong time.Duration `form:"pingPong"`
+			Campaign string        `form:"campaign" binding:"omitempty,uuid"`
+		}
+		postId, err := uuid.FromString(c.Param("id"))
+		if err != nil {
+			return handler.NewErrorResponse(http.StatusBadRequest, handler.InvalidUriValue, "invalid id in uri",
+				validate.NewValidationErrorDetails("id", "required uuid format", c.Param("id")))
+		}
+		var query RequestQuery
+		if err := c.ShouldBindQuery(&query); err != nil {
+			var details []*validate.ValidationErrDetail
+			if vErrs, ok := err.(validator.ValidationErrors); ok {
+				details = validate.ValidationErrorDetails(&query, "form", vErrs)
+			}
+			return handler.NewErrorResponse(http.StatusBadRequest, handler.InvalidQueryValue, "invalid minDbm, pingPong or campaign", details)
+		}
+		loc, res := h.postLocation(c, postId)
+		if res != nil {
+			return res
+		}
+		campaignId, res := campaign.FilterId(c.Request.Context(), h.campaignDB, query.Campaign)
+		if res != nil {
+			return res
+		}
+		from, to, res := bindRange(c, loc, true)
+		if res != nil {
+			return res
+		}
+		opts := model.ServingOptions{MaxGap: h.sessionGap, MinDbm: defaultMinDbm, PingPongWindow: defaultPingPongWindow}
+		if query.MinDbm != nil {
+			opts.MinDbm = *query.MinDbm
+		}
+		if query.PingPong > 0 {
+			opts.PingPongWindow = query.PingPong
+		}
+
+		samples, err := h.postDB.GetServingCells(c.Request.Context(), postId, *from, *to, campaignId)
+		if err != nil {
+			logger.Errorw("post.GetServingCells failed", "postId", postId, "err", err)
+			return handler.NewInternalErrorResponse(err)
+		}
+		return handler.NewSuccessResponse(http.StatusOK, NewServingCellsResponse(model.SplitServing(samples, opts)))
+	})
+}
+
+// GetSessions lists the sessions the post started between from and to, in the zone of the post or tz.
+func (h *Handler) GetSessions(c *gin.Context) {
+	handler.HandleRequest(c, func(c *gin.Context) *handler.Response {
+		postId, res := bindPostId(c)
+		if res != nil {
+			return res
+		}
+		loc, res := h.postLocation(c, postId)
+		if res != nil {
+			return res
+		}
+		from, to, res := bindRange(c, loc, true)
+		if res != nil {
+			return res
+		}
+		sessions, err := h.postDB.GetSessions(c.Request.Context(), postId, *from, *to, h.sessionGap)
+		if err != nil {
+			logging.FromContext(c).Errorw("post.GetSessions failed", "postId", postId, "err", err)
+			return handler.NewInternalErrorResponse(err)
+		}
+		return handler.NewSuccessResponse(http.StatusOK, NewSessionsResponse(sessions, loc))
+	})
+}
+
+func (h *Handler) GetSession(c *gin.Context) {
+	handler.HandleRequest(c, func(c *gin.Context) *handler.Response {
+		postId, res := bindPostId(c)
+		if res != nil {
+			return res
+		}
+		loc, res := h.postLocation(c, postId)
+		if res != nil {
+			return res
+		}
+		session, err := h.postDB.GetSession(c.Request.Context(), postId, c.Param("sessionId"), h.sessionGap)
+		if errors.Is(err, database.ErrSessionNotFound) {
+			return handler.NewErrorResponse(http.StatusNotFound, handler.NotFoundEntity, "session not found", nil)
+		}
+		if err != nil {
+			logging.FromContext(c).Errorw("post.GetSession failed", "postId", postId, "err", err)
+			return handler.NewInternalErrorResponse(err)
+		}
+		return handler.NewSuccessResponse(http.StatusOK, NewSessionResponse(session, loc))
+	})
+}
+
+// GetSessionReport sums up the route and radio conditions of a session as JSON, or as an HTML or CSV
+// download for customers. With campaign only the fixes of that campaign are reported.
+func (h *Handler) GetSessionReport(c *gin.Context) {
+	handler.HandleRequest(c, func(c *gin.Context) *handler.Response {
+		logger := logging.FromContext(c)
+		type RequestQuery struct {
+			Format   string   `form:"format" binding:"omitempty,oneof=json html csv"`
+			MinDbm   *float64 `form:"minDbm"`
+			Campaign string   `form:"campaign" binding:"omitempty,uuid"`
+		}
+		postId, res := bindPostId(c)
+		if res != nil {
+			return res
+		}
+		var query RequestQuery
+		if err := c.ShouldBindQuery(&query); err != nil {
+			var details []*validate.ValidationErrDetail
+			if vErrs, ok := err.(validator.ValidationErrors); ok {
+				details = validate.ValidationErrorDetails(&query, "form", vErrs)
+			}
+			return handler.NewErrorResponse(http.StatusBadRequest, handler.InvalidQueryValue, "invalid format, minDbm or campaign", details)
+		}
+		ctx := c.Request.Context()
+		post, err := h.postDB.GetPostDetails(ctx, postId)
+		if err != nil {
+			return postErrorResponse(err)
+		}
+		campaignId, res := campaign.FilterId(ctx, h.campaignDB, query.Campaign)
+		if res != nil {
+			return res
+		}
+		loc, res := bindLocation(c)
+		if res != nil {
+			return res
+		}
+		if loc == nil {
+			loc = post.Location()
+		}
+
+		session, err := h.postDB.GetSession(ctx, postId, c.Param("sessionId"), h.sessionGap)
+		if errors.Is(err, database.ErrSessionNotFound) {
+			return handler.NewErrorResponse(http.StatusNotFound, handler.NotFoundEntity, "session not found", nil)
+		}
+		if err != nil {
+			logger.Errorw("post.GetSessionReport failed", "postId", postId, "err", err)
+			return handler.NewInternalErrorResponse(err)
+		}
+		from, to := session.Start, session.End.Add(time.Microsecond)
+		samples, err := h.postDB.GetServingCells(ctx, postId, from, to, campaignId)
+		if err != nil {
+			logger.Errorw("post.GetSessionReport failed", "postId", postId, "err", err)
+			return handler.NewInternalErrorResponse(err)
+		}
+		cells, err := h.postDB.GetSessionCells(ctx, postId, from, to, campaignId)
+		if err != nil {
+			logger.Errorw("post.GetSessionReport failed", "postId", postId, "err", err)
+			return handler.NewInternalErrorResponse(err)
+		}
+
+		opts := model.ServingOptions{MaxGap: h.sessionGap, MinDbm: defaultMinDbm, PingPongWindow: defaultPingPongWindow}
+		if query.MinDbm != nil {
+			opts.MinDbm = *query.MinDbm
+		}
+		report := NewTripReportResponse(post.Name, model.BuildTripReport(session, samples, cells, opts), loc)
+
+		var content []byte
+		contentType := "text/csv; charset=utf-8"
+		switch query.Format {
+		case ReportHTML:
+			content, err = writeReportHTML(report)
+			contentType = "text/html; charset=utf-8"
+		case ReportCSV:
+			content, err = writeReportCSV(report)
+		default:
+			return handler.NewSuccessResponse(http.StatusOK, report)
+		}
+		if err != nil {
+			logger.Errorw("post.GetSessionReport failed to encode", "postId", postId, "format", query.Format, "err", err)
+			return handler.NewInternalErrorResponse(err)
+		}
+		fileName := fmt.Sprintf("%s-%s-report.%s", post.Name, session.Start.In(loc).Format("20060102T150405Z0700"), query.Format)
+		return handler.NewFileResponse(http.StatusOK, contentType, fileName, content)
+	})
+}
+
+// ExportTrack downloads a session, or the track between from and to, as GPX, KML or GeoJSON. Cells heard
+// along the track are added as waypoints when scans is set. With campaign only the fixes of that campaign
+// are kept, and the range defaults to the window of the post in it.
+func (h *Handler) ExportTrack(c *gin.Context) {
+	handler.HandleRequest(c, func(c *gin.Context) *handler.Response {
+		logger := logging.FromContext(c)
+		type RequestQuery struct {
+			Format   string `form:"format" binding:"required,oneof=gpx kml geojson"`
+			Session  string `form:"session"`
+			Scans    bool   `form:"scans"`
+			Campaign string `form:"campaign" binding:"omitempty,uuid"`
+		}
+		postId, res := bindPostId(c)
+		if res != nil {
+			return res
+		}
+		var query RequestQuery
+		if err := c.ShouldBindQuery(&query); err != nil {
+			var details []*validate.ValidationErrDetail
+			if vErrs, ok := err.(validator.ValidationErrors); ok {
+				details = validate.ValidationErrorDetails(&query, "form", vErrs)
+			}
+			return handler.NewErrorResponse(http.StatusBadRequest, handler.InvalidQueryValue, "invalid format, session or campaign", details)
+		}
+		ctx := c.Request.Context()
+		post, err := h.postDB.GetPostDetails(ctx, postId)
+		if err != nil {
+			return postErrorResponse(err)
+		}
+
+		loc, res := bindLocation(c)
+		if res != nil {
+			return res
+		}
+		if loc == nil {
+			loc = post.Location()
+		}
+
+		var campaignId *uuid.UUID
+		var from, to time.Time
+		if query.Campaign != "" {
+			id := uuid.FromStringOrNil(query.Campaign)
+			campaign, err := h.campaignDB.GetCampaign(ctx, id)
+			if errors.Is(err, campaignDB.ErrCampaignNotFound) {
+				return handler.NewErrorResponse(http.StatusNotFound, handler.NotFoundEntity, "campaign not found", nil)
+			}
+			if err != nil {
+				logger.Errorw("post.ExportTrack failed", "postId", postId, "campaignId", id, "err", err)
+				return handler.NewInternalErrorResponse(err)
+			}
+			var ok bool
+			if from, to, ok = campaign.Window(postId); !ok {
+				return handler.NewErrorResponse(http.StatusNotFound, handler.NotFoundEntity, "post is not part of the campaign", nil)
+			}
+			campaignId = &id
+		}
+
+		track := &Track{Name: post.Name, Location: loc}
+		if query.Session != "" {
+			session, err := h.postDB.GetSession(ctx, postId, query.Session, h.sessionGap)
+			if errors.Is(err, database.ErrSessionNotFound) {
+				return handler.NewErrorResponse(http.StatusNotFound, handler.NotFoundEntity, "session not found", nil)
+			}
+			if err != nil {
+				logger.Errorw("post.ExportTrack failed", "postId", postId, "err", err)
+				return handler.NewInternalErrorResponse(err)
+			}
+			track.Fixes = session.Fixes
+			from, to = session.Start, session.End.Add(time.Microsecond)
+		} else {
+			rangeFrom, rangeTo, res := bindRange(c, loc, campaignId == nil)
+			if res != nil {
+				return res
+			}
+			if rangeFrom != nil {
+				from = *rangeFrom
+			}
+			if rangeTo != nil {
+				to = *rangeTo
+			}
+		}
+		if track.Fixes == nil || campaignId != nil {
+			if track.Fixes, err = h.postDB.GetTrack(ctx, postId, from, to, campaignId); err != nil {
+				logger.Errorw("post.ExportTrack failed", "postId", postId, "err", err)
+				return handler.NewInternalErrorResponse(err)
+			}
+		}
+		if len(track.Fixes) == 0 {
+			return handler.NewErrorResponse(http.StatusNotFound, handler.NotFoundEntity, "no fixes in range", nil)
+		}
+		if query.Scans {
+			if track.Scans, err = h.postDB.GetTrackScans(ctx, postId, from, to, campaignId); err != nil {
+				logger.Errorw("post.ExportTrack failed", "postId", postId, "err", err)
+				return handler.NewInternalErrorResponse(err)
+			}
+		}
+
+		exporter := exporters[query.Format]
+		content, err := exporter.Write(track)
+		if err != nil {
+			logger.Errorw("post.ExportTrack failed to encode", "postId", postId, "format", query.Format, "err", err)
+			return handler.NewInternalErrorResponse(err)
+		}
+		fileName := fmt.Sprintf("%s-%s.%s", post.Name, track.Fixes[0].Time.In(loc).Format("20060102T150405Z0700"), exporter.Extension)
+		return handler.NewFileResponse(http.StatusOK, exporter.ContentType, fileName, content)
 	})
 }
 
-func RouteV1(cfg *config.Config, h *Handler, r *gin.Engine) {
+func bindPostId(c *gin.Context) (uuid.UUID, *handler.Response) {
+	id, err := uuid.FromString(c.Param("id"))
+	if err != nil {
+		return uuid.Nil, handler.NewErrorResponse(http.StatusBadRequest, handler.InvalidUriValue, "invalid id in uri",
+			validate.NewValidationErrorDetails("id", "required uuid format", c.Param("id")))
+	}
+	return id, nil
+}
+
+// bindLocation reads the tz parameter, an IANA zone name, nil when it is not given.
+func bindLocation(c *gin.Context) (*time.Location, *handler.Response) {
+	name, ok := c.GetQuery("tz")
+	if !ok {
+		return nil, nil
+	}
+	loc, err := model.LoadTimeZone(name)
+	if err != nil {
+		return nil, handler.NewErrorResponse(http.StatusBadRequest, handler.InvalidQueryValue, "invalid tz",
+			validate.NewValidationErrorDetails("tz", "IANA time zone", name))
+	}
+	return loc, nil
+}
+
+// postLocation is the zone a request about a post is answered in, the tz parameter or else the zone of the post.
+// Unknown posts answer 404 either way.
+func (h *Handler) postLocation(c *gin.Context, postId uuid.UUID) (*time.Location, *handler.Response) {
+	loc, res := bindLocation(c)
+	if res != nil {
+		return nil, res
+	}
+	post, err := h.postDB.GetPostById(c.Request.Context(), postId)
+	if err != nil {
+		logging.FromContext(c).Errorw("post.postLocation failed", "postId", postId, "err", err)
+		return nil, handler.NewInternalErrorResponse(err)
+	}
+	if post == nil {
+		return nil, postErrorResponse(database.ErrPostNotFound)
+	}
+	if loc != nil {
+		return loc, nil
+	}
+	return post.Location(), nil
+}
+
+// bindRange reads the from and to parameters as ISO-8601 date-times or dates in loc, a date as to includes
+// that day. Missing bounds are nil unless required.
+func bindRange(c *gin.Context, loc *time.Location, required bool) (from, to *time.Time, res *handler.Response) {
+	bounds := []struct {
+		name  string
+		end   bool
+		value **time.Time
+	}{{"from", false, &from}, {"to", true, &to}}
+	for _, bound := range bounds {
+		value, ok := c.GetQuery(bound.name)
+		if !ok || value == "" {
+			if required {
+				return nil, nil, handler.NewErrorResponse(http.StatusBadRequest, handler.InvalidQueryValue, "invalid from or to",
+					validate.NewValidationErrorDetails(bound.name, "required", ""))
+			}
+			continue
+		}
+		t, err := model.ParseDateTime(value, loc, bound.end)
+		if err != nil {
+			return nil, nil, handler.NewErrorResponse(http.StatusBadRequest, handler.InvalidQueryValue, "invalid from or to",
+				validate.NewValidationErrorDetails(bound.name, "ISO-8601 date or date-time", value))
+		}
+		*bound.value = &t
+	}
+	if from != nil && to != nil && !from.Before(*to) {
+		return nil, nil, handler.NewErrorResponse(http.StatusBadRequest, handler.InvalidQueryValue, "from must be before to", nil)
+	}
+	return from, to, nil
+}
+
+// postErrorResponse maps fleet management errors to responses, other errors are internal.
+func postErrorResponse(err error) *handler.Response {
+	switch {
+	case errors.Is(err, database.ErrPostNotFound):
+		return handler.NewErrorResponse(http.StatusNotFound, handler.NotFoundEntity, "post not found", nil)
+	case errors.Is(err, database.ErrUnknownOperator):
+		return handler.NewErrorResponse(http.StatusBadRequest, handler.InvalidBodyValue, err.Error(),
+			validate.NewValidationErrorDetails("simOperators", "existing operator ids", ""))
+	}
+	return handler.NewInternalErrorResponse(err)
+}
+
+func invalidTimeZoneResponse(name string) *handler.Response {
+	return handler.NewErrorResponse(http.StatusBadRequest, handler.InvalidBodyValue, "invalid timeZone",
+		validate.NewValidationErrorDetails("timeZone", "IANA time zone", name))
+}
+
+func invalidKindResponse(kind string) *handler.Response {
+	return handler.NewErrorResponse(http.StatusBadRequest, handler.InvalidBodyValue, "invalid kind",
+		validate.NewValidationErrorDetails("kind", "one of vehicle, fixed", kind))
+}
+
+// ListPosts returns the fleet with every post status, retired posts are left out unless includeRetired is set.
+func (h *Handler) ListPosts(c *gin.Context) {
+	handler.HandleRequest(c, func(c *gin.Context) *handler.Response {
+		includeRetired := c.Query("includeRetired") == "true"
+		posts, err := h.postDB.ListPosts(c.Request.Context(), includeRetired, scopedPost(c))
+		if err != nil {
+			logging.FromContext(c).Errorw("post.ListPosts failed", "err", err)
+			return handler.NewInternalErrorResponse(err)
+		}
+		return handler.NewSuccessResponse(http.StatusOK, NewPostListResponse(posts))
+	})
+}
+
+func (h *Handler) GetPostDetails(c *gin.Context) {
+	handler.HandleRequest(c, func(c *gin.Context) *handler.Response {
+		id, res := bindPostId(c)
+		if res != nil {
+			return res
+		}
+		post, err := h.postDB.GetPostDetails(c.Request.Context(), id)
+		if err != nil {
+			return postErrorResponse(err)
+		}
+		return handler.NewSuccessResponse(http.StatusOK, NewPostDetailsResponse(post))
+	})
+}
+
+func (h *Handler) CreatePost(c *gin.Context) {
+	handler.HandleRequest(c, func(c *gin.Context) *handler.Response {
+		logger := logging.FromContext(c)
+		type RequestBody struct {
+			Name            string      `json:"name" binding:"required"`
+			Kind            string      `json:"kind"`
+			EquipmentSerial *string     `json:"equipmentSerial"`
+			Owner           *string     `json:"owner"`
+			Description     *string     `json:"description"`
+			TimeZone        string      `json:"timeZone"`
+			SimOperators    []uuid.UUID `json:"simOperators"`
+		}
+		var body RequestBody
+		if err := c.ShouldBindJSON(&body); err != nil {
+			logger.Errorw("post.CreatePost failed to bind", "err", err)
+			var details []*validate.ValidationErrDetail
+			if vErrs, ok := err.(validator.ValidationErrors); ok {
+				details = validate.ValidationErrorDetails(&body, "json", vErrs)
+			}
+			return handler.NewErrorResponse(http.StatusBadRequest, handler.InvalidBodyValue, "invalid post", details)
+		}
+		if body.Kind == "" {
+			body.Kind = model.KindVehicle
+		}
+		if !model.ValidKind(body.Kind) {
+			return invalidKindResponse(body.Kind)
+		}
+		if body.TimeZone == "" {
+			body.TimeZone = model.DefaultTimeZone
+		}
+		if _, err := model.LoadTimeZone(body.TimeZone); err != nil {
+			return invalidTimeZoneResponse(body.TimeZone)
+		}
+		post, err := h.postDB.CreatePost(c.Request.Context(), &model.Post{
+			Name:            body.Name,
+			Kind:            body.Kind,
+			EquipmentSerial: body.EquipmentSerial,
+			Owner:           body.Owner,
+			Description:     body.Description,
+			TimeZone:        body.TimeZone,
+		}, body.SimOperators)
+		if err != nil {
+			logger.Errorw("post.CreatePost failed", "err", err)
+			return postErrorResponse(err)
+		}
+		return handler.NewSuccessResponse(http.StatusCreated, NewPostDetailsResponse(post))
+	})
+}
+
+// UpdatePost changes the fields present in the body, simOperators replaces the whole list.
+func (h *Handler) UpdatePost(c *gin.Context) {
+	handler.HandleRequest(c, func(c *gin.Context) *handler.Response {
+		logger := logging.FromContext(c)
+		id, res := bindPostId(c)
+		if res != nil {
+			return res
+		}
+		type RequestBody struct {
+			Name            *string      `json:"name" binding:"omitempty,min=1"`
+			Kind            *string      `json:"kind"`
+			EquipmentSerial *string      `json:"equipmentSerial"`
+			Owner           *string      `json:"owner"`
+			Description     *string      `json:"description"`
+			TimeZone        *string      `json:"timeZone"`
+			SimOperators    *[]uuid.UUID `json:"simOperators"`
+		}
+		var body RequestBody
+		if err := c.ShouldBindJSON(&body); err != nil {
+			logger.Errorw("post.UpdatePost failed to bind", "err", err)
+			var details []*validate.ValidationErrDetail
+			if vErrs, ok := err.(validator.ValidationErrors); ok {
+				details = validate.ValidationErrorDetails(&body, "json", vErrs)
+			}
+			return handler.NewErrorResponse(http.StatusBadRequest, handler.InvalidBodyValue, "invalid post", details)
+		}
+		if body.Kind != nil && !model.ValidKind(*body.Kind) {
+			return invalidKindResponse(*body.Kind)
+		}
+		if body.TimeZone != nil {
+			if _, err := model.LoadTimeZone(*body.TimeZone); err != nil {
+				return invalidTimeZoneResponse(*body.TimeZone)
+			}
+		}
+		post, err := h.postDB.UpdatePost(c.Request.Context(), id, &model.PostUpdate{
+			Name:            body.Name,
+			Kind:            body.Kind,
+			EquipmentSerial: body.EquipmentSerial,
+			Owner:           body.Owner,
+			Description:     body.Description,
+			TimeZone:        body.TimeZone,
+			SimOperators:    body.SimOperators,
+		})
+		if err != nil {
+			logger.Errorw("post.UpdatePost failed", "id", id, "err", err)
+			return postErrorResponse(err)
+		}
+		return handler.NewSuccessResponse(http.StatusOK, NewPostDetailsResponse(post))
+	})
+}
+
+// RetirePost takes a post out of the fleet list, its measurements stay available.
+func (h *Handler) RetirePost(c *gin.Context) {
+	handler.HandleRequest(c, func(c *gin.Context) *handler.Response {
+		id, res := bindPostId(c)
+		if res != nil {
+			return res
+		}
+		post, err := h.postDB.RetirePost(c.Request.Context(), id)
+		if err != nil {
+			logging.FromContext(c).Errorw("post.RetirePost failed", "id", id, "err", err)
+			return postErrorResponse(err)
+		}
+		return handler.NewSuccessResponse(http.StatusOK, NewPostDetailsResponse(post))
+	})
+}
+
+// treeQuery is the page and depth of a v2 tree request.
+type treeQuery struct {
+	Depth  string `form:"depth" binding:"omitempty,oneof=post date session"`
+	Limit  int    `form:"limit" binding:"min=0"`
+	Offset int    `form:"offset" binding:"min=0"`
+}
+
+func bindTreeQuery(c *gin.Context, depth string) (*treeQuery, *handler.Response) {
+	query := &treeQuery{Depth: depth}
+	if err := c.ShouldBindQuery(query); err != nil {
+		var details []*validate.ValidationErrDetail
+		if vErrs, ok := err.(validator.ValidationErrors); ok {
+			details = validate.ValidationErrorDetails(query, "form", vErrs)
+		}
+		return nil, handler.NewErrorResponse(http.StatusBadRequest, handler.InvalidQueryValue, "invalid tree query", details)
+	}
+	if query.Limit == 0 || query.Limit > maxTreeLimit {
+		query.Limit = defaultTreeLimit
+	}
+	return query, nil
+}
+
+// GetTree returns a page of posts, by default without children so clients can load dates and sessions
+// lazily. depth=date or depth=session fills the children in up to that level. Days are those of each
+// post's zone, or of tz for every post when it is given; from and to are read in tz, UTC without it.
+func (h *Handler) GetTree(c *gin.Context) {
+	handler.HandleRequest(c, func(c *gin.Context) *handler.Response {
+		query, res := bindTreeQuery(c, DepthPost)
+		if res != nil {
+			return res
+		}
+		loc, res := bindLocation(c)
+		if res != nil {
+			return res
+		}
+		rangeLoc := loc
+		if rangeLoc == nil {
+			rangeLoc = time.UTC
+		}
+		from, to, res := bindRange(c, rangeLoc, false)
+		if res != nil {
+			return res
+		}
+		rows, total, err := h.postDB.GetTree(c.Request.Context(), &model.TreeQuery{
+			PostId: scopedPost(c),
+			From:   from,
+			To:     to,
+			Gap:    h.sessionGap,
+			Limit:  query.Limit,
+			Offset: query.Offset,
+		})
+		if err != nil {
+			logging.FromContext(c).Errorw("post.GetTree failed", "err", err)
+			return handler.NewInternalErrorResponse(err)
+		}
+		page := &model.TreePage{Total: total, Posts: model.BuildTree(rows, loc)}
+		return handler.NewSuccessResponse(http.StatusOK, NewTreePostPage(page, query.Limit, query.Offset, query.Depth))
+	})
+}
+
+// getTreePost returns the post of the uri with its sessions between from and to, days taken in loc.
+func (h *Handler) getTreePost(c *gin.Context, postId uuid.UUID, loc *time.Location, from, to *time.Time) (*model.TreePost, *handler.Response) {
+	rows, _, err := h.postDB.GetTree(c.Request.Context(), &model.TreeQuery{PostId: &postId, From: from, To: to, Gap: h.sessionGap})
+	if err != nil {
+		logging.FromContext(c).Errorw("post.getTreePost failed", "postId", postId, "err", err)
+		return nil, handler.NewInternalErrorResponse(err)
+	}
+	posts := model.BuildTree(rows, loc)
+	if len(posts) == 0 {
+		// postLocation already found the post, with a range it is left out when it has no session in it.
+		return &model.TreePost{PostId: postId, Location: loc}, nil
+	}
+	return &posts[0], nil
+}
+
+// GetTreeDates returns a page of the dates of one post, without sessions unless depth=session.
+func (h *Handler) GetTreeDates(c *gin.Context) {
+	handler.HandleRequest(c, func(c *gin.Context) *handler.Response {
+		query, res := bindTreeQuery(c, DepthDate)
+		if res != nil {
+			return res
+		}
+		if query.Depth == DepthPost {
+			query.Depth = DepthDate
+		}
+		postId, res := bindPostId(c)
+		if res != nil {
+			return res
+		}
+		loc, res := h.postLocation(c, postId)
+		if res != nil {
+			return res
+		}
+		from, to, res := bindRange(c, loc, false)
+		if res != nil {
+			return res
+		}
+		post, res := h.getTreePost(c, postId, loc, from, to)
+		if res != nil {
+			return res
+		}
+		return handler.NewSuccessResponse(http.StatusOK, NewTreeDatePage(post, query.Limit, query.Offset, query.Depth))
+	})
+}
+
+// GetTreeSessions returns a page of the sessions of one post starting on the date of the uri.
+func (h *Handler) GetTreeSessions(c *gin.Context) {
+	handler.HandleRequest(c, func(c *gin.Context) *handler.Response {
+		query, res := bindTreeQuery(c, DepthSession)
+		if res != nil {
+			return res
+		}
+		postId, res := bindPostId(c)
+		if res != nil {
+			return res
+		}
+		loc, res := h.postLocation(c, postId)
+		if res != nil {
+			return res
+		}
+		day, err := model.ParseDate(c.Param("date"), loc)
+		if err != nil {
+			return handler.NewErrorResponse(http.StatusBadRequest, handler.InvalidUriValue, "invalid date in uri",
+				validate.NewValidationErrorDetails("date", "YYYY-MM-DD", c.Param("date")))
+		}
+		next := day.AddDate(0, 0, 1)
+		post, res := h.getTreePost(c, postId, loc, &day, &next)
+		if res != nil {
+			return res
+		}
+		date := &model.TreeDate{Date: c.Param("date")}
+		if len(post.Dates) != 0 {
+			date = &post.Dates[0]
+		}
+		return handler.NewSuccessResponse(http.StatusOK, NewTreeSessionPage(post, date, query.Limit, query.Offset))
+	})
+}
+
+// RouteV2 serves the typed post tree.
+func RouteV2(cfg *config.Config, h *Handler, a *auth.Authenticator, l *ratelimit.Limiter, r *gin.Engine) {
+	v2 := r.Group("v2/api")
+	v2.Use(middleware.CorsMiddleware(), middleware.RequestIDMiddleware(), middleware.TimeoutMiddleware(cfg.ServerConfig.WriteTimeout))
+
+	postsV2 := v2.Group("posts")
+	postsV2.Use(a.Authenticate(), a.Require(authModel.PermissionRead), a.RequirePost("id"), l.Limit("posts"))
+	{
+		postsV2.GET("/tree", h.GetTree)
+		postsV2.GET("/tree/:id/dates", h.GetTreeDates)
+		postsV2.GET("/tree/:id/dates/:date/sessions", h.GetTreeSessions)
+	}
+}
+
+func RouteV1(cfg *config.Config, h *Handler, a *auth.Authenticator, l *ratelimit.Limiter, r *gin.Engine) {
 	v1 := r.Group("v1/api")
 	v1.Use(middleware.CorsMiddleware(), middleware.RequestIDMiddleware(), middleware.TimeoutMiddleware(cfg.ServerConfig.WriteTimeout))
 
 	postsV1 := v1.Group("post")
-	postsV1.Use()
+	postsV1.Use(a.Authenticate(), a.Require(authModel.PermissionRead), a.RequirePost("id"), l.Limit("posts"))
 	{
 		postsV1.GET("/all", h.GetPosts)
+		postsV1.GET("/list", h.ListPosts)
+		postsV1.POST("", a.Require(authModel.PermissionAdmin), h.CreatePost)
+		postsV1.GET("id/:id", h.GetPostDetails)
+		postsV1.PATCH("id/:id", a.Require(authModel.PermissionAdmin), h.UpdatePost)
+		postsV1.POST("id/:id/retire", a.Require(authModel.PermissionAdmin), h.RetirePost)
 		postsV1.GET("id/:id/date/:date/measure/:measure", h.GetPostPath)
+		postsV1.GET("id/:id/servingCells", h.GetServingCells)
+		postsV1.GET("id/:id/sessions", h.GetSessions)
+		postsV1.GET("id/:id/sessions/:sessionId", h.GetSession)
+		postsV1.GET("id/:id/sessions/:sessionId/path", h.GetSessionPath)
+		postsV1.GET("id/:id/sessions/:sessionId/report", a.Require(authModel.PermissionExport), h.GetSessionReport)
+		postsV1.GET("id/:id/export", a.Require(authModel.PermissionExport), h.ExportTrack)
 	}
 }
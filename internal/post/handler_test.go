@@ -1 +1,58 @@
 package post
+
+import (
+	"context"
+	"github.com/gin-gonic/gin"
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"simpleServer/internal/auth"
+	authModel "simpleServer/internal/auth/model"
+	"simpleServer/internal/post/database"
+	"simpleServer/internal/post/model"
+	"testing"
+)
+
+// scopeDB records the post listings were limited to.
+type scopeDB struct {
+	database.PostDB
+	treePosts []*uuid.UUID
+	listPosts []*uuid.UUID
+}
+
+func (d *scopeDB) GetTree(_ context.Context, q *model.TreeQuery) ([]model.TreeRow, int, error) {
+	d.treePosts = append(d.treePosts, q.PostId)
+	return nil, 0, nil
+}
+
+func (d *scopeDB) ListPosts(_ context.Context, _ bool, postId *uuid.UUID) ([]model.Post, error) {
+	d.listPosts = append(d.listPosts, postId)
+	return nil, nil
+}
+
+func serveAs(claims *authModel.Claims, handle gin.HandlerFunc) int {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+	c.Request = c.Request.WithContext(auth.WithClaims(c.Request.Context(), claims))
+	handle(c)
+	return w.Code
+}
+
+func TestListingsKeepToTheBoundPost(t *testing.T) {
+	db := &scopeDB{}
+	h := &Handler{postDB: db}
+	postId := uuid.Must(uuid.NewV4())
+	keyId := uuid.Must(uuid.NewV4())
+	bound := &authModel.Claims{ApiKeyId: &keyId, PostId: &postId, Permissions: []string{authModel.PermissionRead}}
+	viewer := &authModel.Claims{Role: authModel.RoleViewer}
+
+	for _, handle := range []gin.HandlerFunc{h.GetPosts, h.GetTree, h.ListPosts} {
+		require.Equal(t, http.StatusOK, serveAs(bound, handle))
+		require.Equal(t, http.StatusOK, serveAs(viewer, handle))
+	}
+	assert.Equal(t, []*uuid.UUID{&postId, nil, &postId, nil}, db.treePosts)
+	assert.Equal(t, []*uuid.UUID{&postId, nil}, db.listPosts)
+}
@@ -0,0 +1,228 @@
+package model
+
+import (
+	"github.com/twpayne/go-geom"
+	"github.com/twpayne/go-geom/encoding/ewkb"
+	"math"
+	"simpleServer/pkg/geo"
+	"time"
+)
+
+// maxOutlierRun is how many fixes in a row may be rejected as outliers before the track is taken to have
+// really moved there, so one bad first fix can't reject the rest of the track.
+const maxOutlierRun = 3
+
+// kalmanAcceleration is the spectral density of the vehicle acceleration in m²/s³ the smoothing filter expects.
+const kalmanAcceleration = 2.0
+
+// CleanOptions enables the stages of CleanTrack, a zero value disables its stage.
+type CleanOptions struct {
+	// MaxSpeed drops fixes reached from the previous kept fix faster than that many m/s.
+	MaxSpeed float64
+	// StopRadius collapses fixes staying within that many meters for at least StopDuration into the
+	// arrival and departure at their centroid.
+	StopRadius   float64
+	StopDuration time.Duration
+	// Smooth runs a constant velocity Kalman filter over the positions, Accuracy is the GPS error in meters.
+	Smooth   bool
+	Accuracy float64
+	// Tolerance simplifies the track with Douglas-Peucker, keeping vertices further than that many meters.
+	Tolerance float64
+}
+
+// CleanReport counts the fixes removed by every stage, smoothing moves fixes without removing any.
+type CleanReport struct {
+	Input      int `json:"input"`
+	Outliers   int `json:"outliers"`
+	Stops      int `json:"stops"`
+	Simplified int `json:"simplified"`
+	Output     int `json:"output"`
+}
+
+// ZoomTolerance is the ground size in meters of a web mercator pixel at zoom and latitude, the largest
+// error simplification can make without showing on the map.
+func ZoomTolerance(zoom, lat float64) float64 {
+	return 156543.03392 * math.Cos(lat*math.Pi/180) / math.Pow(2, zoom)
+}
+
+// CleanTrack removes outliers, collapses stops, smooths and simplifies fixes ordered by time, in that order.
+func CleanTrack(fixes []GpsData, opts CleanOptions) ([]GpsData, CleanReport) {
+	report := CleanReport{Input: len(fixes)}
+	if opts.MaxSpeed > 0 {
+		fixes = removeOutliers(fixes, opts.MaxSpeed)
+		report.Outliers = report.Input - len(fixes)
+	}
+	if opts.StopRadius > 0 {
+		n := len(fixes)
+		fixes = collapseStops(fixes, opts.StopRadius, opts.StopDuration)
+		report.Stops = n - len(fixes)
+	}
+	if opts.Smooth {
+		fixes = smooth(fixes, opts.Accuracy)
+	}
+	if opts.Tolerance > 0 {
+		n := len(fixes)
+		fixes = simplify(fixes, opts.Tolerance)
+		report.Simplified = n - len(fixes)
+	}
+	report.Output = len(fixes)
+	return fixes, report
+}
+
+func distance(a, b *GpsData) float64 {
+	return geo.Distance(a.Coordinates.X(), a.Coordinates.Y(), b.Coordinates.X(), b.Coordinates.Y())
+}
+
+func withPosition(fix GpsData, lng, lat float64) GpsData {
+	fix.Coordinates = ewkb.Point{Point: geom.NewPoint(geom.XY).MustSetCoords(geom.Coord{lng, lat}).SetSRID(4326)}
+	return fix
+}
+
+func removeOutliers(fixes []GpsData, maxSpeed float64) []GpsData {
+	if len(fixes) == 0 {
+		return fixes
+	}
+	kept := []GpsData{fixes[0]}
+	run := 0
+	for i := 1; i < len(fixes); i++ {
+		last := &kept[len(kept)-1]
+		d, dt := distance(last, &fixes[i]), fixes[i].Time.Sub(last.Time).Seconds()
+		if d > maxSpeed*dt && run < maxOutlierRun {
+			run++
+			continue
+		}
+		run = 0
+		kept = append(kept, fixes[i])
+	}
+	return kept
+}
+
+func collapseStops(fixes []GpsData, radius float64, minDuration time.Duration) []GpsData {
+	kept := make([]GpsData, 0, len(fixes))
+	for start := 0; start < len(fixes); {
+		end := start + 1
+		for end < len(fixes) && distance(&fixes[start], &fixes[end]) <= radius {
+			end++
+		}
+		stop := fixes[start:end]
+		if len(stop) < 3 || stop[len(stop)-1].Time.Sub(stop[0].Time) < minDuration {
+			kept = append(kept, fixes[start])
+			start++
+			continue
+		}
+		var lng, lat float64
+		for _, fix := range stop {
+			lng, lat = lng+fix.Coordinates.X(), lat+fix.Coordinates.Y()
+		}
+		lng, lat = lng/float64(len(stop)), lat/float64(len(stop))
+		arrival, departure := withPosition(stop[0], lng, lat), withPosition(stop[len(stop)-1], lng, lat)
+		arrival.Speed, departure.Speed = 0, 0
+		kept = append(kept, arrival, departure)
+		start = end
+	}
+	return kept
+}
+
+// kalmanAxis filters one projected axis with a position and velocity state.
+type kalmanAxis struct {
+	p, v             float64
+	pp, pv, vv       float64
+	measurementNoise float64
+}
+
+func (k *kalmanAxis) step(dt, z float64) float64 {
+	// predict with constant velocity, the process noise grows with the time since the last fix.
+	k.p += k.v * dt
+	k.pp += dt*(2*k.pv+dt*k.vv) + kalmanAcceleration*dt*dt*dt/3
+	k.pv += dt*k.vv + kalmanAcceleration*dt*dt/2
+	k.vv += kalmanAcceleration * dt
+
+	s := k.pp + k.measurementNoise
+	gp, gv := k.pp/s, k.pv/s
+	residual := z - k.p
+	k.p += gp * residual
+	k.v += gv * residual
+	k.vv -= gv * k.pv
+	k.pv -= gv * k.pp
+	k.pp -= gp * k.pp
+	return k.p
+}
+
+func smooth(fixes []GpsData, accuracy float64) []GpsData {
+	if len(fixes) < 2 {
+		return fixes
+	}
+	if accuracy <= 0 {
+		accuracy = 10
+	}
+	projection := geo.NewProjection(fixes[0].Coordinates.X(), fixes[0].Coordinates.Y())
+	noise := accuracy * accuracy
+	x := kalmanAxis{pp: noise, vv: 100, measurementNoise: noise}
+	y := kalmanAxis{pp: noise, vv: 100, measurementNoise: noise}
+	smoothed := make([]GpsData, len(fixes))
+	smoothed[0] = fixes[0]
+	for i := 1; i < len(fixes); i++ {
+		dt := math.Max(0, fixes[i].Time.Sub(fixes[i-1].Time).Seconds())
+		zx, zy := projection.Forward(fixes[i].Coordinates.X(), fixes[i].Coordinates.Y())
+		lng, lat := projection.Inverse(x.step(dt, zx), y.step(dt, zy))
+		smoothed[i] = withPosition(fixes[i], lng, lat)
+	}
+	return smoothed
+}
+
+// simplify keeps the vertices Douglas-Peucker needs to stay within tolerance meters of the track. Both ends
+// of a stop are kept too, they hold no shape but without them playback would creep through the stop.
+func simplify(fixes []GpsData, tolerance float64) []GpsData {
+	if len(fixes) < 3 {
+		return fixes
+	}
+	projection := geo.NewProjection(fixes[0].Coordinates.X(), fixes[0].Coordinates.Y())
+	xs, ys := make([]float64, len(fixes)), make([]float64, len(fixes))
+	for i, fix := range fixes {
+		xs[i], ys[i] = projection.Forward(fix.Coordinates.X(), fix.Coordinates.Y())
+	}
+	keep := make([]bool, len(fixes))
+	keep[0], keep[len(fixes)-1] = true, true
+	for i := 1; i < len(fixes); i++ {
+		if xs[i] == xs[i-1] && ys[i] == ys[i-1] {
+			keep[i-1], keep[i] = true, true
+		}
+	}
+	var stack [][2]int
+	for first, i := 0, 1; i < len(fixes); i++ {
+		if keep[i] {
+			stack = append(stack, [2]int{first, i})
+			first = i
+		}
+	}
+	for len(stack) > 0 {
+		first, last := stack[len(stack)-1][0], stack[len(stack)-1][1]
+		stack = stack[:len(stack)-1]
+		farthest, maxDistance := -1, tolerance
+		for i := first + 1; i < last; i++ {
+			if d := segmentDistance(xs[i], ys[i], xs[first], ys[first], xs[last], ys[last]); d > maxDistance {
+				farthest, maxDistance = i, d
+			}
+		}
+		if farthest >= 0 {
+			keep[farthest] = true
+			stack = append(stack, [2]int{first, farthest}, [2]int{farthest, last})
+		}
+	}
+	kept := make([]GpsData, 0, len(fixes))
+	for i := range fixes {
+		if keep[i] {
+			kept = append(kept, fixes[i])
+		}
+	}
+	return kept
+}
+
+func segmentDistance(px, py, ax, ay, bx, by float64) float64 {
+	dx, dy := bx-ax, by-ay
+	t := 0.0
+	if l := dx*dx + dy*dy; l > 0 {
+		t = math.Max(0, math.Min(1, ((px-ax)*dx+(py-ay)*dy)/l))
+	}
+	return math.Hypot(px-ax-t*dx, py-ay-t*dy)
+}
@@ -0,0 +1,76 @@
+package model
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestCleanTrack(t *testing.T) {
+	t0 := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	var fixes []GpsData
+	// driving east at about 14 m/s, a fix every second.
+	for i := 0; i < 10; i++ {
+		fixes = append(fixes, fix(t0.Add(time.Duration(i)*time.Second), 30+float64(i)*0.0002, 50, 14))
+	}
+	// a jump 1 km north.
+	fixes[4] = fix(fixes[4].Time, fixes[4].Coordinates.X(), 50.009, 14)
+	// waiting a minute at the last position with a few meters of jitter.
+	last := fixes[len(fixes)-1]
+	for i := 1; i <= 6; i++ {
+		fixes = append(fixes, fix(last.Time.Add(time.Duration(i)*10*time.Second), last.Coordinates.X()+float64(i%2)*0.00003, 50, 0))
+	}
+
+	cleaned, report := CleanTrack(fixes, CleanOptions{
+		MaxSpeed:     70,
+		StopRadius:   15,
+		StopDuration: 30 * time.Second,
+		Tolerance:    1,
+	})
+	assert.Equal(t, 16, report.Input)
+	assert.Equal(t, 1, report.Outliers)
+	assert.Equal(t, 5, report.Stops)
+	// the straight drive keeps its ends only, and the stop its arrival and departure.
+	assert.Equal(t, 7, report.Simplified)
+	assert.Equal(t, 3, report.Output)
+	require.Len(t, cleaned, 3)
+	assert.Equal(t, last.Time, cleaned[1].Time)
+	assert.Equal(t, last.Time.Add(60*time.Second), cleaned[2].Time)
+	assert.Equal(t, cleaned[1].Coordinates.Coords(), cleaned[2].Coordinates.Coords())
+}
+
+func TestRemoveOutliersRecovers(t *testing.T) {
+	t0 := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	// the first fix is far off, the following ones agree with each other.
+	fixes := []GpsData{fix(t0, 31, 51, 0)}
+	for i := 1; i <= 6; i++ {
+		fixes = append(fixes, fix(t0.Add(time.Duration(i)*time.Second), 30+float64(i)*0.0001, 50, 7))
+	}
+	kept := removeOutliers(fixes, 70)
+	assert.Len(t, kept, 4)
+	assert.Equal(t, fixes[4].Time, kept[1].Time)
+}
+
+func TestSmooth(t *testing.T) {
+	t0 := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	var fixes []GpsData
+	for i := 0; i < 60; i++ {
+		// 10 m/s east with 8 m of alternating noise north.
+		noise := 8 * float64(1-2*(i%2)) / 111195
+		fixes = append(fixes, fix(t0.Add(time.Duration(i)*time.Second), 30+float64(i)*10/71474, 50+noise, 10))
+	}
+	smoothed, report := CleanTrack(fixes, CleanOptions{Smooth: true, Accuracy: 8})
+	assert.Equal(t, len(fixes), report.Output)
+	require.Len(t, smoothed, len(fixes))
+	for _, fix := range smoothed[30:] {
+		assert.Less(t, math.Abs(fix.Coordinates.Y()-50)*111195, 4.0)
+	}
+}
+
+func TestZoomTolerance(t *testing.T) {
+	assert.InDelta(t, 156543.03, ZoomTolerance(0, 0), 0.01)
+	assert.InDelta(t, 0.6, ZoomTolerance(18, 0), 0.01)
+	assert.InDelta(t, ZoomTolerance(10, 0)/2, ZoomTolerance(10, 60), 1e-6)
+}
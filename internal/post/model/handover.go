@@ -0,0 +1,154 @@
+package model
+
+import (
+	"github.com/gofrs/uuid"
+	"github.com/twpayne/go-geom/encoding/ewkb"
+	"strings"
+	"time"
+)
+
+const (
+	EventHandover         = "handover"
+	EventFallback         = "fallback"
+	EventUpgrade          = "upgrade"
+	EventCoverageLost     = "coverageLost"
+	EventCoverageRestored = "coverageRestored"
+)
+
+// technologyRanks orders technologies by generation, a move to a lower rank is a fallback.
+var technologyRanks = map[string]int{"GSM": 2, "UMTS": 3, "LTE": 4, "NR": 5}
+
+func technologyRank(technology *string) int {
+	if technology == nil {
+		return 0
+	}
+	return technologyRanks[strings.ToUpper(*technology)]
+}
+
+// ServingSample is a GPS fix of a post with the cell it was served by, the strongest cell heard at the fix.
+// Gsm is nil when no cell was heard.
+type ServingSample struct {
+	GpsId       uuid.UUID  `db:"gps_id"`
+	Time        time.Time  `db:"time"`
+	Coordinates ewkb.Point `db:"coordinates"`
+	Gsm         *uuid.UUID `db:"gsm"`
+	Cid         *int32     `db:"cid"`
+	LacTac      *int32     `db:"lac_tac"`
+	ArfcnNumber *int64     `db:"arfcn_number"`
+	Technology  *string    `db:"technology"`
+	Dbm         *float64   `db:"dbm"`
+}
+
+type ServingOptions struct {
+	// MaxGap splits the track where consecutive fixes are further apart in time.
+	MaxGap time.Duration
+	// MinDbm treats weaker serving cells as lost coverage.
+	MinDbm float64
+	// PingPongWindow marks a handover back to the previous cell within that time as ping-pong.
+	PingPongWindow time.Duration
+}
+
+// ServingSegment is a stretch of the track served by one cell, or without coverage when Cell is nil.
+type ServingSegment struct {
+	Cell    *ServingSample
+	Samples []ServingSample
+	// Next is the first fix of the following segment when the track continues without a gap.
+	Next *ServingSample
+	// EnteredBy is the event that started the segment, empty at the start of the track or after a gap.
+	EnteredBy string
+	PingPong  bool
+}
+
+func (s *ServingSegment) Start() time.Time { return s.Samples[0].Time }
+
+func (s *ServingSegment) End() time.Time { return s.Samples[len(s.Samples)-1].Time }
+
+// Dbm returns the average and minimum level of the segment, false without coverage.
+func (s *ServingSegment) Dbm() (avg, min float64, ok bool) {
+	var sum float64
+	var n int
+	for _, sample := range s.Samples {
+		if sample.Dbm == nil {
+			continue
+		}
+		if n == 0 || *sample.Dbm < min {
+			min = *sample.Dbm
+		}
+		sum += *sample.Dbm
+		n++
+	}
+	if n == 0 {
+		return 0, 0, false
+	}
+	return sum / float64(n), min, true
+}
+
+func (o *ServingOptions) covered(sample *ServingSample) bool {
+	return sample.Gsm != nil && (sample.Dbm == nil || *sample.Dbm >= o.MinDbm)
+}
+
+// SplitServing cuts the time ordered fixes into segments of one serving cell and classifies how each
+// segment was entered.
+func SplitServing(samples []ServingSample, opts ServingOptions) []ServingSegment {
+	var segments []ServingSegment
+	for i := range samples {
+		sample := samples[i]
+		var cell *ServingSample
+		if opts.covered(&sample) {
+			cell = &samples[i]
+		}
+		if len(segments) > 0 {
+			last := &segments[len(segments)-1]
+			gap := opts.MaxGap > 0 && sample.Time.Sub(last.End()) > opts.MaxGap
+			if !gap && sameCell(last.Cell, cell) {
+				last.Samples = append(last.Samples, sample)
+				continue
+			}
+			if !gap {
+				last.Next = &samples[i]
+				segment := ServingSegment{Cell: cell, Samples: []ServingSample{sample}, EnteredBy: transition(last.Cell, cell)}
+				segment.PingPong = isPingPong(segments, &segment, opts.PingPongWindow)
+				segments = append(segments, segment)
+				continue
+			}
+		}
+		segments = append(segments, ServingSegment{Cell: cell, Samples: []ServingSample{sample}})
+	}
+	return segments
+}
+
+func sameCell(a, b *ServingSample) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return *a.Gsm == *b.Gsm
+}
+
+func transition(from, to *ServingSample) string {
+	switch {
+	case from == nil:
+		return EventCoverageRestored
+	case to == nil:
+		return EventCoverageLost
+	}
+	fromRank, toRank := technologyRank(from.Technology), technologyRank(to.Technology)
+	switch {
+	case toRank < fromRank:
+		return EventFallback
+	case toRank > fromRank:
+		return EventUpgrade
+	}
+	return EventHandover
+}
+
+// isPingPong tells if segment returns to the cell served before a short visit to another cell.
+func isPingPong(segments []ServingSegment, segment *ServingSegment, window time.Duration) bool {
+	if window <= 0 || len(segments) < 2 || segment.Cell == nil {
+		return false
+	}
+	visit, before := &segments[len(segments)-1], &segments[len(segments)-2]
+	if visit.Cell == nil || visit.EnteredBy == "" || !sameCell(before.Cell, segment.Cell) {
+		return false
+	}
+	return segment.Start().Sub(visit.Start()) <= window
+}
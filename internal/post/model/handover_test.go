@@ -0,0 +1,81 @@
+package model
+
+import (
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/twpayne/go-geom"
+	"github.com/twpayne/go-geom/encoding/ewkb"
+	"testing"
+	"time"
+)
+
+var start = time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+
+type cell struct {
+	gsm        uuid.UUID
+	technology string
+}
+
+var (
+	lteA = cell{uuid.Must(uuid.NewV4()), "LTE"}
+	lteB = cell{uuid.Must(uuid.NewV4()), "LTE"}
+	gsmC = cell{uuid.Must(uuid.NewV4()), "GSM"}
+)
+
+// track builds one fix a second, a nil cell is a fix without any scan.
+func track(cells ...*cell) []ServingSample {
+	samples := make([]ServingSample, len(cells))
+	for i, c := range cells {
+		samples[i] = ServingSample{
+			Time:        start.Add(time.Duration(i) * time.Second),
+			Coordinates: ewkb.Point{Point: geom.NewPoint(geom.XY).MustSetCoords(geom.Coord{30 + float64(i)*0.001, 60})},
+		}
+		if c != nil {
+			gsm, technology, dbm := c.gsm, c.technology, -80.0
+			samples[i].Gsm, samples[i].Technology, samples[i].Dbm = &gsm, &technology, &dbm
+		}
+	}
+	return samples
+}
+
+func events(segments []ServingSegment) []string {
+	var result []string
+	for _, s := range segments {
+		result = append(result, s.EnteredBy)
+	}
+	return result
+}
+
+func TestSplitServing(t *testing.T) {
+	opts := ServingOptions{MaxGap: 5 * time.Second, MinDbm: -110, PingPongWindow: 3 * time.Second}
+	segments := SplitServing(track(&lteA, &lteA, &lteB, &lteA, &lteA, &gsmC, nil, nil, &lteB), opts)
+
+	require.Len(t, segments, 6)
+	assert.Equal(t, []string{"", EventHandover, EventHandover, EventFallback, EventCoverageLost, EventCoverageRestored}, events(segments))
+	assert.Len(t, segments[0].Samples, 2)
+	assert.Equal(t, segments[1].Samples[0].Time, segments[0].Next.Time)
+	assert.True(t, segments[2].PingPong, "back to A one second after leaving it")
+	assert.False(t, segments[1].PingPong)
+	assert.Nil(t, segments[4].Cell)
+	assert.Len(t, segments[4].Samples, 2)
+	assert.Nil(t, segments[5].Next)
+
+	avg, min, ok := segments[0].Dbm()
+	assert.True(t, ok)
+	assert.Equal(t, -80.0, avg)
+	assert.Equal(t, -80.0, min)
+}
+
+func TestSplitServingGapAndWeakCell(t *testing.T) {
+	samples := track(&lteA, &lteA, &lteB)
+	samples[2].Time = samples[1].Time.Add(time.Minute)
+	weak := -120.0
+	samples[1].Dbm = &weak
+
+	segments := SplitServing(samples, ServingOptions{MaxGap: 5 * time.Second, MinDbm: -110})
+	require.Len(t, segments, 3)
+	// the weak fix counts as lost coverage, the gap starts a new line without a transition.
+	assert.Equal(t, []string{"", EventCoverageLost, ""}, events(segments))
+	assert.Nil(t, segments[1].Next)
+}
@@ -8,10 +8,55 @@ import (
 	"time"
 )
 
+const (
+	KindVehicle = "vehicle"
+	KindFixed   = "fixed"
+)
+
 type Post struct {
-	Id          uuid.UUID `db:"id"`
-	Name        string    `db:"name"`
-	Coordinates []GpsData
+	Id              uuid.UUID `db:"id"`
+	Name            string    `db:"name"`
+	Kind            string    `db:"kind"`
+	EquipmentSerial *string   `db:"equipment_serial"`
+	Owner           *string   `db:"owner"`
+	Description     *string   `db:"description"`
+	// TimeZone is the IANA zone the days of the post are counted in.
+	TimeZone     string     `db:"time_zone"`
+	RetiredAt    *time.Time `db:"retired_at"`
+	CreatedAt    time.Time  `db:"created_at"`
+	UpdatedAt    time.Time  `db:"updated_at"`
+	Coordinates  []GpsData
+	SimOperators []Operator
+	// Status is nil until the post sends its first GPS fix.
+	Status *PostStatus
+}
+
+type Operator struct {
+	Id   uuid.UUID `db:"id"`
+	Name string    `db:"name"`
+	Mcc  int16     `db:"mcc"`
+	Mnc  int16     `db:"mnc"`
+}
+
+// PostStatus is the last known position of a post.
+type PostStatus struct {
+	LastSeen    time.Time  `db:"last_seen"`
+	Coordinates ewkb.Point `db:"last_coordinates"`
+}
+
+// PostUpdate holds the fields to change, nil fields are kept. Empty optional strings are cleared.
+type PostUpdate struct {
+	Name            *string
+	Kind            *string
+	EquipmentSerial *string
+	Owner           *string
+	Description     *string
+	TimeZone        *string
+	SimOperators    *[]uuid.UUID
+}
+
+func ValidKind(kind string) bool {
+	return kind == KindVehicle || kind == KindFixed
 }
 
 type GpsData struct {
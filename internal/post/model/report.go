@@ -0,0 +1,140 @@
+package model
+
+import (
+	"github.com/gofrs/uuid"
+	"simpleServer/pkg/geo"
+	"sort"
+	"strings"
+	"time"
+)
+
+// NoCoverage stands for the stretches of a trip without a serving cell above the threshold.
+const NoCoverage = "none"
+
+// ObservedCell is a cell heard during a trip. Registered cells are known to the base station registry,
+// new cells were never heard by any post before the trip.
+type ObservedCell struct {
+	Gsm         uuid.UUID `db:"gsm_id"`
+	Cid         *int32    `db:"cid"`
+	LacTac      *int32    `db:"lac_tac"`
+	ArfcnNumber *int64    `db:"arfcn_number"`
+	Technology  *string   `db:"technology"`
+	Samples     int       `db:"samples"`
+	MaxDbm      *float64  `db:"max_dbm"`
+	FirstSeen   time.Time `db:"first_seen"`
+	Registered  bool      `db:"registered"`
+	New         bool      `db:"new"`
+}
+
+// TechnologyShare is the time and distance a trip was served by one technology.
+type TechnologyShare struct {
+	Technology string
+	Duration   time.Duration
+	Distance   float64
+	// Share is the part of the trip time.
+	Share float64
+}
+
+// TripReport sums up the radio conditions along a session.
+type TripReport struct {
+	Session   *Session
+	Threshold float64
+	// Distance and Duration are what the serving samples cover, gaps longer than the session gap left out.
+	Distance     float64
+	Duration     time.Duration
+	Technologies []TechnologyShare
+	// BelowDistance is the distance driven without a serving cell at or above Threshold, BelowShare its
+	// part of Distance and BelowSamples the fixes taken there.
+	BelowDistance float64
+	BelowShare    float64
+	BelowSamples  int
+	Samples       int
+	// Events counts the serving cell changes by kind, PingPongs the handovers back within the window.
+	Events    map[string]int
+	PingPongs int
+	Cells     []ObservedCell
+	// UnknownCells were heard but are missing from the registry, NewCells were heard for the first time.
+	UnknownCells int
+	NewCells     int
+}
+
+// BuildTripReport sums up session from its serving samples ordered by time and the cells heard along it.
+// A step between two fixes is counted for the serving cell of the first one.
+func BuildTripReport(session *Session, samples []ServingSample, cells []ObservedCell, opts ServingOptions) *TripReport {
+	report := &TripReport{
+		Session:   session,
+		Threshold: opts.MinDbm,
+		Samples:   len(samples),
+		Events:    make(map[string]int),
+		Cells:     cells,
+	}
+
+	durations := make(map[string]time.Duration)
+	distances := make(map[string]float64)
+	for i := range samples {
+		sample := &samples[i]
+		covered := opts.covered(sample)
+		if !covered {
+			report.BelowSamples++
+		}
+		if i+1 == len(samples) {
+			break
+		}
+		next := &samples[i+1]
+		dt := next.Time.Sub(sample.Time)
+		if opts.MaxGap > 0 && dt > opts.MaxGap {
+			continue
+		}
+		d := geo.Distance(sample.Coordinates.X(), sample.Coordinates.Y(), next.Coordinates.X(), next.Coordinates.Y())
+		technology := NoCoverage
+		if covered {
+			technology = "unknown"
+			if sample.Technology != nil {
+				technology = strings.ToUpper(*sample.Technology)
+			}
+		} else {
+			report.BelowDistance += d
+		}
+		durations[technology] += dt
+		distances[technology] += d
+		report.Duration += dt
+		report.Distance += d
+	}
+	if report.Distance > 0 {
+		report.BelowShare = report.BelowDistance / report.Distance
+	}
+
+	for technology, duration := range durations {
+		share := TechnologyShare{Technology: technology, Duration: duration, Distance: distances[technology]}
+		if report.Duration > 0 {
+			share.Share = float64(duration) / float64(report.Duration)
+		}
+		report.Technologies = append(report.Technologies, share)
+	}
+	sort.Slice(report.Technologies, func(i, j int) bool {
+		a, b := report.Technologies[i], report.Technologies[j]
+		if a.Duration != b.Duration {
+			return a.Duration > b.Duration
+		}
+		return a.Technology < b.Technology
+	})
+
+	for _, segment := range SplitServing(samples, opts) {
+		if segment.EnteredBy != "" {
+			report.Events[segment.EnteredBy]++
+		}
+		if segment.PingPong {
+			report.PingPongs++
+		}
+	}
+
+	for _, cell := range cells {
+		if !cell.Registered {
+			report.UnknownCells++
+		}
+		if cell.New {
+			report.NewCells++
+		}
+	}
+	return report
+}
@@ -0,0 +1,47 @@
+package model
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestBuildTripReport(t *testing.T) {
+	samples := track(&lteA, &lteA, &gsmC, nil, &lteA, &lteA, &lteA)
+	// a serving cell below the threshold counts like a fix without any.
+	weak := -120.0
+	samples[4].Dbm = &weak
+	// the step over a gap counts for neither time nor distance.
+	samples[6].Time = start.Add(10 * time.Minute)
+	cells := []ObservedCell{
+		{Gsm: lteA.gsm, Registered: true},
+		{Gsm: gsmC.gsm, Registered: false, New: true},
+	}
+	session := &Session{Id: SessionId(start)}
+
+	report := BuildTripReport(session, samples, cells, ServingOptions{MaxGap: 2 * time.Minute, MinDbm: -115})
+	assert.Equal(t, 7, report.Samples)
+	assert.Equal(t, 5*time.Second, report.Duration)
+	assert.InDelta(t, 278, report.Distance, 1)
+
+	require.Len(t, report.Technologies, 3)
+	assert.Equal(t, "LTE", report.Technologies[0].Technology)
+	assert.Equal(t, 2*time.Second, report.Technologies[0].Duration)
+	assert.Equal(t, NoCoverage, report.Technologies[1].Technology)
+	assert.InDelta(t, 0.4, report.Technologies[1].Share, 1e-9)
+	assert.Equal(t, "GSM", report.Technologies[2].Technology)
+
+	assert.Equal(t, 2, report.BelowSamples)
+	assert.InDelta(t, 0.4, report.BelowShare, 1e-3)
+	assert.Equal(t, map[string]int{EventFallback: 1, EventCoverageLost: 1, EventCoverageRestored: 1}, report.Events)
+	assert.Equal(t, 1, report.UnknownCells)
+	assert.Equal(t, 1, report.NewCells)
+}
+
+func TestBuildTripReportEmpty(t *testing.T) {
+	report := BuildTripReport(&Session{}, nil, nil, ServingOptions{MinDbm: -115})
+	assert.Zero(t, report.Distance)
+	assert.Zero(t, report.BelowShare)
+	assert.Empty(t, report.Technologies)
+}
@@ -0,0 +1,45 @@
+package model
+
+import (
+	"github.com/twpayne/go-geom"
+	"github.com/twpayne/go-geom/encoding/ewkb"
+	"math"
+	"time"
+)
+
+// Resample returns fixes at every interval from the first fix on, interpolated linearly between the recorded
+// fixes around them. Fixes must be ordered by time, a non positive interval returns them unchanged.
+func Resample(fixes []GpsData, interval time.Duration) []GpsData {
+	if interval <= 0 || len(fixes) < 2 {
+		return fixes
+	}
+	start, end := fixes[0].Time, fixes[len(fixes)-1].Time
+	resampled := make([]GpsData, 0, int(end.Sub(start)/interval)+1)
+	j := 0
+	for t := start; !t.After(end); t = t.Add(interval) {
+		for j < len(fixes)-2 && fixes[j+1].Time.Before(t) {
+			j++
+		}
+		resampled = append(resampled, interpolate(&fixes[j], &fixes[j+1], t))
+	}
+	return resampled
+}
+
+func interpolate(a, b *GpsData, t time.Time) GpsData {
+	f := 0.0
+	if span := b.Time.Sub(a.Time); span > 0 {
+		f = math.Min(1, math.Max(0, float64(t.Sub(a.Time))/float64(span)))
+	}
+	lerp := func(x, y float64) float64 { return x + (y-x)*f }
+	// heading turns the short way round, 350 to 10 passes through 0.
+	turn := math.Mod(float64(b.Heading-a.Heading)+540, 360) - 180
+	lng, lat := lerp(a.Coordinates.X(), b.Coordinates.X()), lerp(a.Coordinates.Y(), b.Coordinates.Y())
+	return GpsData{
+		Coordinates: ewkb.Point{Point: geom.NewPoint(geom.XY).MustSetCoords(geom.Coord{lng, lat}).SetSRID(4326)},
+		Time:        t,
+		Altitude:    float32(lerp(float64(a.Altitude), float64(b.Altitude))),
+		Speed:       float32(lerp(float64(a.Speed), float64(b.Speed))),
+		Heading:     float32(math.Mod(float64(a.Heading)+turn*f+360, 360)),
+		PostId:      a.PostId,
+	}
+}
@@ -0,0 +1,30 @@
+package model
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestResample(t *testing.T) {
+	t0 := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	fixes := []GpsData{
+		fix(t0, 30, 50, 10),
+		fix(t0.Add(4*time.Second), 30.004, 50, 20),
+		fix(t0.Add(5*time.Second), 30.004, 50.002, 0),
+	}
+	fixes[0].Heading, fixes[1].Heading = 350, 10
+
+	resampled := Resample(fixes, 2*time.Second)
+	require.Len(t, resampled, 3)
+	assert.Equal(t, t0.Add(2*time.Second), resampled[1].Time)
+	assert.InDelta(t, 30.002, resampled[1].Coordinates.X(), 1e-9)
+	assert.InDelta(t, 50, resampled[1].Coordinates.Y(), 1e-9)
+	assert.InDelta(t, 15, resampled[1].Speed, 1e-6)
+	assert.InDelta(t, 0, resampled[1].Heading, 1e-4)
+	assert.Equal(t, t0.Add(4*time.Second), resampled[2].Time)
+	assert.InDelta(t, 30.004, resampled[2].Coordinates.X(), 1e-9)
+
+	assert.Equal(t, fixes, Resample(fixes, 0))
+}
@@ -0,0 +1,95 @@
+package model
+
+import (
+	"fmt"
+	"github.com/gofrs/uuid"
+	"github.com/twpayne/go-geom/encoding/ewkb"
+	"math"
+	"simpleServer/pkg/geo"
+	"strconv"
+	"time"
+)
+
+// Session is a stretch of a post track without gaps longer than the session gap. It is identified by
+// its start time, which doesn't change as long as no fix is inserted before it.
+type Session struct {
+	Id     string
+	PostId uuid.UUID
+	Start  time.Time
+	End    time.Time
+	Points int
+	// Distance is the length of the track in meters.
+	Distance float64
+	// AvgSpeed is Distance over the session duration and MaxSpeed the highest speed the GPS reported, in m/s.
+	AvgSpeed float64
+	MaxSpeed float64
+	// Bbox is min lng, min lat, max lng, max lat.
+	Bbox  [4]float64
+	Fixes []GpsData
+}
+
+func SessionId(start time.Time) string {
+	return strconv.FormatInt(start.UnixMicro(), 10)
+}
+
+// ParseSessionId returns the start time a session id stands for.
+func ParseSessionId(id string) (time.Time, error) {
+	micros, err := strconv.ParseInt(id, 10, 64)
+	if err != nil || micros <= 0 {
+		return time.Time{}, fmt.Errorf("invalid session id %q", id)
+	}
+	return time.UnixMicro(micros).UTC(), nil
+}
+
+// SplitSessions cuts fixes ordered by time into sessions wherever consecutive fixes are more than gap apart.
+func SplitSessions(postId uuid.UUID, fixes []GpsData, gap time.Duration) []Session {
+	sessions := make([]Session, 0)
+	start := 0
+	for i := 1; i <= len(fixes); i++ {
+		if i == len(fixes) || fixes[i].Time.Sub(fixes[i-1].Time) > gap {
+			sessions = append(sessions, NewSession(postId, fixes[start:i]))
+			start = i
+		}
+	}
+	return sessions
+}
+
+// NewSession summarizes fixes of one session, ordered by time. fixes must not be empty.
+func NewSession(postId uuid.UUID, fixes []GpsData) Session {
+	first, last := fixes[0], fixes[len(fixes)-1]
+	s := Session{
+		Id:     SessionId(first.Time),
+		PostId: postId,
+		Start:  first.Time,
+		End:    last.Time,
+		Points: len(fixes),
+		Bbox:   [4]float64{math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)},
+		Fixes:  fixes,
+	}
+	for i, fix := range fixes {
+		lng, lat := fix.Coordinates.X(), fix.Coordinates.Y()
+		s.Bbox[0], s.Bbox[1] = math.Min(s.Bbox[0], lng), math.Min(s.Bbox[1], lat)
+		s.Bbox[2], s.Bbox[3] = math.Max(s.Bbox[2], lng), math.Max(s.Bbox[3], lat)
+		s.MaxSpeed = math.Max(s.MaxSpeed, float64(fix.Speed))
+		if i > 0 {
+			prev := fixes[i-1]
+			s.Distance += geo.Distance(prev.Coordinates.X(), prev.Coordinates.Y(), lng, lat)
+		}
+	}
+	if duration := s.End.Sub(s.Start).Seconds(); duration > 0 {
+		s.AvgSpeed = s.Distance / duration
+	}
+	return s
+}
+
+// TrackScan is a cell heard at a fix of the post track.
+type TrackScan struct {
+	Time        time.Time  `db:"time"`
+	Coordinates ewkb.Point `db:"coordinates"`
+	Altitude    float32    `db:"altitude"`
+	Technology  *string    `db:"technology"`
+	ArfcnNumber *int64     `db:"arfcn_number"`
+	LacTac      *int32     `db:"lac_tac"`
+	Cid         *int32     `db:"cid"`
+	Dbm         *float64   `db:"dbm"`
+}
@@ -0,0 +1,57 @@
+package model
+
+import (
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/twpayne/go-geom"
+	"github.com/twpayne/go-geom/encoding/ewkb"
+	"testing"
+	"time"
+)
+
+func fix(t time.Time, lng, lat float64, speed float32) GpsData {
+	return GpsData{
+		Time:        t,
+		Coordinates: ewkb.Point{Point: geom.NewPoint(geom.XY).MustSetCoords(geom.Coord{lng, lat})},
+		Speed:       speed,
+	}
+}
+
+func TestSplitSessions(t *testing.T) {
+	postId := uuid.Must(uuid.NewV4())
+	t0 := time.Date(2024, 5, 1, 23, 58, 0, 0, time.UTC)
+	fixes := []GpsData{
+		fix(t0, 30, 50, 10),
+		fix(t0.Add(60*time.Second), 30.001, 50, 12),
+		// exactly the gap apart still belongs to the session.
+		fix(t0.Add(180*time.Second), 30.002, 50.001, 9),
+		fix(t0.Add(301*time.Second), 31, 51, 0),
+		fix(t0.Add(310*time.Second), 31, 51.001, 1),
+	}
+
+	sessions := SplitSessions(postId, fixes, 120*time.Second)
+	require.Len(t, sessions, 2)
+
+	first := sessions[0]
+	assert.Equal(t, postId, first.PostId)
+	assert.Equal(t, t0, first.Start)
+	assert.Equal(t, t0.Add(180*time.Second), first.End)
+	assert.Equal(t, 3, first.Points)
+	assert.InDelta(t, 71.5+132.2, first.Distance, 1)
+	assert.InDelta(t, first.Distance/180, first.AvgSpeed, 1e-9)
+	assert.Equal(t, 12.0, first.MaxSpeed)
+	assert.Equal(t, [4]float64{30, 50, 30.002, 50.001}, first.Bbox)
+
+	second := sessions[1]
+	assert.Equal(t, 2, second.Points)
+	assert.InDelta(t, 111.2, second.Distance, 1)
+
+	start, err := ParseSessionId(second.Id)
+	require.NoError(t, err)
+	assert.True(t, start.Equal(second.Start))
+	_, err = ParseSessionId("yesterday")
+	assert.Error(t, err)
+
+	assert.Empty(t, SplitSessions(postId, nil, time.Minute))
+}
@@ -0,0 +1,76 @@
+package model
+
+import (
+	"fmt"
+	"time"
+	// the zone database is embedded, server images often come without one.
+	_ "time/tzdata"
+)
+
+// DefaultTimeZone is the zone of posts created without one.
+const DefaultTimeZone = "UTC"
+
+// LoadTimeZone returns the IANA zone called name. "Local" is refused, the server zone means nothing to clients.
+func LoadTimeZone(name string) (*time.Location, error) {
+	if name == "" || name == "Local" {
+		return nil, fmt.Errorf("invalid time zone %q", name)
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("invalid time zone %q", name)
+	}
+	return loc, nil
+}
+
+// Location is the zone of the post, UTC when it holds none or an unknown one.
+func (p *Post) Location() *time.Location {
+	if loc, err := LoadTimeZone(p.TimeZone); err == nil {
+		return loc
+	}
+	return time.UTC
+}
+
+// dateTimeLayouts are the ISO-8601 forms accepted for instants, the ones without offset are taken in the
+// request zone.
+var dateTimeLayouts = []struct {
+	layout string
+	zoned  bool
+}{
+	{time.RFC3339Nano, true},
+	{"2006-01-02T15:04:05", false},
+	{"2006-01-02T15:04", false},
+}
+
+// ParseDateTime reads an ISO-8601 date-time, with an offset or local to loc, or a date standing for the
+// start of that day in loc. end makes a date stand for the start of the next day, so a range ending on a
+// date includes it.
+func ParseDateTime(value string, loc *time.Location, end bool) (time.Time, error) {
+	for _, l := range dateTimeLayouts {
+		if l.zoned {
+			if t, err := time.Parse(l.layout, value); err == nil {
+				return t, nil
+			}
+			continue
+		}
+		if t, err := time.ParseInLocation(l.layout, value, loc); err == nil {
+			return t, nil
+		}
+	}
+	day, err := ParseDate(value, loc)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date-time %q", value)
+	}
+	if end {
+		day = day.AddDate(0, 0, 1)
+	}
+	return day, nil
+}
+
+// ParseDate reads an ISO-8601 calendar date as the start of that day in loc.
+func ParseDate(value string, loc *time.Location) (time.Time, error) {
+	day, err := time.ParseInLocation(DateLayout, value, loc)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date %q", value)
+	}
+	return day, nil
+}
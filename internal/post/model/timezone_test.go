@@ -0,0 +1,48 @@
+package model
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestParseDateTime(t *testing.T) {
+	kyiv, err := LoadTimeZone("Europe/Kyiv")
+	require.NoError(t, err)
+
+	tests := []struct {
+		value string
+		end   bool
+		want  time.Time
+	}{
+		{"2024-05-01T10:00:00Z", false, time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)},
+		{"2024-05-01T10:00:00+02:00", false, time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC)},
+		{"2024-05-01T10:00:00", false, time.Date(2024, 5, 1, 7, 0, 0, 0, time.UTC)},
+		{"2024-05-01T10:00", false, time.Date(2024, 5, 1, 7, 0, 0, 0, time.UTC)},
+		{"2024-05-01", false, time.Date(2024, 4, 30, 21, 0, 0, 0, time.UTC)},
+		{"2024-05-01", true, time.Date(2024, 5, 1, 21, 0, 0, 0, time.UTC)},
+		// the day clocks go forward is 23 hours long.
+		{"2024-03-31", true, time.Date(2024, 3, 31, 21, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		got, err := ParseDateTime(tt.value, kyiv, tt.end)
+		require.NoError(t, err, tt.value)
+		assert.True(t, tt.want.Equal(got), "%s: want %s, got %s", tt.value, tt.want, got)
+	}
+
+	_, err = ParseDateTime("01.May.2024", kyiv, false)
+	assert.Error(t, err)
+}
+
+func TestLoadTimeZone(t *testing.T) {
+	_, err := LoadTimeZone("Local")
+	assert.Error(t, err)
+	_, err = LoadTimeZone("Mars/Olympus")
+	assert.Error(t, err)
+
+	post := &Post{TimeZone: "nowhere"}
+	assert.Equal(t, time.UTC, post.Location())
+	post.TimeZone = "America/New_York"
+	assert.Equal(t, "America/New_York", post.Location().String())
+}
@@ -0,0 +1,89 @@
+package model
+
+import (
+	"github.com/gofrs/uuid"
+	"time"
+)
+
+// DateLayout names the days of the post tree.
+const DateLayout = "2006-01-02"
+
+// TreeQuery selects the posts of a tree page and the sessions starting between From and To, nil bounds are
+// open. Without bounds every post is listed, with them only posts holding a session in range. Limit 0
+// returns every post.
+type TreeQuery struct {
+	PostId *uuid.UUID
+	From   *time.Time
+	To     *time.Time
+	Gap    time.Duration
+	Limit  int
+	Offset int
+}
+
+// TreeRow is a session of a post as summarised by the database, posts without sessions come as one row
+// with a nil Start.
+type TreeRow struct {
+	PostId   uuid.UUID  `db:"post_id"`
+	PostName string     `db:"post_name"`
+	TimeZone string     `db:"time_zone"`
+	Start    *time.Time `db:"start"`
+	End      *time.Time `db:"end"`
+	Points   int        `db:"points"`
+}
+
+// TreePage is a page of posts, Total counts the posts matching the query on every page.
+type TreePage struct {
+	Total int
+	Posts []TreePost
+}
+
+type TreePost struct {
+	PostId   uuid.UUID
+	Name     string
+	Location *time.Location
+	Dates    []TreeDate
+}
+
+// TreeDate holds the sessions starting on one day, Date is formatted with DateLayout.
+type TreeDate struct {
+	Date     string
+	Sessions []TreeSession
+}
+
+type TreeSession struct {
+	Id     string
+	Start  time.Time
+	End    time.Time
+	Points int
+}
+
+// BuildTree groups rows ordered by post and start into posts, days and sessions, keeping their order.
+// Days are taken in loc, or in the zone of each post when loc is nil.
+func BuildTree(rows []TreeRow, loc *time.Location) []TreePost {
+	posts := make([]TreePost, 0)
+	for _, row := range rows {
+		if len(posts) == 0 || posts[len(posts)-1].PostId != row.PostId {
+			post := TreePost{PostId: row.PostId, Name: row.PostName, Location: loc, Dates: make([]TreeDate, 0)}
+			if post.Location == nil {
+				post.Location = (&Post{TimeZone: row.TimeZone}).Location()
+			}
+			posts = append(posts, post)
+		}
+		if row.Start == nil || row.End == nil {
+			continue
+		}
+		post := &posts[len(posts)-1]
+		date := row.Start.In(post.Location).Format(DateLayout)
+		if len(post.Dates) == 0 || post.Dates[len(post.Dates)-1].Date != date {
+			post.Dates = append(post.Dates, TreeDate{Date: date})
+		}
+		day := &post.Dates[len(post.Dates)-1]
+		day.Sessions = append(day.Sessions, TreeSession{
+			Id:     SessionId(*row.Start),
+			Start:  *row.Start,
+			End:    *row.End,
+			Points: row.Points,
+		})
+	}
+	return posts
+}
@@ -0,0 +1,51 @@
+package model
+
+import (
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestBuildTree(t *testing.T) {
+	first, second := uuid.Must(uuid.NewV4()), uuid.Must(uuid.NewV4())
+	at := func(day, hour int) *time.Time {
+		t := time.Date(2024, 5, day, hour, 0, 0, 0, time.UTC)
+		return &t
+	}
+	rows := []TreeRow{
+		{PostId: first, PostName: "A", Start: at(1, 8), End: at(1, 9), Points: 10},
+		{PostId: first, PostName: "A", Start: at(1, 22), End: at(2, 1), Points: 20},
+		{PostId: first, PostName: "A", Start: at(3, 10), End: at(3, 11), Points: 5},
+		{PostId: second, PostName: "B"},
+	}
+
+	posts := BuildTree(rows, time.UTC)
+	require.Len(t, posts, 2)
+	assert.Equal(t, "A", posts[0].Name)
+	require.Len(t, posts[0].Dates, 2)
+	assert.Equal(t, "2024-05-01", posts[0].Dates[0].Date)
+	// a session running past midnight belongs to the day it started.
+	require.Len(t, posts[0].Dates[0].Sessions, 2)
+	assert.Equal(t, SessionId(*at(1, 22)), posts[0].Dates[0].Sessions[1].Id)
+	assert.Equal(t, 20, posts[0].Dates[0].Sessions[1].Points)
+	assert.Equal(t, "2024-05-03", posts[0].Dates[1].Date)
+	assert.Equal(t, second, posts[1].PostId)
+	assert.Empty(t, posts[1].Dates)
+
+	// days follow the given location, or the zone of every post without one.
+	kyiv := time.FixedZone("EEST", 3*60*60)
+	posts = BuildTree(rows, kyiv)
+	require.Len(t, posts[0].Dates, 3)
+	for i := range rows {
+		rows[i].TimeZone = "Europe/Kyiv"
+	}
+	rows[3].TimeZone = ""
+	posts = BuildTree(rows, nil)
+	assert.Equal(t, time.UTC, posts[1].Location)
+	assert.Equal(t, "Europe/Kyiv", posts[0].Location.String())
+	require.Len(t, posts[0].Dates, 3)
+	assert.Equal(t, []string{"2024-05-01", "2024-05-02", "2024-05-03"},
+		[]string{posts[0].Dates[0].Date, posts[0].Dates[1].Date, posts[0].Dates[2].Date})
+}
@@ -0,0 +1,246 @@
+package post
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"github.com/gofrs/uuid"
+	"html/template"
+	"simpleServer/internal/post/model"
+	"sort"
+	"strconv"
+	"time"
+)
+
+const (
+	ReportJSON = "json"
+	ReportHTML = "html"
+	ReportCSV  = "csv"
+)
+
+// TripReportResponse is a trip report with times in the zone of the request and durations in seconds.
+type TripReportResponse struct {
+	Post         string                     `json:"post"`
+	Session      *SessionResponse           `json:"session"`
+	Threshold    float64                    `json:"threshold"`
+	Distance     float64                    `json:"distance"`
+	Duration     float64                    `json:"duration"`
+	Samples      int                        `json:"samples"`
+	Below        BelowThresholdResponse     `json:"belowThreshold"`
+	Technologies []*TechnologyShareResponse `json:"technologies"`
+	Events       map[string]int             `json:"events"`
+	PingPongs    int                        `json:"pingPongs"`
+	UnknownCells int                        `json:"unknownCells"`
+	NewCells     int                        `json:"newCells"`
+	Cells        []*ObservedCellResponse    `json:"cells"`
+}
+
+type BelowThresholdResponse struct {
+	Distance float64 `json:"distance"`
+	Share    float64 `json:"share"`
+	Samples  int     `json:"samples"`
+}
+
+type TechnologyShareResponse struct {
+	Technology string  `json:"technology"`
+	Duration   float64 `json:"duration"`
+	Distance   float64 `json:"distance"`
+	Share      float64 `json:"share"`
+}
+
+type ObservedCellResponse struct {
+	GsmId      uuid.UUID `json:"gsmId"`
+	Technology *string   `json:"technology"`
+	Arfcn      *int64    `json:"arfcn"`
+	LacTac     *int32    `json:"lacTac"`
+	Cid        *int32    `json:"cid"`
+	Samples    int       `json:"samples"`
+	MaxDbm     *float64  `json:"maxDbm"`
+	FirstSeen  time.Time `json:"firstSeen"`
+	Registered bool      `json:"registered"`
+	New        bool      `json:"new"`
+}
+
+func NewTripReportResponse(postName string, report *model.TripReport, loc *time.Location) *TripReportResponse {
+	res := &TripReportResponse{
+		Post:      postName,
+		Session:   NewSessionResponse(report.Session, loc),
+		Threshold: report.Threshold,
+		Distance:  report.Distance,
+		Duration:  report.Duration.Seconds(),
+		Samples:   report.Samples,
+		Below: BelowThresholdResponse{
+			Distance: report.BelowDistance,
+			Share:    report.BelowShare,
+			Samples:  report.BelowSamples,
+		},
+		Technologies: make([]*TechnologyShareResponse, len(report.Technologies)),
+		Events:       report.Events,
+		PingPongs:    report.PingPongs,
+		UnknownCells: report.UnknownCells,
+		NewCells:     report.NewCells,
+		Cells:        make([]*ObservedCellResponse, len(report.Cells)),
+	}
+	for i, share := range report.Technologies {
+		res.Technologies[i] = &TechnologyShareResponse{
+			Technology: share.Technology,
+			Duration:   share.Duration.Seconds(),
+			Distance:   share.Distance,
+			Share:      share.Share,
+		}
+	}
+	for i, cell := range report.Cells {
+		res.Cells[i] = &ObservedCellResponse{
+			GsmId:      cell.Gsm,
+			Technology: cell.Technology,
+			Arfcn:      cell.ArfcnNumber,
+			LacTac:     cell.LacTac,
+			Cid:        cell.Cid,
+			Samples:    cell.Samples,
+			MaxDbm:     cell.MaxDbm,
+			FirstSeen:  cell.FirstSeen.In(loc),
+			Registered: cell.Registered,
+			New:        cell.New,
+		}
+	}
+	return res
+}
+
+// eventNames lists the events of a report in a stable order.
+func (r *TripReportResponse) eventNames() []string {
+	names := make([]string, 0, len(r.Events))
+	for name := range r.Events {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func optional[T any](value *T) string {
+	if value == nil {
+		return ""
+	}
+	return fmt.Sprint(*value)
+}
+
+func percent(share float64) string {
+	return strconv.FormatFloat(share*100, 'f', 1, 64)
+}
+
+func kilometres(metres float64) string {
+	return strconv.FormatFloat(metres/1000, 'f', 2, 64)
+}
+
+func hms(seconds float64) string {
+	return (time.Duration(seconds) * time.Second).String()
+}
+
+var reportTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"optional": func(value interface{}) string {
+		switch v := value.(type) {
+		case *string:
+			return optional(v)
+		case *int32:
+			return optional(v)
+		case *int64:
+			return optional(v)
+		case *float64:
+			return optional(v)
+		}
+		return ""
+	},
+	"percent":    percent,
+	"kilometres": kilometres,
+	"hms":        hms,
+	"time":       func(t time.Time) string { return t.Format(time.DateTime) },
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Trip report {{.Post}} {{.Session.Date}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; margin-bottom: 2em; }
+th, td { border: 1px solid #ccc; padding: 0.3em 0.6em; text-align: left; }
+.warn { color: #b00; }
+</style>
+</head>
+<body>
+<h1>Trip report: {{.Post}}</h1>
+<p>{{time .Session.Start}} – {{time .Session.End}} ({{.Session.TimeZone}})</p>
+<h2>Summary</h2>
+<table>
+<tr><th>Distance, km</th><td>{{kilometres .Distance}}</td></tr>
+<tr><th>Duration</th><td>{{hms .Duration}}</td></tr>
+<tr><th>Fixes</th><td>{{.Samples}}</td></tr>
+<tr><th>Below {{.Threshold}} dBm, km</th><td>{{kilometres .Below.Distance}} ({{percent .Below.Share}}%)</td></tr>
+<tr><th>Ping-pong handovers</th><td>{{.PingPongs}}</td></tr>
+<tr><th>Cells observed</th><td>{{len .Cells}}</td></tr>
+<tr><th>Unknown cells</th><td>{{.UnknownCells}}</td></tr>
+<tr><th>New cells</th><td>{{.NewCells}}</td></tr>
+</table>
+<h2>Technologies</h2>
+<table>
+<tr><th>Technology</th><th>Duration</th><th>Distance, km</th><th>Share, %</th></tr>
+{{range .Technologies}}<tr><td>{{.Technology}}</td><td>{{hms .Duration}}</td><td>{{kilometres .Distance}}</td><td>{{percent .Share}}</td></tr>
+{{end}}</table>
+<h2>Events</h2>
+<table>
+<tr><th>Event</th><th>Count</th></tr>
+{{range $name, $count := .Events}}<tr><td>{{$name}}</td><td>{{$count}}</td></tr>
+{{end}}</table>
+<h2>Cells</h2>
+<table>
+<tr><th>Technology</th><th>ARFCN</th><th>LAC/TAC</th><th>CID</th><th>Fixes</th><th>Max dBm</th><th>First seen</th><th>Registered</th><th>New</th></tr>
+{{range .Cells}}<tr{{if not .Registered}} class="warn"{{end}}><td>{{optional .Technology}}</td><td>{{optional .Arfcn}}</td><td>{{optional .LacTac}}</td><td>{{optional .Cid}}</td><td>{{.Samples}}</td><td>{{optional .MaxDbm}}</td><td>{{time .FirstSeen}}</td><td>{{if .Registered}}yes{{else}}no{{end}}</td><td>{{if .New}}yes{{else}}no{{end}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+func writeReportHTML(report *TripReportResponse) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := reportTemplate.Execute(&buf, report); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// writeReportCSV writes the report as sections one after the other, each headed by its name and columns
+// and closed by an empty line.
+func writeReportCSV(report *TripReportResponse) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	formatFloat := func(value float64) string { return strconv.FormatFloat(value, 'f', -1, 64) }
+	rows := [][]string{
+		{"summary"},
+		{"post", "session", "start", "end", "timeZone", "distance", "duration", "samples", "threshold",
+			"belowDistance", "belowShare", "belowSamples", "pingPongs", "cells", "unknownCells", "newCells"},
+		{report.Post, report.Session.Id, report.Session.Start.Format(exportTimeLayout), report.Session.End.Format(exportTimeLayout),
+			report.Session.TimeZone, formatFloat(report.Distance), formatFloat(report.Duration), strconv.Itoa(report.Samples),
+			formatFloat(report.Threshold), formatFloat(report.Below.Distance), formatFloat(report.Below.Share),
+			strconv.Itoa(report.Below.Samples), strconv.Itoa(report.PingPongs), strconv.Itoa(len(report.Cells)),
+			strconv.Itoa(report.UnknownCells), strconv.Itoa(report.NewCells)},
+		{},
+		{"technologies"},
+		{"technology", "duration", "distance", "share"},
+	}
+	for _, share := range report.Technologies {
+		rows = append(rows, []string{share.Technology, formatFloat(share.Duration), formatFloat(share.Distance), formatFloat(share.Share)})
+	}
+	rows = append(rows, []string{}, []string{"events"}, []string{"event", "count"})
+	for _, name := range report.eventNames() {
+		rows = append(rows, []string{name, strconv.Itoa(report.Events[name])})
+	}
+	rows = append(rows, []string{}, []string{"cells"},
+		[]string{"gsmId", "technology", "arfcn", "lacTac", "cid", "samples", "maxDbm", "firstSeen", "registered", "new"})
+	for _, cell := range report.Cells {
+		rows = append(rows, []string{cell.GsmId.String(), optional(cell.Technology), optional(cell.Arfcn), optional(cell.LacTac),
+			optional(cell.Cid), strconv.Itoa(cell.Samples), optional(cell.MaxDbm), cell.FirstSeen.Format(exportTimeLayout),
+			strconv.FormatBool(cell.Registered), strconv.FormatBool(cell.New)})
+	}
+	if err := w.WriteAll(rows); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,73 @@
+package post
+
+import (
+	"encoding/csv"
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"simpleServer/internal/post/model"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testReport() *TripReportResponse {
+	t0 := time.Date(2024, 5, 1, 7, 0, 0, 0, time.UTC)
+	technology, cid, dbm := "LTE", int32(55012), -87.5
+	report := &model.TripReport{
+		Session:   &model.Session{Id: model.SessionId(t0), Start: t0, End: t0.Add(30 * time.Minute)},
+		Threshold: -115,
+		Distance:  12500,
+		Duration:  30 * time.Minute,
+		Technologies: []model.TechnologyShare{
+			{Technology: "LTE", Duration: 27 * time.Minute, Distance: 11000, Share: 0.9},
+			{Technology: model.NoCoverage, Duration: 3 * time.Minute, Distance: 1500, Share: 0.1},
+		},
+		BelowDistance: 1500,
+		BelowShare:    0.12,
+		Events:        map[string]int{model.EventHandover: 4, model.EventCoverageLost: 1},
+		Cells: []model.ObservedCell{
+			{Gsm: uuid.Must(uuid.NewV4()), Technology: &technology, Cid: &cid, Samples: 120, MaxDbm: &dbm, FirstSeen: t0},
+		},
+		UnknownCells: 1,
+	}
+	return NewTripReportResponse("Van <1>", report, time.FixedZone("EEST", 3*60*60))
+}
+
+func TestNewTripReportResponse(t *testing.T) {
+	report := testReport()
+	assert.Equal(t, 1800.0, report.Duration)
+	assert.Equal(t, 1620.0, report.Technologies[0].Duration)
+	assert.Equal(t, "2024-05-01", report.Session.Date)
+	assert.Equal(t, "2024-05-01T10:00:00+03:00", report.Cells[0].FirstSeen.Format(time.RFC3339))
+}
+
+func TestWriteReportHTML(t *testing.T) {
+	content, err := writeReportHTML(testReport())
+	require.NoError(t, err)
+	text := string(content)
+	assert.Contains(t, text, "<h1>Trip report: Van &lt;1&gt;</h1>")
+	assert.Contains(t, text, "<td>12.50</td>")
+	assert.Contains(t, text, "<td>1.50 (12.0%)</td>")
+	assert.Contains(t, text, "<td>LTE</td><td>27m0s</td><td>11.00</td><td>90.0</td>")
+	assert.Contains(t, text, `<tr class="warn"><td>LTE</td><td></td><td></td><td>55012</td><td>120</td><td>-87.5</td>`)
+}
+
+func TestWriteReportCSV(t *testing.T) {
+	content, err := writeReportCSV(testReport())
+	require.NoError(t, err)
+	r := csv.NewReader(strings.NewReader(string(content)))
+	r.FieldsPerRecord = -1
+	rows, err := r.ReadAll()
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"summary"}, rows[0])
+	assert.Equal(t, "Van <1>", rows[2][0])
+	assert.Equal(t, "2024-05-01T10:00:00.000+03:00", rows[2][2])
+	assert.Equal(t, []string{"LTE", "1620", "11000", "0.9"}, rows[5])
+	assert.Equal(t, []string{"coverageLost", "1"}, rows[9])
+	assert.Equal(t, []string{"handover", "4"}, rows[10])
+	cell := rows[len(rows)-1]
+	assert.Equal(t, []string{"LTE", "", "", "55012", "120", "-87.5"}, cell[1:7])
+	assert.Equal(t, []string{"false", "false"}, cell[8:])
+}
@@ -1,171 +1,446 @@
 package post
 
 import (
-	"fmt"
 	"github.com/gofrs/uuid"
+	"github.com/twpayne/go-geom"
+	"github.com/twpayne/go-geom/encoding/geojson"
 	"simpleServer/internal/post/model"
 	"time"
 )
 
-type Post struct {
-	PostId   uuid.UUID              `json:"postId"`
-	Name     string                 `json:"name"`
-	Children map[string]interface{} `json:"children"`
+// PostTree is the v1 post tree. Nodes are numbered level by level, posts first, then their dates, then
+// the session times.
+type PostTree struct {
+	Title   string      `json:"title"`
+	Content []*PostNode `json:"content"`
+}
+
+type PostNode struct {
+	Id       int         `json:"id"`
+	PostId   uuid.UUID   `json:"postId"`
+	Name     string      `json:"name"`
+	Children []DateGroup `json:"children"`
+}
+
+type DateGroup struct {
+	Title   string      `json:"title"`
+	Content []*DateNode `json:"content"`
+}
+
+type DateNode struct {
+	Id       int         `json:"id"`
+	Name     string      `json:"name"`
+	Children []TimeGroup `json:"children"`
+}
+
+type TimeGroup struct {
+	Title   string      `json:"title"`
+	Content []*TimeNode `json:"content"`
 }
 
 type TimeNode struct {
+	Id        int       `json:"id"`
 	Name      string    `json:"name"`
 	RowNumber int       `json:"rowNumber"`
 	Date      string    `json:"date"`
 	PostId    uuid.UUID `json:"postId"`
+	SessionId string    `json:"sessionId"`
 	IsTime    bool      `json:"isTime"`
 }
 
+// Waypoint is a fix in the deck.gl TripsLayer format, Timestamp is in epoch milliseconds.
 type Waypoint struct {
 	Coordinates []float64 `json:"coordinates"`
-	Timestamp   int       `json:"timestamp"`
+	Timestamp   int64     `json:"timestamp"`
+	Altitude    float32   `json:"altitude"`
+	// Speed is in m/s, Heading in degrees clockwise from north.
+	Speed   float32 `json:"speed"`
+	Heading float32 `json:"heading"`
 }
 
-func (node TimeNode) GetMapNode() map[string]interface{} {
-	return map[string]interface{}{
-		"name":      node.Name,
-		"rowNumber": node.RowNumber,
-		"date":      node.Date,
-		"postId":    node.PostId,
-		"isTime":    node.IsTime,
+// NewPostTreeResponse builds the v1 post tree, every post holds its scan dates and every date the sessions
+// started on it.
+func NewPostTreeResponse(posts []model.TreePost) *PostTree {
+	tree := &PostTree{Title: "Posts", Content: make([]*PostNode, len(posts))}
+	var dates []*DateNode
+	var times []*TimeNode
+	for i, post := range posts {
+		node := &PostNode{
+			PostId:   post.PostId,
+			Name:     post.Name,
+			Children: []DateGroup{{Title: "Scan Dates", Content: make([]*DateNode, len(post.Dates))}},
+		}
+		for j, date := range post.Dates {
+			day, _ := time.Parse(model.DateLayout, date.Date)
+			name := day.Format(legacyDateLayout)
+			dateNode := &DateNode{
+				Name:     name,
+				Children: []TimeGroup{{Title: "Scans time", Content: make([]*TimeNode, len(date.Sessions))}},
+			}
+			for k, session := range date.Sessions {
+				timeNode := &TimeNode{
+					Name:      session.Start.In(post.Location).Format("15:04"),
+					RowNumber: k,
+					Date:      name,
+					PostId:    post.PostId,
+					SessionId: session.Id,
+					IsTime:    true,
+				}
+				dateNode.Children[0].Content[k] = timeNode
+				times = append(times, timeNode)
+			}
+			node.Children[0].Content[j] = dateNode
+			dates = append(dates, dateNode)
+		}
+		tree.Content[i] = node
+	}
+
+	id := 1
+	for _, node := range tree.Content {
+		node.Id, id = id, id+1
+	}
+	for _, node := range dates {
+		node.Id, id = id, id+1
 	}
+	for _, node := range times {
+		node.Id, id = id, id+1
+	}
+	return tree
 }
 
-type JsonNodeDetour struct {
-	Graph      map[string]interface{}
-	DetourNode string
+// NewPostPathResponse returns the post fixes as a TripsLayer trip, with what cleaning removed when it ran.
+func NewPostPathResponse(post *model.Post, cleaning *model.CleanReport) []map[string]interface{} {
+	path := make([]Waypoint, len(post.Coordinates))
+	for i, fix := range post.Coordinates {
+		path[i] = Waypoint{
+			Coordinates: []float64{fix.Coordinates.X(), fix.Coordinates.Y()},
+			Timestamp:   fix.Time.UnixMilli(),
+			Altitude:    fix.Altitude,
+			Speed:       fix.Speed,
+			Heading:     fix.Heading,
+		}
+	}
+
+	trip := map[string]interface{}{"waypoints": path}
+	if cleaning != nil {
+		trip["cleaning"] = cleaning
+	}
+	return []map[string]interface{}{trip}
 }
 
-func (detour *JsonNodeDetour) JsonDetour() {
-	detourQueue := []map[string]interface{}{detour.Graph}
-	iterator := 1
+// SessionResponse times are given in the zone of the request, Date is the day the session started there.
+type SessionResponse struct {
+	Id       string     `json:"id"`
+	PostId   uuid.UUID  `json:"postId"`
+	Date     string     `json:"date"`
+	TimeZone string     `json:"timeZone"`
+	Start    time.Time  `json:"start"`
+	End      time.Time  `json:"end"`
+	Points   int        `json:"points"`
+	Distance float64    `json:"distance"`
+	AvgSpeed float64    `json:"avgSpeed"`
+	MaxSpeed float64    `json:"maxSpeed"`
+	Bbox     [4]float64 `json:"bbox"`
+}
 
-	for len(detourQueue) > 0 {
-		detourNode := detourQueue[0]
-		detourQueue = detourQueue[1:]
-		if _, ok := detourNode[detour.DetourNode]; ok {
-			detourNode["id"] = iterator
-			iterator++
-		}
-		for _, value := range detourNode {
-			switch value.(type) {
-			case []map[string]interface{}:
-				for i := range value.([]map[string]interface{}) {
-					detourQueue = append(detourQueue, value.([]map[string]interface{})[i])
-				}
-			case map[string]interface{}:
-				detourQueue = append(detourQueue, value.(map[string]interface{}))
-			}
-		}
+func NewSessionResponse(session *model.Session, loc *time.Location) *SessionResponse {
+	return &SessionResponse{
+		Id:       session.Id,
+		PostId:   session.PostId,
+		Date:     session.Start.In(loc).Format(model.DateLayout),
+		TimeZone: loc.String(),
+		Start:    session.Start.In(loc),
+		End:      session.End.In(loc),
+		Points:   session.Points,
+		Distance: session.Distance,
+		AvgSpeed: session.AvgSpeed,
+		MaxSpeed: session.MaxSpeed,
+		Bbox:     session.Bbox,
+	}
+}
+
+func NewSessionsResponse(sessions []model.Session, loc *time.Location) []*SessionResponse {
+	res := make([]*SessionResponse, len(sessions))
+	for i := range sessions {
+		res[i] = NewSessionResponse(&sessions[i], loc)
 	}
+	return res
 }
 
-func NewPostDateResponse(postsDb []model.Post) map[string]interface{} {
-	postData := make(map[string]interface{})
-	postData["title"] = "Posts"
+func servingCellProperties(cell *model.ServingSample) map[string]interface{} {
+	if cell == nil {
+		return map[string]interface{}{"covered": false}
+	}
+	return map[string]interface{}{
+		"covered":    true,
+		"gsmId":      cell.Gsm,
+		"cid":        cell.Cid,
+		"lacTac":     cell.LacTac,
+		"arfcn":      cell.ArfcnNumber,
+		"technology": cell.Technology,
+	}
+}
 
-	posts := make([]map[string]interface{}, 0)
-	for _, postDb := range postsDb {
-		post := Post{
-			PostId: postDb.Id,
-			Name:   postDb.Name,
+// NewServingCellsResponse draws every serving segment as a LineString and every transition between
+// segments as a Point at the first fix after it.
+func NewServingCellsResponse(segments []model.ServingSegment) *geojson.FeatureCollection {
+	collection := &geojson.FeatureCollection{Features: make([]*geojson.Feature, 0, 2*len(segments))}
+	for i := range segments {
+		segment := &segments[i]
+		coords := make([]geom.Coord, 0, len(segment.Samples)+1)
+		for _, sample := range segment.Samples {
+			coords = append(coords, geom.Coord{sample.Coordinates.X(), sample.Coordinates.Y()})
+		}
+		// the line runs up to the next segment, so the track has no holes where the cell changes.
+		if segment.Next != nil {
+			coords = append(coords, geom.Coord{segment.Next.Coordinates.X(), segment.Next.Coordinates.Y()})
+		}
+		if len(coords) == 1 {
+			coords = append(coords, coords[0])
 		}
 
-		scanDates := make([]map[string]interface{}, 0)
-		if len(postDb.Coordinates) != 0 {
-			scanDate := make(map[string]interface{})
-			scanDate["name"] = postDb.Coordinates[0].Time.Format("2.January.2006")
-			lastTimeNode := TimeNode{
-				Name:      postDb.Coordinates[0].Time.Format("15:04"),
-				RowNumber: 0,
-				Date:      scanDate["name"].(string),
-				PostId:    postDb.Id,
-				IsTime:    true,
-			}
-			scanDate["children"] = []map[string]interface{}{
-				{
-					"title":   "Scans time",
-					"content": []map[string]interface{}{lastTimeNode.GetMapNode()},
-				},
-			}
-			scanDates = append(scanDates, scanDate)
-			for i := 1; i < len(postDb.Coordinates); i++ {
-				currDate := postDb.Coordinates[i].Time
-				if scanDate["name"].(string) == currDate.Format("2.January.2006") {
-					first, _ := time.Parse("15:04", lastTimeNode.Name)
-					second, _ := time.Parse("15:04", fmt.Sprintf("%d:%d", currDate.Hour(), currDate.Minute()))
-					timeDiff := second.Sub(first)
-					if timeDiff.Seconds() >= 120 {
-						lastTimeNode = TimeNode{
-							Name:      currDate.Format("15:04"),
-							RowNumber: lastTimeNode.RowNumber + 1,
-							Date:      scanDate["name"].(string),
-							PostId:    postDb.Id,
-							IsTime:    true,
-						}
-						scanDate["children"].([]map[string]interface{})[0]["content"] = append(scanDate["children"].([]map[string]interface{})[0]["content"].([]map[string]interface{}), lastTimeNode.GetMapNode())
-					}
-				} else {
-					scanDate = make(map[string]interface{})
-					scanDate["name"] = currDate.Format("2.January.2006")
-					lastTimeNode = TimeNode{
-						Name:      currDate.Format("15:04"),
-						RowNumber: 0,
-						Date:      scanDate["name"].(string),
-						PostId:    postDb.Id,
-						IsTime:    true,
-					}
-					scanDate["children"] = []map[string]interface{}{
-						{
-							"title":   "Scans time",
-							"content": []map[string]interface{}{lastTimeNode.GetMapNode()},
-						},
-					}
-					scanDates = append(scanDates, scanDate)
-				}
-			}
+		properties := servingCellProperties(segment.Cell)
+		properties["start"] = segment.Start()
+		properties["end"] = segment.End()
+		properties["samples"] = len(segment.Samples)
+		properties["enteredBy"] = segment.EnteredBy
+		properties["pingPong"] = segment.PingPong
+		if avg, min, ok := segment.Dbm(); ok {
+			properties["avgDbm"], properties["minDbm"] = avg, min
 		}
+		collection.Features = append(collection.Features, &geojson.Feature{
+			Geometry:   geom.NewLineString(geom.XY).MustSetCoords(coords).SetSRID(4326),
+			Properties: properties,
+		})
 
-		posts = append(posts, map[string]interface{}{
-			"postId": post.PostId,
-			"name":   post.Name,
-			"children": []map[string]interface{}{{
-				"title":   "Scan Dates",
-				"content": scanDates,
-			}},
+		if segment.EnteredBy == "" {
+			continue
+		}
+		first := segment.Samples[0]
+		event := map[string]interface{}{
+			"event":    segment.EnteredBy,
+			"time":     first.Time,
+			"pingPong": segment.PingPong,
+			"from":     servingCellProperties(segments[i-1].Cell),
+			"to":       servingCellProperties(segment.Cell),
+		}
+		collection.Features = append(collection.Features, &geojson.Feature{
+			Geometry:   geom.NewPoint(geom.XY).MustSetCoords(geom.Coord{first.Coordinates.X(), first.Coordinates.Y()}).SetSRID(4326),
+			Properties: event,
 		})
 	}
-	postData["content"] = posts
+	return collection
+}
+
+type OperatorResponse struct {
+	Id   uuid.UUID `json:"id"`
+	Name string    `json:"name"`
+	Mcc  int16     `json:"mcc"`
+	Mnc  int16     `json:"mnc"`
+}
+
+type PostStatusResponse struct {
+	LastSeen    time.Time `json:"lastSeen"`
+	Coordinates []float64 `json:"coordinates"`
+}
+
+type PostDetailsResponse struct {
+	Id              uuid.UUID           `json:"id"`
+	Name            string              `json:"name"`
+	Kind            string              `json:"kind"`
+	EquipmentSerial *string             `json:"equipmentSerial"`
+	Owner           *string             `json:"owner"`
+	Description     *string             `json:"description"`
+	TimeZone        string              `json:"timeZone"`
+	SimOperators    []OperatorResponse  `json:"simOperators"`
+	Retired         bool                `json:"retired"`
+	RetiredAt       *time.Time          `json:"retiredAt"`
+	CreatedAt       time.Time           `json:"createdAt"`
+	UpdatedAt       time.Time           `json:"updatedAt"`
+	Status          *PostStatusResponse `json:"status"`
+}
+
+func NewPostDetailsResponse(post *model.Post) *PostDetailsResponse {
+	res := &PostDetailsResponse{
+		Id:              post.Id,
+		Name:            post.Name,
+		Kind:            post.Kind,
+		EquipmentSerial: post.EquipmentSerial,
+		Owner:           post.Owner,
+		Description:     post.Description,
+		TimeZone:        post.TimeZone,
+		SimOperators:    make([]OperatorResponse, len(post.SimOperators)),
+		Retired:         post.RetiredAt != nil,
+		RetiredAt:       post.RetiredAt,
+		CreatedAt:       post.CreatedAt,
+		UpdatedAt:       post.UpdatedAt,
+	}
+	for i, operator := range post.SimOperators {
+		res.SimOperators[i] = OperatorResponse{Id: operator.Id, Name: operator.Name, Mcc: operator.Mcc, Mnc: operator.Mnc}
+	}
+	if post.Status != nil {
+		res.Status = &PostStatusResponse{
+			LastSeen:    post.Status.LastSeen,
+			Coordinates: []float64{post.Status.Coordinates.X(), post.Status.Coordinates.Y()},
+		}
+	}
+	return res
+}
 
-	detourQueue := JsonNodeDetour{
-		Graph:      postData,
-		DetourNode: "name",
+func NewPostListResponse(posts []model.Post) []*PostDetailsResponse {
+	res := make([]*PostDetailsResponse, len(posts))
+	for i := range posts {
+		res[i] = NewPostDetailsResponse(&posts[i])
 	}
+	return res
+}
 
-	detourQueue.JsonDetour()
+// TreePostResponse is a post of the v2 tree. Children are only filled in as deep as asked for, the counts
+// always are.
+type TreePostResponse struct {
+	Id       string              `json:"id"`
+	PostId   uuid.UUID           `json:"postId"`
+	Name     string              `json:"name"`
+	TimeZone string              `json:"timeZone"`
+	Dates    int                 `json:"dates"`
+	Sessions int                 `json:"sessions"`
+	Points   int                 `json:"points"`
+	Children []*TreeDateResponse `json:"children,omitempty"`
+}
 
-	return postData
+// TreeDateResponse ids are the post id and the date, stable for as long as the date has sessions.
+type TreeDateResponse struct {
+	Id       string                 `json:"id"`
+	PostId   uuid.UUID              `json:"postId"`
+	Date     string                 `json:"date"`
+	Sessions int                    `json:"sessions"`
+	Points   int                    `json:"points"`
+	Children []*TreeSessionResponse `json:"children,omitempty"`
 }
 
-func NewPostPathResponse(post *model.Post) []map[string]interface{} {
-	path := make([]interface{}, 0)
-	timestampStart := 1554772579000
-	for i := range post.Coordinates {
-		path = append(path, Waypoint{
-			Coordinates: []float64{post.Coordinates[i].Coordinates.X(), post.Coordinates[i].Coordinates.Y()},
-			Timestamp:   timestampStart + i*10,
-		})
+// TreeSessionResponse ids are the post and session ids, stable like session ids.
+type TreeSessionResponse struct {
+	Id        string    `json:"id"`
+	PostId    uuid.UUID `json:"postId"`
+	SessionId string    `json:"sessionId"`
+	Start     time.Time `json:"start"`
+	End       time.Time `json:"end"`
+	Points    int       `json:"points"`
+	// Duration is in seconds.
+	Duration float64 `json:"duration"`
+}
+
+type TreePostPage struct {
+	Total  int                 `json:"total"`
+	Limit  int                 `json:"limit"`
+	Offset int                 `json:"offset"`
+	Items  []*TreePostResponse `json:"items"`
+}
+
+type TreeDatePage struct {
+	Total  int                 `json:"total"`
+	Limit  int                 `json:"limit"`
+	Offset int                 `json:"offset"`
+	Items  []*TreeDateResponse `json:"items"`
+}
+
+type TreeSessionPage struct {
+	Total  int                    `json:"total"`
+	Limit  int                    `json:"limit"`
+	Offset int                    `json:"offset"`
+	Items  []*TreeSessionResponse `json:"items"`
+}
+
+const (
+	DepthPost    = "post"
+	DepthDate    = "date"
+	DepthSession = "session"
+)
+
+func NewTreeSessionResponse(post *model.TreePost, session *model.TreeSession) *TreeSessionResponse {
+	return &TreeSessionResponse{
+		Id:        post.PostId.String() + "/" + session.Id,
+		PostId:    post.PostId,
+		SessionId: session.Id,
+		Start:     session.Start.In(post.Location),
+		End:       session.End.In(post.Location),
+		Points:    session.Points,
+		Duration:  session.End.Sub(session.Start).Seconds(),
+	}
+}
+
+func NewTreeDateResponse(post *model.TreePost, date *model.TreeDate, depth string) *TreeDateResponse {
+	node := &TreeDateResponse{
+		Id:       post.PostId.String() + "/" + date.Date,
+		PostId:   post.PostId,
+		Date:     date.Date,
+		Sessions: len(date.Sessions),
+	}
+	for i := range date.Sessions {
+		node.Points += date.Sessions[i].Points
+		if depth == DepthSession {
+			node.Children = append(node.Children, NewTreeSessionResponse(post, &date.Sessions[i]))
+		}
 	}
+	return node
+}
 
-	result := make(map[string]interface{})
-	result["waypoints"] = path
-	trueResult := make([]map[string]interface{}, 0)
-	trueResult = append(trueResult, result)
+func NewTreePostResponse(post *model.TreePost, depth string) *TreePostResponse {
+	node := &TreePostResponse{
+		Id:       post.PostId.String(),
+		PostId:   post.PostId,
+		Name:     post.Name,
+		TimeZone: post.Location.String(),
+		Dates:    len(post.Dates),
+	}
+	for i := range post.Dates {
+		date := NewTreeDateResponse(post, &post.Dates[i], depth)
+		node.Sessions += date.Sessions
+		node.Points += date.Points
+		if depth != DepthPost {
+			node.Children = append(node.Children, date)
+		}
+	}
+	return node
+}
 
-	return trueResult
+func NewTreePostPage(page *model.TreePage, limit, offset int, depth string) *TreePostPage {
+	items := make([]*TreePostResponse, len(page.Posts))
+	for i := range page.Posts {
+		items[i] = NewTreePostResponse(&page.Posts[i], depth)
+	}
+	return &TreePostPage{Total: page.Total, Limit: limit, Offset: offset, Items: items}
+}
+
+// NewTreeDatePage pages the dates of post.
+func NewTreeDatePage(post *model.TreePost, limit, offset int, depth string) *TreeDatePage {
+	dates := pageBounds(len(post.Dates), limit, offset)
+	items := make([]*TreeDateResponse, 0, dates[1]-dates[0])
+	for i := dates[0]; i < dates[1]; i++ {
+		items = append(items, NewTreeDateResponse(post, &post.Dates[i], depth))
+	}
+	return &TreeDatePage{Total: len(post.Dates), Limit: limit, Offset: offset, Items: items}
+}
+
+// NewTreeSessionPage pages the sessions of date.
+func NewTreeSessionPage(post *model.TreePost, date *model.TreeDate, limit, offset int) *TreeSessionPage {
+	sessions := pageBounds(len(date.Sessions), limit, offset)
+	items := make([]*TreeSessionResponse, 0, sessions[1]-sessions[0])
+	for i := sessions[0]; i < sessions[1]; i++ {
+		items = append(items, NewTreeSessionResponse(post, &date.Sessions[i]))
+	}
+	return &TreeSessionPage{Total: len(date.Sessions), Limit: limit, Offset: offset, Items: items}
+}
+
+// pageBounds returns the index range of a page over n items.
+func pageBounds(n, limit, offset int) [2]int {
+	start := offset
+	if start > n {
+		start = n
+	}
+	end := start + limit
+	if end > n {
+		end = n
+	}
+	return [2]int{start, end}
 }
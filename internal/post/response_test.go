@@ -0,0 +1,73 @@
+package post
+
+import (
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"simpleServer/internal/post/model"
+	"testing"
+	"time"
+)
+
+func treePosts() []model.TreePost {
+	at := func(day, hour int) *time.Time {
+		t := time.Date(2024, 5, day, hour, 0, 0, 0, time.UTC)
+		return &t
+	}
+	first, second := uuid.Must(uuid.FromString("6f1c1f5e-3a4b-4c7d-9e2f-000000000001")),
+		uuid.Must(uuid.FromString("6f1c1f5e-3a4b-4c7d-9e2f-000000000002"))
+	return model.BuildTree([]model.TreeRow{
+		{PostId: first, PostName: "A", Start: at(1, 8), End: at(1, 9), Points: 10},
+		{PostId: first, PostName: "A", Start: at(1, 12), End: at(1, 13), Points: 4},
+		{PostId: first, PostName: "A", Start: at(3, 10), End: at(3, 11), Points: 5},
+		{PostId: second, PostName: "B", Start: at(2, 7), End: at(2, 8), Points: 3},
+	}, time.UTC)
+}
+
+func TestNewPostTreeResponse(t *testing.T) {
+	tree := NewPostTreeResponse(treePosts())
+	require.Len(t, tree.Content, 2)
+
+	// posts are numbered first, then every date, then every session time.
+	assert.Equal(t, []int{1, 2}, []int{tree.Content[0].Id, tree.Content[1].Id})
+	dates := tree.Content[0].Children[0].Content
+	require.Len(t, dates, 2)
+	assert.Equal(t, "1.May.2024", dates[0].Name)
+	assert.Equal(t, []int{3, 4, 5}, []int{dates[0].Id, dates[1].Id, tree.Content[1].Children[0].Content[0].Id})
+	times := dates[0].Children[0].Content
+	require.Len(t, times, 2)
+	assert.Equal(t, 6, times[0].Id)
+	assert.Equal(t, "12:00", times[1].Name)
+	assert.Equal(t, 1, times[1].RowNumber)
+	assert.Equal(t, 9, tree.Content[1].Children[0].Content[0].Children[0].Content[0].Id)
+}
+
+func TestNewTreePostPage(t *testing.T) {
+	posts := treePosts()
+	page := NewTreePostPage(&model.TreePage{Total: 7, Posts: posts}, 2, 0, DepthPost)
+	assert.Equal(t, 7, page.Total)
+	require.Len(t, page.Items, 2)
+	assert.Equal(t, posts[0].PostId.String(), page.Items[0].Id)
+	assert.Equal(t, 2, page.Items[0].Dates)
+	assert.Equal(t, 3, page.Items[0].Sessions)
+	assert.Equal(t, 19, page.Items[0].Points)
+	assert.Nil(t, page.Items[0].Children)
+
+	page = NewTreePostPage(&model.TreePage{Total: 2, Posts: posts}, 2, 0, DepthSession)
+	require.Len(t, page.Items[0].Children, 2)
+	assert.Equal(t, posts[0].PostId.String()+"/2024-05-01", page.Items[0].Children[0].Id)
+	require.Len(t, page.Items[0].Children[0].Children, 2)
+	session := page.Items[0].Children[0].Children[0]
+	assert.Equal(t, posts[0].PostId.String()+"/"+session.SessionId, session.Id)
+	assert.Equal(t, 3600.0, session.Duration)
+
+	dates := NewTreeDatePage(&posts[0], 1, 1, DepthDate)
+	assert.Equal(t, 2, dates.Total)
+	require.Len(t, dates.Items, 1)
+	assert.Equal(t, "2024-05-03", dates.Items[0].Date)
+	assert.Nil(t, dates.Items[0].Children)
+
+	sessions := NewTreeSessionPage(&posts[0], &posts[0].Dates[0], 10, 5)
+	assert.Equal(t, 2, sessions.Total)
+	assert.Empty(t, sessions.Items)
+}
@@ -0,0 +1,155 @@
+package ratelimit
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/gofrs/uuid"
+	"math"
+	"net/http"
+	authModel "simpleServer/internal/auth/model"
+	"simpleServer/internal/cache"
+	"simpleServer/internal/config"
+	"simpleServer/internal/middleware/handler"
+	"simpleServer/pkg/logging"
+	"simpleServer/pkg/metrics"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Limiter guards route groups against clients making too many requests or too many at once. Request
+// rates are counted on redis when the cache is, so they hold across instances, concurrency is counted
+// per instance.
+type Limiter struct {
+	enabled  bool
+	limits   config.RateLimit
+	groups   map[string]config.RateLimit
+	store    store
+	mu       sync.Mutex
+	inFlight map[string]*inFlight
+	now      func() time.Time
+}
+
+func NewLimiter(cfg *config.Config, provider cache.ICacheProvider) *Limiter {
+	l := &Limiter{
+		enabled:  cfg.RateLimitConfig.Enabled,
+		limits:   cfg.RateLimitConfig.Default,
+		groups:   cfg.RateLimitConfig.Groups,
+		inFlight: make(map[string]*inFlight),
+		now:      time.Now,
+	}
+	if redisProvider, ok := provider.(*cache.RedisCacheProvider); ok {
+		l.store = &redisStore{cli: redisProvider.Client(), prefix: cfg.CacheConfig.Prefix + "ratelimit:"}
+	} else {
+		logging.DefaultLogger().Infow("rate limits are kept per instance without redis")
+		l.store = newMemoryStore()
+	}
+	return l
+}
+
+func (l *Limiter) limit(group string) config.RateLimit {
+	if limit, ok := l.groups[group]; ok {
+		return limit
+	}
+	return l.limits
+}
+
+// inFlight counts the requests of a group being served, in total and per client.
+type inFlight struct {
+	mu      sync.Mutex
+	total   int
+	clients map[string]int
+}
+
+func (f *inFlight) acquire(client string, limit config.RateLimit) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if (limit.Concurrency > 0 && f.total >= limit.Concurrency) ||
+		(limit.ClientConcurrency > 0 && f.clients[client] >= limit.ClientConcurrency) {
+		return false
+	}
+	f.total++
+	f.clients[client]++
+	return true
+}
+
+func (f *inFlight) release(client string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.total--
+	if f.clients[client]--; f.clients[client] <= 0 {
+		delete(f.clients, client)
+	}
+}
+
+func (l *Limiter) groupInFlight(group string) *inFlight {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	f, ok := l.inFlight[group]
+	if !ok {
+		f = &inFlight{clients: make(map[string]int)}
+		l.inFlight[group] = f
+	}
+	return f
+}
+
+// clientKey tells the caller of a request apart, by API key, then by user, then by IP.
+func clientKey(c *gin.Context) string {
+	if claims := authModel.FromContext(c.Request.Context()); claims != nil {
+		if claims.ApiKeyId != nil {
+			return "key:" + claims.ApiKeyId.String()
+		}
+		if claims.UserId != uuid.Nil {
+			return "user:" + claims.UserId.String()
+		}
+	}
+	return "ip:" + c.ClientIP()
+}
+
+func tooManyRequests(c *gin.Context, retryAfter time.Duration, message string) {
+	c.Header("Retry-After", strconv.Itoa(int(math.Max(1, math.Ceil(retryAfter.Seconds())))))
+	c.AbortWithStatusJSON(http.StatusTooManyRequests, &handler.ErrorResponse{Code: handler.TooManyRequests, Message: message})
+}
+
+// Limit applies the limits of group to its routes. It goes after the authenticating middlewares, so
+// clients are told apart by key or user rather than by IP.
+func (l *Limiter) Limit(group string) gin.HandlerFunc {
+	limit := l.limit(group)
+	return func(c *gin.Context) {
+		if !l.enabled {
+			c.Next()
+			return
+		}
+		client := clientKey(c)
+		logger := logging.FromContext(c)
+		if limit.Rate > 0 && limit.Burst > 0 {
+			interval := time.Duration(float64(time.Second) / limit.Rate)
+			remaining, retryAfter, err := l.store.take(c.Request.Context(), group+":"+client, interval, limit.Burst, l.now())
+			switch {
+			case err != nil:
+				// a broken limiter must not take the api down with it.
+				logger.Errorw("rate limit check failed", "group", group, "err", err)
+			case retryAfter > 0:
+				logger.Infow("rate limit exceeded", "group", group, "client", client, "retryAfter", retryAfter)
+				metrics.Default().RateLimited.WithLabelValues(group, "rate").Inc()
+				c.Header("X-RateLimit-Limit", strconv.Itoa(limit.Burst))
+				c.Header("X-RateLimit-Remaining", "0")
+				tooManyRequests(c, retryAfter, "rate limit exceeded")
+				return
+			default:
+				c.Header("X-RateLimit-Limit", strconv.Itoa(limit.Burst))
+				c.Header("X-RateLimit-Remaining", strconv.Itoa(remaining))
+			}
+		}
+		if limit.Concurrency > 0 || limit.ClientConcurrency > 0 {
+			f := l.groupInFlight(group)
+			if !f.acquire(client, limit) {
+				logger.Infow("concurrency limit exceeded", "group", group, "client", client)
+				metrics.Default().RateLimited.WithLabelValues(group, "concurrency").Inc()
+				tooManyRequests(c, time.Second, "too many concurrent requests")
+				return
+			}
+			defer f.release(client)
+		}
+		c.Next()
+	}
+}
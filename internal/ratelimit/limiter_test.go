@@ -0,0 +1,124 @@
+package ratelimit
+
+import (
+	"context"
+	"github.com/gin-gonic/gin"
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"simpleServer/internal/auth/model"
+	"simpleServer/internal/config"
+	"testing"
+	"time"
+)
+
+func TestMemoryStoreTake(t *testing.T) {
+	s := newMemoryStore()
+	ctx := context.Background()
+	now := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	interval := 100 * time.Millisecond
+
+	for want := 2; want >= 0; want-- {
+		remaining, retryAfter, err := s.take(ctx, "a", interval, 3, now)
+		require.NoError(t, err)
+		assert.Equal(t, want, remaining)
+		assert.Zero(t, retryAfter)
+	}
+	_, retryAfter, err := s.take(ctx, "a", interval, 3, now)
+	require.NoError(t, err)
+	assert.Equal(t, interval, retryAfter, "the burst is spent")
+
+	remaining, retryAfter, _ := s.take(ctx, "b", interval, 3, now)
+	assert.Equal(t, 2, remaining, "clients have their own budget")
+	assert.Zero(t, retryAfter)
+
+	remaining, retryAfter, _ = s.take(ctx, "a", interval, 3, now.Add(interval))
+	assert.Equal(t, 0, remaining, "one request came back after an interval")
+	assert.Zero(t, retryAfter)
+
+	remaining, _, _ = s.take(ctx, "a", interval, 3, now.Add(time.Minute))
+	assert.Equal(t, 2, remaining, "idle clients get the whole burst back")
+}
+
+func testLimiter(limit config.RateLimit) *Limiter {
+	cfg := &config.Config{}
+	cfg.RateLimitConfig.Enabled = true
+	cfg.RateLimitConfig.Default = config.RateLimit{Rate: 100, Burst: 100}
+	cfg.RateLimitConfig.Groups = map[string]config.RateLimit{"heatmap": limit}
+	l := NewLimiter(cfg, nil)
+	now := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	l.now = func() time.Time { return now }
+	return l
+}
+
+func TestLimitRate(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	l := testLimiter(config.RateLimit{Rate: 0.5, Burst: 2})
+	userId := uuid.Must(uuid.NewV4())
+
+	r := gin.New()
+	r.GET("/heatmap", func(c *gin.Context) {
+		if c.GetHeader("X-User") != "" {
+			c.Request = c.Request.WithContext(model.WithClaims(c.Request.Context(), &model.Claims{UserId: userId, Role: model.RoleViewer}))
+		}
+	}, l.Limit("heatmap"), func(c *gin.Context) { c.Status(http.StatusNoContent) })
+	serve := func(user bool) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/heatmap", nil)
+		if user {
+			req.Header.Set("X-User", "1")
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	assert.Equal(t, http.StatusNoContent, serve(true).Code)
+	w := serve(true)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, "0", w.Header().Get("X-RateLimit-Remaining"))
+	w = serve(true)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "2", w.Header().Get("Retry-After"))
+	assert.Equal(t, http.StatusNoContent, serve(false).Code, "anonymous callers are limited by ip")
+}
+
+func TestLimitConcurrency(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	l := testLimiter(config.RateLimit{Concurrency: 2, ClientConcurrency: 1})
+	release := make(chan struct{})
+	entered := make(chan struct{})
+
+	r := gin.New()
+	r.GET("/heatmap", l.Limit("heatmap"), func(c *gin.Context) {
+		if c.Query("hold") != "" {
+			entered <- struct{}{}
+			<-release
+		}
+		c.Status(http.StatusNoContent)
+	})
+	serve := func(ip, query string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/heatmap"+query, nil)
+		req.RemoteAddr = ip + ":1234"
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	done := make(chan int, 2)
+	go func() { done <- serve("10.0.0.1", "?hold=1").Code }()
+	<-entered
+	w := serve("10.0.0.1", "")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code, "one request per client")
+	assert.Equal(t, "1", w.Header().Get("Retry-After"))
+
+	go func() { done <- serve("10.0.0.2", "?hold=1").Code }()
+	<-entered
+	assert.Equal(t, http.StatusTooManyRequests, serve("10.0.0.3", "").Code, "two requests in total")
+
+	close(release)
+	assert.Equal(t, http.StatusNoContent, <-done)
+	assert.Equal(t, http.StatusNoContent, <-done)
+	assert.Equal(t, http.StatusNoContent, serve("10.0.0.3", "").Code)
+}
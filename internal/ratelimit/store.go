@@ -0,0 +1,87 @@
+package ratelimit
+
+import (
+	"context"
+	"github.com/go-redis/redis/v8"
+	"math"
+	"sync"
+	"time"
+)
+
+// store keeps the budgets of the clients with the generic cell rate algorithm: a client is allowed a
+// request when its theoretical arrival time, pushed back by every request, is at most Burst intervals
+// ahead of now.
+type store interface {
+	// take spends one request of key, it returns how many are left or else how long to wait for the next one.
+	take(ctx context.Context, key string, interval time.Duration, burst int, now time.Time) (remaining int, retryAfter time.Duration, err error)
+}
+
+// gcraScript runs the algorithm on redis so the instances share the budgets, times are in milliseconds.
+var gcraScript = redis.NewScript(`
+local now = tonumber(ARGV[1])
+local interval = tonumber(ARGV[2])
+local burst = tonumber(ARGV[3])
+local tat = tonumber(redis.call('get', KEYS[1]) or now)
+if tat < now then tat = now end
+local next_tat = tat + interval
+local allow_at = next_tat - burst * interval
+if allow_at > now then
+	return {0, math.ceil(allow_at - now)}
+end
+redis.call('set', KEYS[1], tostring(next_tat), 'PX', math.ceil(next_tat - now))
+return {math.floor((now - allow_at) / interval), 0}
+`)
+
+type redisStore struct {
+	cli    redis.UniversalClient
+	prefix string
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+func (s *redisStore) take(ctx context.Context, key string, interval time.Duration, burst int, now time.Time) (int, time.Duration, error) {
+	res, err := gcraScript.Run(ctx, s.cli, []string{s.prefix + key},
+		float64(now.UnixMicro())/1000, milliseconds(interval), burst).Int64Slice()
+	if err != nil {
+		return 0, 0, err
+	}
+	return int(res[0]), time.Duration(res[1]) * time.Millisecond, nil
+}
+
+// memoryStore keeps the budgets of this instance only, for setups without redis.
+type memoryStore struct {
+	mu  sync.Mutex
+	tat map[string]time.Time
+}
+
+// sweepSize is the number of clients above which idle ones are dropped.
+const sweepSize = 10000
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{tat: make(map[string]time.Time)}
+}
+
+func (s *memoryStore) take(_ context.Context, key string, interval time.Duration, burst int, now time.Time) (int, time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.tat) > sweepSize {
+		for k, tat := range s.tat {
+			if tat.Before(now) {
+				delete(s.tat, k)
+			}
+		}
+	}
+	tat, ok := s.tat[key]
+	if !ok || tat.Before(now) {
+		tat = now
+	}
+	next := tat.Add(interval)
+	allowAt := next.Add(-time.Duration(burst) * interval)
+	if allowAt.After(now) {
+		return 0, allowAt.Sub(now), nil
+	}
+	s.tat[key] = next
+	return int(math.Floor(float64(now.Sub(allowAt)) / float64(interval))), 0, nil
+}
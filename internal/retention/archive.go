@@ -0,0 +1,101 @@
+package retention
+
+import (
+	"compress/gzip"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// archivePath is the file the part-th archive of the samples of day goes to. Parts after the first hold
+// samples that arrived after the day was archived.
+func archivePath(dir string, day time.Time, part int) string {
+	name := "gsmhistory-" + day.Format("2006-01-02")
+	if part > 1 {
+		name += fmt.Sprintf(".part%d", part)
+	}
+	return filepath.Join(dir, name+".csv.gz")
+}
+
+// writeArchive writes the rows produced by fill to a gzipped csv file of day in dir and returns its path,
+// empty when there were no rows. The file only appears under its final name once it is complete and
+// synced, so a crash never leaves a truncated archive, and it never replaces an earlier archive of the day.
+func writeArchive(dir string, day time.Time, columns []string, fill func(write func(row []interface{}) error) (int64, error)) (string, int64, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", 0, err
+	}
+	tmp, err := os.CreateTemp(dir, filepath.Base(archivePath(dir, day, 1))+".*.tmp")
+	if err != nil {
+		return "", 0, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	gz := gzip.NewWriter(tmp)
+	w := csv.NewWriter(gz)
+	if err := w.Write(columns); err != nil {
+		return "", 0, err
+	}
+	record := make([]string, len(columns))
+	count, err := fill(func(row []interface{}) error {
+		for i := range record {
+			record[i] = ""
+			if i < len(row) {
+				record[i] = formatValue(row[i])
+			}
+		}
+		return w.Write(record)
+	})
+	if err != nil || count == 0 {
+		// nothing was measured that day, an archive holding the header only is noise.
+		return "", count, err
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return "", count, err
+	}
+	if err := gz.Close(); err != nil {
+		return "", count, err
+	}
+	if err := tmp.Sync(); err != nil {
+		return "", count, err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", count, err
+	}
+	// linking fails rather than replacing an existing part, the temporary name is removed either way.
+	for part := 1; ; part++ {
+		path := archivePath(dir, day, part)
+		err := os.Link(tmp.Name(), path)
+		if err == nil {
+			return path, count, nil
+		}
+		if !errors.Is(err, fs.ErrExist) {
+			return "", count, err
+		}
+	}
+}
+
+func formatValue(v interface{}) string {
+	switch value := v.(type) {
+	case nil:
+		return ""
+	case time.Time:
+		return value.UTC().Format(time.RFC3339Nano)
+	case []byte:
+		return string(value)
+	case float32:
+		return strconv.FormatFloat(float64(value), 'f', -1, 32)
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	case fmt.Stringer:
+		return value.String()
+	default:
+		return fmt.Sprint(value)
+	}
+}
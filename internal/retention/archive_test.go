@@ -0,0 +1,74 @@
+package retention
+
+import (
+	"compress/gzip"
+	"encoding/csv"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func readArchive(t *testing.T, path string) [][]string {
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	require.NoError(t, err)
+	records, err := csv.NewReader(gz).ReadAll()
+	require.NoError(t, err)
+	return records
+}
+
+func TestWriteArchive(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "archive")
+	day := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+
+	path, count, err := writeArchive(dir, day, []string{"id", "time", "dbm", "rsrp"}, func(write func(row []interface{}) error) (int64, error) {
+		if err := write([]interface{}{"a", day.Add(time.Hour), int64(-71), nil}); err != nil {
+			return 0, err
+		}
+		return 2, write([]interface{}{[]byte("b"), day, int64(-90), float32(-101.5)})
+	})
+	require.NoError(t, err)
+	assert.EqualValues(t, 2, count)
+	assert.Equal(t, "gsmhistory-2024-05-01.csv.gz", filepath.Base(path))
+	assert.Equal(t, [][]string{
+		{"id", "time", "dbm", "rsrp"},
+		{"a", "2024-05-01T01:00:00Z", "-71", ""},
+		{"b", "2024-05-01T00:00:00Z", "-90", "-101.5"},
+	}, readArchive(t, path))
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1, "temporary file is removed")
+}
+
+func TestWriteArchiveTwiceKeepsBothParts(t *testing.T) {
+	dir := t.TempDir()
+	day := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	rows := func(id string) func(write func(row []interface{}) error) (int64, error) {
+		return func(write func(row []interface{}) error) (int64, error) {
+			return 1, write([]interface{}{id})
+		}
+	}
+
+	first, _, err := writeArchive(dir, day, []string{"id"}, rows("a"))
+	require.NoError(t, err)
+	// samples that arrive late for the day go to a new part, the first archive stays as it was.
+	second, _, err := writeArchive(dir, day, []string{"id"}, rows("late"))
+	require.NoError(t, err)
+	assert.Equal(t, "gsmhistory-2024-05-01.part2.csv.gz", filepath.Base(second))
+	assert.Equal(t, [][]string{{"id"}, {"a"}}, readArchive(t, first))
+	assert.Equal(t, [][]string{{"id"}, {"late"}}, readArchive(t, second))
+
+	empty, count, err := writeArchive(dir, day, []string{"id"}, func(func(row []interface{}) error) (int64, error) { return 0, nil })
+	require.NoError(t, err)
+	assert.Empty(t, empty)
+	assert.Zero(t, count)
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 2)
+}
@@ -0,0 +1,242 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"simpleServer/dbutils"
+	heatmapModel "simpleServer/internal/heatmap/model"
+	"simpleServer/internal/retention/model"
+	"simpleServer/pkg/logging"
+	"strings"
+	"time"
+)
+
+type RetentionDB interface {
+	GetState(ctx context.Context) (*model.RollupState, error)
+
+	// FirstDay returns the day of the oldest GPS fix with samples, nil when there are none.
+	FirstDay(ctx context.Context) (*time.Time, error)
+
+	// RollUpDay replaces the rollups of day and moves the watermark past it.
+	RollUpDay(ctx context.Context, day time.Time, grid float64) (int64, error)
+
+	// MergePending adds the samples ingested for days already rolled up to their rollups.
+	MergePending(ctx context.Context, grid float64) (int64, error)
+
+	// OldestRawDay returns the day of the oldest raw sample, nil when there are none.
+	OldestRawDay(ctx context.Context) (*time.Time, error)
+
+	// EachRawSample calls f with every raw sample of day, in the order of ArchiveColumns.
+	EachRawSample(ctx context.Context, day time.Time, f func(row []interface{}) error) (int64, error)
+
+	PurgeDay(ctx context.Context, day time.Time) (int64, error)
+
+	RunExclusive(ctx context.Context, f func(ctx context.Context) error) (bool, error)
+}
+
+// ArchiveColumns are written to archives, with the GPS fix of each sample so archives stand on their own.
+var ArchiveColumns = []string{"id", "gsm", "gps", "time", "dbm", "rsrp", "rsrq", "sinr", "rscp", "ecio", "timing_advance",
+	"post_id", "gps_time", "lng", "lat"}
+
+type retentionDB struct {
+	dbh *sqlx.DB
+}
+
+func NewRetentionDB(dbh *sqlx.DB) RetentionDB {
+	return &retentionDB{dbh: dbh}
+}
+
+// retentionLockKey is the advisory lock held while rolling up and purging.
+const retentionLockKey = 0x726f6c6c
+
+func (r *retentionDB) GetState(ctx context.Context) (*model.RollupState, error) {
+	var state model.RollupState
+	err := dbutils.Get(ctx, r.dbh, &state, `select rolled_until, grid from "RollupState"`)
+	if errors.Is(err, sql.ErrNoRows) {
+		return &model.RollupState{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+func (r *retentionDB) day(ctx context.Context, query string) (*time.Time, error) {
+	var day *time.Time
+	if err := dbutils.Get(ctx, r.dbh, &day, query); err != nil {
+		return nil, err
+	}
+	return day, nil
+}
+
+func (r *retentionDB) FirstDay(ctx context.Context) (*time.Time, error) {
+	return r.day(ctx, `select cast(min(time) at time zone 'UTC' as date) from "GpsData"`)
+}
+
+func (r *retentionDB) OldestRawDay(ctx context.Context) (*time.Time, error) {
+	return r.day(ctx, `select cast(min(GPS.time) at time zone 'UTC' as date)
+		from "GsmHistory" GH inner join "GpsData" GPS on GPS.id = GH.gps`)
+}
+
+// rollupColumns returns the columns of "SignalRollups" and the aggregations of GH and GPS filling them,
+// day and grid are sql expressions.
+func rollupColumns(day, grid string) (columns, values []string) {
+	columns = []string{"day", "gsm", "cell", "samples"}
+	values = []string{day, "GH.gsm", fmt.Sprintf("st_setsrid(st_snaptogrid(GPS.coordinates, %s), 4326)", grid), "count(*)"}
+	seen := make(map[string]bool)
+	for _, m := range heatmapModel.Metrics() {
+		if seen[m.Column] {
+			continue
+		}
+		seen[m.Column] = true
+		columns = append(columns, m.Column+"_sum", m.Column+"_count", m.Column+"_min", m.Column+"_max")
+		values = append(values,
+			fmt.Sprintf("sum(GH.%s)", m.Column), fmt.Sprintf("count(GH.%s)", m.Column),
+			fmt.Sprintf("min(GH.%s)", m.Column), fmt.Sprintf("max(GH.%s)", m.Column))
+	}
+	return columns, values
+}
+
+// rollupQuery sums every heatmap metric of the day per cell and grid square.
+func rollupQuery() string {
+	columns, values := rollupColumns("$1", "$2")
+	return fmt.Sprintf(`insert into "SignalRollups" (%s)
+		select %s
+		from "GsmHistory" GH
+		inner join "GpsData" GPS on GPS.id = GH.gps
+		where GPS.time >= $3 and GPS.time < $4
+		group by GH.gsm, st_snaptogrid(GPS.coordinates, $2)`, strings.Join(columns, ", "), strings.Join(values, ", "))
+}
+
+// mergePendingQuery takes the pending samples out of "RollupPending" and adds them to the rollups of their day,
+// the raw samples of the day may already be purged so existing rollups are combined rather than replaced.
+func mergePendingQuery() string {
+	columns, values := rollupColumns("P.day", "$1")
+	updates := []string{`samples = R.samples + excluded.samples`}
+	for _, column := range columns[4:] {
+		switch {
+		case strings.HasSuffix(column, "_sum"):
+			updates = append(updates, fmt.Sprintf("%[1]s = coalesce(R.%[1]s + excluded.%[1]s, R.%[1]s, excluded.%[1]s)", column))
+		case strings.HasSuffix(column, "_count"):
+			updates = append(updates, fmt.Sprintf("%[1]s = R.%[1]s + excluded.%[1]s", column))
+		case strings.HasSuffix(column, "_min"):
+			updates = append(updates, fmt.Sprintf("%[1]s = least(R.%[1]s, excluded.%[1]s)", column))
+		default:
+			updates = append(updates, fmt.Sprintf("%[1]s = greatest(R.%[1]s, excluded.%[1]s)", column))
+		}
+	}
+	return fmt.Sprintf(`with P as (
+			delete from "RollupPending" returning sample, day
+		)
+		insert into "SignalRollups" as R (%s)
+		select %s
+		from P
+		inner join "GsmHistory" GH on GH.id = P.sample
+		inner join "GpsData" GPS on GPS.id = GH.gps
+		group by P.day, GH.gsm, st_snaptogrid(GPS.coordinates, $1)
+		on conflict (day, gsm, cell) do update set %s`,
+		strings.Join(columns, ", "), strings.Join(values, ", "), strings.Join(updates, ", "))
+}
+
+func (r *retentionDB) RollUpDay(ctx context.Context, day time.Time, grid float64) (int64, error) {
+	logger := logging.FromContext(ctx)
+	logger.Debugw("retention roll up day", "day", day.Format("2006-01-02"))
+
+	var rows int64
+	err := dbutils.RunTx(ctx, r.dbh, func(tx *sqlx.Tx) error {
+		// moving the watermark first locks the state, ingestion waits for it so the samples of day committed
+		// meanwhile are marked pending rather than missed by the rollup.
+		query := `insert into "RollupState" (rolled_until, grid) values ($1, $2)
+			on conflict (id) do update set rolled_until = greatest("RollupState".rolled_until, excluded.rolled_until)`
+		if _, err := dbutils.Exec(ctx, tx, query, day.AddDate(0, 0, 1), grid); err != nil {
+			return err
+		}
+		if _, err := dbutils.Exec(ctx, tx, `delete from "SignalRollups" where day = $1`, day); err != nil {
+			return err
+		}
+		res, err := dbutils.Exec(ctx, tx, rollupQuery(), day, grid, day, day.AddDate(0, 0, 1))
+		if err != nil {
+			return err
+		}
+		rows, err = res.RowsAffected()
+		return err
+	})
+	return rows, err
+}
+
+func (r *retentionDB) MergePending(ctx context.Context, grid float64) (int64, error) {
+	logger := logging.FromContext(ctx)
+	logger.Debugw("retention merge pending samples")
+
+	var rows int64
+	err := dbutils.RunTx(ctx, r.dbh, func(tx *sqlx.Tx) error {
+		if _, err := dbutils.Exec(ctx, tx, `select 1 from "RollupState" for update`); err != nil {
+			return err
+		}
+		res, err := dbutils.Exec(ctx, tx, mergePendingQuery(), grid)
+		if err != nil {
+			return err
+		}
+		rows, err = res.RowsAffected()
+		return err
+	})
+	return rows, err
+}
+
+func (r *retentionDB) EachRawSample(ctx context.Context, day time.Time, f func(row []interface{}) error) (int64, error) {
+	query := `select GH.id, GH.gsm, GH.gps, GH.time, GH.dbm, GH.rsrp, GH.rsrq, GH.sinr, GH.rscp, GH.ecio, GH.timing_advance,
+			GPS.post_id, GPS.time as gps_time, st_x(GPS.coordinates) as lng, st_y(GPS.coordinates) as lat
+		from "GsmHistory" GH
+		inner join "GpsData" GPS on GPS.id = GH.gps
+		where GPS.time >= $1 and GPS.time < $2
+		order by GPS.time`
+	rows, err := r.dbh.QueryxContext(ctx, query, day, day.AddDate(0, 0, 1))
+	if err != nil {
+		return 0, fmt.Errorf("query samples of %s: %w", day.Format("2006-01-02"), err)
+	}
+	defer rows.Close()
+
+	var count int64
+	for rows.Next() {
+		row, err := rows.SliceScan()
+		if err != nil {
+			return count, err
+		}
+		if err := f(row); err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, rows.Err()
+}
+
+func (r *retentionDB) PurgeDay(ctx context.Context, day time.Time) (int64, error) {
+	logger := logging.FromContext(ctx)
+	logger.Debugw("retention purge day", "day", day.Format("2006-01-02"))
+
+	var purged int64
+	err := dbutils.RunTx(ctx, r.dbh, func(tx *sqlx.Tx) error {
+		// pending samples are only purged once merged into the rollups.
+		query := `delete from "GsmHistory" GH using "GpsData" GPS
+			where GPS.id = GH.gps and GPS.time >= $1 and GPS.time < $2
+			and not exists (select 1 from "RollupPending" P where P.sample = GH.id)`
+		res, err := dbutils.Exec(ctx, tx, query, day, day.AddDate(0, 0, 1))
+		if err != nil {
+			return err
+		}
+		if purged, err = res.RowsAffected(); err != nil {
+			return err
+		}
+		// idempotency keys only matter for batches retried shortly after ingestion.
+		_, err = dbutils.Exec(ctx, tx, `delete from "IngestKeys" where created_at < $1`, day.AddDate(0, 0, 1))
+		return err
+	})
+	return purged, err
+}
+
+func (r *retentionDB) RunExclusive(ctx context.Context, f func(ctx context.Context) error) (bool, error) {
+	return dbutils.WithAdvisoryLock(ctx, r.dbh, retentionLockKey, f)
+}
@@ -0,0 +1,18 @@
+package model
+
+import "time"
+
+// RollupState tells which days are rolled up. RolledUntil is nil before the first rollup.
+type RollupState struct {
+	RolledUntil *time.Time `db:"rolled_until"`
+	Grid        float64    `db:"grid"`
+}
+
+type RunResult struct {
+	RolledDays      int   `json:"rolledDays"`
+	RollupRows      int64 `json:"rollupRows"`
+	PurgedDays      int   `json:"purgedDays"`
+	PurgedSamples   int64 `json:"purgedSamples"`
+	ArchivedFiles   int   `json:"archivedFiles"`
+	ArchivedRecords int64 `json:"archivedRecords"`
+}
@@ -0,0 +1,138 @@
+package retention
+
+import (
+	"context"
+	"fmt"
+	"go.uber.org/fx"
+	"simpleServer/internal/config"
+	"simpleServer/internal/retention/database"
+	"simpleServer/internal/retention/model"
+	"simpleServer/pkg/logging"
+	"simpleServer/pkg/periodic"
+	"time"
+)
+
+var ErrAlreadyRunning = fmt.Errorf("retention is %w", periodic.ErrAlreadyRunning)
+
+const day = 24 * time.Hour
+
+// Service rolls raw samples up into daily summaries and purges raw samples past their age.
+type Service struct {
+	retentionDB database.RetentionDB
+	cfg         config.RetentionConfig
+	now         func() time.Time
+}
+
+func NewService(lc fx.Lifecycle, cfg *config.Config, db database.RetentionDB) *Service {
+	service := &Service{retentionDB: db, cfg: cfg.RetentionConfig, now: time.Now}
+	if !service.cfg.Enabled || service.cfg.Interval <= 0 {
+		return service
+	}
+
+	periodic.Start(lc, "retention", service.cfg.Interval, func(ctx context.Context) error {
+		result, err := service.Run(ctx)
+		if err == nil {
+			logging.DefaultLogger().Infow("retention done", "rolledDays", result.RolledDays, "purgedDays", result.PurgedDays,
+				"purgedSamples", result.PurgedSamples, "archivedFiles", result.ArchivedFiles)
+		}
+		return err
+	})
+	return service
+}
+
+// Run rolls up every finished day not rolled up yet and merges samples ingested late for rolled up days,
+// then purges raw samples older than the raw age. Days are UTC days; only rolled up samples are ever purged.
+func (s *Service) Run(ctx context.Context) (*model.RunResult, error) {
+	result := &model.RunResult{}
+	acquired, err := s.retentionDB.RunExclusive(ctx, func(ctx context.Context) error {
+		today := s.now().UTC().Truncate(day)
+		watermark, err := s.rollUp(ctx, today, result)
+		if err != nil || watermark == nil || s.cfg.RawAge <= 0 {
+			return err
+		}
+
+		limit := today.Add(-s.cfg.RawAge).Truncate(day)
+		if watermark.Before(limit) {
+			limit = *watermark
+		}
+		return s.purge(ctx, limit, result)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !acquired {
+		return nil, ErrAlreadyRunning
+	}
+	return result, nil
+}
+
+// rollUp summarises the days from the watermark to today and the pending samples of earlier days,
+// and returns the new watermark.
+func (s *Service) rollUp(ctx context.Context, today time.Time, result *model.RunResult) (*time.Time, error) {
+	logger := logging.FromContext(ctx)
+	state, err := s.retentionDB.GetState(ctx)
+	if err != nil {
+		return nil, err
+	}
+	grid := s.cfg.RollupGrid
+	start := state.RolledUntil
+	if start != nil {
+		if state.Grid != grid {
+			logger.Warnw("retention keeps the grid of existing rollups", "grid", state.Grid, "configured", grid)
+		}
+		grid = state.Grid
+	} else if start, err = s.retentionDB.FirstDay(ctx); err != nil || start == nil {
+		return nil, err
+	}
+
+	current := start.UTC()
+	for ; current.Before(today); current = current.AddDate(0, 0, 1) {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		rows, err := s.retentionDB.RollUpDay(ctx, current, grid)
+		if err != nil {
+			return nil, err
+		}
+		result.RolledDays++
+		result.RollupRows += rows
+	}
+	rows, err := s.retentionDB.MergePending(ctx, grid)
+	if err != nil {
+		return nil, err
+	}
+	result.RollupRows += rows
+	return &current, nil
+}
+
+func (s *Service) purge(ctx context.Context, limit time.Time, result *model.RunResult) error {
+	oldest, err := s.retentionDB.OldestRawDay(ctx)
+	if err != nil || oldest == nil {
+		return err
+	}
+	for current := oldest.UTC(); current.Before(limit); current = current.AddDate(0, 0, 1) {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if s.cfg.ArchiveDir != "" {
+			path, archived, err := writeArchive(s.cfg.ArchiveDir, current, database.ArchiveColumns,
+				func(write func(row []interface{}) error) (int64, error) {
+					return s.retentionDB.EachRawSample(ctx, current, write)
+				})
+			if err != nil {
+				return err
+			}
+			if path != "" {
+				result.ArchivedFiles++
+				result.ArchivedRecords += archived
+			}
+		}
+		purged, err := s.retentionDB.PurgeDay(ctx, current)
+		if err != nil {
+			return err
+		}
+		result.PurgedDays++
+		result.PurgedSamples += purged
+	}
+	return nil
+}
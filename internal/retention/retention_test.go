@@ -0,0 +1,65 @@
+package retention
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"simpleServer/internal/config"
+	"simpleServer/internal/retention/model"
+	"testing"
+	"time"
+)
+
+// fakeRetentionDB records the calls of a run.
+type fakeRetentionDB struct {
+	state *model.RollupState
+	calls []string
+}
+
+func (f *fakeRetentionDB) GetState(context.Context) (*model.RollupState, error) { return f.state, nil }
+
+func (f *fakeRetentionDB) FirstDay(context.Context) (*time.Time, error) { return nil, nil }
+
+func (f *fakeRetentionDB) RollUpDay(_ context.Context, day time.Time, _ float64) (int64, error) {
+	f.calls = append(f.calls, "roll "+day.Format("2006-01-02"))
+	return 1, nil
+}
+
+func (f *fakeRetentionDB) MergePending(context.Context, float64) (int64, error) {
+	f.calls = append(f.calls, "merge")
+	return 2, nil
+}
+
+func (f *fakeRetentionDB) OldestRawDay(context.Context) (*time.Time, error) {
+	oldest := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	return &oldest, nil
+}
+
+func (f *fakeRetentionDB) EachRawSample(context.Context, time.Time, func(row []interface{}) error) (int64, error) {
+	return 0, nil
+}
+
+func (f *fakeRetentionDB) PurgeDay(_ context.Context, day time.Time) (int64, error) {
+	f.calls = append(f.calls, "purge "+day.Format("2006-01-02"))
+	return 1, nil
+}
+
+func (f *fakeRetentionDB) RunExclusive(ctx context.Context, run func(ctx context.Context) error) (bool, error) {
+	return true, run(ctx)
+}
+
+func TestRunMergesPendingBeforePurge(t *testing.T) {
+	watermark := time.Date(2024, 5, 3, 0, 0, 0, 0, time.UTC)
+	db := &fakeRetentionDB{state: &model.RollupState{RolledUntil: &watermark, Grid: 0.001}}
+	service := &Service{
+		retentionDB: db,
+		cfg:         config.RetentionConfig{RawAge: 2 * day, RollupGrid: 0.001},
+		now:         func() time.Time { return time.Date(2024, 5, 4, 12, 0, 0, 0, time.UTC) },
+	}
+
+	result, err := service.Run(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"roll 2024-05-03", "merge", "purge 2024-05-01"}, db.calls)
+	assert.Equal(t, 1, result.RolledDays)
+	assert.EqualValues(t, 3, result.RollupRows)
+}
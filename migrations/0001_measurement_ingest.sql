@@ -0,0 +1,25 @@
+-- Cell identity columns used to resolve scans to "GsmData" rows.
+alter table "GsmData"
+    add column if not exists cid         integer,
+    add column if not exists lac_tac     integer,
+    add column if not exists operator_id uuid;
+
+create index if not exists "GsmData_cell_idx" on "GsmData" (arfcn, cid, lac_tac, operator_id);
+
+alter table "GsmHistory"
+    add column if not exists time timestamptz;
+
+create index if not exists "GsmHistory_gps_idx" on "GsmHistory" (gps);
+create index if not exists "GsmHistory_gsm_idx" on "GsmHistory" (gsm);
+create index if not exists "GpsData_post_time_idx" on "GpsData" (post_id, time);
+
+-- Client supplied keys of already ingested records, used to deduplicate retried batches.
+create table if not exists "IngestKeys"
+(
+    post_id    uuid        not null,
+    kind       text        not null,
+    key        text        not null,
+    record_id  uuid        not null,
+    created_at timestamptz not null default now(),
+    primary key (post_id, kind, key)
+);
@@ -0,0 +1,8 @@
+-- Technology specific metrics of a sample, "dbm" stays the generic received level.
+alter table "GsmHistory"
+    add column if not exists rsrp           real,
+    add column if not exists rsrq           real,
+    add column if not exists sinr           real,
+    add column if not exists rscp           real,
+    add column if not exists ecio           real,
+    add column if not exists timing_advance smallint;
@@ -0,0 +1,19 @@
+-- Estimated locations of cells heard in measurements but missing in "BsInfo", waiting for an analyst.
+create table if not exists "CellCandidates"
+(
+    id          uuid primary key,
+    gsm         uuid                  not null references "GsmData" (id),
+    method      text                  not null,
+    coordinates geometry(Point, 4326) not null,
+    azimuth     real,
+    spread      real                  not null,
+    samples     integer               not null,
+    status      text                  not null default 'pending',
+    bs          bigint,
+    comment     text,
+    created_at  timestamptz           not null default now(),
+    updated_at  timestamptz           not null default now()
+);
+
+create unique index if not exists "CellCandidates_pending_gsm_idx" on "CellCandidates" (gsm) where status = 'pending';
+create index if not exists "CellCandidates_status_idx" on "CellCandidates" (status, created_at);
@@ -0,0 +1,21 @@
+-- Suspicious cells found by the rogue base station detector, one row per rule and cell.
+create table if not exists "Alerts"
+(
+    id          uuid primary key,
+    rule        text                  not null,
+    gsm         uuid                  not null references "GsmData" (id),
+    post_id     uuid,
+    score       real                  not null,
+    evidence    jsonb                 not null,
+    coordinates geometry(Point, 4326) not null,
+    first_seen  timestamptz           not null,
+    last_seen   timestamptz           not null,
+    status      text                  not null default 'open',
+    comment     text,
+    created_at  timestamptz           not null default now(),
+    updated_at  timestamptz           not null default now(),
+    unique (rule, gsm)
+);
+
+create index if not exists "Alerts_status_idx" on "Alerts" (status, score desc);
+create index if not exists "GpsData_time_idx" on "GpsData" (time);
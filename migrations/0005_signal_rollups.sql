@@ -0,0 +1,48 @@
+-- Daily summaries of "GsmHistory" per cell and grid square. Every metric keeps sum, count, min and max,
+-- so averages can be combined across days and with raw samples.
+create table if not exists "SignalRollups"
+(
+    day           date                  not null,
+    gsm           uuid                  not null,
+    cell          geometry(Point, 4326) not null,
+    samples       integer               not null,
+    dbm_sum       float8,
+    dbm_count     integer               not null default 0,
+    dbm_min       real,
+    dbm_max       real,
+    rsrp_sum      float8,
+    rsrp_count    integer               not null default 0,
+    rsrp_min      real,
+    rsrp_max      real,
+    rsrq_sum      float8,
+    rsrq_count    integer               not null default 0,
+    rsrq_min      real,
+    rsrq_max      real,
+    sinr_sum      float8,
+    sinr_count    integer               not null default 0,
+    sinr_min      real,
+    sinr_max      real,
+    rscp_sum      float8,
+    rscp_count    integer               not null default 0,
+    rscp_min      real,
+    rscp_max      real,
+    ecio_sum      float8,
+    ecio_count    integer               not null default 0,
+    ecio_min      real,
+    ecio_max      real,
+    timing_advance_sum   float8,
+    timing_advance_count integer        not null default 0,
+    timing_advance_min   real,
+    timing_advance_max   real,
+    primary key (day, gsm, cell)
+);
+
+create index if not exists "SignalRollups_cell_idx" on "SignalRollups" using gist (cell);
+
+-- Every day before rolled_until is summarised in "SignalRollups" on a grid of grid degrees.
+create table if not exists "RollupState"
+(
+    id           boolean primary key default true check (id),
+    rolled_until date   not null,
+    grid         float8 not null
+);
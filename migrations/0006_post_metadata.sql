@@ -0,0 +1,17 @@
+-- Fleet management fields of posts.
+alter table "Post"
+    add column if not exists kind             text        not null default 'vehicle',
+    add column if not exists equipment_serial text,
+    add column if not exists owner            text,
+    add column if not exists description      text,
+    add column if not exists retired_at       timestamptz,
+    add column if not exists created_at       timestamptz not null default now(),
+    add column if not exists updated_at       timestamptz not null default now();
+
+-- Operators of the SIM cards installed in a post.
+create table if not exists "PostOperators"
+(
+    post_id     uuid not null references "Post" (id) on delete cascade,
+    operator_id uuid not null references "Operators" (id),
+    primary key (post_id, operator_id)
+);
@@ -0,0 +1,53 @@
+-- Zones posts are assigned to or must stay out of.
+create table if not exists "Geofences"
+(
+    id          uuid primary key,
+    name        text                         not null,
+    kind        text                         not null,
+    area        geometry(MultiPolygon, 4326) not null,
+    -- dwell_limit is how long in seconds a post may stay inside before a dwell event, null never fires.
+    dwell_limit integer,
+    active      boolean                      not null default true,
+    created_at  timestamptz                  not null default now(),
+    updated_at  timestamptz                  not null default now()
+);
+
+create index if not exists "Geofences_area_idx" on "Geofences" using gist (area);
+
+-- Posts a geofence applies to, a geofence without rows applies to every post.
+create table if not exists "GeofencePosts"
+(
+    geofence_id uuid not null references "Geofences" (id) on delete cascade,
+    post_id     uuid not null references "Post" (id) on delete cascade,
+    primary key (geofence_id, post_id)
+);
+
+-- Whether a post was inside a geofence at its last evaluated fix.
+create table if not exists "GeofenceStates"
+(
+    geofence_id    uuid        not null references "Geofences" (id) on delete cascade,
+    post_id        uuid        not null references "Post" (id) on delete cascade,
+    inside         boolean     not null,
+    since          timestamptz not null,
+    dwell_notified boolean     not null default false,
+    last_time      timestamptz not null,
+    primary key (geofence_id, post_id)
+);
+
+-- Geofence and silence events of posts.
+create table if not exists "PostEvents"
+(
+    id              uuid primary key,
+    post_id         uuid                  not null references "Post" (id) on delete cascade,
+    geofence_id     uuid                  references "Geofences" (id) on delete set null,
+    type            text                  not null,
+    time            timestamptz           not null,
+    coordinates     geometry(Point, 4326),
+    alarm           boolean               not null default false,
+    details         jsonb                 not null default '{}',
+    acknowledged_at timestamptz,
+    created_at      timestamptz           not null default now()
+);
+
+create index if not exists "PostEvents_created_idx" on "PostEvents" (created_at);
+create index if not exists "PostEvents_post_idx" on "PostEvents" (post_id, type, time);
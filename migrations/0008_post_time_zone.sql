@@ -0,0 +1,3 @@
+-- IANA time zone the days of a post are counted in.
+alter table "Post"
+    add column if not exists time_zone text not null default 'UTC';
@@ -0,0 +1,28 @@
+-- Drive test campaigns: posts measuring a region for a customer over a date range.
+create table if not exists "Campaigns"
+(
+    id          uuid primary key,
+    name        text                         not null,
+    customer    text                         not null default '',
+    description text                         not null default '',
+    area        geometry(MultiPolygon, 4326) not null,
+    starts_at   timestamptz                  not null,
+    ends_at     timestamptz                  not null,
+    created_at  timestamptz                  not null default now(),
+    updated_at  timestamptz                  not null default now(),
+    check (starts_at < ends_at)
+);
+
+create index if not exists "Campaigns_area_idx" on "Campaigns" using gist (area);
+
+-- Posts taking part in a campaign, a null bound takes the one of the campaign.
+create table if not exists "CampaignPosts"
+(
+    campaign_id uuid not null references "Campaigns" (id) on delete cascade,
+    post_id     uuid not null references "Post" (id) on delete cascade,
+    starts_at   timestamptz,
+    ends_at     timestamptz,
+    primary key (campaign_id, post_id)
+);
+
+create index if not exists "CampaignPosts_post_idx" on "CampaignPosts" (post_id);
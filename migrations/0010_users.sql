@@ -0,0 +1,25 @@
+-- Users signing in to the API, field-post users are bound to the post they upload for.
+create table if not exists "Users"
+(
+    id            uuid primary key,
+    username      text        not null unique,
+    password_hash text        not null,
+    role          text        not null,
+    post_id       uuid references "Post" (id) on delete set null,
+    active        boolean     not null default true,
+    created_at    timestamptz not null default now(),
+    updated_at    timestamptz not null default now()
+);
+
+-- Refresh tokens are stored as sha256 hashes and replaced on every refresh.
+create table if not exists "RefreshTokens"
+(
+    id          uuid primary key,
+    user_id     uuid        not null references "Users" (id) on delete cascade,
+    token_hash  bytea       not null unique,
+    expires_at  timestamptz not null,
+    revoked_at  timestamptz,
+    created_at  timestamptz not null default now()
+);
+
+create index if not exists "RefreshTokens_user_idx" on "RefreshTokens" (user_id);
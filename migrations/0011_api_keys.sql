@@ -0,0 +1,19 @@
+-- Keys of posts and machine clients calling the API without a user, stored as sha256 hashes.
+create table if not exists "ApiKeys"
+(
+    id              uuid primary key,
+    name            text        not null,
+    prefix          text        not null,
+    key_hash        bytea       not null unique,
+    post_id         uuid references "Post" (id) on delete cascade,
+    permissions     text[]      not null,
+    created_by      uuid references "Users" (id) on delete set null,
+    created_at      timestamptz not null default now(),
+    expires_at      timestamptz,
+    revoked_at      timestamptz,
+    last_used_at    timestamptz,
+    last_request_id text,
+    replaced_by     uuid references "ApiKeys" (id) on delete set null
+);
+
+create index if not exists "ApiKeys_post_idx" on "ApiKeys" (post_id);
@@ -0,0 +1,7 @@
+-- Samples ingested for days already rolled up. The next retention run merges them into "SignalRollups"
+-- and only purges them once merged.
+create table if not exists "RollupPending"
+(
+    sample uuid primary key,
+    day    date not null
+);
@@ -0,0 +1,88 @@
+-- Concurrent ingests could each create a "GsmData" row for the same cell. The duplicates are folded into one
+-- row per cell, preferring a row that knows its operator, before the cell is made unique.
+create temp table gsm_duplicates on commit drop as
+select D.id, K.id as keeper
+from "GsmData" D
+         inner join (select distinct on (arfcn, cid, lac_tac) id, arfcn, cid, lac_tac
+                     from "GsmData"
+                     order by arfcn, cid, lac_tac, operator_id is null, id) K
+                    on K.arfcn = D.arfcn and K.cid = D.cid and K.lac_tac = D.lac_tac
+where D.id <> K.id;
+
+update "GsmHistory" GH
+set gsm = D.keeper
+from gsm_duplicates D
+where GH.gsm = D.id;
+
+-- pending candidates are estimated again from the merged samples.
+delete
+from "CellCandidates" C using gsm_duplicates D
+where C.gsm = D.id
+  and C.status = 'pending';
+update "CellCandidates" C
+set gsm = D.keeper
+from gsm_duplicates D
+where C.gsm = D.id;
+
+delete
+from "Alerts" A using gsm_duplicates D
+where A.gsm = D.id
+  and exists(select 1 from "Alerts" K where K.rule = A.rule and K.gsm = D.keeper);
+update "Alerts" A
+set gsm = D.keeper
+from gsm_duplicates D
+where A.gsm = D.id;
+
+-- the raw samples of rolled up days may be purged already, so rollups are combined rather than rebuilt.
+insert into "SignalRollups" as K (day, gsm, cell, samples, dbm_sum, dbm_count, dbm_min, dbm_max, rsrp_sum, rsrp_count, rsrp_min,
+                             rsrp_max, rsrq_sum, rsrq_count, rsrq_min, rsrq_max, sinr_sum, sinr_count, sinr_min, sinr_max,
+                             rscp_sum, rscp_count, rscp_min, rscp_max, ecio_sum, ecio_count, ecio_min, ecio_max,
+                             timing_advance_sum, timing_advance_count, timing_advance_min, timing_advance_max)
+select R.day, D.keeper, R.cell, sum(R.samples), sum(R.dbm_sum), sum(R.dbm_count), min(R.dbm_min),
+       max(R.dbm_max), sum(R.rsrp_sum), sum(R.rsrp_count), min(R.rsrp_min), max(R.rsrp_max),
+       sum(R.rsrq_sum), sum(R.rsrq_count), min(R.rsrq_min), max(R.rsrq_max), sum(R.sinr_sum),
+       sum(R.sinr_count), min(R.sinr_min), max(R.sinr_max), sum(R.rscp_sum), sum(R.rscp_count),
+       min(R.rscp_min), max(R.rscp_max), sum(R.ecio_sum), sum(R.ecio_count), min(R.ecio_min),
+       max(R.ecio_max), sum(R.timing_advance_sum), sum(R.timing_advance_count), min(R.timing_advance_min),
+       max(R.timing_advance_max)
+from "SignalRollups" R
+         inner join gsm_duplicates D on D.id = R.gsm
+group by R.day, D.keeper, R.cell
+on conflict (day, gsm, cell) do update set samples = K.samples + excluded.samples,
+    dbm_sum = coalesce(K.dbm_sum + excluded.dbm_sum, K.dbm_sum, excluded.dbm_sum),
+    dbm_count = K.dbm_count + excluded.dbm_count,
+    dbm_min = least(K.dbm_min, excluded.dbm_min),
+    dbm_max = greatest(K.dbm_max, excluded.dbm_max),
+    rsrp_sum = coalesce(K.rsrp_sum + excluded.rsrp_sum, K.rsrp_sum, excluded.rsrp_sum),
+    rsrp_count = K.rsrp_count + excluded.rsrp_count,
+    rsrp_min = least(K.rsrp_min, excluded.rsrp_min),
+    rsrp_max = greatest(K.rsrp_max, excluded.rsrp_max),
+    rsrq_sum = coalesce(K.rsrq_sum + excluded.rsrq_sum, K.rsrq_sum, excluded.rsrq_sum),
+    rsrq_count = K.rsrq_count + excluded.rsrq_count,
+    rsrq_min = least(K.rsrq_min, excluded.rsrq_min),
+    rsrq_max = greatest(K.rsrq_max, excluded.rsrq_max),
+    sinr_sum = coalesce(K.sinr_sum + excluded.sinr_sum, K.sinr_sum, excluded.sinr_sum),
+    sinr_count = K.sinr_count + excluded.sinr_count,
+    sinr_min = least(K.sinr_min, excluded.sinr_min),
+    sinr_max = greatest(K.sinr_max, excluded.sinr_max),
+    rscp_sum = coalesce(K.rscp_sum + excluded.rscp_sum, K.rscp_sum, excluded.rscp_sum),
+    rscp_count = K.rscp_count + excluded.rscp_count,
+    rscp_min = least(K.rscp_min, excluded.rscp_min),
+    rscp_max = greatest(K.rscp_max, excluded.rscp_max),
+    ecio_sum = coalesce(K.ecio_sum + excluded.ecio_sum, K.ecio_sum, excluded.ecio_sum),
+    ecio_count = K.ecio_count + excluded.ecio_count,
+    ecio_min = least(K.ecio_min, excluded.ecio_min),
+    ecio_max = greatest(K.ecio_max, excluded.ecio_max),
+    timing_advance_sum = coalesce(K.timing_advance_sum + excluded.timing_advance_sum, K.timing_advance_sum, excluded.timing_advance_sum),
+    timing_advance_count = K.timing_advance_count + excluded.timing_advance_count,
+    timing_advance_min = least(K.timing_advance_min, excluded.timing_advance_min),
+    timing_advance_max = greatest(K.timing_advance_max, excluded.timing_advance_max);
+delete
+from "SignalRollups" R using gsm_duplicates D
+where R.gsm = D.id;
+
+delete
+from "GsmData" G using gsm_duplicates D
+where G.id = D.id;
+
+create unique index if not exists "GsmData_cell_key_idx" on "GsmData" (arfcn, cid, lac_tac);
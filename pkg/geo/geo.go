@@ -0,0 +1,51 @@
+package geo
+
+import "math"
+
+const earthRadius = 6371008.8
+
+func toRadians(deg float64) float64 { return deg * math.Pi / 180 }
+
+func toDegrees(rad float64) float64 { return rad * 180 / math.Pi }
+
+// Distance returns the great circle distance in meters between two lng/lat points.
+func Distance(lng1, lat1, lng2, lat2 float64) float64 {
+	phi1, phi2 := toRadians(lat1), toRadians(lat2)
+	dPhi := phi2 - phi1
+	dLambda := toRadians(lng2 - lng1)
+	a := math.Sin(dPhi/2)*math.Sin(dPhi/2) + math.Cos(phi1)*math.Cos(phi2)*math.Sin(dLambda/2)*math.Sin(dLambda/2)
+	return 2 * earthRadius * math.Asin(math.Min(1, math.Sqrt(a)))
+}
+
+// Bearing returns the initial bearing in degrees clockwise from north, in [0, 360).
+func Bearing(lng1, lat1, lng2, lat2 float64) float64 {
+	phi1, phi2 := toRadians(lat1), toRadians(lat2)
+	dLambda := toRadians(lng2 - lng1)
+	y := math.Sin(dLambda) * math.Cos(phi2)
+	x := math.Cos(phi1)*math.Sin(phi2) - math.Sin(phi1)*math.Cos(phi2)*math.Cos(dLambda)
+	return math.Mod(toDegrees(math.Atan2(y, x))+360, 360)
+}
+
+// Projection maps lng/lat to meters east/north of an origin. It is accurate for the few
+// kilometers a cell or a track segment spans.
+type Projection struct {
+	lng0, lat0 float64
+	kx, ky     float64
+}
+
+func NewProjection(lng0, lat0 float64) *Projection {
+	return &Projection{
+		lng0: lng0,
+		lat0: lat0,
+		kx:   toRadians(1) * earthRadius * math.Cos(toRadians(lat0)),
+		ky:   toRadians(1) * earthRadius,
+	}
+}
+
+func (p *Projection) Forward(lng, lat float64) (x, y float64) {
+	return (lng - p.lng0) * p.kx, (lat - p.lat0) * p.ky
+}
+
+func (p *Projection) Inverse(x, y float64) (lng, lat float64) {
+	return p.lng0 + x/p.kx, p.lat0 + y/p.ky
+}
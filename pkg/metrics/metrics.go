@@ -0,0 +1,197 @@
+package metrics
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	// defaultMetrics is the default set of collectors. It is initialized once per package
+	// include upon calling Default.
+	defaultMetrics     *Metrics
+	defaultMetricsOnce sync.Once
+)
+
+var conf = &Config{}
+
+type Config struct {
+	// Namespace prefixes the names of all metrics.
+	Namespace string
+}
+
+// SetConfig sets given metrics configs for the Default metrics.
+// Must set configs before calling Default()
+func SetConfig(c *Config) {
+	conf = &Config{Namespace: c.Namespace}
+}
+
+// Metrics are the collectors of the server, all registered on Registry.
+type Metrics struct {
+	Registry *prometheus.Registry
+
+	HTTPRequests *prometheus.CounterVec
+	HTTPDuration *prometheus.HistogramVec
+	DBDuration   *prometheus.HistogramVec
+	CacheLookups *prometheus.CounterVec
+	// ClusterBuild times building the base station clusters.
+	ClusterBuild  prometheus.Histogram
+	IngestRecords *prometheus.CounterVec
+	RateLimited   *prometheus.CounterVec
+
+	namespace string
+}
+
+// New creates the collectors under namespace on a registry of their own, which also collects go runtime
+// and process metrics.
+func New(namespace string) *Metrics {
+	m := &Metrics{
+		Registry: prometheus.NewRegistry(),
+		HTTPRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace, Subsystem: "http", Name: "requests_total",
+			Help: "HTTP requests by method, route and status.",
+		}, []string{"method", "route", "status"}),
+		HTTPDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace, Subsystem: "http", Name: "request_duration_seconds",
+			Help:    "HTTP request latency by method, route and status.",
+			Buckets: []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30},
+		}, []string{"method", "route", "status"}),
+		DBDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace, Subsystem: "db", Name: "query_duration_seconds",
+			Help:    "Database query latency by operation and result.",
+			Buckets: []float64{0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10},
+		}, []string{"operation", "result"}),
+		CacheLookups: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace, Subsystem: "cache", Name: "lookups_total",
+			Help: "Cache lookups by operation and result, a hit, a miss or an error.",
+		}, []string{"operation", "result"}),
+		ClusterBuild: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: namespace, Subsystem: "cluster", Name: "rebuild_duration_seconds",
+			Help:    "Time taken to build the base station clusters.",
+			Buckets: prometheus.ExponentialBuckets(0.1, 2, 10),
+		}),
+		IngestRecords: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace, Subsystem: "ingest", Name: "records_total",
+			Help: "Uploaded measurement records by kind and status.",
+		}, []string{"kind", "status"}),
+		RateLimited: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace, Subsystem: "http", Name: "rate_limited_total",
+			Help: "Requests refused by the rate limiter by route group and reason.",
+		}, []string{"group", "reason"}),
+		namespace: namespace,
+	}
+	m.Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{Namespace: namespace}),
+		m.HTTPRequests, m.HTTPDuration, m.DBDuration, m.CacheLookups, m.ClusterBuild, m.IngestRecords, m.RateLimited,
+	)
+	return m
+}
+
+// Default returns the default metrics for the package.
+func Default() *Metrics {
+	defaultMetricsOnce.Do(func() {
+		defaultMetrics = New(conf.Namespace)
+	})
+	return defaultMetrics
+}
+
+// Handler serves the metrics in the prometheus exposition format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.Registry, promhttp.HandlerOpts{})
+}
+
+// RegisterDB collects the connection pool stats of db, name tells databases apart.
+func (m *Metrics) RegisterDB(name string, db *sql.DB) error {
+	return m.Registry.Register(newDBStatsCollector(m.namespace, name, db))
+}
+
+// Result labels the outcome of an operation by its error.
+func Result(err error) string {
+	if err != nil {
+		return "error"
+	}
+	return "ok"
+}
+
+// ObserveQuery records the duration of a database operation started at start.
+func ObserveQuery(operation string, start time.Time, err error) {
+	Default().DBDuration.WithLabelValues(operation, Result(err)).Observe(time.Since(start).Seconds())
+}
+
+// Middleware counts and times the requests by route, requests matching no route share one label.
+func Middleware() gin.HandlerFunc {
+	m := Default()
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		status := strconv.Itoa(c.Writer.Status())
+		m.HTTPRequests.WithLabelValues(c.Request.Method, route, status).Inc()
+		m.HTTPDuration.WithLabelValues(c.Request.Method, route, status).Observe(time.Since(start).Seconds())
+	}
+}
+
+// dbStatsCollector reads the pool stats of a database on every scrape.
+type dbStatsCollector struct {
+	db                *sql.DB
+	maxOpen           *prometheus.Desc
+	open              *prometheus.Desc
+	inUse             *prometheus.Desc
+	idle              *prometheus.Desc
+	waitCount         *prometheus.Desc
+	waitDuration      *prometheus.Desc
+	maxIdleClosed     *prometheus.Desc
+	maxLifeClosed     *prometheus.Desc
+	maxIdleTimeClosed *prometheus.Desc
+}
+
+func newDBStatsCollector(namespace, name string, db *sql.DB) *dbStatsCollector {
+	labels := prometheus.Labels{"db": name}
+	desc := func(metric, help string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName(namespace, "db_pool", metric), help, nil, labels)
+	}
+	return &dbStatsCollector{
+		db:                db,
+		maxOpen:           desc("max_open_connections", "Maximum number of open connections."),
+		open:              desc("open_connections", "Open connections, in use and idle."),
+		inUse:             desc("in_use_connections", "Connections in use."),
+		idle:              desc("idle_connections", "Idle connections."),
+		waitCount:         desc("wait_count_total", "Connections waited for."),
+		waitDuration:      desc("wait_duration_seconds_total", "Time spent waiting for a connection."),
+		maxIdleClosed:     desc("max_idle_closed_total", "Connections closed as the idle pool was full."),
+		maxLifeClosed:     desc("max_lifetime_closed_total", "Connections closed for reaching their maximum lifetime."),
+		maxIdleTimeClosed: desc("max_idle_time_closed_total", "Connections closed for idling too long."),
+	}
+}
+
+func (c *dbStatsCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, d := range []*prometheus.Desc{c.maxOpen, c.open, c.inUse, c.idle, c.waitCount, c.waitDuration,
+		c.maxIdleClosed, c.maxLifeClosed, c.maxIdleTimeClosed} {
+		ch <- d
+	}
+}
+
+func (c *dbStatsCollector) Collect(ch chan<- prometheus.Metric) {
+	stats := c.db.Stats()
+	ch <- prometheus.MustNewConstMetric(c.maxOpen, prometheus.GaugeValue, float64(stats.MaxOpenConnections))
+	ch <- prometheus.MustNewConstMetric(c.open, prometheus.GaugeValue, float64(stats.OpenConnections))
+	ch <- prometheus.MustNewConstMetric(c.inUse, prometheus.GaugeValue, float64(stats.InUse))
+	ch <- prometheus.MustNewConstMetric(c.idle, prometheus.GaugeValue, float64(stats.Idle))
+	ch <- prometheus.MustNewConstMetric(c.waitCount, prometheus.CounterValue, float64(stats.WaitCount))
+	ch <- prometheus.MustNewConstMetric(c.waitDuration, prometheus.CounterValue, stats.WaitDuration.Seconds())
+	ch <- prometheus.MustNewConstMetric(c.maxIdleClosed, prometheus.CounterValue, float64(stats.MaxIdleClosed))
+	ch <- prometheus.MustNewConstMetric(c.maxLifeClosed, prometheus.CounterValue, float64(stats.MaxLifetimeClosed))
+	ch <- prometheus.MustNewConstMetric(c.maxIdleTimeClosed, prometheus.CounterValue, float64(stats.MaxIdleTimeClosed))
+}
@@ -0,0 +1,61 @@
+package metrics
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stubDriver never connects, sql.Open only needs it registered.
+type stubDriver struct{}
+
+func (stubDriver) Open(string) (driver.Conn, error) {
+	return nil, errors.New("stub driver does not connect")
+}
+
+func init() {
+	sql.Register("stub", stubDriver{})
+}
+
+func TestMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(Middleware())
+	r.GET("/posts/:id", func(c *gin.Context) { c.Status(http.StatusNoContent) })
+
+	for _, path := range []string{"/posts/1", "/posts/2", "/nowhere"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+	requests := Default().HTTPRequests
+	assert.Equal(t, 2.0, testutil.ToFloat64(requests.WithLabelValues("GET", "/posts/:id", "204")), "counted by route")
+	assert.Equal(t, 1.0, testutil.ToFloat64(requests.WithLabelValues("GET", "unmatched", "404")))
+}
+
+func TestNamespaceAndDBStats(t *testing.T) {
+	m := New("test_server")
+	// the pool of a database opened but never used, its stats are all zero.
+	db, err := sql.Open("stub", "")
+	require.NoError(t, err)
+	require.NoError(t, m.RegisterDB("observer", db))
+	m.ClusterBuild.Observe(1.5)
+
+	w := httptest.NewRecorder()
+	m.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := w.Body.String()
+	assert.Contains(t, body, `test_server_db_pool_open_connections{db="observer"} 0`)
+	assert.Contains(t, body, "test_server_cluster_rebuild_duration_seconds_count 1")
+	for _, line := range strings.Split(body, "\n") {
+		if strings.HasPrefix(line, "# HELP ") && !strings.HasPrefix(line, "# HELP go_") {
+			assert.True(t, strings.HasPrefix(line, "# HELP test_server_"), line)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package periodic
+
+import (
+	"context"
+	"errors"
+	"go.uber.org/fx"
+	"simpleServer/pkg/logging"
+	"time"
+)
+
+// ErrAlreadyRunning tells a run was skipped because the job runs elsewhere, jobs wrap it to name themselves.
+var ErrAlreadyRunning = errors.New("already running")
+
+// Start calls run right after lc starts and then every interval until lc stops, the context of run is
+// cancelled on stop. name names the job in logs; run logs its own results.
+func Start(lc fx.Lifecycle, name string, interval time.Duration, run func(ctx context.Context) error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	lc.Append(fx.Hook{
+		OnStart: func(context.Context) error {
+			go func() {
+				defer close(done)
+				loop(ctx, name, interval, run)
+			}()
+			return nil
+		},
+		OnStop: func(stopCtx context.Context) error {
+			cancel()
+			select {
+			case <-done:
+			case <-stopCtx.Done():
+			}
+			return nil
+		},
+	})
+}
+
+func loop(ctx context.Context, name string, interval time.Duration, run func(ctx context.Context) error) {
+	logger := logging.DefaultLogger()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		err := run(ctx)
+		switch {
+		case errors.Is(err, ErrAlreadyRunning):
+			logger.Debugw(name + " skipped, running elsewhere")
+		case err != nil:
+			logger.Errorw(name+" failed", "err", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
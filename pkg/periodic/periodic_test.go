@@ -0,0 +1,39 @@
+package periodic
+
+import (
+	"context"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/fx/fxtest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestStartRunsUntilStopped(t *testing.T) {
+	lc := fxtest.NewLifecycle(t)
+	var runs atomic.Int32
+	stopped := make(chan struct{})
+	Start(lc, "test job", time.Millisecond, func(ctx context.Context) error {
+		if runs.Add(1) == 3 {
+			go func() {
+				<-ctx.Done()
+				close(stopped)
+			}()
+		}
+		// skipped and failed runs don't stop the job.
+		if runs.Load()%2 == 0 {
+			return fmt.Errorf("test job is %w", ErrAlreadyRunning)
+		}
+		return assert.AnError
+	})
+	assert.Zero(t, runs.Load(), "nothing runs before the start")
+
+	lc.RequireStart()
+	assert.Eventually(t, func() bool { return runs.Load() >= 3 }, time.Second, time.Millisecond)
+	lc.RequireStop()
+	<-stopped
+	after := runs.Load()
+	time.Sleep(5 * time.Millisecond)
+	assert.Equal(t, after, runs.Load(), "no run after the stop")
+}
@@ -0,0 +1,64 @@
+package trace
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() { otel.SetTracerProvider(sdktrace.NewTracerProvider()) })
+	return recorder
+}
+
+func TestMiddlewareContinuesTrace(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	recorder := recordSpans(t)
+
+	var fields []interface{}
+	r := gin.New()
+	r.Use(Middleware())
+	r.GET("/heatmap/:id", func(c *gin.Context) {
+		fields = LogFields(c)
+		_, span := Start(c, "db.select")
+		End(span, errors.New("boom"))
+		c.Status(http.StatusInternalServerError)
+	})
+	req := httptest.NewRequest(http.MethodGet, "/heatmap/7", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 2)
+	query, server := spans[0], spans[1]
+	assert.Equal(t, "GET /heatmap/:id", server.Name())
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", server.SpanContext().TraceID().String())
+	assert.Equal(t, "00f067aa0ba902b7", server.Parent().SpanID().String(), "child of the caller's span")
+	assert.Equal(t, codes.Error, server.Status().Code)
+	assert.Equal(t, server.SpanContext().SpanID(), query.Parent().SpanID())
+	assert.Equal(t, codes.Error, query.Status().Code)
+	assert.Equal(t, []interface{}{"traceId", "4bf92f3577b34da6a3ce929d0e0e4736", "spanId", server.SpanContext().SpanID().String()}, fields)
+}
+
+func TestLogFieldsWithoutSpan(t *testing.T) {
+	assert.Nil(t, LogFields(context.Background()))
+}
+
+func TestSetupRejectsUnknownExporter(t *testing.T) {
+	_, err := Setup(context.Background(), &Config{Exporter: "zipkin", SampleRatio: 1})
+	assert.Error(t, err)
+}